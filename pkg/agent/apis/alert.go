@@ -19,6 +19,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"kubegems.io/kubegems/pkg/utils/msgbus"
+	"kubegems.io/kubegems/pkg/utils/prometheus"
+	"kubegems.io/kubegems/pkg/utils/prometheus/channels"
 )
 
 // 获取各个集群的告警信息
@@ -43,3 +45,25 @@ func (h *AlertHandler) Webhook(c *gin.Context) {
 	h.Watcher.DispatchMessage(msg)
 	OK(c, nil)
 }
+
+//	@Tags			Agent.V1
+//	@Summary		render alert channel template and send notification
+//	@Description	alertmanager sends alerts of channels with a template here, the template is rendered and sent to the channel
+//	@Accept			json
+//	@Produce		json
+//	@Param			channel	query		string									true	"channel config"
+//	@Success		200		{object}	handlers.ResponseStruct{Data=string}	""
+//	@Router			/alert/render [post]
+//	@Security		JWT
+func (h *AlertHandler) Render(c *gin.Context) {
+	alert := prometheus.WebhookAlert{}
+	if err := c.BindJSON(&alert); err != nil {
+		NotOK(c, err)
+		return
+	}
+	if err := channels.SendRendered(c.Request.Context(), c.Request.URL.Query(), alert); err != nil {
+		NotOK(c, err)
+		return
+	}
+	OK(c, nil)
+}
@@ -52,8 +52,6 @@ func NewDefaultOptions() *Options {
 	}
 }
 
-type handlerMux struct{ r *route.Router }
-
 const (
 	ActionCreate  = "create"
 	ActionDelete  = "delete"
@@ -66,18 +64,18 @@ const (
 	ActionDisable = "disable"
 )
 
-// register
-func (mu handlerMux) register(group, version, resource, action string, handler gin.HandlerFunc, method ...string) {
+// registerCustom 注册自定义 api，同时注册集群级别以及命名空间级别的路径
+func registerCustom(custom *route.RouterGroup, group, version, resource, action string, handler gin.HandlerFunc) {
 	switch action {
 	case ActionGet:
-		mu.r.MustRegister(http.MethodGet, fmt.Sprintf("/custom/%s/%s/%s/{name}", group, version, resource), handler)
-		mu.r.MustRegister(http.MethodGet, fmt.Sprintf("/custom/%s/%s/namespaces/{namespace}/%s/{name}", group, version, resource), handler)
+		custom.GET(fmt.Sprintf("/%s/%s/%s/{name}", group, version, resource), handler)
+		custom.GET(fmt.Sprintf("/%s/%s/namespaces/{namespace}/%s/{name}", group, version, resource), handler)
 	case ActionList:
-		mu.r.MustRegister(http.MethodGet, fmt.Sprintf("/custom/%s/%s/%s", group, version, resource), handler)
-		mu.r.MustRegister(http.MethodGet, fmt.Sprintf("/custom/%s/%s/namespaces/{namespace}/%s", group, version, resource), handler)
+		custom.GET(fmt.Sprintf("/%s/%s/%s", group, version, resource), handler)
+		custom.GET(fmt.Sprintf("/%s/%s/namespaces/{namespace}/%s", group, version, resource), handler)
 	default:
-		mu.r.MustRegister("*", fmt.Sprintf("/custom/%s/%s/%s/{name}/actions/%s", group, version, resource, action), handler)
-		mu.r.MustRegister("*", fmt.Sprintf("/custom/%s/%s/namespaces/{namespace}/%s/{name}/actions/%s", group, version, resource, action), handler)
+		custom.MustRegister("*", fmt.Sprintf("/%s/%s/%s/{name}/actions/%s", group, version, resource, action), handler)
+		custom.MustRegister("*", fmt.Sprintf("/%s/%s/namespaces/{namespace}/%s/{name}/actions/%s", group, version, resource, action), handler)
 	}
 }
 
@@ -122,9 +120,8 @@ func Routes(ctx context.Context, cluster cluster.Interface,
 	installerOptions *installerapi.ClientOptions,
 ) (func(c *gin.Context), error) {
 	rr := route.NewRouter()
-
-	routes := handlerMux{r: rr}
-	routes.r.GET("/healthz", func(c *gin.Context) {
+	custom := rr.Group("/custom")
+	rr.GET("/healthz", func(c *gin.Context) {
 		content, err := cluster.Kubernetes().Discovery().RESTClient().Get().AbsPath("/healthz").DoRaw(ctx)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -143,8 +140,8 @@ func Routes(ctx context.Context, cluster cluster.Interface,
 		}
 		c.JSON(http.StatusOK, gin.H{"healthy": "ok"})
 	})
-	routes.r.GET("/version", func(c *gin.Context) { c.JSON(http.StatusOK, version.Get()) })
-	routes.r.GET("/kubernetes-version", func(c *gin.Context) {
+	rr.GET("/version", func(c *gin.Context) { c.JSON(http.StatusOK, version.Get()) })
+	rr.GET("/kubernetes-version", func(c *gin.Context) {
 		version, err := cluster.Discovery().ServerVersion()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -154,155 +151,156 @@ func Routes(ctx context.Context, cluster cluster.Interface,
 	})
 
 	serviceProxyHandler := ServiceProxyHandler{}
-	routes.r.ANY("/v1/service-proxy/{realpath}*", serviceProxyHandler.ServiceProxy)
+	rr.ANY("/v1/service-proxy/{realpath}*", serviceProxyHandler.ServiceProxy)
 
 	// restful api for all k8s resources
-	routes.registerREST(cluster)
+	registerREST(rr.Group("/v1"), cluster)
 
 	// custom api
 	staticsHandler := &StatisticsHandler{C: cluster}
-	routes.register("statistics.system", "v1", "workloads", ActionList, staticsHandler.ClusterWorkloadStatistics)
-	routes.register("statistics.system", "v1", "resources", ActionList, staticsHandler.ClusterResourceStatistics)
-	routes.register("statistics.system", "v1", "all", ActionList, staticsHandler.ClusterStatistics)
+	registerCustom(custom, "statistics.system", "v1", "workloads", ActionList, staticsHandler.ClusterWorkloadStatistics)
+	registerCustom(custom, "statistics.system", "v1", "resources", ActionList, staticsHandler.ClusterResourceStatistics)
+	registerCustom(custom, "statistics.system", "v1", "all", ActionList, staticsHandler.ClusterStatistics)
 
 	nodeHandler := &NodeHandler{C: cluster.GetClient()}
-	routes.register("core", "v1", "nodes", ActionGet, nodeHandler.Get)
-	routes.register("core", "v1", "nodes", "metadata", nodeHandler.PatchNodeLabelOrAnnotations)
-	routes.register("core", "v1", "nodes", "taint", nodeHandler.PatchNodeTaint)
-	routes.register("core", "v1", "nodes", "cordon", nodeHandler.PatchNodeCordon)
+	registerCustom(custom, "core", "v1", "nodes", ActionGet, nodeHandler.Get)
+	registerCustom(custom, "core", "v1", "nodes", "metadata", nodeHandler.PatchNodeLabelOrAnnotations)
+	registerCustom(custom, "core", "v1", "nodes", "taint", nodeHandler.PatchNodeTaint)
+	registerCustom(custom, "core", "v1", "nodes", "cordon", nodeHandler.PatchNodeCordon)
 
 	nsHandler := &NamespaceHandler{C: cluster.GetClient()}
-	routes.register("core", "v1", "namespaces", ActionList, nsHandler.List)
+	registerCustom(custom, "core", "v1", "namespaces", ActionList, nsHandler.List)
 
 	kubectlHandler := KubectlHandler{cluster: cluster, options: kubectlOptions}
-	routes.register("system", "v1", "kubectl", ActionList, kubectlHandler.ExecKubectl)
+	registerCustom(custom, "system", "v1", "kubectl", ActionList, kubectlHandler.ExecKubectl)
 
 	podHandler := PodHandler{cluster: cluster}
-	routes.register("core", "v1", "pods", ActionList, podHandler.List)
-	routes.register("core", "v1", "pods", "shell", podHandler.ExecPods)
-	routes.register("core", "v1", "pods", "debug", kubectlHandler.DebugPod)
-	routes.register("core", "v1", "pods", "logs", podHandler.GetContainerLogs)
-	routes.register("core", "v1", "pods", "file", podHandler.DownloadFileFromPod)
-	routes.register("core", "v1", "pods", "upfile", podHandler.UploadFileToContainer)
-	routes.register("core", "v1", "pods", "ls", podHandler.ListDir)
+	registerCustom(custom, "core", "v1", "pods", ActionList, podHandler.List)
+	registerCustom(custom, "core", "v1", "pods", "shell", podHandler.ExecPods)
+	registerCustom(custom, "core", "v1", "pods", "debug", kubectlHandler.DebugPod)
+	registerCustom(custom, "core", "v1", "pods", "logs", podHandler.GetContainerLogs)
+	registerCustom(custom, "core", "v1", "pods", "file", podHandler.DownloadFileFromPod)
+	registerCustom(custom, "core", "v1", "pods", "upfile", podHandler.UploadFileToContainer)
+	registerCustom(custom, "core", "v1", "pods", "ls", podHandler.ListDir)
 
 	rolloutHandler := &RolloutHandler{cluster: cluster}
-	routes.register("apps", "v1", "daemonsets", "rollouthistory", rolloutHandler.DaemonSetHistory)
-	routes.register("apps", "v1", "statefulsets", "rollouthistory", rolloutHandler.StatefulSetHistory)
-	routes.register("apps", "v1", "deployments", "rollouthistory", rolloutHandler.DeploymentHistory)
-	routes.register("apps", "v1", "daemonsets", "rollback", rolloutHandler.DaemonsetRollback)
-	routes.register("apps", "v1", "statefulsets", "rollback", rolloutHandler.StatefulSetRollback)
-	routes.register("apps", "v1", "deployments", "rollback", rolloutHandler.DeploymentRollback)
+	registerCustom(custom, "apps", "v1", "daemonsets", "rollouthistory", rolloutHandler.DaemonSetHistory)
+	registerCustom(custom, "apps", "v1", "statefulsets", "rollouthistory", rolloutHandler.StatefulSetHistory)
+	registerCustom(custom, "apps", "v1", "deployments", "rollouthistory", rolloutHandler.DeploymentHistory)
+	registerCustom(custom, "apps", "v1", "daemonsets", "rollback", rolloutHandler.DaemonsetRollback)
+	registerCustom(custom, "apps", "v1", "statefulsets", "rollback", rolloutHandler.StatefulSetRollback)
+	registerCustom(custom, "apps", "v1", "deployments", "rollback", rolloutHandler.DeploymentRollback)
 
 	prometheusHandler, err := NewPrometheusHandler(options.PrometheusServer)
 	if err != nil {
 		return nil, err
 	}
-	routes.register("prometheus", "v1", "vector", ActionList, prometheusHandler.Vector)
-	routes.register("prometheus", "v1", "matrix", ActionList, prometheusHandler.Matrix)
-	routes.register("prometheus", "v1", "labelvalues", ActionList, prometheusHandler.LabelValues)
-	routes.register("prometheus", "v1", "labelnames", ActionList, prometheusHandler.LabelNames)
-	routes.register("prometheus", "v1", "targets", ActionList, prometheusHandler.Targets)
-	routes.register("prometheus", "v1", "alertrule", ActionList, prometheusHandler.AlertRule)
-	routes.register("prometheus", "v1", "certinfos", ActionGet, prometheusHandler.CertInfo)
+	registerCustom(custom, "prometheus", "v1", "vector", ActionList, prometheusHandler.Vector)
+	registerCustom(custom, "prometheus", "v1", "matrix", ActionList, prometheusHandler.Matrix)
+	registerCustom(custom, "prometheus", "v1", "labelvalues", ActionList, prometheusHandler.LabelValues)
+	registerCustom(custom, "prometheus", "v1", "labelnames", ActionList, prometheusHandler.LabelNames)
+	registerCustom(custom, "prometheus", "v1", "targets", ActionList, prometheusHandler.Targets)
+	registerCustom(custom, "prometheus", "v1", "alertrule", ActionList, prometheusHandler.AlertRule)
+	registerCustom(custom, "prometheus", "v1", "certinfos", ActionGet, prometheusHandler.CertInfo)
 
 	alertmanagerHandler, err := NewAlertmanagerClient(options.AlertmanagerServer, cluster.Kubernetes())
 	if err != nil {
 		return nil, err
 	}
-	routes.register("alertmanager", "v1", "alerts", ActionList, alertmanagerHandler.ListAlerts)
-	routes.register("alertmanager", "v1", "alerts", ActionCheck, alertmanagerHandler.CheckConfig)
-	routes.register("alertmanager", "v1", "silence", ActionList, alertmanagerHandler.ListSilence)
-	routes.register("alertmanager", "v1", "silence", ActionCreate, alertmanagerHandler.CreateSilence)
-	routes.register("alertmanager", "v1", "silence", ActionDelete, alertmanagerHandler.DeleteSilence)
+	registerCustom(custom, "alertmanager", "v1", "alerts", ActionList, alertmanagerHandler.ListAlerts)
+	registerCustom(custom, "alertmanager", "v1", "alerts", ActionCheck, alertmanagerHandler.CheckConfig)
+	registerCustom(custom, "alertmanager", "v1", "silence", ActionList, alertmanagerHandler.ListSilence)
+	registerCustom(custom, "alertmanager", "v1", "silence", ActionCreate, alertmanagerHandler.CreateSilence)
+	registerCustom(custom, "alertmanager", "v1", "silence", ActionDelete, alertmanagerHandler.DeleteSilence)
 
 	lokiHandler, err := NewLokiHandler(options.LokiServer)
 	if err != nil {
 		return nil, err
 	}
-	routes.register("loki", "v1", "query", ActionList, lokiHandler.Query)
-	routes.register("loki", "v1", "queryrange", ActionList, lokiHandler.QueryRange)
-	routes.register("loki", "v1", "labels", ActionList, lokiHandler.Labels)
-	routes.register("loki", "v1", "labelvalues", ActionList, lokiHandler.LabelValues)
-	routes.register("loki", "v1", "tail", ActionList, lokiHandler.Tail)
-	routes.register("loki", "v1", "series", ActionList, lokiHandler.Series)
-	routes.register("loki", "v1", "alertrule", ActionList, lokiHandler.AlertRule)
+	registerCustom(custom, "loki", "v1", "query", ActionList, lokiHandler.Query)
+	registerCustom(custom, "loki", "v1", "queryrange", ActionList, lokiHandler.QueryRange)
+	registerCustom(custom, "loki", "v1", "labels", ActionList, lokiHandler.Labels)
+	registerCustom(custom, "loki", "v1", "labelvalues", ActionList, lokiHandler.LabelValues)
+	registerCustom(custom, "loki", "v1", "tail", ActionList, lokiHandler.Tail)
+	registerCustom(custom, "loki", "v1", "series", ActionList, lokiHandler.Series)
+	registerCustom(custom, "loki", "v1", "alertrule", ActionList, lokiHandler.AlertRule)
 
 	jobHandle := &JobHandler{C: cluster.GetClient(), cluster: cluster}
-	routes.register("batch", "v1", "jobs", ActionList, jobHandle.List)
+	registerCustom(custom, "batch", "v1", "jobs", ActionList, jobHandle.List)
 
 	eventHandler := EventHandler{C: cluster.GetClient()}
-	routes.register("core", "v1", "events", ActionList, eventHandler.List)
+	registerCustom(custom, "core", "v1", "events", ActionList, eventHandler.List)
 
 	pvcHandler := PvcHandler{C: cluster.GetClient()}
-	routes.register("core", "v1", "pvcs", ActionList, pvcHandler.List)
-	routes.register("core", "v1", "pvcs", ActionGet, pvcHandler.Get)
+	registerCustom(custom, "core", "v1", "pvcs", ActionList, pvcHandler.List)
+	registerCustom(custom, "core", "v1", "pvcs", ActionGet, pvcHandler.Get)
 
 	secretHandler := SecretHandler{C: cluster.GetClient(), cluster: cluster}
-	routes.register("core", "v1", "secrets", ActionList, secretHandler.List)
+	registerCustom(custom, "core", "v1", "secrets", ActionList, secretHandler.List)
 
 	pluginHandler, err := NewPluginHandler(installerOptions)
 	if err != nil {
 		return nil, err
 	}
-	routes.r.GET("/v1/plugins", pluginHandler.List)
-	routes.r.GET("/v1/plugins/{name}", pluginHandler.Get)
-	routes.r.POST("/v1/plugins/{name}", pluginHandler.Enable)
-	routes.r.DELETE("/v1/plugins/{name}", pluginHandler.Disable)
-	routes.r.POST("/v1/plugins:check-update", pluginHandler.CheckUpdate)
+	rr.GET("/v1/plugins", pluginHandler.List)
+	rr.GET("/v1/plugins/{name}", pluginHandler.Get)
+	rr.POST("/v1/plugins/{name}", pluginHandler.Enable)
+	rr.DELETE("/v1/plugins/{name}", pluginHandler.Disable)
+	rr.POST("/v1/plugins:check-update", pluginHandler.CheckUpdate)
 
 	argoRolloutHandler := &ArgoRolloutHandler{cluster: cluster}
-	routes.register("argoproj.io", "v1alpha1", "rollouts", "info", argoRolloutHandler.GetRolloutInfo)
-	routes.register("argoproj.io", "v1alpha1", "rollouts", "depinfo", argoRolloutHandler.GetRolloutDepInfo)
+	registerCustom(custom, "argoproj.io", "v1alpha1", "rollouts", "info", argoRolloutHandler.GetRolloutInfo)
+	registerCustom(custom, "argoproj.io", "v1alpha1", "rollouts", "depinfo", argoRolloutHandler.GetRolloutDepInfo)
 
 	jaegerHandler := &jaegerHandler{Server: options.JaegerServer}
-	routes.register("jaeger", "v1", "span", ActionList, jaegerHandler.GetSpanCount)
+	registerCustom(custom, "jaeger", "v1", "span", ActionList, jaegerHandler.GetSpanCount)
 
 	// watcher 给消息中心使用的，不暴露给前端用户
 	w := NewWatcher(cluster.GetCache())
 	w.Start()
-	routes.r.GET("/notify", w.StreamWatch)
+	rr.GET("/notify", w.StreamWatch)
 
 	alertHandler := &AlertHandler{Watcher: w}
-	routes.r.POST("/alert", alertHandler.Webhook)
+	rr.POST("/alert", alertHandler.Webhook)
+	rr.POST("/alert/render", alertHandler.Render)
 
 	clusterHandler := &ClusterHandler{cluster: cluster}
-	routes.r.GET("/v1/api-resources", clusterHandler.APIResources)
+	rr.GET("/v1/api-resources", clusterHandler.APIResources)
 
 	// service client 使用的内部 apis
 	clientrest := client.ClientRest{Cli: cluster.GetClient()}
-	clientrest.Register(routes.r)
+	clientrest.Register(rr)
 
 	clienttransport := client.NewClientTransport()
-	clienttransport.Register(routes.r)
+	clienttransport.Register(rr)
 
-	return func(c *gin.Context) { routes.r.Match(c)(c) }, err
+	return rr.Handle, err
 }
 
-func (mu handlerMux) registerREST(cluster cluster.Interface) {
+func registerREST(r *route.RouterGroup, cluster cluster.Interface) {
 	resthandler := REST{
 		client:  cluster.GetClient(),
 		cluster: cluster,
 	}
 
-	mu.r.GET("/v1/{group}/{version}/{resource}", resthandler.List)
-	mu.r.GET("/v1/{group}/{version}/namespaces/{namespace}/{resource}", resthandler.List)
+	r.GET("/{group}/{version}/{resource}", resthandler.List)
+	r.GET("/{group}/{version}/namespaces/{namespace}/{resource}", resthandler.List)
 
-	mu.r.GET("/v1/{group}/{version}/{resource}/{name}", resthandler.Get)
-	mu.r.GET("/v1/{group}/{version}/namespaces/{namespace}/{resource}/{name}", resthandler.Get)
+	r.GET("/{group}/{version}/{resource}/{name}", resthandler.Get)
+	r.GET("/{group}/{version}/namespaces/{namespace}/{resource}/{name}", resthandler.Get)
 
-	mu.r.POST("/v1/{group}/{version}/{resource}/{name}", resthandler.Create)
-	mu.r.POST("/v1/{group}/{version}/namespaces/{namespace}/{resource}/{name}", resthandler.Create)
+	r.POST("/{group}/{version}/{resource}/{name}", resthandler.Create)
+	r.POST("/{group}/{version}/namespaces/{namespace}/{resource}/{name}", resthandler.Create)
 
-	mu.r.PUT("/v1/{group}/{version}/{resource}/{name}", resthandler.Update)
-	mu.r.PUT("/v1/{group}/{version}/namespaces/{namespace}/{resource}/{name}", resthandler.Update)
+	r.PUT("/{group}/{version}/{resource}/{name}", resthandler.Update)
+	r.PUT("/{group}/{version}/namespaces/{namespace}/{resource}/{name}", resthandler.Update)
 
-	mu.r.PATCH("/v1/{group}/{version}/{resource}/{name}", resthandler.Patch)
-	mu.r.PATCH("/v1/{group}/{version}/namespaces/{namespace}/{resource}/{name}", resthandler.Patch)
+	r.PATCH("/{group}/{version}/{resource}/{name}", resthandler.Patch)
+	r.PATCH("/{group}/{version}/namespaces/{namespace}/{resource}/{name}", resthandler.Patch)
 
-	mu.r.DELETE("/v1/{group}/{version}/{resource}/{name}", resthandler.Delete)
-	mu.r.DELETE("/v1/{group}/{version}/namespaces/{namespace}/{resource}/{name}", resthandler.Delete)
+	r.DELETE("/{group}/{version}/{resource}/{name}", resthandler.Delete)
+	r.DELETE("/{group}/{version}/namespaces/{namespace}/{resource}/{name}", resthandler.Delete)
 
-	mu.r.PATCH("/v1/{group}/{version}/{resource}/{name}/actions/scale", resthandler.Scale)
-	mu.r.PATCH("/v1/{group}/{version}/namespaces/{namespace}/{resource}/{name}/actions/scale", resthandler.Scale)
+	r.PATCH("/{group}/{version}/{resource}/{name}/actions/scale", resthandler.Scale)
+	r.PATCH("/{group}/{version}/namespaces/{namespace}/{resource}/{name}/actions/scale", resthandler.Scale)
 }
@@ -24,6 +24,7 @@ import (
 func SignerMiddleware() func(c *gin.Context) {
 	signer := httpsigs.GetSigner()
 	signer.AddWhiteList("/alert")
+	signer.AddWhiteList("/alert/render")
 	signer.AddWhiteList("/healthz")
 
 	return func(c *gin.Context) {
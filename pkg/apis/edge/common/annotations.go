@@ -19,8 +19,11 @@ const (
 	AnnotationKeyEdgeHubCert    = "edge.kubegems.io/edge-hub-key"
 	AnnotationKeyEdgeHubCA      = "edge.kubegems.io/edge-hub-ca"
 	AnnotationKeyEdgeHubKey     = "edge.kubegems.io/edge-hub-cert"
+	AnnotationKeyEdgeHubAPI     = "edge.kubegems.io/edge-hub-api"
 	LabelKeIsyEdgeHub           = "edge.kubegems.io/is-edge-hub"
 
+	AnnotationKeyEdgeServerAPI = "edge.kubegems.io/edge-server-api"
+
 	AnnotationKeyEdgeAgentAddress           = "edge.kubegems.io/edge-agent-address"
 	AnnotationKeyEdgeAgentKeepaliveInterval = "edge.kubegems.io/edge-agent-keepalive-interval"
 	AnnotationKeyEdgeAgentRegisterAddress   = "edge.kubegems.io/edge-agent-register-address"
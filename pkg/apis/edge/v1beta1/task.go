@@ -39,12 +39,23 @@ type EdgeTaskSpec struct {
 	EdgeClusterName string `json:"edgeClusterName,omitempty"`
 	// +kubebuilder:pruning:PreserveUnknownFields
 	Resources []runtime.RawExtension `json:"resources,omitempty"`
+	// DriftPolicy is the action on resources changed on the edge cluster, default Report.
+	// +kubebuilder:validation:Enum=Report;Heal
+	DriftPolicy EdgeTaskDriftPolicy `json:"driftPolicy,omitempty"`
 }
 
+type EdgeTaskDriftPolicy string
+
+const (
+	EdgeTaskDriftPolicyReport EdgeTaskDriftPolicy = "Report" // set the Drifted condition only
+	EdgeTaskDriftPolicyHeal   EdgeTaskDriftPolicy = "Heal"   // re-apply the resources
+)
+
 type EdgeTaskPhase string
 
 const (
 	EdgeTaskPhaseWaiting EdgeTaskPhase = "Waiting"
+	EdgeTaskPhaseQueued  EdgeTaskPhase = "Queued" // waiting for the edge cluster to connect
 	EdgeTaskPhaseRunning EdgeTaskPhase = "Running"
 	EdgeTaskPhaseFailed  EdgeTaskPhase = "Failed"
 )
@@ -91,6 +102,7 @@ const (
 	EdgeTaskConditionTypeDistributed EdgeTaskConditionType = "Distributed" // distributed the resource
 	EdgeTaskConditionTypeAvailable   EdgeTaskConditionType = "Available"   // resources is available
 	EdgeTaskConditionTypeCleaned     EdgeTaskConditionType = "Cleaned"     // resources cleanup
+	EdgeTaskConditionTypeDrifted     EdgeTaskConditionType = "Drifted"     // resources changed on the edge cluster
 )
 
 type EdgeTaskConditionType string
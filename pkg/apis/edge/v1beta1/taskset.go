@@ -0,0 +1,102 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+// EdgeTaskSet distributes the same resources to edge clusters selected by labels,
+// an EdgeTask is created for each edge cluster and updated in waves.
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Namespaced
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.phase",description="Status"
+// +kubebuilder:printcolumn:name="Total",type="integer",JSONPath=".status.total",description="Selected edge clusters"
+// +kubebuilder:printcolumn:name="Updated",type="integer",JSONPath=".status.updated",description="Edge clusters updated to current resources"
+// +kubebuilder:printcolumn:name="Ready",type="integer",JSONPath=".status.ready",description="Updated edge clusters with all resources ready"
+type EdgeTaskSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              EdgeTaskSetSpec   `json:"spec,omitempty"`
+	Status            EdgeTaskSetStatus `json:"status,omitempty"`
+}
+
+type EdgeTaskSetSpec struct {
+	// Selector selects edge clusters in the same namespace, empty selector selects all edge clusters.
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Resources []runtime.RawExtension `json:"resources,omitempty"`
+	Rollout   EdgeTaskSetRollout     `json:"rollout,omitempty"`
+	// DriftPolicy of the created edge tasks.
+	// +kubebuilder:validation:Enum=Report;Heal
+	DriftPolicy EdgeTaskDriftPolicy `json:"driftPolicy,omitempty"`
+}
+
+type EdgeTaskSetRollout struct {
+	// BatchSize is the number of edge clusters updated in each wave, default 1.
+	// +kubebuilder:validation:Minimum=0
+	BatchSize int32 `json:"batchSize,omitempty"`
+	// MaxUnavailable is the number of updated edge clusters allowed to be not ready when starting the next wave.
+	// Offline edge clusters are not counted, their resources are applied after reconnected.
+	// +kubebuilder:validation:Minimum=0
+	MaxUnavailable int32 `json:"maxUnavailable,omitempty"`
+	// ProgressDeadlineSeconds is the time an updated online edge cluster has to become ready,
+	// otherwise it is considered failed and the rollout pauses, default 600.
+	// +kubebuilder:validation:Minimum=0
+	ProgressDeadlineSeconds int32 `json:"progressDeadlineSeconds,omitempty"`
+	// Paused stops updating more edge clusters.
+	Paused bool `json:"paused,omitempty"`
+}
+
+type EdgeTaskSetPhase string
+
+const (
+	EdgeTaskSetPhaseProgressing EdgeTaskSetPhase = "Progressing"
+	EdgeTaskSetPhaseCompleted   EdgeTaskSetPhase = "Completed"
+	EdgeTaskSetPhasePaused      EdgeTaskSetPhase = "Paused" // paused by spec.rollout.paused
+	EdgeTaskSetPhaseFailed      EdgeTaskSetPhase = "Failed" // paused on failed edge clusters
+)
+
+type EdgeTaskSetStatus struct {
+	ObservedGeneration int64                      `json:"observedGeneration,omitempty"`
+	Phase              EdgeTaskSetPhase           `json:"phase,omitempty"`
+	Message            string                     `json:"message,omitempty"`
+	ResourcesHash      string                     `json:"resourcesHash,omitempty"` // hash of current spec resources
+	Total              int32                      `json:"total,omitempty"`
+	Updated            int32                      `json:"updated,omitempty"`
+	Ready              int32                      `json:"ready,omitempty"`
+	Failed             int32                      `json:"failed,omitempty"`
+	Clusters           []EdgeTaskSetClusterStatus `json:"clusters,omitempty"`
+}
+
+type EdgeTaskSetClusterStatus struct {
+	Name    string        `json:"name,omitempty"`    // edge cluster name
+	Task    string        `json:"task,omitempty"`    // edge task name
+	Updated bool          `json:"updated,omitempty"` // edge task has current resources
+	Ready   bool          `json:"ready,omitempty"`   // all resources of current edge task ready
+	Failed  bool          `json:"failed,omitempty"`  // failed to distribute or not ready before deadline
+	Offline bool          `json:"offline,omitempty"` // edge cluster offline, resources are applied after reconnected
+	Phase   EdgeTaskPhase `json:"phase,omitempty"`   // edge task phase
+	Message string        `json:"message,omitempty"` // reason of not ready
+}
+
+// +kubebuilder:object:root=true
+type EdgeTaskSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EdgeTaskSet `json:"items"`
+}
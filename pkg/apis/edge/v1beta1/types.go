@@ -25,6 +25,7 @@ import (
 // +kubebuilder:printcolumn:name="RegisterAddress",type="string",JSONPath=".spec.register.address",description="Hub address for register"
 // +kubebuilder:printcolumn:name="Token",type="string",JSONPath=".spec.register.bootstrapToken",description="Token used for register"
 // +kubebuilder:printcolumn:name="LastOnline",type="string",JSONPath=".status.tunnel.lastOnlineTimestamp",description="CreationTimestamp of the bundle"
+// +kubebuilder:printcolumn:name="CertExpires",type="string",JSONPath=".status.certs.notAfter",description="Expiration of the edge certificate"
 type EdgeCluster struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -57,6 +58,7 @@ type EdgeClusterStatus struct {
 	Register    RegisterStatus    `json:"register,omitempty"`
 	Tunnel      TunnelStatus      `json:"tunnel,omitempty"`
 	Manufacture ManufactureStatus `json:"manufacture,omitempty"`
+	Certs       CertsStatus       `json:"certs,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -86,10 +88,23 @@ type Certs struct {
 	Key  []byte `json:"key,omitempty"`
 }
 
+type CertsStatus struct {
+	SerialNumber string       `json:"serialNumber,omitempty"` // serial number of the current edge certificate
+	NotBefore    *metav1.Time `json:"notBefore,omitempty"`
+	NotAfter     *metav1.Time `json:"notAfter,omitempty"`
+	LastRotated  *metav1.Time `json:"lastRotated,omitempty"`
+	Revoked      []string     `json:"revoked,omitempty"` // serial numbers of revoked edge certificates
+}
+
 type RegisterStatus struct {
-	LastRegister      *metav1.Time `json:"lastRegister,omitempty"`
-	LastRegisterToken string       `json:"lastRegisterToken,omitempty"`
-	URL               string       `json:"url,omitempty"`
+	LastRegister       *metav1.Time `json:"lastRegister,omitempty"`
+	LastRegisterToken  string       `json:"lastRegisterToken,omitempty"`
+	URL                string       `json:"url,omitempty"`
+	PeerID             string       `json:"peerID,omitempty"`             // tunnel peer id the credential bound to
+	CredentialHash     string       `json:"credentialHash,omitempty"`     // sha256 of the credential exchanged by bootstrap token
+	CredentialIssued   *metav1.Time `json:"credentialIssued,omitempty"`   // time the credential issued
+	CredentialUsed     *metav1.Time `json:"credentialUsed,omitempty"`     // time the credential first used, the bootstrap token can't be exchanged again since
+	ExchangedTokenHash string       `json:"exchangedTokenHash,omitempty"` // sha256 of the bootstrap token already exchanged
 }
 
 type TunnelStatus struct {
@@ -124,4 +139,6 @@ var _ = SchemeBuilder.Register(
 	&EdgeHubList{},
 	&EdgeTask{},
 	&EdgeTaskList{},
+	&EdgeTaskSet{},
+	&EdgeTaskSetList{},
 )
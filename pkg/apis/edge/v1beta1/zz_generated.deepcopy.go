@@ -20,6 +20,7 @@
 package v1beta1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -53,6 +54,38 @@ func (in *Certs) DeepCopy() *Certs {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertsStatus) DeepCopyInto(out *CertsStatus) {
+	*out = *in
+	if in.NotBefore != nil {
+		in, out := &in.NotBefore, &out.NotBefore
+		*out = (*in).DeepCopy()
+	}
+	if in.NotAfter != nil {
+		in, out := &in.NotAfter, &out.NotAfter
+		*out = (*in).DeepCopy()
+	}
+	if in.LastRotated != nil {
+		in, out := &in.LastRotated, &out.LastRotated
+		*out = (*in).DeepCopy()
+	}
+	if in.Revoked != nil {
+		in, out := &in.Revoked, &out.Revoked
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertsStatus.
+func (in *CertsStatus) DeepCopy() *CertsStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CertsStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EdgeCluster) DeepCopyInto(out *EdgeCluster) {
 	*out = *in
@@ -140,6 +173,7 @@ func (in *EdgeClusterStatus) DeepCopyInto(out *EdgeClusterStatus) {
 			(*out)[key] = val
 		}
 	}
+	in.Certs.DeepCopyInto(&out.Certs)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EdgeClusterStatus.
@@ -399,6 +433,143 @@ func (in *EdgeTaskResourceStatus) DeepCopy() *EdgeTaskResourceStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EdgeTaskSet) DeepCopyInto(out *EdgeTaskSet) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EdgeTaskSet.
+func (in *EdgeTaskSet) DeepCopy() *EdgeTaskSet {
+	if in == nil {
+		return nil
+	}
+	out := new(EdgeTaskSet)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *EdgeTaskSet) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EdgeTaskSetClusterStatus) DeepCopyInto(out *EdgeTaskSetClusterStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EdgeTaskSetClusterStatus.
+func (in *EdgeTaskSetClusterStatus) DeepCopy() *EdgeTaskSetClusterStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(EdgeTaskSetClusterStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EdgeTaskSetList) DeepCopyInto(out *EdgeTaskSetList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]EdgeTaskSet, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EdgeTaskSetList.
+func (in *EdgeTaskSetList) DeepCopy() *EdgeTaskSetList {
+	if in == nil {
+		return nil
+	}
+	out := new(EdgeTaskSetList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *EdgeTaskSetList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EdgeTaskSetRollout) DeepCopyInto(out *EdgeTaskSetRollout) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EdgeTaskSetRollout.
+func (in *EdgeTaskSetRollout) DeepCopy() *EdgeTaskSetRollout {
+	if in == nil {
+		return nil
+	}
+	out := new(EdgeTaskSetRollout)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EdgeTaskSetSpec) DeepCopyInto(out *EdgeTaskSetSpec) {
+	*out = *in
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = make([]runtime.RawExtension, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	out.Rollout = in.Rollout
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EdgeTaskSetSpec.
+func (in *EdgeTaskSetSpec) DeepCopy() *EdgeTaskSetSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(EdgeTaskSetSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EdgeTaskSetStatus) DeepCopyInto(out *EdgeTaskSetStatus) {
+	*out = *in
+	if in.Clusters != nil {
+		in, out := &in.Clusters, &out.Clusters
+		*out = make([]EdgeTaskSetClusterStatus, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EdgeTaskSetStatus.
+func (in *EdgeTaskSetStatus) DeepCopy() *EdgeTaskSetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(EdgeTaskSetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EdgeTaskSpec) DeepCopyInto(out *EdgeTaskSpec) {
 	*out = *in
@@ -502,6 +673,14 @@ func (in *RegisterStatus) DeepCopyInto(out *RegisterStatus) {
 		in, out := &in.LastRegister, &out.LastRegister
 		*out = (*in).DeepCopy()
 	}
+	if in.CredentialIssued != nil {
+		in, out := &in.CredentialIssued, &out.CredentialIssued
+		*out = (*in).DeepCopy()
+	}
+	if in.CredentialUsed != nil {
+		in, out := &in.CredentialUsed, &out.CredentialUsed
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegisterStatus.
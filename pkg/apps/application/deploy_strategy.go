@@ -113,6 +113,7 @@ func (h *ApplicationHandler) EnableStrategyDeployment(c *gin.Context) {
 				Name:     "sync",
 				Function: TaskFunction_Application_Sync,
 				Args:     workflow.ArgsOf(ref),
+				Retry:    SyncRetryPolicy,
 			},
 			// {
 			// 	Name:     "wait-sync",
@@ -164,6 +165,7 @@ func (h *ApplicationHandler) SwitchStrategy(c *gin.Context) {
 				Name:     "sync",
 				Function: TaskFunction_Application_Sync,
 				Args:     workflow.ArgsOf(ref),
+				Retry:    SyncRetryPolicy,
 			},
 			// {
 			// 	Name:     "wait-sync",
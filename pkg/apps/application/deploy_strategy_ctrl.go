@@ -131,6 +131,7 @@ func (h *ApplicationHandler) asyncUndo(ctx context.Context, ref PathRef, targetr
 			Name:     "sync",
 			Function: TaskFunction_Application_Sync,
 			Args:     workflow.ArgsOf(ref),
+			Retry:    SyncRetryPolicy,
 		},
 		// {
 		// 	Name:     "wait-sync",
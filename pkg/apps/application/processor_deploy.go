@@ -23,6 +23,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/argoproj/argo-cd/v2/pkg/apis/application"
 	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
@@ -63,6 +64,15 @@ const (
 	TaskFunction_Application_Undo                      = "application_undo"
 )
 
+// SyncRetryPolicy argo 同步可能因为集群或者 argo 短暂不可用而失败，此时进行重试
+var SyncRetryPolicy = &workflow.RetryPolicy{
+	MaxAttempts:     3,
+	InitialInterval: 10 * time.Second,
+	MaxInterval:     time.Minute,
+	Multiplier:      2,
+	Jitter:          0.2,
+}
+
 // ProvideFuntions 用于对异步任务框架指出所使用的方法
 func (p *ApplicationProcessor) ProvideFuntions() map[string]interface{} {
 	return map[string]interface{}{
@@ -782,6 +792,7 @@ func (p *ApplicationProcessor) BatchUpdateImages(ctx context.Context, ref PathRe
 				Name:     "sync",
 				Function: TaskFunction_Application_Sync,
 				Args:     workflow.ArgsOf(iref),
+				Retry:    SyncRetryPolicy,
 			},
 		}
 
@@ -16,6 +16,7 @@ package application
 
 import (
 	"context"
+	"fmt"
 	"path"
 
 	"kubegems.io/kubegems/pkg/utils/workflow"
@@ -61,6 +62,31 @@ func (p *TaskProcessor) WatchTasks(ctx context.Context, ref PathRef,
 	return p.Workflowcli.WatchTasks(ctx, TaskGroupApplication, TaskNameOf(ref, typ), callback)
 }
 
+// ControlTask 对应用的异步任务进行取消，暂停，恢复
+func (p *TaskProcessor) ControlTask(ctx context.Context, ref PathRef, uid string, action workflow.TaskAction) error {
+	// 任务名称中包含任务类型，在该应用的所有任务中查找
+	tasks, err := p.ListTasks(ctx, ref, "")
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		if task.UID != uid {
+			continue
+		}
+		switch action {
+		case workflow.TaskActionCancel:
+			return p.Workflowcli.CancelTask(ctx, task.Group, task.Name, task.UID)
+		case workflow.TaskActionPause:
+			return p.Workflowcli.PauseTask(ctx, task.Group, task.Name, task.UID)
+		case workflow.TaskActionResume:
+			return p.Workflowcli.ResumeTask(ctx, task.Group, task.Name, task.UID)
+		default:
+			return fmt.Errorf("unsupported task action %s", action)
+		}
+	}
+	return fmt.Errorf("task %s not found", uid)
+}
+
 func TaskNameOf(ref PathRef, taskname string) string {
 	if ref.IsEmpty() {
 		return ""
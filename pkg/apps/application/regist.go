@@ -87,6 +87,7 @@ func (h *ApplicationHandler) RegistRouter(rg *gin.RouterGroup) error {
 	task := deploy.Task
 	rg.GET("/tenant/:tenant_id/project/:project_id/environment/:environment_id/applications/:name/tasks", h.CheckByEnvironmentID, task.List)
 	rg.GET("/tenant/:tenant_id/project/:project_id/environment/:environment_id/applications/_/tasks", h.CheckByEnvironmentID, task.BatchList)
+	rg.POST("/tenant/:tenant_id/project/:project_id/environment/:environment_id/applications/:name/tasks/:uid/control", h.CheckByEnvironmentID, task.Control)
 
 	// 应用部署编排文件
 	rg.GET("/tenant/:tenant_id/project/:project_id/environment/:environment_id/applications/:name/files", h.CheckByEnvironmentID, deploy.ListFiles)
@@ -100,6 +100,36 @@ func (h *TaskHandler) List(c *gin.Context) {
 	})
 }
 
+type TaskControl struct {
+	Action workflow.TaskAction `json:"action"` // 控制指令 in(Cancel,Pause,Resume)
+}
+
+// @Tags			Application
+// @Summary		应用异步任务控制
+// @Description	取消，暂停，恢复应用异步任务
+// @Accept			json
+// @Produce		json
+// @Param			tenant_id		path		int										true	"tenaut id"
+// @Param			project_id		path		int										true	"project id"
+// @Param			environment_id	path		int										true	"environment_id"
+// @Param			name			path		string									true	"application name"
+// @Param			uid				path		string									true	"task uid"
+// @Param			body			body		TaskControl								true	"control"
+// @Success		200				{object}	handlers.ResponseStruct{Data=string}	"ok"
+// @Router			/v1/tenant/{tenant_id}/project/{project_id}/environment/{environment_id}/applications/{name}/tasks/{uid}/control [post]
+// @Security		JWT
+func (h *TaskHandler) Control(c *gin.Context) {
+	control := &TaskControl{}
+	h.NamedRefFunc(c, control, func(ctx context.Context, ref PathRef) (interface{}, error) {
+		h.SetAuditData(c, string(control.Action), "应用任务", ref.Name)
+
+		if err := h.Processor.ControlTask(ctx, ref, c.Param("uid"), control.Action); err != nil {
+			return nil, err
+		}
+		return "ok", nil
+	})
+}
+
 // @Tags			Application
 // @Summary		应用列表的异步任务列表
 // @Description	应用列表的异步任务列表
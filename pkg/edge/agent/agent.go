@@ -49,7 +49,8 @@ type EdgeAgent struct {
 	manufectures map[string]string
 	clientID     string
 	cluster      cluster.Interface
-	tunserver    tunnel.GrpcTunnelServer
+	tunserver    *tunnel.TunnelServer
+	upstream     tunnel.UpstreamConnector
 	httpapi      *AgentAPI
 	options      *Options
 	annotations  tunnel.Annotations
@@ -58,18 +59,26 @@ type EdgeAgent struct {
 func Run(ctx context.Context, options *Options) error {
 	ctx = log.NewContext(ctx, log.LogrLogger)
 
-	tlsconfig := &tls.Config{
-		InsecureSkipVerify: options.TLS.InsecureSkipVerify,
-	}
-
 	c, err := cluster.NewLocalAgentClusterAndStart(ctx)
 	if err != nil {
 		return err
 	}
+	clientcert, err := NewClientCertificate(c.GetClient(), options.TLS.CertFile, options.TLS.KeyFile)
+	if err != nil {
+		return err
+	}
+	tlsconfig := &tls.Config{
+		InsecureSkipVerify:   options.TLS.InsecureSkipVerify,
+		GetClientCertificate: clientcert.GetClientCertificate,
+	}
 	clientid, err := getClientID(ctx, c.GetClient(), options)
 	if err != nil {
 		return err
 	}
+	// edge hub requires the tunnel id to be the one the certificate issued to
+	if cn := clientcert.CommonName(); cn != "" {
+		clientid = cn
+	}
 	if clientid == "" {
 		return fmt.Errorf("empty client id specified")
 	}
@@ -77,6 +86,26 @@ func Run(ctx context.Context, options *Options) error {
 	if err != nil {
 		return err
 	}
+	token, err := readBootstrapToken(options.TokenFile)
+	if err != nil {
+		return err
+	}
+	credential, err := getCredential(ctx, c.GetClient())
+	if err != nil {
+		return err
+	}
+	tunserver := tunnel.NewTunnelServer(clientid, nil)
+	tunserver.Compressions = options.Compressions
+	tunserver.SetCredential(credential)
+	tunserver.OnCredential = func(credential string) {
+		if err := saveCredential(ctx, c.GetClient(), credential); err != nil {
+			log.Error(err, "save credential")
+		}
+	}
+	upstream, err := tunnel.NewUpstreamConnector(options.Transport, tunserver)
+	if err != nil {
+		return err
+	}
 	ea := &EdgeAgent{
 		config:       c.GetConfig(),
 		manufectures: manufectures,
@@ -84,13 +113,14 @@ func Run(ctx context.Context, options *Options) error {
 		options:      options,
 		annotations:  nil,
 		cluster:      c,
-		httpapi:      &AgentAPI{cluster: c},
-		tunserver:    tunnel.GrpcTunnelServer{TunnelServer: tunnel.NewTunnelServer(clientid, nil)},
+		httpapi:      &AgentAPI{cluster: c, certs: clientcert},
+		tunserver:    tunserver,
+		upstream:     upstream,
 	}
 
 	eg, ctx := errgroup.WithContext(ctx)
 	eg.Go(func() error {
-		return ea.tunserver.ConnectUpstreamWithRetry(ctx, options.EdgeHubAddr, tlsconfig, "", ea.getAnnotations(ctx))
+		return ea.upstream.ConnectUpstreamWithRetry(ctx, options.EdgeHubAddr, tlsconfig, token, ea.getAnnotations(ctx))
 	})
 	eg.Go(func() error {
 		return ea.RunKeepAliveRouter(ctx, ea.options.KeepAliveInterval, ea.getAnnotations)
@@ -120,7 +150,7 @@ func (ea *EdgeAgent) RunKeepAliveRouter(ctx context.Context, duration time.Durat
 		case <-timer.C:
 			timer.Reset(duration)
 			annotations := annotationsfunc(ctx)
-			ea.tunserver.TunnelServer.SendKeepAlive(ctx, annotations)
+			ea.tunserver.SendKeepAlive(ctx, annotations)
 		}
 	}
 }
@@ -16,6 +16,7 @@ package agent
 
 import (
 	"context"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"kubegems.io/kubegems/pkg/agent/apis"
@@ -26,6 +27,7 @@ import (
 
 type AgentAPI struct {
 	cluster *cluster.Cluster
+	certs   *ClientCertificate
 }
 
 func (a *AgentAPI) Run(ctx context.Context, listen string) error {
@@ -43,5 +45,9 @@ func (a *AgentAPI) Run(ctx context.Context, listen string) error {
 		return err
 	}
 	ginr.Any("/*path", ginhandler)
-	return system.ListenAndServeContext(ctx, listen, nil, ginr)
+	// gin catch-all path conflicts with other routes
+	mux := http.NewServeMux()
+	mux.Handle("/internal/edge/certs", a.certs)
+	mux.Handle("/", ginr)
+	return system.ListenAndServeContext(ctx, listen, nil, mux)
 }
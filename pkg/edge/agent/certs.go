@@ -0,0 +1,138 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kubegems.io/kubegems/pkg/apis/edge/v1beta1"
+	"kubegems.io/kubegems/pkg/log"
+	"kubegems.io/kubegems/pkg/utils/kube"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// CertsSecret 安装时创建的证书 secret，挂载于 /app/certs
+const CertsSecret = "kubegems-edge-agent-secret"
+
+// ClientCertificate 连接 edge hub 时使用的客户端证书，轮换后无需重启即可在下次连接时生效
+type ClientCertificate struct {
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	cli  client.Client
+}
+
+// NewClientCertificate 从文件加载证书，文件不存在时不使用客户端证书
+func NewClientCertificate(cli client.Client, certFile, keyFile string) (*ClientCertificate, error) {
+	c := &ClientCertificate{cli: cli}
+	if certFile == "" || keyFile == "" {
+		return c, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			log.Info("no client certificate found", "cert", certFile)
+			return c, nil
+		}
+		return nil, err
+	}
+	c.cert = &cert
+	return c, nil
+}
+
+// CommonName 返回证书签发给的边缘集群，未使用客户端证书时返回空
+func (c *ClientCertificate) CommonName() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.cert == nil || len(c.cert.Certificate) == 0 {
+		return ""
+	}
+	leaf, err := x509.ParseCertificate(c.cert.Certificate[0])
+	if err != nil {
+		return ""
+	}
+	return leaf.Subject.CommonName
+}
+
+func (c *ClientCertificate) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.cert == nil {
+		// send no certificate
+		return &tls.Certificate{}, nil
+	}
+	return c.cert, nil
+}
+
+// Rotate 校验并保存新的证书，同时更新证书 secret 以便重启后继续使用
+func (c *ClientCertificate) Rotate(ctx context.Context, certs v1beta1.Certs) error {
+	cert, err := tls.X509KeyPair(certs.Cert, certs.Key)
+	if err != nil {
+		return err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      CertsSecret,
+			Namespace: kube.LocalNamespaceOrDefault("kubegems-edge"),
+		},
+	}
+	if _, err := controllerutil.CreateOrPatch(ctx, c.cli, secret, func() error {
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Type = corev1.SecretTypeTLS
+		secret.Data[corev1.TLSCertKey] = certs.Cert
+		secret.Data[corev1.TLSPrivateKeyKey] = certs.Key
+		if len(certs.CA) > 0 {
+			secret.Data[corev1.ServiceAccountRootCAKey] = certs.CA
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+	return nil
+}
+
+// ServeHTTP 接收 edge server 下发的新证书
+func (c *ClientCertificate) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	certs := v1beta1.Certs{}
+	if err := json.NewDecoder(r.Body).Decode(&certs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := c.Rotate(r.Context(), certs); err != nil {
+		log.Error(err, "rotate client certificate")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Info("client certificate rotated")
+	w.WriteHeader(http.StatusNoContent)
+}
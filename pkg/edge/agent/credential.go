@@ -0,0 +1,79 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kubegems.io/kubegems/pkg/log"
+	"kubegems.io/kubegems/pkg/utils/kube"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const credentialKey = "credential"
+
+// readBootstrapToken 读取安装时写入的引导 token，文件不存在时不使用 token
+func readBootstrapToken(file string) (string, error) {
+	if file == "" {
+		return "", nil
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			log.Info("no bootstrap token found", "file", file)
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// getCredential 读取引导 token 交换得到的凭据
+func getCredential(ctx context.Context, cli client.Client) (string, error) {
+	secret := &corev1.Secret{}
+	key := client.ObjectKey{Name: ClientIDSecret, Namespace: kube.LocalNamespaceOrDefault("kubegems-edge")}
+	if err := cli.Get(ctx, key, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return string(secret.Data[credentialKey]), nil
+}
+
+// saveCredential 保存 edge server 签发的凭据，引导 token 只能交换一次，重启后需要使用该凭据连接
+func saveCredential(ctx context.Context, cli client.Client, credential string) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ClientIDSecret,
+			Namespace: kube.LocalNamespaceOrDefault("kubegems-edge"),
+		},
+	}
+	_, err := controllerutil.CreateOrPatch(ctx, cli, secret, func() error {
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data[credentialKey] = []byte(credential)
+		return nil
+	})
+	return err
+}
@@ -14,7 +14,11 @@
 
 package agent
 
-import "time"
+import (
+	"time"
+
+	"kubegems.io/kubegems/pkg/edge/tunnel"
+)
 
 const (
 	ClientIDSecret           = "kubegems-edge-agent-id"
@@ -29,17 +33,24 @@ type Options struct {
 	ManufactureRemap  []string      `json:"manufactureRemap,omitempty" description:"remap manufacture file key to newkey,example 'newkey=existskey'"`
 	Manufacture       []string      `json:"manufacture,omitempty" description:"manufacture kvs,example 'some-key=value,foo=bar'"`
 	EdgeHubAddr       string        `json:"edgeHubAddr,omitempty"`
+	Transport         string        `json:"transport,omitempty" description:"tunnel transport to edge hub, grpc or websocket, both served on the tls address of edge hub, use websocket when only http proxy available"`
+	Compressions      []string      `json:"compressions,omitempty" description:"enabled tunnel compressions in preference order, zstd or gzip, compression used only if edge hub supports"`
 	KeepAliveInterval time.Duration `json:"keepAliveInterval,omitempty"`
 	TLS               *ClientTLS    `json:"tls,omitempty" description:"skip server tls verify"`
+	TokenFile         string        `json:"tokenFile,omitempty" description:"bootstrap token exchanged for an edge credential on the first connect"`
 }
 
 type ClientTLS struct {
-	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+	CertFile           string `json:"certFile,omitempty" description:"client certificate issued by edge hub, rotated by edge server"`
+	KeyFile            string `json:"keyFile,omitempty"`
 }
 
 func NewDefaultOptions() *Options {
 	return &Options{
 		EdgeHubAddr:       "127.0.0.1:8080",
+		Transport:         tunnel.TransportGRPC,
+		Compressions:      []string{},
 		Listen:            ":8080",
 		DeviceID:          "",
 		DeviceIDKey:       "",
@@ -47,6 +58,10 @@ func NewDefaultOptions() *Options {
 		ManufactureFile:   []string{"/etc/os-release"},
 		ManufactureRemap:  []string{},
 		Manufacture:       []string{},
-		TLS:               &ClientTLS{},
+		TLS: &ClientTLS{
+			CertFile: "/app/certs/tls.crt",
+			KeyFile:  "/app/certs/tls.key",
+		},
+		TokenFile: "/app/certs/token",
 	}
 }
@@ -0,0 +1,61 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"kubegems.io/kubegems/pkg/edge/tunnel"
+)
+
+// WatchTunnelEvents 订阅 edge server 的隧道事件，直到连接断开或者 ctx 结束
+func WatchTunnelEvents(ctx context.Context, edgeServerAddr string, onEvent func(tunnel.TunnelEvent)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, edgeServerAddr+"/v1/tunnel/events", nil)
+	if err != nil {
+		return err
+	}
+	cli := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // nolint: gosec
+		},
+	}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("watch tunnel events: %s: %s", resp.Status, string(body))
+	}
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		event := tunnel.TunnelEvent{}
+		if err := decoder.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		onEvent(event)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hub
+
+import (
+	"net/http"
+
+	route "kubegems.io/library/rest/api"
+	"kubegems.io/library/rest/request"
+	"kubegems.io/library/rest/response"
+
+	"kubegems.io/kubegems/pkg/edge/tunnel"
+)
+
+// RevocationAPI 由 edge server 通过隧道同步吊销的边缘证书
+type RevocationAPI struct {
+	Auth   *tunnel.CertAuthManager
+	Tunnel *tunnel.TunnelServer
+}
+
+func (a *RevocationAPI) ListRevoked(resp http.ResponseWriter, req *http.Request) {
+	response.OK(resp, a.Auth.Revoked())
+}
+
+func (a *RevocationAPI) SetRevoked(resp http.ResponseWriter, req *http.Request) {
+	serials := []string{}
+	if err := request.Body(req, &serials); err != nil {
+		response.BadRequest(resp, err.Error())
+		return
+	}
+	a.Auth.SetRevoked(serials)
+	response.OK(resp, serials)
+}
+
+// fromEdgeServer 仅允许 edge server 经由上游隧道发起的请求，下游的边缘节点无法通过隧道调用
+func (a *RevocationAPI) fromEdgeServer(next http.HandlerFunc) http.HandlerFunc {
+	return func(resp http.ResponseWriter, req *http.Request) {
+		origin, ok := a.Tunnel.OriginOf(req.RemoteAddr)
+		if !ok || !origin.Upstream || origin.Peer != origin.Tunnel {
+			response.Forbidden(resp, "only requests from edge server allowed")
+			return
+		}
+		next(resp, req)
+	}
+}
+
+func (a *RevocationAPI) RegisterRoute(r *route.Group) {
+	r.AddSubGroup(
+		route.NewGroup("/tunnel/revocations").Tag("tunnel").AddRoutes(
+			route.GET("").To(a.fromEdgeServer(a.ListRevoked)).Doc("list revoked certificate serial numbers").Response([]string{}),
+			route.PUT("").To(a.fromEdgeServer(a.SetRevoked)).Doc("replace revoked certificate serial numbers, only edge server allowed").Parameters(
+				route.BodyParameter("serials", []string{}),
+			),
+		),
+	)
+}
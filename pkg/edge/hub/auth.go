@@ -0,0 +1,92 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hub
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"kubegems.io/library/rest/response"
+
+	"kubegems.io/kubegems/pkg/apis/edge/common"
+	"kubegems.io/kubegems/pkg/edge/tunnel"
+)
+
+// EdgeServerTokenVerifier 通过隧道请求上游 edge server 校验边缘集群的 token，
+// 边缘集群与 token 的对应关系以及已签发的凭据仅保存在 edge server。
+type EdgeServerTokenVerifier struct {
+	Tunnel *tunnel.TunnelServer
+	Hub    string
+}
+
+func (v *EdgeServerTokenVerifier) VerifyToken(ctx context.Context, name string, token string) (string, error) {
+	server, address, err := v.upstream()
+	if err != nil {
+		return "", err
+	}
+	review := tunnel.TokenReview{Peer: name, Hub: v.Hub, Token: token}
+	content, err := json.Marshal(review)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, address+"/v1/edge-tokenreviews", bytes.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	cli := &http.Client{
+		Transport: &http.Transport{
+			DialContext: v.Tunnel.DialerOn(server).DialContext,
+			// server api is only reachable through the tunnel
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // nolint: gosec
+		},
+	}
+	defer cli.CloseIdleConnections()
+	resp, err := cli.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("review token: %w", err)
+	}
+	defer resp.Body.Close()
+	result := &response.Response{Data: &review}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return "", fmt.Errorf("review token: %s: %w", resp.Status, err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", errors.New(result.Message)
+	}
+	return review.Credential, nil
+}
+
+// upstream 返回默认上游即 edge server 的 id 以及 api 地址
+func (v *EdgeServerTokenVerifier) upstream() (string, string, error) {
+	topology := v.Tunnel.Topology()
+	if topology.DefaultOut == "" {
+		return "", "", errors.New("edge server not connected")
+	}
+	for _, route := range topology.Routes {
+		if route.Peer != topology.DefaultOut {
+			continue
+		}
+		if address := route.Annotations[common.AnnotationKeyEdgeServerAPI]; address != "" {
+			return route.Peer, address, nil
+		}
+	}
+	return "", "", fmt.Errorf("edge server %s has no api address", topology.DefaultOut)
+}
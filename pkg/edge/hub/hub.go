@@ -17,11 +17,13 @@ package hub
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"net/http"
 
 	"golang.org/x/sync/errgroup"
 	"kubegems.io/kubegems/pkg/apis/edge/common"
 	"kubegems.io/kubegems/pkg/edge/tunnel"
+	"kubegems.io/kubegems/pkg/edge/tunnel/debug"
 	"kubegems.io/kubegems/pkg/log"
 	"kubegems.io/kubegems/pkg/utils/certificate"
 	"kubegems.io/kubegems/pkg/utils/config"
@@ -47,23 +49,49 @@ func New(options *Options) (*EdgeHubServer, error) {
 		return nil, err
 	}
 	cert, key := certificate.EncodeToX509Pair(tlsConfig.Certificates[0])
+	// edge certificates are issued by the hub certificate
+	issuer, err := x509.ParseCertificate(tlsConfig.Certificates[0].Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig.ClientAuth == tls.NoClientCert {
+		// verified by the auth manager
+		tlsConfig.ClientAuth = tls.RequestClientCert
+	}
+	auth := tunnel.NewCertAuthManager(issuer, options.RequireCert)
+	tokenauth := &tunnel.TokenAuthManager{RequireToken: options.RequireToken, Next: auth}
+	tunserver := tunnel.NewTunnelServer(options.ServerID, tokenauth)
+	tunserver.Compressions = options.Compressions
+	// edge agents must not reach the hub api or other local services through the tunnel
+	tunserver.DialFilter = tunnel.DenyDownstreamLocalDial
+	// disconnect edge agents once their certificates are revoked
+	auth.OnRevoked = func(peer string) { tunserver.Disconnect(peer) }
+	tokenauth.Verifier = &EdgeServerTokenVerifier{Tunnel: tunserver, Hub: options.ServerID}
 	hub := &EdgeHubServer{
 		upstreamAnnotations: map[string]string{
 			common.AnnotationKeyEdgeHubAddress: options.Host,
 			common.AnnotationKeyEdgeHubCert:    string(cert),
 			common.AnnotationKeyEdgeHubKey:     string(key),
+			common.AnnotationKeyEdgeHubAPI:     hubAPIAddress(options),
 		},
 		GrpcTunnelServer: tunnel.GrpcTunnelServer{
-			TunnelServer: tunnel.NewTunnelServer(options.ServerID, nil),
+			TunnelServer: tunserver,
 		},
+		auth:      auth,
 		tlsConfig: tlsConfig,
 		options:   options,
 	}
 	return hub, nil
 }
 
+// hubAPIAddress returns the address edge server calls hub api through the tunnel
+func hubAPIAddress(options *Options) string {
+	return tunnel.LocalAPIAddress(options.Listen, options.Listen == options.ListenGrpc)
+}
+
 type EdgeHubServer struct {
 	tunnel.GrpcTunnelServer
+	auth                *tunnel.CertAuthManager
 	tlsConfig           *tls.Config
 	options             *Options
 	upstreamAnnotations tunnel.Annotations
@@ -76,18 +104,29 @@ func (s *EdgeHubServer) Run(ctx context.Context) error {
 		eg.Go(func() error {
 			return system.ListenAndServeContextGRPCAndHTTP(
 				ctx, s.options.Listen, s.tlsConfig,
-				s.HTTPAPI(),
+				s.TunnelHandler(s.HTTPAPI()),
 				s.GrpcServer(s.tlsConfig),
 			)
 		})
 	} else {
 		eg.Go(func() error {
-			return s.ServeGrpc(ctx, s.options.ListenGrpc, s.tlsConfig)
+			// websocket tunnels share the tls port with grpc tunnels
+			return system.ListenAndServeContextGRPCAndHTTP(
+				ctx, s.options.ListenGrpc, s.tlsConfig,
+				s.TunnelHandler(http.NotFoundHandler()),
+				s.GrpcServer(s.tlsConfig),
+			)
 		})
 		eg.Go(func() error {
 			return system.ListenAndServeContext(ctx, s.options.Listen, nil, s.HTTPAPI())
 		})
 	}
+	eg.Go(func() error {
+		return debug.Run(ctx, s.options.ListenDebug, s.options.DebugToken, s.TunnelServer)
+	})
+	eg.Go(func() error {
+		return debug.RunMetrics(ctx, s.options.ListenMetrics, s.TunnelServer)
+	})
 	eg.Go(func() error {
 		c := s.tlsConfig.Clone()
 		c.InsecureSkipVerify = true
@@ -99,7 +138,16 @@ func (s *EdgeHubServer) Run(ctx context.Context) error {
 	return eg.Wait()
 }
 
+// TunnelHandler 在 tls 端口上接收 WebSocket 隧道，其余请求交给 next 处理
+func (s *EdgeHubServer) TunnelHandler(next http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	// edge agents behind http proxies connect via websocket
+	mux.Handle(tunnel.DefaultWebSocketPath, tunnel.WebSocketTunnelServer{TunnelServer: s.TunnelServer})
+	mux.Handle("/", next)
+	return mux
+}
+
 func (s *EdgeHubServer) HTTPAPI() http.Handler {
-	// handler provides a health check endpoint
-	return api.NewAPI().HealthCheck(nil).BuildHandler()
+	// handler provides a health check endpoint and the api called by edge server through the tunnel
+	return api.NewAPI().HealthCheck(nil).Register("/v1", &RevocationAPI{Auth: s.auth, Tunnel: s.TunnelServer}).BuildHandler()
 }
@@ -14,23 +14,36 @@
 
 package hub
 
-import "kubegems.io/kubegems/pkg/utils/system"
+import (
+	"kubegems.io/kubegems/pkg/edge/tunnel"
+	"kubegems.io/kubegems/pkg/edge/tunnel/debug"
+	"kubegems.io/kubegems/pkg/utils/system"
+)
 
 type Options struct {
 	Listen         string      `json:"listen,omitempty"`
 	ListenGrpc     string      `json:"listenGrpc,omitempty"`
+	ListenDebug    string      `json:"listenDebug,omitempty" description:"address of tunnel debug api, disabled if debugToken is empty"`
+	DebugToken     string      `json:"debugToken,omitempty" description:"bearer token required by tunnel debug api"`
+	ListenMetrics  string      `json:"listenMetrics,omitempty" description:"address of tunnel metrics"`
 	Host           string      `json:"host,omitempty" validate:"required"`
 	ServerID       string      `json:"serverID,omitempty" validate:"required"`
 	TLS            *system.TLS `json:"tls,omitempty"`
 	EdgeServerAddr string      `json:"edgeServerAddr,omitempty"`
+	Compressions   []string    `json:"compressions,omitempty" description:"tunnel compressions accepted from edge agents"`
+	RequireCert    bool        `json:"requireCert,omitempty" description:"reject edge agents without a client certificate issued by this hub, edge agents without one are always rejected once any certificate is revoked"`
+	RequireToken   bool        `json:"requireToken,omitempty" description:"reject edge agents without a bootstrap token or credential reviewed by edge server, edge agents without a token skip the review and its duplicate peer check if not required"`
 }
 
 func NewDefaultOptions() *Options {
 	return &Options{
 		Listen:         ":8080",
 		ListenGrpc:     ":50051",
+		ListenDebug:    debug.DefaultListen,
+		ListenMetrics:  debug.DefaultListenMetrics,
 		TLS:            system.NewDefaultTLS(),
 		ServerID:       "",
 		EdgeServerAddr: "127.0.0.1:50052",
+		Compressions:   tunnel.SupportedCompressions,
 	}
 }
@@ -16,6 +16,7 @@ package server
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/google/uuid"
@@ -26,6 +27,7 @@ import (
 
 	"kubegems.io/kubegems/pkg/apis/edge/v1beta1"
 	"kubegems.io/kubegems/pkg/edge/tunnel"
+	"kubegems.io/kubegems/pkg/edge/tunnel/debug"
 )
 
 type EdgeClusterAPI struct {
@@ -171,11 +173,50 @@ func (a *EdgeClusterAPI) GetEdgeHub(resp http.ResponseWriter, req *http.Request)
 	response.OK(resp, edgehub)
 }
 
+func (a *EdgeClusterAPI) RotateCerts(resp http.ResponseWriter, req *http.Request) {
+	uid := request.Path(req, "uid", "")
+	revoke, _ := strconv.ParseBool(request.Query(req, "revoke", "false"))
+	cluster, err := a.Cluster.RotateCerts(req.Context(), uid, revoke)
+	if err != nil {
+		response.BadRequest(resp, err.Error())
+		return
+	}
+	response.OK(resp, cluster.Status.Certs)
+}
+
+// ReviewToken 由 edge hub 通过隧道调用，校验边缘集群连接时提供的 token
+func (a *EdgeClusterAPI) ReviewToken(resp http.ResponseWriter, req *http.Request) {
+	review := &tunnel.TokenReview{}
+	if err := request.Body(req, review); err != nil {
+		response.BadRequest(resp, err.Error())
+		return
+	}
+	if err := a.Cluster.ReviewToken(req.Context(), review); err != nil {
+		response.Error(resp, response.NewStatusErrorMessage(http.StatusUnauthorized, err.Error()))
+		return
+	}
+	review.Token = "" // do not echo the token
+	response.OK(resp, review)
+}
+
+// WatchTunnelEvents 供 edge task 控制器订阅边缘集群的连接状态
+func (a *EdgeClusterAPI) WatchTunnelEvents(resp http.ResponseWriter, req *http.Request) {
+	(&debug.API{Tunnel: a.Tunnel}).WatchEvents(resp, req)
+}
+
 func (a *EdgeClusterAPI) RegisterRoute(r *route.Group) {
 	r.AddRoutes(
 		route.GET("/edge-clusters/{uid}/agent-installer.yaml").To(a.InstallAgentTemplate).
 			Parameters(route.QueryParameter("token", "bootstrap token")),
 	).AddSubGroup(
+		route.NewGroup("/edge-tokenreviews").Tag("edge-cluster").AddRoutes(
+			route.POST("").To(a.ReviewToken).Doc("review token of edge cluster, called by edge hubs").
+				Parameters(route.BodyParameter("review", tunnel.TokenReview{})).
+				Response(tunnel.TokenReview{}),
+		),
+		route.NewGroup("/tunnel").Tag("tunnel").AddRoutes(
+			route.GET("/events").To(a.WatchTunnelEvents).Doc("watch tunnel events").Response(tunnel.TunnelEvent{}),
+		),
 		route.NewGroup("/edge-hubs").Tag("edge-hub").AddRoutes(
 			route.GET("").To(a.ListEdgeHubs).Doc("list edge hubs").
 				Response([]v1beta1.EdgeHub{}),
@@ -205,6 +246,10 @@ func (a *EdgeClusterAPI) RegisterRoute(r *route.Group) {
 			route.DELETE("/{uid}").To(a.RemoveEdgeCluster).Parameters(
 				route.PathParameter("uid", "uid name"),
 			),
+			route.POST("/{uid}/rotate-certs").To(a.RotateCerts).Doc("rotate edge certificate").Parameters(
+				route.PathParameter("uid", "uid name"),
+				route.QueryParameter("revoke", "revoke the previous certificate").Optional(),
+			).Response(v1beta1.CertsStatus{}),
 		).AddSubGroup(
 			route.NewGroup("/{uid}/proxy/{path}*").Tag("proxy").Parameters(
 				route.PathParameter("uid", "uid name"),
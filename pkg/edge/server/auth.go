@@ -0,0 +1,189 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kubegems.io/kubegems/pkg/apis/edge/v1beta1"
+	"kubegems.io/kubegems/pkg/edge/tunnel"
+	"kubegems.io/kubegems/pkg/log"
+)
+
+const (
+	EventReasonAuthenticationFailed = "AuthenticationFailed"
+	EventReasonCredentialIssued     = "CredentialIssued"
+)
+
+var (
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrBootstrapTokenUsed = errors.New("bootstrap token has been exchanged")
+	ErrDuplicatePeer      = errors.New("duplicate peer id")
+)
+
+// ReviewToken 校验 edge hub 转发的边缘集群 token。
+// 引导 token 交换的凭据与交换时的 peer id 绑定；凭据首次使用前同一 peer 可以重新交换，以免边缘集群保存凭据失败后无法连接，
+// 凭据使用后引导 token 失效，更新 spec 中的引导 token 后可以重新交换。
+// edge hub 未开启 requireToken 时，未提供 token 的边缘集群不经过此校验，也不检查重复的 peer id。
+// 认证失败时在对应的 EdgeCluster 上记录事件。
+func (m *EdgeManager) ReviewToken(ctx context.Context, review *tunnel.TokenReview) error {
+	cluster, err := m.lookupTokenCluster(ctx, review.Peer, review.Token)
+	if err != nil {
+		log.Error(err, "lookup edge cluster of token", "peer", review.Peer, "hub", review.Hub)
+		return fmt.Errorf("%w for peer %s", ErrInvalidToken, review.Peer)
+	}
+	credential, err := m.exchangeToken(ctx, cluster, review)
+	if err != nil {
+		m.recordEvent(cluster, corev1.EventTypeWarning, EventReasonAuthenticationFailed,
+			"peer %s from hub %s: %v", review.Peer, review.Hub, err)
+		return err
+	}
+	if credential != "" {
+		m.recordEvent(cluster, corev1.EventTypeNormal, EventReasonCredentialIssued,
+			"credential issued to peer %s from hub %s", review.Peer, review.Hub)
+	}
+	review.Credential = credential
+	return nil
+}
+
+// lookupTokenCluster 按凭据、引导 token 以及 peer id 的顺序查找 token 所属的边缘集群
+func (m *EdgeManager) lookupTokenCluster(ctx context.Context, peer, token string) (*v1beta1.EdgeCluster, error) {
+	if name, _, ok := strings.Cut(token, ":"); ok {
+		if cluster, err := m.ClusterStore.Get(ctx, name); err == nil {
+			return cluster, nil
+		}
+	}
+	if token != "" {
+		_, clusters, err := m.ClusterStore.List(ctx, ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for i := range clusters {
+			if clusters[i].Spec.Register.BootstrapToken == token {
+				return &clusters[i], nil
+			}
+		}
+	}
+	// record the failure on the cluster named as the peer
+	return m.ClusterStore.Get(ctx, peer)
+}
+
+// exchangeToken 校验 token，为引导 token 签发凭据。
+// 凭据与 peer id 绑定，持有有效凭据的对端可以在旧的隧道超时前重新连接，替代旧的会话；
+// 引导 token 在 peer 仍然可达时不能重新交换，以免他人使用同一引导 token 替换已连接对端的凭据。
+func (m *EdgeManager) exchangeToken(ctx context.Context, cluster *v1beta1.EdgeCluster, review *tunnel.TokenReview) (string, error) {
+	exchange, err := verifyToken(cluster, review.Peer, review.Token)
+	if err != nil {
+		return "", err
+	}
+	if !exchange {
+		return "", m.markCredentialUsed(ctx, cluster)
+	}
+	if m.Tunnel != nil && m.isReachable(review.Peer) {
+		return "", fmt.Errorf("%w: %s is already connected", ErrDuplicatePeer, review.Peer)
+	}
+	credential, err := newCredential(cluster.Name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := m.ClusterStore.Update(ctx, cluster.Name, func(in *v1beta1.EdgeCluster) error {
+		now := metav1.Now()
+		in.Status.Register.PeerID = review.Peer
+		in.Status.Register.CredentialHash = hashToken(credential)
+		in.Status.Register.CredentialIssued = &now
+		in.Status.Register.CredentialUsed = nil
+		in.Status.Register.ExchangedTokenHash = hashToken(review.Token)
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	log.Info("edge credential issued", "cluster", cluster.Name, "peer", review.Peer, "hub", review.Hub)
+	return credential, nil
+}
+
+// markCredentialUsed 记录凭据首次使用，此后引导 token 不能再次交换
+func (m *EdgeManager) markCredentialUsed(ctx context.Context, cluster *v1beta1.EdgeCluster) error {
+	if cluster.Status.Register.CredentialUsed != nil {
+		return nil
+	}
+	_, err := m.ClusterStore.Update(ctx, cluster.Name, func(in *v1beta1.EdgeCluster) error {
+		if in.Status.Register.CredentialUsed == nil {
+			now := metav1.Now()
+			in.Status.Register.CredentialUsed = &now
+		}
+		return nil
+	})
+	return err
+}
+
+func (m *EdgeManager) isReachable(peer string) bool {
+	for _, route := range m.Tunnel.Topology().Routes {
+		if route.Peer == peer {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *EdgeManager) recordEvent(cluster *v1beta1.EdgeCluster, eventtype, reason, messageFmt string, args ...any) {
+	if m.Recorder == nil {
+		return
+	}
+	m.Recorder.Eventf(cluster, eventtype, reason, messageFmt, args...)
+}
+
+// verifyToken 校验 token，返回是否需要为引导 token 签发新的凭据
+func verifyToken(cluster *v1beta1.EdgeCluster, peer, token string) (bool, error) {
+	if token == "" {
+		return false, tunnel.ErrNoToken
+	}
+	register := cluster.Status.Register
+	if register.CredentialHash != "" && hashToken(token) == register.CredentialHash {
+		if register.PeerID != "" && register.PeerID != peer {
+			return false, fmt.Errorf("%w: credential is bound to %s", ErrDuplicatePeer, register.PeerID)
+		}
+		return false, nil
+	}
+	if bootstrap := cluster.Spec.Register.BootstrapToken; bootstrap != "" && token == bootstrap {
+		// the peer may not have saved the credential, allow it to exchange again until the credential used
+		if register.ExchangedTokenHash == hashToken(token) && (register.CredentialUsed != nil || register.PeerID != peer) {
+			return false, ErrBootstrapTokenUsed
+		}
+		return true, nil
+	}
+	return false, ErrInvalidToken
+}
+
+// newCredential 生成以集群名为前缀的随机凭据，用于查找凭据所属的集群
+func newCredential(name string) (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return name + ":" + hex.EncodeToString(random), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
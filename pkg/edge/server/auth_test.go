@@ -0,0 +1,139 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kubegems.io/kubegems/pkg/apis/edge/v1beta1"
+	"kubegems.io/kubegems/pkg/edge/tunnel"
+)
+
+type memoryClusterStore struct {
+	EdgeClusterStore
+	mu       sync.Mutex
+	clusters map[string]*v1beta1.EdgeCluster
+}
+
+func (s *memoryClusterStore) Get(ctx context.Context, name string) (*v1beta1.EdgeCluster, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cluster, ok := s.clusters[name]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return cluster.DeepCopy(), nil
+}
+
+func (s *memoryClusterStore) Update(ctx context.Context, name string, fun func(cluster *v1beta1.EdgeCluster) error) (*v1beta1.EdgeCluster, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cluster, ok := s.clusters[name]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	if err := fun(cluster); err != nil {
+		return nil, err
+	}
+	return cluster.DeepCopy(), nil
+}
+
+// pipeTunnel 内存中的隧道
+type pipeTunnel struct {
+	in, out chan *tunnel.Packet
+	closed  chan struct{}
+	once    *sync.Once
+}
+
+func newPipeTunnel() (*pipeTunnel, *pipeTunnel) {
+	a, b, closed, once := make(chan *tunnel.Packet, 64), make(chan *tunnel.Packet, 64), make(chan struct{}), &sync.Once{}
+	return &pipeTunnel{in: a, out: b, closed: closed, once: once}, &pipeTunnel{in: b, out: a, closed: closed, once: once}
+}
+
+func (t *pipeTunnel) Recv(into *tunnel.Packet) error {
+	select {
+	case pkt := <-t.in:
+		*into = *pkt
+		return nil
+	case <-t.closed:
+		return io.EOF
+	}
+}
+
+func (t *pipeTunnel) Send(pkt *tunnel.Packet) error {
+	cp := *pkt
+	select {
+	case t.out <- &cp:
+		return nil
+	case <-t.closed:
+		return io.EOF
+	}
+}
+
+func (t *pipeTunnel) Close() error {
+	t.once.Do(func() { close(t.closed) })
+	return nil
+}
+
+func TestEdgeManager_exchangeToken_staleRoute(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the route to the previous session of edge is not removed yet
+	server, edge := tunnel.NewTunnelServer("server", nil), tunnel.NewTunnelServer("edge", nil)
+	down, up := newPipeTunnel()
+	go server.Connect(ctx, up, "", nil, tunnel.TunnelOptions{})
+	go edge.Connect(ctx, down, "", nil, tunnel.TunnelOptions{SendRouteChange: true, IsDefaultOut: true})
+
+	credential := "edge:credential"
+	issued := metav1.Now()
+	store := &memoryClusterStore{clusters: map[string]*v1beta1.EdgeCluster{
+		"edge": {
+			ObjectMeta: metav1.ObjectMeta{Name: "edge"},
+			Spec:       v1beta1.EdgeClusterSpec{Register: v1beta1.RegisterInfo{BootstrapToken: "bootstrap"}},
+			Status: v1beta1.EdgeClusterStatus{Register: v1beta1.RegisterStatus{
+				PeerID:             "edge",
+				CredentialHash:     hashToken(credential),
+				CredentialIssued:   &issued,
+				ExchangedTokenHash: hashToken("bootstrap"),
+			}},
+		},
+	}}
+	m := &EdgeManager{ClusterStore: store, Tunnel: server}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !m.isReachable("edge") {
+		if time.Now().After(deadline) {
+			t.Fatal("edge not reachable")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cluster, _ := store.Get(ctx, "edge")
+	// a valid credential replaces the previous session
+	if _, err := m.exchangeToken(ctx, cluster, &tunnel.TokenReview{Peer: "edge", Token: credential}); err != nil {
+		t.Errorf("exchangeToken() with credential error = %v", err)
+	}
+	// the bootstrap token can not be exchanged again while the peer is reachable
+	cluster.Status.Register.CredentialUsed = nil
+	if _, err := m.exchangeToken(ctx, cluster, &tunnel.TokenReview{Peer: "edge", Token: "bootstrap"}); !errors.Is(err, ErrDuplicatePeer) {
+		t.Errorf("exchangeToken() with bootstrap token error = %v, want %v", err, ErrDuplicatePeer)
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kubegems.io/kubegems/pkg/apis/edge/common"
+	"kubegems.io/kubegems/pkg/apis/edge/v1beta1"
+	"kubegems.io/kubegems/pkg/log"
+)
+
+const (
+	DefaultCertRotationInterval = time.Hour
+	// DefaultCertRenewBefore 证书在过期前该时间内自动续期
+	DefaultCertRenewBefore = 30 * 24 * time.Hour
+)
+
+// parseCertsStatus 解析 PEM 证书链中的第一个证书
+func parseCertsStatus(certpem []byte) (v1beta1.CertsStatus, error) {
+	block, _ := pem.Decode(certpem)
+	if block == nil {
+		return v1beta1.CertsStatus{}, fmt.Errorf("no certificate found in pem")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return v1beta1.CertsStatus{}, err
+	}
+	notbefore, notafter := metav1.NewTime(cert.NotBefore), metav1.NewTime(cert.NotAfter)
+	return v1beta1.CertsStatus{
+		SerialNumber: cert.SerialNumber.String(),
+		NotBefore:    &notbefore,
+		NotAfter:     &notafter,
+	}, nil
+}
+
+// setCertsStatus 记录新证书，revokeOld 时吊销之前的证书
+func setCertsStatus(status *v1beta1.CertsStatus, issued v1beta1.CertsStatus, revokeOld bool) {
+	if revokeOld && status.SerialNumber != "" && status.SerialNumber != issued.SerialNumber {
+		status.Revoked = append(status.Revoked, status.SerialNumber)
+	}
+	now := metav1.Now()
+	status.SerialNumber = issued.SerialNumber
+	status.NotBefore = issued.NotBefore
+	status.NotAfter = issued.NotAfter
+	status.LastRotated = &now
+}
+
+// RotateCerts 为边缘集群签发新证书并通过隧道下发给 edge agent，agent 在下次连接时使用新证书
+func (m *EdgeManager) RotateCerts(ctx context.Context, uid string, revokeOld bool) (*v1beta1.EdgeCluster, error) {
+	cluster, err := m.ClusterStore.Get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if !cluster.Status.Tunnel.Connected {
+		return nil, fmt.Errorf("edge cluster %s is not connected", uid)
+	}
+	if cluster.Spec.Register.HubName == "" {
+		return nil, fmt.Errorf("no hub name specified for the edge cluster")
+	}
+	hub, err := m.HubStore.Get(ctx, cluster.Spec.Register.HubName)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := m.gencert(uid, nil, hub)
+	if err != nil {
+		return nil, err
+	}
+	issued, err := parseCertsStatus(certs.Cert)
+	if err != nil {
+		return nil, err
+	}
+	agentaddress := cluster.Status.Manufacture[common.AnnotationKeyEdgeAgentAddress]
+	if agentaddress == "" {
+		agentaddress = common.AnnotationValueDefaultEdgeAgentAddress // fallback
+	}
+	cli := &http.Client{Transport: m.Tunnel.TransportOnTunnel(uid)}
+	if err := doJSON(ctx, cli, http.MethodPut, agentaddress+"/internal/edge/certs", certs); err != nil {
+		return nil, fmt.Errorf("push certificate to edge cluster %s: %w", uid, err)
+	}
+	log.Info("edge certificate rotated", "uid", uid, "serial", issued.SerialNumber, "revokeOld", revokeOld)
+	updated, err := m.ClusterStore.Update(ctx, uid, func(cluster *v1beta1.EdgeCluster) error {
+		setCertsStatus(&cluster.Status.Certs, issued, revokeOld)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if revokeOld {
+		if err := m.SyncRevocations(ctx); err != nil {
+			return updated, err
+		}
+	}
+	return updated, nil
+}
+
+// RevokedSerials 返回所有边缘集群吊销的证书序列号
+func (m *EdgeManager) RevokedSerials(ctx context.Context) ([]string, error) {
+	_, clusters, err := m.ClusterStore.List(ctx, ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	revoked := []string{}
+	for _, cluster := range clusters {
+		revoked = append(revoked, cluster.Status.Certs.Revoked...)
+	}
+	sort.Strings(revoked)
+	return revoked, nil
+}
+
+// SyncRevocations 将吊销的证书序列号同步到所有在线的 edge hub
+func (m *EdgeManager) SyncRevocations(ctx context.Context) error {
+	revoked, err := m.RevokedSerials(ctx)
+	if err != nil {
+		return err
+	}
+	_, hubs, err := m.HubStore.List(ctx, ListOptions{})
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, hub := range hubs {
+		if !hub.Status.Tunnel.Connected {
+			continue
+		}
+		if err := m.syncRevocationsTo(ctx, hub.Name, hub.Status.Manufacture[common.AnnotationKeyEdgeHubAPI], revoked); err != nil {
+			log.Error(err, "sync revocations", "hub", hub.Name)
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("sync revocations to %d hubs failed: %w", len(errs), errs[0])
+	}
+	return nil
+}
+
+func (m *EdgeManager) syncRevocationsTo(ctx context.Context, hubname, apiaddress string, revoked []string) error {
+	if apiaddress == "" {
+		return fmt.Errorf("edge hub %s has no api address", hubname)
+	}
+	cli := &http.Client{
+		Transport: &http.Transport{
+			DialContext: m.Tunnel.DialerOn(hubname).DialContext,
+			// hub api is only reachable through the tunnel
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // nolint: gosec
+		},
+	}
+	defer cli.CloseIdleConnections()
+	return doJSON(ctx, cli, http.MethodPut, apiaddress+"/v1/tunnel/revocations", revoked)
+}
+
+// RunCertRotation 定期续期即将过期的边缘证书，renewBefore 为距离过期的时间
+func (m *EdgeManager) RunCertRotation(ctx context.Context, interval, renewBefore time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultCertRotationInterval
+	}
+	if renewBefore <= 0 {
+		renewBefore = DefaultCertRenewBefore
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			m.renewExpiring(ctx, renewBefore)
+		}
+	}
+}
+
+func (m *EdgeManager) renewExpiring(ctx context.Context, renewBefore time.Duration) {
+	_, clusters, err := m.ClusterStore.List(ctx, ListOptions{})
+	if err != nil {
+		log.Error(err, "list edge clusters")
+		return
+	}
+	deadline := time.Now().Add(renewBefore)
+	for _, cluster := range clusters {
+		notafter := cluster.Status.Certs.NotAfter
+		if !cluster.Status.Tunnel.Connected || notafter == nil || notafter.Time.After(deadline) {
+			continue
+		}
+		// 续期时保留旧证书，避免新证书下发失败导致无法连接
+		if _, err := m.RotateCerts(ctx, cluster.Name, false); err != nil {
+			log.Error(err, "renew edge certificate", "uid", cluster.Name)
+		}
+	}
+}
+
+func doJSON(ctx context.Context, cli *http.Client, method, url string, body any) error {
+	content, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s: %s: %s", method, url, resp.Status, string(msg))
+	}
+	return nil
+}
@@ -27,6 +27,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/cli-runtime/pkg/printers"
+	"k8s.io/client-go/tools/record"
 	"kubegems.io/kubegems/pkg/agent/cluster"
 	"kubegems.io/kubegems/pkg/apis/edge/common"
 	"kubegems.io/kubegems/pkg/apis/edge/v1beta1"
@@ -46,6 +47,8 @@ type EdgeManager struct {
 	SelfAddress  string
 	ClusterStore EdgeClusterStore
 	HubStore     EdgeHubStore
+	Tunnel       *tunnel.TunnelServer // push certificates to edge clusters and revocations to hubs
+	Recorder     record.EventRecorder // record authentication events on edge clusters
 }
 
 func NewClusterManager(ctx context.Context, namespace string, selfhost string) (*EdgeManager, error) {
@@ -74,6 +77,7 @@ func NewClusterManager(ctx context.Context, namespace string, selfhost string) (
 		ClusterStore: EdgeClusterK8sStore{cli: c.GetClient(), ns: namespace},
 		HubStore:     EdgeHubK8sStore{cli: c.GetClient(), ns: namespace},
 		SelfAddress:  selfhost,
+		Recorder:     c.GetEventRecorderFor("kubegems-edge-server"),
 	}, nil
 }
 
@@ -186,17 +190,23 @@ func (m *EdgeManager) RenderInstallManifests(ctx context.Context, uid, token str
 		}
 		edgecerts = generated
 	}
+	issued, err := parseCertsStatus(edgecerts.Cert)
+	if err != nil {
+		return nil, err
+	}
 	// update register status
 	if _, err := m.ClusterStore.Update(ctx, uid, func(cluster *v1beta1.EdgeCluster) error {
 		now := metav1.Now()
 		cluster.Status.Register.LastRegister = &now
 		cluster.Status.Register.LastRegisterToken = token
+		// a re-register replaces the previous certificate
+		setCertsStatus(&cluster.Status.Certs, issued, false)
 		return nil
 	}); err != nil {
 		return nil, err
 	}
 	// render template
-	objects := RenderManifets(uid, exists.Spec.Register.Image, hubaddress, *edgecerts)
+	objects := RenderManifets(uid, token, exists.Spec.Register.Image, hubaddress, *edgecerts)
 	printer := printers.YAMLPrinter{}
 	buf := bytes.NewBuffer(nil)
 	for _, obj := range objects {
@@ -247,6 +257,16 @@ func (m *EdgeManager) OnTunnelConnectedStatusChange(ctx context.Context,
 			return nil
 		}
 		log.Info("set hub tunnel status", "name", name, "connected", connected)
+		if connected {
+			defer func() {
+				// hub keeps revocations in memory, resync after it connected
+				go func() {
+					if err := m.SyncRevocations(ctx); err != nil {
+						log.Error(err, "sync revocations", "hub", name)
+					}
+				}()
+			}()
+		}
 		_, err := m.HubStore.Update(ctx, name, func(cluster *v1beta1.EdgeHub) error {
 			cluster.Status.Tunnel.Connected = connected
 			cluster.Status.Manufacture = anno // annotations as manufacture set
@@ -27,7 +27,7 @@ import (
 const DefaultEdgeAgentImage = "docker.io/kubegems/kubegems-edge-agent:latest"
 
 // nolint: gomnd,funlen
-func RenderManifets(uid string, image string, edgehubaddress string, certs v1beta1.Certs) []client.Object {
+func RenderManifets(uid string, token string, image string, edgehubaddress string, certs v1beta1.Certs) []client.Object {
 	if image == "" {
 		image = DefaultEdgeAgentImage
 	}
@@ -122,6 +122,7 @@ func RenderManifets(uid string, image string, edgehubaddress string, certs v1bet
 				corev1.TLSCertKey:              certs.Cert,
 				corev1.TLSPrivateKeyKey:        certs.Key,
 				corev1.ServiceAccountRootCAKey: certs.CA,
+				"token":                        []byte(token), // bootstrap token, exchanged for a credential on the first connect
 			},
 		},
 		// cluster RBAC
@@ -15,25 +15,38 @@
 package server
 
 import (
+	"time"
+
 	"kubegems.io/kubegems/pkg/edge/tunnel"
+	"kubegems.io/kubegems/pkg/edge/tunnel/debug"
 	"kubegems.io/kubegems/pkg/utils/database"
 	"kubegems.io/kubegems/pkg/utils/system"
 )
 
 type Options struct {
-	Listen     string           `json:"listen,omitempty"`
-	Host       string           `json:"host,omitempty"`
-	ListenGrpc string           `json:"listenGrpc,omitempty"`
-	ServerID   string           `json:"serverID,omitempty"`
-	TLS        *system.TLS      `json:"tls,omitempty"`
-	Database   database.Options `json:"database,omitempty"`
+	Listen               string           `json:"listen,omitempty"`
+	Host                 string           `json:"host,omitempty"`
+	ListenGrpc           string           `json:"listenGrpc,omitempty"`
+	ListenDebug          string           `json:"listenDebug,omitempty" description:"address of tunnel debug api, disabled if debugToken is empty"`
+	DebugToken           string           `json:"debugToken,omitempty" description:"bearer token required by tunnel debug api"`
+	ListenMetrics        string           `json:"listenMetrics,omitempty" description:"address of tunnel metrics"`
+	ServerID             string           `json:"serverID,omitempty"`
+	TLS                  *system.TLS      `json:"tls,omitempty"`
+	Database             database.Options `json:"database,omitempty"`
+	CertRotationInterval time.Duration    `json:"certRotationInterval,omitempty" description:"interval to check expiring edge certificates"`
+	CertRenewBefore      time.Duration    `json:"certRenewBefore,omitempty" description:"renew edge certificates expire within this duration"`
 }
 
 func NewDefaultOptions() *Options {
 	return &Options{
-		Listen:     ":8080",
-		ListenGrpc: ":50052",
-		TLS:        system.NewDefaultTLS(),
-		ServerID:   tunnel.RandomServerID("server-"),
+		Listen:        ":8080",
+		ListenGrpc:    ":50052",
+		ListenDebug:   debug.DefaultListen,
+		ListenMetrics: debug.DefaultListenMetrics,
+		TLS:           system.NewDefaultTLS(),
+		ServerID:      tunnel.RandomServerID("server-"),
+
+		CertRotationInterval: DefaultCertRotationInterval,
+		CertRenewBefore:      DefaultCertRenewBefore,
 	}
 }
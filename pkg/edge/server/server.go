@@ -22,7 +22,9 @@ import (
 	"golang.org/x/sync/errgroup"
 	"kubegems.io/library/rest/api"
 
+	"kubegems.io/kubegems/pkg/apis/edge/common"
 	"kubegems.io/kubegems/pkg/edge/tunnel"
+	"kubegems.io/kubegems/pkg/edge/tunnel/debug"
 	"kubegems.io/kubegems/pkg/log"
 	"kubegems.io/kubegems/pkg/utils/pprof"
 	"kubegems.io/kubegems/pkg/utils/system"
@@ -52,9 +54,15 @@ func NewEdgeServer(ctx context.Context, options *Options) (*EdgeServer, error) {
 	if err != nil {
 		return nil, err
 	}
+	tunserver := tunnel.NewTunnelServer(options.ServerID, nil)
+	edgemanager.Tunnel = tunserver
 	server := &EdgeServer{
 		server: &tunnel.GrpcTunnelServer{
-			TunnelServer: tunnel.NewTunnelServer(options.ServerID, nil),
+			TunnelServer: tunserver,
+			// edge hubs review tokens of edge clusters through the tunnel
+			ClientAnnotations: tunnel.Annotations{
+				common.AnnotationKeyEdgeServerAPI: serverAPIAddress(options),
+			},
 		},
 		tlsConfig: tlsConfig,
 		options:   options,
@@ -63,6 +71,11 @@ func NewEdgeServer(ctx context.Context, options *Options) (*EdgeServer, error) {
 	return server, nil
 }
 
+// serverAPIAddress returns the address edge hubs call server api through the tunnel
+func serverAPIAddress(options *Options) string {
+	return tunnel.LocalAPIAddress(options.Listen, options.Listen == options.ListenGrpc)
+}
+
 func (s *EdgeServer) Run(ctx context.Context) error {
 	ctx = log.NewContext(ctx, log.LogrLogger)
 	eg, ctx := errgroup.WithContext(ctx)
@@ -84,9 +97,18 @@ func (s *EdgeServer) Run(ctx context.Context) error {
 			return system.ListenAndServeContext(ctx, s.options.Listen, nil, s.HTTPAPI())
 		})
 	}
+	eg.Go(func() error {
+		return debug.Run(ctx, s.options.ListenDebug, s.options.DebugToken, s.server.TunnelServer)
+	})
+	eg.Go(func() error {
+		return debug.RunMetrics(ctx, s.options.ListenMetrics, s.server.TunnelServer)
+	})
 	eg.Go(func() error {
 		return s.clusters.SyncTunnelStatusFrom(ctx, s.server.TunnelServer)
 	})
+	eg.Go(func() error {
+		return s.clusters.RunCertRotation(ctx, s.options.CertRotationInterval, s.options.CertRenewBefore)
+	})
 	eg.Go(func() error {
 		return pprof.Run(ctx)
 	})
@@ -17,6 +17,7 @@ package task
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
@@ -47,6 +48,8 @@ const (
 type Reconciler struct {
 	client.Client
 	EdgeClients *EdgeClientsHolder
+	// DriftCheckInterval is the interval to check drift of distributed resources, disabled if zero.
+	DriftCheckInterval time.Duration
 }
 
 // nolint: forcetypeassert
@@ -98,8 +101,12 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 	_ = r.Status().Update(ctx, edgeTask)
 	if err != nil {
 		log.Error(err, "apply edge task")
+		return ctrl.Result{}, err
+	}
+	if r.DriftCheckInterval > 0 && edgeTask.Status.Phase != edgev1beta1.EdgeTaskPhaseQueued {
+		return ctrl.Result{RequeueAfter: r.DriftCheckInterval}, nil
 	}
-	return ctrl.Result{}, err
+	return ctrl.Result{}, nil
 }
 
 func (r *Reconciler) remove(ctx context.Context, edgeTask *edgev1beta1.EdgeTask) error {
@@ -162,6 +169,10 @@ func (r *Reconciler) apply(ctx context.Context, edgeTask *edgev1beta1.EdgeTask)
 	}
 	// wait for the edge cluster to be online
 	if donext, err := r.stageWaitForEdgeCluster(ctx, edgeTask); !donext {
+		// queued until the edge cluster connected, resources applied already keep running on the edge
+		if err == nil && edgeTask.Status.Phase != edgev1beta1.EdgeTaskPhaseRunning {
+			edgeTask.Status.Phase = edgev1beta1.EdgeTaskPhaseQueued
+		}
 		return err
 	}
 	// stage apply resources
@@ -172,7 +183,8 @@ func (r *Reconciler) apply(ctx context.Context, edgeTask *edgev1beta1.EdgeTask)
 	if err := r.stageCheckResource(ctx, edgeTask); err != nil {
 		return err
 	}
-	return nil
+	// check resources changed on the edge
+	return r.stageCheckDrift(ctx, edgeTask)
 }
 
 func (r *Reconciler) stageRenderResources(ctx context.Context, edgeTask *edgev1beta1.EdgeTask) ([]*unstructured.Unstructured, bool, error) {
@@ -217,13 +229,18 @@ func (r *Reconciler) stageWaitForEdgeCluster(ctx context.Context, edgeTask *edge
 		log.Error(err, "get edge cluster")
 		return false, err
 	}
-	if edgeCluster.Status.Phase != edgev1beta1.EdgePhaseOnline {
+	online := edgeCluster.Status.Phase == edgev1beta1.EdgePhaseOnline
+	// tunnel events arrive earlier than the edge cluster status
+	if connected, known := r.EdgeClients.Connected(edgeclustername); known {
+		online = connected
+	}
+	if !online {
 		log.Info("edge cluster is not online", "edgecluster", edgeCluster.Name, "phase", edgeCluster.Status.Phase)
 		UpdateEdgeTaskCondition(edgeTask, edgev1beta1.EdgeTaskCondition{
 			Type:    edgev1beta1.EdgeTaskConditionTypeOnline,
 			Status:  corev1.ConditionFalse,
 			Reason:  "EdgeClusterNotOnline",
-			Message: "edge cluster is not online",
+			Message: "edge cluster is not online, queued until connected",
 		})
 		// invalid edge cluster cache to rebuild cache on reconnected
 		r.EdgeClients.Invalid(edgeclustername)
@@ -0,0 +1,286 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package task
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/exp/maps"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	edgev1beta1 "kubegems.io/kubegems/pkg/apis/edge/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// stageCheckDrift 检查边缘集群上的资源是否与下发的资源一致，根据 DriftPolicy 报告或者重新下发
+func (r *Reconciler) stageCheckDrift(ctx context.Context, task *edgev1beta1.EdgeTask) error {
+	log := logr.FromContextOrDiscard(ctx)
+	log.V(5).Info("check drift")
+	// render again, the applied resources were updated by the apply response
+	resources, err := ParseResources(task.Spec.Resources)
+	if err != nil {
+		return fmt.Errorf("parse resources: %w", err)
+	}
+	if HashResources(resources) != task.Status.ResourcesHash {
+		// not distributed yet
+		return nil
+	}
+	for _, resource := range resources {
+		InjectEdgeTask(resource, task)
+	}
+	cli, err := r.EdgeClients.Get(task.Spec.EdgeClusterName)
+	if err != nil {
+		return fmt.Errorf("get edge client: %w", err)
+	}
+	drifted := []string{}
+	for _, desired := range resources {
+		diffs, err := r.driftOf(ctx, cli, desired)
+		if err != nil {
+			log.Error(err, "check drift", "kind", desired.GetKind(), "name", desired.GetName())
+			return nil // do not requeue on cache error
+		}
+		if len(diffs) > 0 {
+			drifted = append(drifted, fmt.Sprintf("%s/%s: %s", desired.GetKind(), desired.GetName(), strings.Join(diffs, ",")))
+		}
+	}
+	if len(drifted) == 0 {
+		UpdateEdgeTaskCondition(task, edgev1beta1.EdgeTaskCondition{
+			Type:   edgev1beta1.EdgeTaskConditionTypeDrifted,
+			Status: corev1.ConditionFalse,
+			Reason: "NoDrift",
+		})
+		return nil
+	}
+	message := strings.Join(drifted, "; ")
+	if task.Spec.DriftPolicy != edgev1beta1.EdgeTaskDriftPolicyHeal {
+		log.Info("resources drifted", "drifted", message)
+		UpdateEdgeTaskCondition(task, edgev1beta1.EdgeTaskCondition{
+			Type:    edgev1beta1.EdgeTaskConditionTypeDrifted,
+			Status:  corev1.ConditionTrue,
+			Reason:  "ResourcesDrifted",
+			Message: message,
+		})
+		return nil
+	}
+	log.Info("resources drifted, re-apply resources", "drifted", message)
+	resourceStatus, err := r.applyResources(ctx, task, resources)
+	task.Status.ResourcesStatus = resourceStatus
+	if err != nil {
+		UpdateEdgeTaskCondition(task, edgev1beta1.EdgeTaskCondition{
+			Type:    edgev1beta1.EdgeTaskConditionTypeDrifted,
+			Status:  corev1.ConditionTrue,
+			Reason:  "HealFailed",
+			Message: fmt.Sprintf("%s: %v", message, err),
+		})
+		return fmt.Errorf("heal drifted resources: %w", err)
+	}
+	UpdateEdgeTaskCondition(task, edgev1beta1.EdgeTaskCondition{
+		Type:    edgev1beta1.EdgeTaskConditionTypeDrifted,
+		Status:  corev1.ConditionFalse,
+		Reason:  "DriftHealed",
+		Message: message,
+	})
+	return nil
+}
+
+// driftOf 返回边缘集群上的对象与期望对象不一致的字段
+func (r *Reconciler) driftOf(ctx context.Context, cli client.Client, desired *unstructured.Unstructured) ([]string, error) {
+	status := &edgev1beta1.EdgeTaskResourceStatus{
+		APIVersion: desired.GetAPIVersion(),
+		Kind:       desired.GetKind(),
+	}
+	live := newObjFrom(status)
+	if err := cli.Get(ctx, client.ObjectKeyFromObject(desired), live); err != nil {
+		if apierrors.IsNotFound(err) {
+			return []string{"not found"}, nil
+		}
+		return nil, err
+	}
+	livecontent, err := runtime.DefaultUnstructuredConverter.ToUnstructured(live)
+	if err != nil {
+		return nil, err
+	}
+	return DriftedFields(desired.Object, livecontent), nil
+}
+
+// DriftedFields 比较期望对象中设置的字段，忽略 status 以及由 apiserver 维护的 metadata 字段。
+// 仅比较期望对象中存在的字段，避免 apiserver 填充的默认值被认为是变更。
+func DriftedFields(desired, live map[string]any) []string {
+	diffs := []string{}
+	for key, val := range withoutWriteOnlyFields(desired) {
+		switch key {
+		case "apiVersion", "kind", "status":
+			continue
+		case "metadata":
+			desiredmeta, _ := val.(map[string]any)
+			livemeta, _ := live[key].(map[string]any)
+			for _, field := range []string{"labels", "annotations"} {
+				if want, ok := desiredmeta[field]; ok {
+					diffs = append(diffs, driftedFields("metadata."+field, want, livemeta[field])...)
+				}
+			}
+		default:
+			diffs = append(diffs, driftedFields(key, val, live[key])...)
+		}
+	}
+	sort.Strings(diffs)
+	return diffs
+}
+
+// withoutWriteOnlyFields 将只写的字段转换为 apiserver 返回的字段，Secret 的 stringData 由 apiserver 合并至 data
+func withoutWriteOnlyFields(desired map[string]any) map[string]any {
+	if desired["apiVersion"] != "v1" || desired["kind"] != "Secret" {
+		return desired
+	}
+	stringdata, ok := desired["stringData"].(map[string]any)
+	if !ok {
+		return desired
+	}
+	converted := maps.Clone(desired)
+	delete(converted, "stringData")
+	data := map[string]any{}
+	if existing, ok := desired["data"].(map[string]any); ok {
+		maps.Copy(data, existing)
+	}
+	// stringData takes precedence over data
+	for key, val := range stringdata {
+		data[key] = base64.StdEncoding.EncodeToString([]byte(fmt.Sprint(val)))
+	}
+	converted["data"] = data
+	return converted
+}
+
+func driftedFields(path string, desired, live any) []string {
+	switch want := desired.(type) {
+	case map[string]any:
+		got, ok := live.(map[string]any)
+		if !ok {
+			if len(want) == 0 && live == nil {
+				return nil
+			}
+			return []string{path}
+		}
+		diffs := []string{}
+		for key, val := range want {
+			diffs = append(diffs, driftedFields(path+"."+key, val, got[key])...)
+		}
+		return diffs
+	case []any:
+		got, ok := live.([]any)
+		if !ok {
+			if len(want) == 0 && live == nil {
+				return nil
+			}
+			return []string{path}
+		}
+		if len(want) != len(got) {
+			return []string{path}
+		}
+		diffs := []string{}
+		for i := range want {
+			diffs = append(diffs, driftedFields(path+"["+strconv.Itoa(i)+"]", want[i], got[i])...)
+		}
+		return diffs
+	default:
+		if !scalarEqual(desired, live, isQuantityField(path)) {
+			return []string{path}
+		}
+		return nil
+	}
+}
+
+// quantityFieldParents 值为 resource.Quantity 的 map 字段，例如 resources.limits、ResourceQuota 的 spec.hard
+var quantityFieldParents = map[string]bool{
+	"requests": true, "limits": true, "hard": true, "used": true, "capacity": true, "allocatable": true,
+	"overhead": true, "max": true, "min": true, "default": true, "defaultRequest": true,
+}
+
+// isQuantityField 判断路径对应的字段是否为 resource.Quantity
+func isQuantityField(path string) bool {
+	parts := strings.Split(path, ".")
+	if parts[len(parts)-1] == "sizeLimit" {
+		return true
+	}
+	if len(parts) < 2 {
+		return false
+	}
+	// list items such as spec.limits[0] of LimitRange are not quantities
+	return quantityFieldParents[parts[len(parts)-2]]
+}
+
+// scalarEqual 比较类型以及值，仅 quantity 字段比较规范化后的数量
+func scalarEqual(desired, live any, quantity bool) bool {
+	if reflect.DeepEqual(desired, live) {
+		return true
+	}
+	if desired == nil {
+		return false
+	}
+	// quantities are normalized by apiserver, e.g. 0.5 -> 500m
+	if quantity {
+		if a, ok := toQuantity(desired); ok {
+			if b, ok := toQuantity(live); ok {
+				return a.Cmp(b) == 0
+			}
+		}
+		return false
+	}
+	// numbers decoded from yaml and converted from typed objects have different go types
+	if a, ok := toFloat(desired); ok {
+		if b, ok := toFloat(live); ok {
+			return a == b
+		}
+	}
+	return false
+}
+
+func toFloat(val any) (float64, bool) {
+	switch v := val.(type) {
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+func toQuantity(val any) (resource.Quantity, bool) {
+	switch v := val.(type) {
+	case string:
+		q, err := resource.ParseQuantity(v)
+		return q, err == nil
+	default:
+		if f, ok := toFloat(val); ok {
+			q, err := resource.ParseQuantity(strconv.FormatFloat(f, 'f', -1, 64))
+			return q, err == nil
+		}
+		return resource.Quantity{}, false
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package task
+
+import (
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/yaml"
+)
+
+const driftDesired = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: default
+  labels:
+    app: demo
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: app
+        image: nginx:1.25
+        resources:
+          limits:
+            cpu: "0.5"
+`
+
+func TestDriftedFields(t *testing.T) {
+	desired := map[string]any{}
+	if err := yaml.Unmarshal([]byte(driftDesired), &desired); err != nil {
+		t.Fatal(err)
+	}
+	// live object with apiserver defaults and metadata
+	newLive := func(mutate func(deploy *appsv1.Deployment)) map[string]any {
+		deploy := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "app",
+				Namespace:       "default",
+				Labels:          map[string]string{"app": "demo"},
+				Annotations:     map[string]string{"deployment.kubernetes.io/revision": "1"},
+				ResourceVersion: "100",
+			},
+			Spec: appsv1.DeploymentSpec{
+				Replicas:             pointer.Int32(2),
+				RevisionHistoryLimit: pointer.Int32(10),
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{
+							Name:            "app",
+							Image:           "nginx:1.25",
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							Resources: corev1.ResourceRequirements{
+								Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+							},
+						}},
+						RestartPolicy: corev1.RestartPolicyAlways,
+					},
+				},
+			},
+			Status: appsv1.DeploymentStatus{Replicas: 1},
+		}
+		if mutate != nil {
+			mutate(deploy)
+		}
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(deploy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return content
+	}
+
+	tests := []struct {
+		name string
+		live map[string]any
+		want []string
+	}{
+		{name: "no drift", live: newLive(nil), want: []string{}},
+		{
+			name: "replicas scaled",
+			live: newLive(func(deploy *appsv1.Deployment) { deploy.Spec.Replicas = pointer.Int32(0) }),
+			want: []string{"spec.replicas"},
+		},
+		{
+			name: "image changed",
+			live: newLive(func(deploy *appsv1.Deployment) { deploy.Spec.Template.Spec.Containers[0].Image = "nginx:latest" }),
+			want: []string{"spec.template.spec.containers[0].image"},
+		},
+		{
+			name: "cpu limit changed",
+			live: newLive(func(deploy *appsv1.Deployment) {
+				deploy.Spec.Template.Spec.Containers[0].Resources.Limits[corev1.ResourceCPU] = resource.MustParse("1")
+			}),
+			want: []string{"spec.template.spec.containers[0].resources.limits.cpu"},
+		},
+		{
+			name: "label removed",
+			live: newLive(func(deploy *appsv1.Deployment) { deploy.Labels = nil }),
+			want: []string{"metadata.labels"},
+		},
+		{
+			name: "container added",
+			live: newLive(func(deploy *appsv1.Deployment) {
+				deploy.Spec.Template.Spec.Containers = append(deploy.Spec.Template.Spec.Containers, corev1.Container{Name: "sidecar"})
+			}),
+			want: []string{"spec.template.spec.containers"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DriftedFields(desired, tt.live); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DriftedFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDriftedFields_secret(t *testing.T) {
+	desired := map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]any{"name": "app"},
+		"data":       map[string]any{"token": "b2xk"},
+		"stringData": map[string]any{"password": "secret", "token": "new"},
+	}
+	newLive := func(data map[string][]byte) map[string]any {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", ResourceVersion: "100"},
+			Data:       data,
+			Type:       corev1.SecretTypeOpaque,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return content
+	}
+	tests := []struct {
+		name string
+		live map[string]any
+		want []string
+	}{
+		{name: "no drift", live: newLive(map[string][]byte{"password": []byte("secret"), "token": []byte("new")}), want: []string{}},
+		{name: "data changed", live: newLive(map[string][]byte{"password": []byte("changed"), "token": []byte("new")}), want: []string{"data.password"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DriftedFields(desired, tt.live); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DriftedFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_scalarEqual(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		desired any
+		live    any
+		want    bool
+	}{
+		{name: "same string", path: "spec.image", desired: "nginx:1.0", live: "nginx:1.0", want: true},
+		{name: "image tag not quantity", path: "metadata.labels.version", desired: "1.0", live: "1", want: false},
+		{name: "string and number", path: "data.count", desired: "1", live: int64(1), want: false},
+		{name: "string and bool", path: "data.enabled", desired: "true", live: true, want: false},
+		{name: "numbers", path: "spec.replicas", desired: float64(2), live: int64(2), want: true},
+		{name: "normalized quantity", path: "resources.limits.cpu", desired: "0.5", live: "500m", want: true},
+		{name: "number quantity", path: "resources.requests.memory", desired: int64(1024), live: "1Ki", want: true},
+		{name: "different quantity", path: "spec.hard.pods", desired: "10", live: "1", want: false},
+		{name: "size limit", path: "spec.volumes[0].emptyDir.sizeLimit", desired: "1Gi", live: "1024Mi", want: true},
+		{name: "list item not quantity", path: "spec.limits[0].type", desired: "Container", live: "Pod", want: false},
+		{name: "nil live", path: "spec.replicas", desired: int64(1), live: nil, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scalarEqual(tt.desired, tt.live, isQuantityField(tt.path)); got != tt.want {
+				t.Errorf("scalarEqual() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -19,11 +19,14 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
+	edgev1beta1 "kubegems.io/kubegems/pkg/apis/edge/v1beta1"
 	edgeclient "kubegems.io/kubegems/pkg/edge/client"
+	"kubegems.io/kubegems/pkg/edge/tunnel"
 	"kubegems.io/kubegems/pkg/utils/kube"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -32,7 +35,10 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
-const DefaultEdgeResourceQueueSize = 1024
+const (
+	DefaultEdgeResourceQueueSize    = 1024
+	DefaultTunnelWatchRetryInterval = 5 * time.Second
+)
 
 type EdgeClusterResourceChangedCallback func(uid string, obj client.Object)
 
@@ -43,6 +49,10 @@ type EdgeClientsHolder struct {
 	events  chan EdgeClusterEvent
 	clients map[string]clientWithCancel
 	mu      sync.RWMutex
+
+	// tunnel connected status of edge clusters from edge server tunnel events
+	connected map[string]bool
+	connmu    sync.RWMutex
 }
 
 type clientWithCancel struct {
@@ -61,13 +71,83 @@ func NewEdgeClientsHolder(ctx context.Context, server string) (*EdgeClientsHolde
 		return nil, fmt.Errorf("scheme is required in edge server address")
 	}
 	return &EdgeClientsHolder{
-		basectx: ctx,
-		server:  server,
-		clients: map[string]clientWithCancel{},
-		events:  make(chan EdgeClusterEvent, DefaultEdgeResourceQueueSize),
+		basectx:   ctx,
+		server:    server,
+		clients:   map[string]clientWithCancel{},
+		events:    make(chan EdgeClusterEvent, DefaultEdgeResourceQueueSize),
+		connected: map[string]bool{},
 	}, nil
 }
 
+// Connected 返回边缘集群的隧道连接状态，known 为 false 时表示尚未收到该集群的隧道事件
+func (c *EdgeClientsHolder) Connected(uid string) (connected bool, known bool) {
+	c.connmu.RLock()
+	defer c.connmu.RUnlock()
+	connected, known = c.connected[uid]
+	return connected, known
+}
+
+// WatchTunnel 订阅 edge server 的隧道事件，边缘集群重新连接时触发排队中的任务
+func (c *EdgeClientsHolder) WatchTunnel(ctx context.Context, cli client.Client) error {
+	log := logr.FromContextOrDiscard(ctx)
+	for {
+		err := edgeclient.WatchTunnelEvents(ctx, c.server, func(event tunnel.TunnelEvent) {
+			c.onTunnelEvent(ctx, cli, event)
+		})
+		// status is unknown until the initial event of next watch
+		c.connmu.Lock()
+		c.connected = map[string]bool{}
+		c.connmu.Unlock()
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Error(err, "watch tunnel events, retrying")
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(DefaultTunnelWatchRetryInterval):
+		}
+	}
+}
+
+func (c *EdgeClientsHolder) onTunnelEvent(ctx context.Context, cli client.Client, event tunnel.TunnelEvent) {
+	connected := event.Kind != tunnel.EventKindDisConnected
+	for uid := range event.Peers {
+		c.connmu.Lock()
+		previous := c.connected[uid]
+		c.connected[uid] = connected
+		c.connmu.Unlock()
+		if !connected {
+			// rebuild client cache on reconnected
+			c.Invalid(uid)
+			continue
+		}
+		if !previous {
+			c.enqueueQueuedTasks(ctx, cli, uid)
+		}
+	}
+}
+
+// enqueueQueuedTasks 触发边缘集群上所有未完成的任务
+func (c *EdgeClientsHolder) enqueueQueuedTasks(ctx context.Context, cli client.Client, uid string) {
+	log := logr.FromContextOrDiscard(ctx)
+	tasks := &edgev1beta1.EdgeTaskList{}
+	if err := cli.List(ctx, tasks, client.MatchingFields{IndexFieldEdgeTaskSpecEdgeClusterName: uid}); err != nil {
+		log.Error(err, "list edge tasks", "uid", uid)
+		return
+	}
+	for _, task := range tasks.Items {
+		if task.Status.Phase == edgev1beta1.EdgeTaskPhaseRunning {
+			continue
+		}
+		select {
+		case c.events <- EdgeClusterEvent{UID: uid, TaskName: task.Name, TaskNamespace: task.Namespace}:
+		default:
+			log.Info("edge resource event queue is full, drop event", "uid", uid, "task", task.Name)
+		}
+	}
+}
+
 func (c *EdgeClientsHolder) Invalid(uid string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
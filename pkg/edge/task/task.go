@@ -16,6 +16,7 @@ package task
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -24,8 +25,11 @@ import (
 	"kubegems.io/kubegems/pkg/log"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
+const DefaultDriftCheckInterval = 5 * time.Minute
+
 func getScheme() *runtime.Scheme {
 	scheme := runtime.NewScheme()
 	edgev1beta1.AddToScheme(scheme)
@@ -33,11 +37,12 @@ func getScheme() *runtime.Scheme {
 }
 
 type Options struct {
-	MaxConcurrentReconciles int    `json:"maxConcurrentReconciles,omitempty"`
-	HealthProbeBindAddress  string `json:"healthProbeBindAddress,omitempty"`
-	MetricsBindAddress      string `json:"metricsBindAddress,omitempty"`
-	EdgeServerAddr          string `json:"edgeServerAddr,omitempty"`
-	EdgeNamespace           string `json:"edgeNamespace,omitempty"`
+	MaxConcurrentReconciles int           `json:"maxConcurrentReconciles,omitempty"`
+	HealthProbeBindAddress  string        `json:"healthProbeBindAddress,omitempty"`
+	MetricsBindAddress      string        `json:"metricsBindAddress,omitempty"`
+	EdgeServerAddr          string        `json:"edgeServerAddr,omitempty"`
+	EdgeNamespace           string        `json:"edgeNamespace,omitempty"`
+	DriftCheckInterval      time.Duration `json:"driftCheckInterval,omitempty" description:"interval to check resources changed on edge clusters, 0 to disable"`
 }
 
 func NewDefaultOptions() *Options {
@@ -47,6 +52,7 @@ func NewDefaultOptions() *Options {
 		EdgeNamespace:           "", // empty means all namespaces
 		HealthProbeBindAddress:  ":8080",
 		MetricsBindAddress:      ":9100",
+		DriftCheckInterval:      DefaultDriftCheckInterval,
 	}
 }
 
@@ -75,12 +81,23 @@ func Run(ctx context.Context, options *Options) error {
 		return err
 	}
 	r := &Reconciler{
-		Client:      mgr.GetClient(),
-		EdgeClients: holder,
+		Client:             mgr.GetClient(),
+		EdgeClients:        holder,
+		DriftCheckInterval: options.DriftCheckInterval,
 	}
 	if err := r.SetupWithManager(ctx, mgr, options); err != nil {
 		log.Error(err, "unable to create controller", "controller", "EdgeTask")
 	}
+	if err := (&TaskSetReconciler{Client: mgr.GetClient()}).SetupWithManager(ctx, mgr, options); err != nil {
+		log.Error(err, "unable to create controller", "controller", "EdgeTaskSet")
+	}
+	// resume queued tasks on edge clusters reconnected
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		return holder.WatchTunnel(logr.NewContext(ctx, log.WithName("tunnel")), mgr.GetClient())
+	})); err != nil {
+		log.Error(err, "unable to watch tunnel events")
+		return err
+	}
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		log.Error(err, "unable to set up health check")
 		return err
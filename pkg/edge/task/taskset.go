@@ -0,0 +1,386 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	edgev1beta1 "kubegems.io/kubegems/pkg/apis/edge/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	LabelEdgeTaskSet                = "edge.kubegems.io/edge-task-set"
+	AnnotationEdgeTaskSetRolloutAt  = "edge.kubegems.io/rollout-at"
+	DefaultProgressDeadlineSeconds  = 600
+	DefaultEdgeTaskSetRequeuePeriod = 30 * time.Second
+)
+
+// ErrEdgeTaskNotOwned 边缘集群同名的 EdgeTask 已经存在但不属于该 EdgeTaskSet，不覆盖用户创建的 EdgeTask
+var ErrEdgeTaskNotOwned = errors.New("edge task already exists and is not owned by the edge task set")
+
+// TaskSetReconciler 为 EdgeTaskSet 选中的每个边缘集群创建 EdgeTask 并分批更新，
+// 资源的下发以及状态检查由 EdgeTask 的 Reconciler 完成。
+type TaskSetReconciler struct {
+	client.Client
+}
+
+func (r *TaskSetReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager, options *Options) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&edgev1beta1.EdgeTaskSet{}).
+		Owns(&edgev1beta1.EdgeTask{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: options.MaxConcurrentReconciles}).
+		Watches(&source.Kind{Type: &edgev1beta1.EdgeCluster{}}, TaskSetEdgeClusterTrigger(ctx, mgr.GetClient())).
+		Complete(r)
+}
+
+// TaskSetEdgeClusterTrigger 边缘集群变化（标签以及在线状态）时触发同一命名空间下的 EdgeTaskSet
+func TaskSetEdgeClusterTrigger(ctx context.Context, cli client.Client) handler.EventHandler {
+	log := logr.FromContextOrDiscard(ctx)
+	return handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+		sets := &edgev1beta1.EdgeTaskSetList{}
+		if err := cli.List(ctx, sets, client.InNamespace(obj.GetNamespace())); err != nil {
+			log.Error(err, "list edge task sets")
+			return nil
+		}
+		requests := make([]reconcile.Request, 0, len(sets.Items))
+		for _, item := range sets.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&item)})
+		}
+		return requests
+	})
+}
+
+func (r *TaskSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := logr.FromContextOrDiscard(ctx).WithValues("edgetaskset", req.Name, "namespace", req.Namespace)
+	ctx = logr.NewContext(ctx, log)
+
+	taskset := &edgev1beta1.EdgeTaskSet{}
+	if err := r.Get(ctx, req.NamespacedName, taskset); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	// edge tasks are removed by garbage collector and cleanup resources in their finalizer
+	if taskset.GetDeletionTimestamp() != nil {
+		return ctrl.Result{}, nil
+	}
+	err := r.sync(ctx, taskset)
+	if updateErr := r.Status().Update(ctx, taskset); updateErr != nil && err == nil {
+		err = updateErr
+	}
+	if err != nil {
+		log.Error(err, "sync edge task set")
+		return ctrl.Result{}, err
+	}
+	if taskset.Status.Phase == edgev1beta1.EdgeTaskSetPhaseProgressing {
+		// check progress deadline of updated edge clusters
+		return ctrl.Result{RequeueAfter: DefaultEdgeTaskSetRequeuePeriod}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+func (r *TaskSetReconciler) sync(ctx context.Context, taskset *edgev1beta1.EdgeTaskSet) error {
+	log := logr.FromContextOrDiscard(ctx)
+	taskset.Status.ObservedGeneration = taskset.Generation
+	taskset.Status.ResourcesHash = HashResources(taskset.Spec.Resources)
+
+	clusters, err := r.selectEdgeClusters(ctx, taskset)
+	if err != nil {
+		taskset.Status.Message = err.Error()
+		return err
+	}
+	tasks := &edgev1beta1.EdgeTaskList{}
+	if err := r.List(ctx, tasks, client.InNamespace(taskset.Namespace), client.MatchingLabels{LabelEdgeTaskSet: taskset.Name}); err != nil {
+		return err
+	}
+	taskOfCluster := map[string]*edgev1beta1.EdgeTask{}
+	for i := range tasks.Items {
+		task := &tasks.Items[i]
+		if !metav1.IsControlledBy(task, taskset) {
+			continue
+		}
+		if _, selected := clusters[task.Spec.EdgeClusterName]; !selected {
+			// edge cluster no longer selected, remove its resources
+			log.Info("remove edge task of unselected edge cluster", "edgetask", task.Name, "edgecluster", task.Spec.EdgeClusterName)
+			if err := r.Delete(ctx, task); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			continue
+		}
+		taskOfCluster[task.Spec.EdgeClusterName] = task
+	}
+
+	deadline := time.Duration(taskset.Spec.Rollout.ProgressDeadlineSeconds) * time.Second
+	if deadline == 0 {
+		deadline = DefaultProgressDeadlineSeconds * time.Second
+	}
+	statuses := make([]edgev1beta1.EdgeTaskSetClusterStatus, 0, len(clusters))
+	for name, cluster := range clusters {
+		status := edgeTaskSetClusterStatus(cluster, taskOfCluster[name], taskset.Status.ResourcesHash, deadline, time.Now())
+		if taskOfCluster[name] == nil {
+			// an edge task with the same name created by others pauses the rollout
+			if err := r.checkEdgeTaskOwner(ctx, taskset, name); errors.Is(err, ErrEdgeTaskNotOwned) {
+				status.Failed, status.Message = true, err.Error()
+			} else if err != nil {
+				return err
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+
+	plan := planRollout(statuses, taskset.Spec.Rollout)
+	for _, i := range plan.Next {
+		status := &statuses[i]
+		log.Info("rollout edge task", "edgecluster", status.Name)
+		task, err := r.applyEdgeTask(ctx, taskset, status.Name)
+		if err != nil {
+			status.Message = err.Error()
+			return err
+		}
+		status.Task, status.Updated, status.Ready, status.Phase, status.Message = task.Name, true, false, "", ""
+	}
+	setTaskSetStatus(&taskset.Status, statuses, plan)
+	return nil
+}
+
+func (r *TaskSetReconciler) selectEdgeClusters(ctx context.Context, taskset *edgev1beta1.EdgeTaskSet) (map[string]*edgev1beta1.EdgeCluster, error) {
+	selector := &metav1.LabelSelector{}
+	if taskset.Spec.Selector != nil {
+		selector = taskset.Spec.Selector
+	}
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector: %w", err)
+	}
+	list := &edgev1beta1.EdgeClusterList{}
+	if err := r.List(ctx, list, client.InNamespace(taskset.Namespace), client.MatchingLabelsSelector{Selector: sel}); err != nil {
+		return nil, err
+	}
+	clusters := make(map[string]*edgev1beta1.EdgeCluster, len(list.Items))
+	for i := range list.Items {
+		if list.Items[i].GetDeletionTimestamp() != nil {
+			continue
+		}
+		clusters[list.Items[i].Name] = &list.Items[i]
+	}
+	return clusters, nil
+}
+
+func edgeTaskName(taskset *edgev1beta1.EdgeTaskSet, clustername string) string {
+	return taskset.Name + "-" + clustername
+}
+
+// checkEdgeTaskOwner 边缘集群同名的 EdgeTask 存在并且不属于 taskset 时返回 ErrEdgeTaskNotOwned
+func (r *TaskSetReconciler) checkEdgeTaskOwner(ctx context.Context, taskset *edgev1beta1.EdgeTaskSet, clustername string) error {
+	task := &edgev1beta1.EdgeTask{}
+	key := client.ObjectKey{Namespace: taskset.Namespace, Name: edgeTaskName(taskset, clustername)}
+	if err := r.Get(ctx, key, task); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(task, taskset) {
+		return fmt.Errorf("%w: %s", ErrEdgeTaskNotOwned, task.Name)
+	}
+	return nil
+}
+
+// applyEdgeTask 创建或者更新边缘集群的 EdgeTask 为当前的资源，不更新不属于 taskset 的 EdgeTask
+func (r *TaskSetReconciler) applyEdgeTask(ctx context.Context, taskset *edgev1beta1.EdgeTaskSet, clustername string) (*edgev1beta1.EdgeTask, error) {
+	task := &edgev1beta1.EdgeTask{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      edgeTaskName(taskset, clustername),
+			Namespace: taskset.Namespace,
+		},
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, task, func() error {
+		if task.ResourceVersion != "" && !metav1.IsControlledBy(task, taskset) {
+			return fmt.Errorf("%w: %s", ErrEdgeTaskNotOwned, task.Name)
+		}
+		if task.Labels == nil {
+			task.Labels = map[string]string{}
+		}
+		task.Labels[LabelEdgeTaskSet] = taskset.Name
+		if task.Annotations == nil {
+			task.Annotations = map[string]string{}
+		}
+		task.Annotations[AnnotationEdgeTaskResourcesHash] = taskset.Status.ResourcesHash
+		task.Annotations[AnnotationEdgeTaskSetRolloutAt] = time.Now().Format(time.RFC3339)
+		task.Spec.EdgeClusterName = clustername
+		task.Spec.Resources = taskset.Spec.Resources
+		task.Spec.DriftPolicy = taskset.Spec.DriftPolicy
+		return controllerutil.SetControllerReference(taskset, task, r.Scheme())
+	})
+	return task, err
+}
+
+// edgeTaskSetClusterStatus 根据 EdgeTask 的状态计算边缘集群的更新状态
+func edgeTaskSetClusterStatus(
+	cluster *edgev1beta1.EdgeCluster, task *edgev1beta1.EdgeTask,
+	hash string, deadline time.Duration, now time.Time,
+) edgev1beta1.EdgeTaskSetClusterStatus {
+	status := edgev1beta1.EdgeTaskSetClusterStatus{Name: cluster.Name}
+	if task == nil {
+		return status
+	}
+	status.Task = task.Name
+	status.Phase = task.Status.Phase
+	status.Updated = task.Annotations[AnnotationEdgeTaskResourcesHash] == hash
+	if !status.Updated {
+		return status
+	}
+	message, failed := edgeTaskProgress(task)
+	status.Message, status.Failed = message, failed
+	if failed {
+		return status
+	}
+	if message == "" {
+		status.Ready = true
+		return status
+	}
+	if cluster.Status.Phase != edgev1beta1.EdgePhaseOnline {
+		// offline edge clusters are neither unavailable nor failed, the edge task is queued until reconnected
+		status.Offline = true
+		status.Message = "edge cluster is not online, " + message
+		return status
+	}
+	// clusters reconnected after the rollout have the deadline since they are online
+	since, err := time.Parse(time.RFC3339, task.Annotations[AnnotationEdgeTaskSetRolloutAt])
+	if err != nil {
+		return status
+	}
+	if online := cluster.Status.Tunnel.LastOnlineTimestamp; online != nil && online.Time.After(since) {
+		since = online.Time
+	}
+	if now.Sub(since) > deadline {
+		status.Failed = true
+		status.Message = fmt.Sprintf("progress deadline exceeded, %s", message)
+	}
+	return status
+}
+
+// edgeTaskProgress 返回 EdgeTask 未就绪的原因以及是否失败，就绪时返回空
+func edgeTaskProgress(task *edgev1beta1.EdgeTask) (string, bool) {
+	// the edge task status is reset when spec changed
+	if task.Status.ObservedGeneration != task.Generation {
+		return "waiting for edge task reconcile", false
+	}
+	for _, condtype := range []edgev1beta1.EdgeTaskConditionType{
+		edgev1beta1.EdgeTaskConditionTypePrepared,
+		edgev1beta1.EdgeTaskConditionTypeDistributed,
+	} {
+		if _, cond := GetEdgeTaskCondition(&task.Status, condtype); cond != nil && cond.Status == corev1.ConditionFalse {
+			return fmt.Sprintf("%s: %s", cond.Reason, cond.Message), true
+		}
+	}
+	notready := []string{}
+	for _, resource := range task.Status.ResourcesStatus {
+		if !resource.Ready {
+			notready = append(notready, resource.Kind+"/"+resource.Name)
+		}
+	}
+	if len(notready) > 0 {
+		return "resources not ready: " + strings.Join(notready, ","), false
+	}
+	if task.Status.Phase != edgev1beta1.EdgeTaskPhaseRunning {
+		return "waiting for resources distributed", false
+	}
+	return "", false
+}
+
+type rolloutPlan struct {
+	Next    []int // index of edge clusters to update
+	Phase   edgev1beta1.EdgeTaskSetPhase
+	Message string
+}
+
+// planRollout 计算下一批需要更新的边缘集群
+// 存在失败的边缘集群时暂停；已更新但未就绪的在线边缘集群数量不超过 MaxUnavailable 时开始下一批，
+// 离线的边缘集群在重新连接后应用资源，不计入不可用数量。
+func planRollout(clusters []edgev1beta1.EdgeTaskSetClusterStatus, rollout edgev1beta1.EdgeTaskSetRollout) rolloutPlan {
+	failed, unavailable, offline, pending := []string{}, 0, 0, []int{}
+	for i, cluster := range clusters {
+		switch {
+		case cluster.Failed:
+			failed = append(failed, cluster.Name)
+		case !cluster.Updated:
+			pending = append(pending, i)
+		case cluster.Ready:
+		case cluster.Offline:
+			offline++
+		default:
+			unavailable++
+		}
+	}
+	if len(failed) > 0 {
+		return rolloutPlan{Phase: edgev1beta1.EdgeTaskSetPhaseFailed, Message: "rollout paused on failed edge clusters: " + strings.Join(failed, ",")}
+	}
+	if len(pending) == 0 && unavailable == 0 {
+		if offline > 0 {
+			return rolloutPlan{
+				Phase:   edgev1beta1.EdgeTaskSetPhaseProgressing,
+				Message: fmt.Sprintf("waiting for %d offline edge clusters", offline),
+			}
+		}
+		return rolloutPlan{Phase: edgev1beta1.EdgeTaskSetPhaseCompleted}
+	}
+	if rollout.Paused {
+		return rolloutPlan{Phase: edgev1beta1.EdgeTaskSetPhasePaused, Message: "rollout paused"}
+	}
+	if unavailable > int(rollout.MaxUnavailable) {
+		return rolloutPlan{
+			Phase:   edgev1beta1.EdgeTaskSetPhaseProgressing,
+			Message: fmt.Sprintf("waiting for %d updated edge clusters ready", unavailable),
+		}
+	}
+	batch := int(rollout.BatchSize)
+	if batch <= 0 {
+		batch = 1
+	}
+	if batch > len(pending) {
+		batch = len(pending)
+	}
+	return rolloutPlan{Next: pending[:batch], Phase: edgev1beta1.EdgeTaskSetPhaseProgressing}
+}
+
+func setTaskSetStatus(status *edgev1beta1.EdgeTaskSetStatus, clusters []edgev1beta1.EdgeTaskSetClusterStatus, plan rolloutPlan) {
+	status.Clusters = clusters
+	status.Phase = plan.Phase
+	status.Message = plan.Message
+	status.Total, status.Updated, status.Ready, status.Failed = int32(len(clusters)), 0, 0, 0
+	for _, cluster := range clusters {
+		if cluster.Updated {
+			status.Updated++
+		}
+		if cluster.Ready {
+			status.Ready++
+		}
+		if cluster.Failed {
+			status.Failed++
+		}
+	}
+}
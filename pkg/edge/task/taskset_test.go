@@ -0,0 +1,221 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package task
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	edgev1beta1 "kubegems.io/kubegems/pkg/apis/edge/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_planRollout(t *testing.T) {
+	pending := edgev1beta1.EdgeTaskSetClusterStatus{}
+	unavailable := edgev1beta1.EdgeTaskSetClusterStatus{Updated: true}
+	ready := edgev1beta1.EdgeTaskSetClusterStatus{Updated: true, Ready: true}
+	failed := edgev1beta1.EdgeTaskSetClusterStatus{Name: "failed", Updated: true, Failed: true}
+	offline := edgev1beta1.EdgeTaskSetClusterStatus{Updated: true, Offline: true}
+
+	tests := []struct {
+		name      string
+		clusters  []edgev1beta1.EdgeTaskSetClusterStatus
+		rollout   edgev1beta1.EdgeTaskSetRollout
+		wantNext  []int
+		wantPhase edgev1beta1.EdgeTaskSetPhase
+	}{
+		{
+			name:      "default batch size",
+			clusters:  []edgev1beta1.EdgeTaskSetClusterStatus{pending, pending, pending},
+			wantNext:  []int{0},
+			wantPhase: edgev1beta1.EdgeTaskSetPhaseProgressing,
+		},
+		{
+			name:      "next wave",
+			clusters:  []edgev1beta1.EdgeTaskSetClusterStatus{ready, ready, pending, pending, pending},
+			rollout:   edgev1beta1.EdgeTaskSetRollout{BatchSize: 2},
+			wantNext:  []int{2, 3},
+			wantPhase: edgev1beta1.EdgeTaskSetPhaseProgressing,
+		},
+		{
+			name:      "wait for updated ready",
+			clusters:  []edgev1beta1.EdgeTaskSetClusterStatus{ready, unavailable, pending},
+			rollout:   edgev1beta1.EdgeTaskSetRollout{BatchSize: 2},
+			wantPhase: edgev1beta1.EdgeTaskSetPhaseProgressing,
+		},
+		{
+			name:      "max unavailable",
+			clusters:  []edgev1beta1.EdgeTaskSetClusterStatus{unavailable, pending, pending},
+			rollout:   edgev1beta1.EdgeTaskSetRollout{BatchSize: 5, MaxUnavailable: 1},
+			wantNext:  []int{1, 2},
+			wantPhase: edgev1beta1.EdgeTaskSetPhaseProgressing,
+		},
+		{
+			name:      "offline not unavailable",
+			clusters:  []edgev1beta1.EdgeTaskSetClusterStatus{offline, pending},
+			wantNext:  []int{1},
+			wantPhase: edgev1beta1.EdgeTaskSetPhaseProgressing,
+		},
+		{
+			name:      "wait for offline",
+			clusters:  []edgev1beta1.EdgeTaskSetClusterStatus{ready, offline},
+			wantPhase: edgev1beta1.EdgeTaskSetPhaseProgressing,
+		},
+		{
+			name:      "pause on failure",
+			clusters:  []edgev1beta1.EdgeTaskSetClusterStatus{failed, pending},
+			rollout:   edgev1beta1.EdgeTaskSetRollout{MaxUnavailable: 10},
+			wantPhase: edgev1beta1.EdgeTaskSetPhaseFailed,
+		},
+		{
+			name:      "paused",
+			clusters:  []edgev1beta1.EdgeTaskSetClusterStatus{ready, pending},
+			rollout:   edgev1beta1.EdgeTaskSetRollout{Paused: true},
+			wantPhase: edgev1beta1.EdgeTaskSetPhasePaused,
+		},
+		{
+			name:      "completed",
+			clusters:  []edgev1beta1.EdgeTaskSetClusterStatus{ready, ready},
+			rollout:   edgev1beta1.EdgeTaskSetRollout{Paused: true},
+			wantPhase: edgev1beta1.EdgeTaskSetPhaseCompleted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := planRollout(tt.clusters, tt.rollout)
+			if !reflect.DeepEqual(got.Next, tt.wantNext) || got.Phase != tt.wantPhase {
+				t.Errorf("planRollout() = %+v, want next %v phase %s", got, tt.wantNext, tt.wantPhase)
+			}
+		})
+	}
+}
+
+func Test_edgeTaskSetClusterStatus(t *testing.T) {
+	now := time.Now()
+	online := &edgev1beta1.EdgeCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "edge"},
+		Status:     edgev1beta1.EdgeClusterStatus{Phase: edgev1beta1.EdgePhaseOnline},
+	}
+	offline := &edgev1beta1.EdgeCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "edge"},
+		Status:     edgev1beta1.EdgeClusterStatus{Phase: edgev1beta1.EdgePhaseOffline},
+	}
+	newTask := func(hash string, rolloutAt time.Time, status edgev1beta1.EdgeTaskStatus) *edgev1beta1.EdgeTask {
+		return &edgev1beta1.EdgeTask{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "set-edge",
+				Generation: 1,
+				Annotations: map[string]string{
+					AnnotationEdgeTaskResourcesHash: hash,
+					AnnotationEdgeTaskSetRolloutAt:  rolloutAt.Format(time.RFC3339),
+				},
+			},
+			Status: status,
+		}
+	}
+	notready := edgev1beta1.EdgeTaskStatus{
+		ObservedGeneration: 1,
+		Phase:              edgev1beta1.EdgeTaskPhaseWaiting,
+		ResourcesStatus:    []edgev1beta1.EdgeTaskResourceStatus{{Kind: "Deployment", Name: "app", Exists: true}},
+	}
+	running := edgev1beta1.EdgeTaskStatus{
+		ObservedGeneration: 1,
+		Phase:              edgev1beta1.EdgeTaskPhaseRunning,
+		ResourcesStatus:    []edgev1beta1.EdgeTaskResourceStatus{{Kind: "Deployment", Name: "app", Exists: true, Ready: true}},
+	}
+	reconnected := online.DeepCopy()
+	reconnected.Status.Tunnel.LastOnlineTimestamp = &metav1.Time{Time: now.Add(-time.Minute)}
+	distributing := edgev1beta1.EdgeTaskStatus{ObservedGeneration: 1, Phase: edgev1beta1.EdgeTaskPhaseWaiting}
+	distributeFailed := edgev1beta1.EdgeTaskStatus{
+		ObservedGeneration: 1,
+		Conditions: []edgev1beta1.EdgeTaskCondition{
+			{Type: edgev1beta1.EdgeTaskConditionTypeDistributed, Status: corev1.ConditionFalse, Reason: "ApplyResourcesFailed"},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		cluster     *edgev1beta1.EdgeCluster
+		task        *edgev1beta1.EdgeTask
+		wantUpdated bool
+		wantReady   bool
+		wantFailed  bool
+		wantOffline bool
+	}{
+		{name: "no task", cluster: online},
+		{name: "previous resources", cluster: online, task: newTask("old", now, running)},
+		{name: "ready", cluster: online, task: newTask("hash", now, running), wantUpdated: true, wantReady: true},
+		{name: "not ready", cluster: online, task: newTask("hash", now, notready), wantUpdated: true},
+		{name: "deadline exceeded", cluster: online, task: newTask("hash", now.Add(-time.Hour), notready), wantUpdated: true, wantFailed: true},
+		{name: "distribution deadline exceeded", cluster: online, task: newTask("hash", now.Add(-time.Hour), distributing), wantUpdated: true, wantFailed: true},
+		{name: "reconnected after rollout", cluster: reconnected, task: newTask("hash", now.Add(-time.Hour), notready), wantUpdated: true},
+		{name: "offline", cluster: offline, task: newTask("hash", now.Add(-time.Hour), notready), wantUpdated: true, wantOffline: true},
+		{name: "distribute failed", cluster: online, task: newTask("hash", now, distributeFailed), wantUpdated: true, wantFailed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := edgeTaskSetClusterStatus(tt.cluster, tt.task, "hash", 10*time.Minute, now)
+			if got.Updated != tt.wantUpdated || got.Ready != tt.wantReady || got.Failed != tt.wantFailed || got.Offline != tt.wantOffline {
+				t.Errorf("edgeTaskSetClusterStatus() = %+v, want updated %v ready %v failed %v offline %v",
+					got, tt.wantUpdated, tt.wantReady, tt.wantFailed, tt.wantOffline)
+			}
+		})
+	}
+}
+
+func TestTaskSetReconciler_sync_notOwned(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := edgev1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	taskset := &edgev1beta1.EdgeTaskSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "set", Namespace: "default", UID: "set-uid"},
+	}
+	clusters := []client.Object{
+		&edgev1beta1.EdgeCluster{ObjectMeta: metav1.ObjectMeta{Name: "edge", Namespace: "default"}},
+	}
+	// created by user with the same name
+	usertask := &edgev1beta1.EdgeTask{
+		ObjectMeta: metav1.ObjectMeta{Name: "set-edge", Namespace: "default"},
+		Spec:       edgev1beta1.EdgeTaskSpec{EdgeClusterName: "other"},
+	}
+	r := &TaskSetReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(append(clusters, taskset, usertask)...).Build(),
+	}
+	ctx := context.Background()
+	if err := r.sync(ctx, taskset); err != nil {
+		t.Fatal(err)
+	}
+	if taskset.Status.Phase != edgev1beta1.EdgeTaskSetPhaseFailed || taskset.Status.Failed != 1 {
+		t.Errorf("phase = %s, failed = %d, want %s, 1", taskset.Status.Phase, taskset.Status.Failed, edgev1beta1.EdgeTaskSetPhaseFailed)
+	}
+	if _, err := r.applyEdgeTask(ctx, taskset, "edge"); !errors.Is(err, ErrEdgeTaskNotOwned) {
+		t.Errorf("applyEdgeTask() error = %v, want %v", err, ErrEdgeTaskNotOwned)
+	}
+	got := &edgev1beta1.EdgeTask{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(usertask), got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Spec.EdgeClusterName != "other" || len(got.OwnerReferences) != 0 {
+		t.Errorf("edge task created by user overwritten: %v", got)
+	}
+}
@@ -16,14 +16,208 @@ package tunnel
 
 import (
 	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/maps"
+)
+
+var (
+	ErrNoCertificate      = errors.New("no client certificate")
+	ErrCertificateRevoked = errors.New("certificate revoked")
+	ErrNoToken            = errors.New("no token")
 )
 
 type AuthenticationManager interface {
 	Authentication(ctx context.Context, name string, token string) error
 }
 
+// CredentialExchanger 认证对端并返回签发给对端的凭据，对端在之后的连接中使用该凭据代替引导 token
+type CredentialExchanger interface {
+	AuthenticationManager
+	Exchange(ctx context.Context, name string, token string) (credential string, err error)
+}
+
 type NonAuthManager struct{}
 
 func (m *NonAuthManager) Authentication(ctx context.Context, name string, token string) error {
 	return nil
 }
+
+type peerCertificatesKey struct{}
+
+// WithPeerCertificates 将对端 TLS 证书放入 context，供 AuthenticationManager 校验
+func WithPeerCertificates(ctx context.Context, certs []*x509.Certificate) context.Context {
+	if len(certs) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, peerCertificatesKey{}, certs)
+}
+
+func PeerCertificatesFromContext(ctx context.Context) []*x509.Certificate {
+	certs, _ := ctx.Value(peerCertificatesKey{}).([]*x509.Certificate)
+	return certs
+}
+
+// CertAuthManager 校验对端的客户端证书：证书需由 Issuer 签发给同名的对端、在有效期内并且未被吊销
+type CertAuthManager struct {
+	Issuer *x509.Certificate
+	// RequireCert 为 false 时允许未提供证书的对端连接，用于兼容未配置证书的旧版本。
+	// 一旦有证书被吊销，未提供证书的对端同样被拒绝，以免持有已吊销证书的对端不提供证书绕过吊销。
+	RequireCert bool
+	// OnRevoked 在已连接对端的证书被吊销时调用，用于断开对端的隧道
+	OnRevoked func(peer string)
+
+	mu      sync.RWMutex
+	revoked map[string]struct{}
+	peers   map[string]string // peer -> serial of the certificate authenticated with
+}
+
+func NewCertAuthManager(issuer *x509.Certificate, requireCert bool) *CertAuthManager {
+	return &CertAuthManager{
+		Issuer:      issuer,
+		RequireCert: requireCert,
+		revoked:     map[string]struct{}{},
+		peers:       map[string]string{},
+	}
+}
+
+// SetRevoked 替换吊销的证书序列号列表，并对使用已吊销证书认证的对端调用 OnRevoked
+func (m *CertAuthManager) SetRevoked(serials []string) {
+	revoked := make(map[string]struct{}, len(serials))
+	for _, serial := range serials {
+		revoked[serial] = struct{}{}
+	}
+	m.mu.Lock()
+	m.revoked = revoked
+	peers := []string{}
+	for peer, serial := range m.peers {
+		if _, ok := revoked[serial]; ok {
+			peers = append(peers, peer)
+			delete(m.peers, peer)
+		}
+	}
+	m.mu.Unlock()
+
+	if m.OnRevoked == nil {
+		return
+	}
+	for _, peer := range peers {
+		m.OnRevoked(peer)
+	}
+}
+
+func (m *CertAuthManager) Revoked() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	serials := maps.Keys(m.revoked)
+	sort.Strings(serials)
+	return serials
+}
+
+// admit 记录对端认证使用的证书，证书已被吊销时返回 false；与 SetRevoked 互斥以免遗漏正在认证的对端
+func (m *CertAuthManager) admit(peer, serial string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.revoked[serial]; ok {
+		return false
+	}
+	m.peers[peer] = serial
+	return true
+}
+
+func (m *CertAuthManager) revocationInUse() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.revoked) > 0
+}
+
+func (m *CertAuthManager) forget(peer string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.peers, peer)
+}
+
+func (m *CertAuthManager) Authentication(ctx context.Context, name string, token string) error {
+	certs := PeerCertificatesFromContext(ctx)
+	if len(certs) == 0 {
+		if m.RequireCert || m.revocationInUse() {
+			return fmt.Errorf("peer %s: %w", name, ErrNoCertificate)
+		}
+		m.forget(name)
+		return nil
+	}
+	cert := certs[0]
+	if cert.Subject.CommonName != name {
+		return fmt.Errorf("peer %s: certificate issued to %s", name, cert.Subject.CommonName)
+	}
+	if now := time.Now(); now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return fmt.Errorf("peer %s: certificate expired or not yet valid", name)
+	}
+	// 边缘证书由 hub 证书直接签发，hub 证书不一定是 CA 证书，因此只校验签名
+	if m.Issuer != nil {
+		if err := m.Issuer.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+			return fmt.Errorf("peer %s: certificate not issued by %s: %w", name, m.Issuer.Subject.CommonName, err)
+		}
+	}
+	if serial := cert.SerialNumber.String(); !m.admit(name, serial) {
+		return fmt.Errorf("peer %s: %w: serial %s", name, ErrCertificateRevoked, serial)
+	}
+	return nil
+}
+
+// TokenReview edge hub 请求 edge server 校验 token 的请求以及结果
+type TokenReview struct {
+	Peer       string `json:"peer"`
+	Hub        string `json:"hub,omitempty"`
+	Token      string `json:"token,omitempty"`
+	Credential string `json:"credential,omitempty"` // credential issued in exchange of the bootstrap token
+}
+
+// TokenVerifier 校验对端的 token；token 为引导 token 时返回新签发的凭据，为已签发的凭据时返回空
+type TokenVerifier interface {
+	VerifyToken(ctx context.Context, name string, token string) (credential string, err error)
+}
+
+type TokenVerifierFunc func(ctx context.Context, name string, token string) (string, error)
+
+func (f TokenVerifierFunc) VerifyToken(ctx context.Context, name string, token string) (string, error) {
+	return f(ctx, name, token)
+}
+
+// TokenAuthManager 使用 Verifier 校验对端的 token，并将引导 token 交换为对端专用的凭据
+type TokenAuthManager struct {
+	Verifier TokenVerifier
+	// RequireToken 为 false 时允许未提供 token 的对端连接，用于兼容未配置 token 的旧版本
+	RequireToken bool
+	// Next 在校验 token 之前执行的认证，例如 CertAuthManager
+	Next AuthenticationManager
+}
+
+func (m *TokenAuthManager) Authentication(ctx context.Context, name string, token string) error {
+	_, err := m.Exchange(ctx, name, token)
+	return err
+}
+
+func (m *TokenAuthManager) Exchange(ctx context.Context, name string, token string) (string, error) {
+	if m.Next != nil {
+		if err := m.Next.Authentication(ctx, name, token); err != nil {
+			return "", err
+		}
+	}
+	if token == "" && !m.RequireToken {
+		return "", nil
+	}
+	if m.Verifier == nil {
+		return "", fmt.Errorf("peer %s: no token verifier", name)
+	}
+	credential, err := m.Verifier.VerifyToken(ctx, name, token)
+	if err != nil {
+		return "", fmt.Errorf("peer %s: %w", name, err)
+	}
+	return credential, nil
+}
@@ -0,0 +1,292 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/util/cert"
+	"kubegems.io/kubegems/pkg/utils/certificate"
+)
+
+// newHubCert 生成自签名的 hub 证书
+func newHubCert(t *testing.T, host string) (certpem, keypem []byte, issuer *x509.Certificate) {
+	certpem, keypem, err := cert.GenerateSelfSignedCertKey(host, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certpem, keypem, parseLeaf(t, certpem, keypem)
+}
+
+func parseLeaf(t *testing.T, certpem, keypem []byte) *x509.Certificate {
+	pair, err := tls.X509KeyPair(certpem, keypem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf
+}
+
+func issueEdgeCert(t *testing.T, hubcert, hubkey []byte, expire *time.Time) *x509.Certificate {
+	certpem, keypem, err := certificate.IssueCertificate(nil, hubcert, hubkey, certificate.CertOptions{CommonName: "edge", ExpireAt: expire})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parseLeaf(t, certpem, keypem)
+}
+
+func TestCertAuthManager_Authentication(t *testing.T) {
+	hubcert, hubkey, issuer := newHubCert(t, "hub")
+	othercert, otherkey, _ := newHubCert(t, "other")
+
+	valid := issueEdgeCert(t, hubcert, hubkey, nil)
+	revoked := issueEdgeCert(t, hubcert, hubkey, nil)
+	expiredAt := time.Now().Add(-time.Minute)
+	expired := issueEdgeCert(t, hubcert, hubkey, &expiredAt)
+	foreign := issueEdgeCert(t, othercert, otherkey, nil)
+
+	if valid.SerialNumber.Cmp(revoked.SerialNumber) == 0 {
+		t.Fatal("issued certificates have the same serial number")
+	}
+
+	tests := []struct {
+		name        string
+		certs       []*x509.Certificate
+		peer        string
+		requireCert bool
+		noRevoked   bool
+		wantErr     error
+		wantAnyErr  bool
+	}{
+		{name: "valid", certs: []*x509.Certificate{valid}},
+		{name: "no cert allowed", certs: nil, noRevoked: true},
+		{name: "no cert required", certs: nil, requireCert: true, noRevoked: true, wantErr: ErrNoCertificate},
+		{name: "no cert with revocation", certs: nil, wantErr: ErrNoCertificate},
+		{name: "revoked", certs: []*x509.Certificate{revoked}, wantErr: ErrCertificateRevoked},
+		{name: "expired", certs: []*x509.Certificate{expired}, wantAnyErr: true},
+		{name: "other issuer", certs: []*x509.Certificate{foreign}, wantAnyErr: true},
+		{name: "issued to other peer", certs: []*x509.Certificate{valid}, peer: "other", wantAnyErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewCertAuthManager(issuer, tt.requireCert)
+			if !tt.noRevoked {
+				m.SetRevoked([]string{revoked.SerialNumber.String()})
+			}
+
+			peer := tt.peer
+			if peer == "" {
+				peer = "edge"
+			}
+			err := m.Authentication(WithPeerCertificates(context.Background(), tt.certs), peer, "")
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Authentication() error = %v, want %v", err, tt.wantErr)
+			}
+			if wantErr := tt.wantErr != nil || tt.wantAnyErr; (err != nil) != wantErr {
+				t.Errorf("Authentication() error = %v, wantErr %v", err, wantErr)
+			}
+		})
+	}
+}
+
+func TestCertAuthManager_SetRevoked(t *testing.T) {
+	hubcert, hubkey, issuer := newHubCert(t, "hub")
+	cert := issueEdgeCert(t, hubcert, hubkey, nil)
+
+	hub := NewTunnelServer("hub", nil)
+	// certificates not required, revocation still applies to peers without one
+	auth := NewCertAuthManager(issuer, false)
+	auth.OnRevoked = func(peer string) { hub.Disconnect(peer) }
+	hub.auth = auth
+	edge := NewTunnelServer("edge", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	down, up := newPipeTunnel()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- hub.Connect(WithPeerCertificates(ctx, []*x509.Certificate{cert}), up, "", nil, TunnelOptions{})
+	}()
+	go edge.Connect(ctx, down, "", nil, TunnelOptions{SendRouteChange: true, IsDefaultOut: true})
+
+	if !waitFor(func() bool { return hub.routeTable.Exists("edge") }) {
+		t.Fatal("edge not connected")
+	}
+	auth.SetRevoked([]string{"unrelated"})
+	if !hub.routeTable.Exists("edge") {
+		t.Fatal("edge disconnected by unrelated revocation")
+	}
+	auth.SetRevoked([]string{cert.SerialNumber.String()})
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("tunnel of revoked certificate not closed")
+	}
+	if hub.routeTable.Exists("edge") {
+		t.Error("edge still connected after revocation")
+	}
+
+	// reconnect without the revoked certificate
+	down, up = newPipeTunnel()
+	go edge.Connect(ctx, down, "", nil, TunnelOptions{SendRouteChange: true, IsDefaultOut: true})
+	if err := hub.Connect(ctx, up, "", nil, TunnelOptions{}); !errors.Is(err, ErrNoCertificate) {
+		t.Errorf("Connect() without certificate error = %v, want %v", err, ErrNoCertificate)
+	}
+}
+
+func TestTokenAuthManager_Exchange(t *testing.T) {
+	verifier := TokenVerifierFunc(func(ctx context.Context, name string, token string) (string, error) {
+		switch token {
+		case "bootstrap":
+			return "credential", nil
+		case "credential":
+			return "", nil
+		default:
+			return "", errors.New("invalid token")
+		}
+	})
+	rejectall := NewCertAuthManager(nil, true) // no peer certificates in context
+	tests := []struct {
+		name           string
+		manager        *TokenAuthManager
+		token          string
+		wantCredential string
+		wantErr        error
+		wantAnyErr     bool
+	}{
+		{name: "bootstrap token exchanged", manager: &TokenAuthManager{Verifier: verifier}, token: "bootstrap", wantCredential: "credential"},
+		{name: "issued credential", manager: &TokenAuthManager{Verifier: verifier}, token: "credential"},
+		{name: "invalid token", manager: &TokenAuthManager{Verifier: verifier}, token: "invalid", wantAnyErr: true},
+		{name: "no token allowed", manager: &TokenAuthManager{Verifier: verifier}},
+		{name: "no token required", manager: &TokenAuthManager{Verifier: verifier, RequireToken: true}, wantAnyErr: true},
+		{name: "next rejected", manager: &TokenAuthManager{Verifier: verifier, Next: rejectall}, token: "bootstrap", wantErr: ErrNoCertificate},
+		{name: "no verifier", manager: &TokenAuthManager{}, token: "bootstrap", wantAnyErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			credential, err := tt.manager.Exchange(context.Background(), "edge", tt.token)
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Exchange() error = %v, want %v", err, tt.wantErr)
+			}
+			if (err != nil) != (tt.wantErr != nil || tt.wantAnyErr) {
+				t.Fatalf("Exchange() error = %v, want error %v", err, tt.wantErr != nil || tt.wantAnyErr)
+			}
+			if credential != tt.wantCredential {
+				t.Errorf("Exchange() = %q, want %q", credential, tt.wantCredential)
+			}
+		})
+	}
+}
+
+func TestTunnelServer_CredentialExchange(t *testing.T) {
+	used := false
+	hub := NewTunnelServer("hub", &TokenAuthManager{
+		RequireToken: true,
+		Verifier: TokenVerifierFunc(func(ctx context.Context, name string, token string) (string, error) {
+			switch {
+			case token == "bootstrap" && !used:
+				used = true
+				return "credential", nil
+			case token == "credential":
+				return "", nil
+			default:
+				return "", errors.New("invalid token")
+			}
+		}),
+	})
+	edge := NewTunnelServer("edge", nil)
+	persisted := ""
+	edge.OnCredential = func(credential string) { persisted = credential }
+
+	connect := func() error {
+		down, up := newPipeTunnel()
+		defer down.Close()
+		defer up.Close()
+		errs := make(chan error, 1)
+		go func() {
+			_, err := hub.authStage(context.Background(), up, "", false)
+			errs <- err
+		}()
+		_, err := edge.authStage(context.Background(), down, "bootstrap", true)
+		if huberr := <-errs; huberr != nil {
+			return huberr
+		}
+		return err
+	}
+	// bootstrap token exchanged on the first connect
+	if err := connect(); err != nil {
+		t.Fatalf("first connect: %v", err)
+	}
+	if edge.Credential() != "credential" || persisted != "credential" {
+		t.Fatalf("credential = %q, persisted = %q, want issued credential", edge.Credential(), persisted)
+	}
+	// the bootstrap token is used only once, reconnect with the credential
+	if err := connect(); err != nil {
+		t.Fatalf("reconnect: %v", err)
+	}
+	edge.SetCredential("")
+	if err := connect(); err == nil {
+		t.Fatal("reuse of bootstrap token should be rejected")
+	}
+}
+
+func TestTunnelServer_UpstreamAuth(t *testing.T) {
+	// hub requires both token and certificate from downstream edge agents
+	hub := NewTunnelServer("hub", &TokenAuthManager{
+		RequireToken: true,
+		Next:         NewCertAuthManager(nil, true),
+		Verifier: TokenVerifierFunc(func(ctx context.Context, name string, token string) (string, error) {
+			return "", nil
+		}),
+	})
+	server := NewTunnelServer("server", nil)
+	edge := NewTunnelServer("edge", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	connect := func(downstream, upstream *TunnelServer) (downerr, uperr chan error) {
+		down, up := newPipeTunnel()
+		downerr, uperr = make(chan error, 1), make(chan error, 1)
+		go func() {
+			downerr <- downstream.Connect(ctx, down, "", nil, TunnelOptions{SendRouteChange: true, IsDefaultOut: true, IsUpstream: true})
+		}()
+		go func() { uperr <- upstream.Connect(ctx, up, "", nil, TunnelOptions{}) }()
+		return downerr, uperr
+	}
+
+	// the server neither sends a token nor a certificate to the hub
+	connect(hub, server)
+	if !waitFor(func() bool { return server.routeTable.Exists("hub") }) {
+		t.Fatal("hub not connected to server")
+	}
+	// downstream connections are still authenticated
+	_, huberr := connect(edge, hub)
+	select {
+	case err := <-huberr:
+		if !errors.Is(err, ErrNoCertificate) {
+			t.Errorf("edge connect error = %v, want %v", err, ErrNoCertificate)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("edge without certificate and token not rejected")
+	}
+}
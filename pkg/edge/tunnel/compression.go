@@ -0,0 +1,194 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	CompressionZstd = "zstd"
+	CompressionGzip = "gzip"
+
+	// MinCompressSize 小于该长度的数据不压缩
+	MinCompressSize = 1 << 10
+	// maxDecompressedSize 解压后数据的最大长度
+	maxDecompressedSize = 64 << 20
+)
+
+// SupportedCompressions 支持的压缩算法，按照优先级排序
+var SupportedCompressions = []string{CompressionZstd, CompressionGzip}
+
+const (
+	compressFlagNone       byte = 0
+	compressFlagCompressed byte = 1
+)
+
+type compressor interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+func newCompressor(name string) (compressor, error) {
+	switch name {
+	case CompressionZstd:
+		return newZstdCompressor()
+	case CompressionGzip:
+		return &gzipCompressor{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %s", name)
+	}
+}
+
+// negotiateCompression 选择双方都支持的压缩算法，按照 SupportedCompressions 的顺序选择以保证双方结果一致
+func negotiateCompression(local, remote []string) string {
+	contains := func(list []string, name string) bool {
+		for _, v := range list {
+			if v == name {
+				return true
+			}
+		}
+		return false
+	}
+	for _, name := range SupportedCompressions {
+		if contains(local, name) && contains(remote, name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// CompressedTunnel 压缩数据包中数据的隧道
+// 压缩在每一跳之间进行，数据前增加一个字节标记是否压缩，较小或者压缩后无收益的数据不压缩。
+type CompressedTunnel struct {
+	Tunnel
+	compressor compressor
+}
+
+func NewCompressedTunnel(tunnel Tunnel, compression string) (*CompressedTunnel, error) {
+	c, err := newCompressor(compression)
+	if err != nil {
+		return nil, err
+	}
+	return &CompressedTunnel{Tunnel: tunnel, compressor: c}, nil
+}
+
+func (t *CompressedTunnel) Send(pkt *Packet) error {
+	if len(pkt.Data) == 0 {
+		return t.Tunnel.Send(pkt)
+	}
+	cp := *pkt
+	cp.Data = nil
+	if len(pkt.Data) >= MinCompressSize {
+		if compressed, err := t.compressor.Compress(pkt.Data); err == nil && len(compressed) < len(pkt.Data) {
+			cp.Data = append([]byte{compressFlagCompressed}, compressed...)
+		}
+	}
+	if cp.Data == nil {
+		cp.Data = append([]byte{compressFlagNone}, pkt.Data...)
+	}
+	return t.Tunnel.Send(&cp)
+}
+
+func (t *CompressedTunnel) Recv(into *Packet) error {
+	if err := t.Tunnel.Recv(into); err != nil {
+		return err
+	}
+	if len(into.Data) == 0 {
+		return nil
+	}
+	switch flag, data := into.Data[0], into.Data[1:]; flag {
+	case compressFlagNone:
+		into.Data = data
+	case compressFlagCompressed:
+		decompressed, err := t.compressor.Decompress(data)
+		if err != nil {
+			return fmt.Errorf("decompress packet: %w", err)
+		}
+		into.Data = decompressed
+	default:
+		return fmt.Errorf("invalid compress flag %d", flag)
+	}
+	return nil
+}
+
+type zstdCompressor struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func newZstdCompressor() (*zstdCompressor, error) {
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecompressedSize))
+	if err != nil {
+		return nil, err
+	}
+	return &zstdCompressor{encoder: encoder, decoder: decoder}, nil
+}
+
+func (c *zstdCompressor) Compress(data []byte) ([]byte, error) {
+	return c.encoder.EncodeAll(data, nil), nil
+}
+
+func (c *zstdCompressor) Decompress(data []byte) ([]byte, error) {
+	return c.decoder.DecodeAll(data, nil)
+}
+
+type gzipCompressor struct {
+	writers sync.Pool
+}
+
+func (c *gzipCompressor) Compress(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w, ok := c.writers.Get().(*gzip.Writer)
+	if ok {
+		w.Reset(buf)
+	} else {
+		w, _ = gzip.NewWriterLevel(buf, gzip.BestSpeed)
+	}
+	defer c.writers.Put(w)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err = io.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxDecompressedSize {
+		return nil, fmt.Errorf("decompressed data exceeds %d bytes", maxDecompressedSize)
+	}
+	return data, nil
+}
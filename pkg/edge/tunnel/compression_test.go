@@ -0,0 +1,97 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func Test_negotiateCompression(t *testing.T) {
+	tests := []struct {
+		name   string
+		local  []string
+		remote []string
+		want   string
+	}{
+		{name: "remote not supported", local: SupportedCompressions, remote: nil, want: ""},
+		{name: "local disabled", local: nil, remote: SupportedCompressions, want: ""},
+		{name: "prefer zstd", local: []string{CompressionGzip, CompressionZstd}, remote: []string{CompressionZstd, CompressionGzip}, want: CompressionZstd},
+		{name: "common gzip", local: []string{CompressionGzip}, remote: []string{CompressionZstd, CompressionGzip}, want: CompressionGzip},
+		{name: "unknown", local: []string{"snappy"}, remote: []string{"snappy"}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := negotiateCompression(tt.local, tt.remote); got != tt.want {
+				t.Errorf("negotiateCompression() = %q, want %q", got, tt.want)
+			}
+			// 双方协商结果一致
+			if got := negotiateCompression(tt.remote, tt.local); got != tt.want {
+				t.Errorf("negotiateCompression() reversed = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompressedTunnel(t *testing.T) {
+	random := make([]byte, 4*MinCompressSize)
+	_, _ = rand.Read(random)
+
+	tests := []struct {
+		name           string
+		data           []byte
+		wantCompressed bool
+	}{
+		{name: "empty", data: nil},
+		{name: "small", data: []byte("hello")},
+		{name: "compressible", data: bytes.Repeat([]byte("kubegems"), MinCompressSize), wantCompressed: true},
+		{name: "incompressible", data: random},
+	}
+	for _, compression := range SupportedCompressions {
+		for _, tt := range tests {
+			t.Run(compression+"/"+tt.name, func(t *testing.T) {
+				ta, tb := newPipeTunnel()
+				// 记录实际在隧道上传输的数据包
+				raw := &recordTunnel{sent: make(chan *Packet, 1)}
+				sender, err := NewCompressedTunnel(raw, compression)
+				if err != nil {
+					t.Fatal(err)
+				}
+				receiver, err := NewCompressedTunnel(tb, compression)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := sender.Send(&Packet{Kind: PacketKindData, Data: tt.data}); err != nil {
+					t.Fatal(err)
+				}
+				sent := <-raw.sent
+				if compressed := len(sent.Data) > 0 && sent.Data[0] == compressFlagCompressed; compressed != tt.wantCompressed {
+					t.Errorf("compressed = %v, want %v", compressed, tt.wantCompressed)
+				}
+				if err := ta.Send(sent); err != nil {
+					t.Fatal(err)
+				}
+				got := &Packet{}
+				if err := receiver.Recv(got); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got.Data, tt.data) {
+					t.Errorf("received data mismatch")
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debug
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"kubegems.io/library/rest/api"
+	"kubegems.io/library/rest/request"
+	"kubegems.io/library/rest/response"
+
+	"kubegems.io/kubegems/pkg/edge/tunnel"
+	"kubegems.io/kubegems/pkg/utils/system"
+)
+
+const (
+	// DefaultListen 调试接口默认仅监听本地地址
+	DefaultListen = "127.0.0.1:8081"
+	// DefaultListenMetrics 指标默认监听所有地址，供 prometheus 在 pod 网络中抓取
+	DefaultListenMetrics = ":9100"
+	// MaxTraceRouteTimeout trace route 允许的最大超时时间
+	MaxTraceRouteTimeout = time.Minute
+)
+
+// API 查看隧道拓扑以及路径的接口
+type API struct {
+	Tunnel *tunnel.TunnelServer
+}
+
+func (a *API) Topology(resp http.ResponseWriter, req *http.Request) {
+	response.OK(resp, a.Tunnel.Topology())
+}
+
+func (a *API) TraceRoute(resp http.ResponseWriter, req *http.Request) {
+	peer := request.Path(req, "peer", "")
+	timeout, err := traceRouteTimeout(request.Query(req, "timeout", ""))
+	if err != nil {
+		response.BadRequest(resp, err.Error())
+		return
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+
+	result, err := a.Tunnel.TraceRoute(ctx, peer)
+	if err != nil {
+		response.BadRequest(resp, err.Error())
+		return
+	}
+	response.OK(resp, result)
+}
+
+func traceRouteTimeout(val string) (time.Duration, error) {
+	if val == "" {
+		return tunnel.DefaultTraceRouteTimeout, nil
+	}
+	timeout, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, err
+	}
+	if timeout <= 0 || timeout > MaxTraceRouteTimeout {
+		return 0, fmt.Errorf("timeout must be in (0, %s]", MaxTraceRouteTimeout)
+	}
+	return timeout, nil
+}
+
+// WatchEvents 以换行分隔的 JSON 持续输出隧道事件，首个事件包含当前所有可达的节点
+func (a *API) WatchEvents(resp http.ResponseWriter, req *http.Request) {
+	flusher, ok := resp.(http.Flusher)
+	if !ok {
+		response.BadRequest(resp, "streaming unsupported")
+		return
+	}
+	watcher := a.Tunnel.Wacth(req.Context())
+	defer watcher.Close()
+
+	resp.Header().Set("Content-Type", "application/x-ndjson")
+	resp.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	encoder := json.NewEncoder(resp)
+	for event := range watcher.Result() {
+		if err := encoder.Encode(event); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func (a *API) RegisterRoute(r *api.Group) {
+	r.AddSubGroup(
+		api.NewGroup("/tunnel").Tag("tunnel").AddRoutes(
+			api.GET("/topology").To(a.Topology).Doc("tunnel topology").Response(tunnel.Topology{}),
+			api.GET("/traceroute/{peer}").To(a.TraceRoute).Doc("trace the path to peer").Parameters(
+				api.PathParameter("peer", "destination peer id"),
+				api.QueryParameter("timeout", "timeout waiting reply, example '10s'").Optional(),
+			).Response(tunnel.TraceResult{}),
+			api.GET("/events").To(a.WatchEvents).Doc("watch tunnel events").Response(tunnel.TunnelEvent{}),
+		),
+	)
+}
+
+// MetricsHandler 返回隧道指标的 prometheus handler
+func MetricsHandler(server *tunnel.TunnelServer) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		tunnel.NewTunnelCollector(server),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Timeout: 10 * time.Second})
+}
+
+// Handler 提供隧道调试接口，请求需要携带 Authorization: Bearer <token>
+func Handler(server *tunnel.TunnelServer, token string) http.Handler {
+	return tokenAuth(token, api.NewAPI().HealthCheck(nil).Register("/v1", &API{Tunnel: server}).BuildHandler())
+}
+
+func tokenAuth(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		bearer := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			response.Error(resp, response.NewStatusErrorMessage(http.StatusUnauthorized, "invalid debug token"))
+			return
+		}
+		next.ServeHTTP(resp, req)
+	})
+}
+
+// Run 在 listen 上提供调试接口，未设置 token 时不启用
+func Run(ctx context.Context, listen, token string, server *tunnel.TunnelServer) error {
+	if listen == "" || token == "" {
+		return nil
+	}
+	return system.ListenAndServeContext(ctx, listen, nil, Handler(server, token))
+}
+
+// RunMetrics 在 listen 上单独提供隧道指标
+func RunMetrics(ctx context.Context, listen string, server *tunnel.TunnelServer) error {
+	if listen == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", MetricsHandler(server))
+	return system.ListenAndServeContext(ctx, listen, nil, mux)
+}
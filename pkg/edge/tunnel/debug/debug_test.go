@@ -0,0 +1,78 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debug
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"kubegems.io/kubegems/pkg/edge/tunnel"
+)
+
+func Test_traceRouteTimeout(t *testing.T) {
+	tests := []struct {
+		val     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{val: "", want: tunnel.DefaultTraceRouteTimeout},
+		{val: "5s", want: 5 * time.Second},
+		{val: "1m", want: MaxTraceRouteTimeout},
+		{val: "1h", wantErr: true},
+		{val: "-1s", wantErr: true},
+		{val: "invalid", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.val, func(t *testing.T) {
+			got, err := traceRouteTimeout(tt.val)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("traceRouteTimeout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("traceRouteTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_tokenAuth(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   bool
+	}{
+		{name: "valid token", token: "secret", header: "Bearer secret", want: true},
+		{name: "invalid token", token: "secret", header: "Bearer invalid"},
+		{name: "no token", token: "secret"},
+		{name: "empty configured token", header: "Bearer "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := tokenAuth(tt.token, http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true }))
+			req := httptest.NewRequest(http.MethodGet, "/v1/tunnel/topology", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			if called != tt.want {
+				t.Errorf("tokenAuth() called = %v, want %v", called, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+var ErrLocalAddressDenied = errors.New("dial to local address denied")
+
+// DenyDownstreamLocalDial 拒绝下游对端通过隧道连接本机的地址，例如本机仅供上游调用的 api；上游对端不受限制
+func DenyDownstreamLocalDial(origin Origin, network, address string) error {
+	if origin.Upstream {
+		return nil
+	}
+	if strings.HasPrefix(network, "unix") {
+		return fmt.Errorf("%w: %s %s", ErrLocalAddressDenied, network, address)
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("invalid address %s", address)
+	}
+	if isLocalIP(ip) {
+		return fmt.Errorf("%w: %s", ErrLocalAddressDenied, address)
+	}
+	return nil
+}
+
+func isLocalIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() {
+		return true
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		// unable to tell, deny
+		return true
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDenyDownstreamLocalDial(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream bool
+		network  string
+		address  string
+		wantErr  bool
+	}{
+		{name: "upstream loopback", upstream: true, network: "tcp", address: "127.0.0.1:8080"},
+		{name: "loopback", network: "tcp", address: "127.0.0.1:8080", wantErr: true},
+		{name: "ipv6 loopback", network: "tcp6", address: "[::1]:8080", wantErr: true},
+		{name: "unspecified", network: "tcp", address: "0.0.0.0:8080", wantErr: true},
+		{name: "unix socket", network: "unix", address: "/var/run/docker.sock", wantErr: true},
+		{name: "remote", network: "tcp", address: "192.0.2.1:443"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := DenyDownstreamLocalDial(Origin{Peer: "edge", Tunnel: "edge", Upstream: tt.upstream}, tt.network, tt.address)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DenyDownstreamLocalDial() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrLocalAddressDenied) {
+				t.Errorf("DenyDownstreamLocalDial() error = %v, want %v", err, ErrLocalAddressDenied)
+			}
+		})
+	}
+}
@@ -42,10 +42,10 @@ const (
 )
 
 type TunnelEvent struct {
-	From            string
-	FromAnnotations map[string]string
-	Kind            EventKind
-	Peers           map[string]Annotations
+	From            string                 `json:"from"`
+	FromAnnotations map[string]string      `json:"fromAnnotations,omitempty"`
+	Kind            EventKind              `json:"kind"`
+	Peers           map[string]Annotations `json:"peers,omitempty"`
 }
 
 type EventWatcher struct {
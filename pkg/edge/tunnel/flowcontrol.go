@@ -0,0 +1,236 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"sync"
+)
+
+const (
+	// DefaultWindowSize 每个连接的接收窗口，发送方最多有该大小的数据未被对端读取
+	DefaultWindowSize = 256 << 10
+	// MaxPacketDataSize 单个数据包的最大数据长度，较大的写入会被拆分
+	MaxPacketDataSize = 32 << 10
+	// DefaultSendQueueSize 每个连接在隧道上排队等待发送的最大字节数
+	DefaultSendQueueSize = DefaultWindowSize
+
+	// minPacketCost 每个数据包最少占用的窗口，保证对端接收队列中的数据包数量不超过 DefaultDataChannelSize
+	minPacketCost = DefaultWindowSize / DefaultDataChannelSize
+)
+
+// packetCost 返回长度为 n 的数据包占用的窗口大小
+func packetCost(n int) int64 {
+	if n < minPacketCost {
+		return minPacketCost
+	}
+	return int64(n)
+}
+
+// sendWindow 连接的发送窗口，对端不支持流控时不限制发送
+type sendWindow struct {
+	enabled bool
+	mu      sync.Mutex
+	size    int64
+	updated chan struct{}
+}
+
+func newSendWindow() *sendWindow {
+	return &sendWindow{updated: make(chan struct{}, 1)}
+}
+
+func (w *sendWindow) init(size int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.enabled, w.size = size > 0, size
+}
+
+// acquire 等待窗口足够发送 cost 大小的数据，done 关闭时返回 net.ErrClosed，timeout 关闭时返回 os.ErrDeadlineExceeded
+func (w *sendWindow) acquire(cost int64, done, timeout <-chan struct{}) error {
+	for {
+		w.mu.Lock()
+		if !w.enabled || w.size >= cost {
+			if w.enabled {
+				w.size -= cost
+			}
+			w.mu.Unlock()
+			return nil
+		}
+		w.mu.Unlock()
+		select {
+		case <-w.updated:
+		case <-done:
+			return net.ErrClosed
+		case <-timeout:
+			return os.ErrDeadlineExceeded
+		}
+	}
+}
+
+func (w *sendWindow) release(increment int64) {
+	w.mu.Lock()
+	w.size += increment
+	w.mu.Unlock()
+	select {
+	case w.updated <- struct{}{}:
+	default:
+	}
+}
+
+// sendScheduler 负责隧道上数据包的发送
+// 数据包按照来源连接排队并轮询发送，避免单个连接占满隧道；其他控制类数据包优先发送。
+// 每个连接排队的数据超过 DefaultSendQueueSize 时阻塞发送方。
+type sendScheduler struct {
+	tunnel Tunnel
+
+	mu      sync.Mutex
+	control []*Packet
+	queues  map[string]*sendQueue
+	order   []string // 有数据包等待发送的连接
+	err     error
+
+	notify chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+type sendQueue struct {
+	packets []*Packet
+	size    int
+	space   chan struct{}
+}
+
+func newSendScheduler(tunnel Tunnel) *sendScheduler {
+	return &sendScheduler{
+		tunnel: tunnel,
+		queues: map[string]*sendQueue{},
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+// schedulerKey 返回数据包所属的连接，需要与数据保持顺序的关闭包与数据包在同一队列中
+func schedulerKey(pkt *Packet) (string, bool) {
+	if pkt.SrcCID == 0 || (pkt.Kind != PacketKindData && pkt.Kind != PacketKindClose) {
+		return "", false
+	}
+	return pkt.Src + "/" + strconv.FormatInt(pkt.SrcCID, 10), true
+}
+
+func (s *sendScheduler) Send(pkt *Packet) error {
+	key, ok := schedulerKey(pkt)
+	for {
+		s.mu.Lock()
+		if s.err != nil {
+			s.mu.Unlock()
+			return s.err
+		}
+		if !ok {
+			s.control = append(s.control, pkt)
+			s.mu.Unlock()
+			s.wakeup()
+			return nil
+		}
+		queue, exists := s.queues[key]
+		if !exists {
+			queue = &sendQueue{space: make(chan struct{}, 1)}
+			s.queues[key] = queue
+			s.order = append(s.order, key)
+		}
+		// 关闭包不阻塞，避免连接无法关闭
+		if queue.size < DefaultSendQueueSize || pkt.Kind == PacketKindClose {
+			queue.packets = append(queue.packets, pkt)
+			queue.size += len(pkt.Data)
+			s.mu.Unlock()
+			s.wakeup()
+			return nil
+		}
+		s.mu.Unlock()
+		select {
+		case <-queue.space:
+		case <-s.done:
+		}
+	}
+}
+
+func (s *sendScheduler) wakeup() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// next 取出下一个需要发送的数据包，控制包优先，其余按连接轮询
+func (s *sendScheduler) next() *Packet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.control) > 0 {
+		pkt := s.control[0]
+		s.control[0] = nil
+		s.control = s.control[1:]
+		return pkt
+	}
+	if len(s.order) == 0 {
+		return nil
+	}
+	key := s.order[0]
+	queue := s.queues[key]
+	pkt := queue.packets[0]
+	queue.packets[0] = nil
+	queue.packets, queue.size = queue.packets[1:], queue.size-len(pkt.Data)
+	if len(queue.packets) > 0 {
+		s.order = append(s.order[1:], key)
+	} else {
+		s.order = s.order[1:]
+		delete(s.queues, key)
+	}
+	select {
+	case queue.space <- struct{}{}:
+	default:
+	}
+	return pkt
+}
+
+func (s *sendScheduler) run() {
+	for {
+		pkt := s.next()
+		if pkt == nil {
+			select {
+			case <-s.notify:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		if err := s.tunnel.Send(pkt); err != nil {
+			s.close(err)
+			return
+		}
+	}
+}
+
+func (s *sendScheduler) close(err error) {
+	s.once.Do(func() {
+		s.mu.Lock()
+		if err == nil {
+			err = net.ErrClosed
+		}
+		s.err, s.control, s.queues, s.order = err, nil, nil, nil
+		s.mu.Unlock()
+		close(s.done)
+	})
+}
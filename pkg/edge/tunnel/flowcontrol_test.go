@@ -0,0 +1,215 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pipeTunnel 内存中的隧道，用于测试
+type pipeTunnel struct {
+	in     <-chan *Packet
+	out    chan<- *Packet
+	closed chan struct{}
+	once   *sync.Once
+}
+
+func newPipeTunnel() (*pipeTunnel, *pipeTunnel) {
+	a, b, closed, once := make(chan *Packet, 64), make(chan *Packet, 64), make(chan struct{}), &sync.Once{}
+	return &pipeTunnel{in: a, out: b, closed: closed, once: once}, &pipeTunnel{in: b, out: a, closed: closed, once: once}
+}
+
+func (t *pipeTunnel) Recv(into *Packet) error {
+	select {
+	case pkt := <-t.in:
+		*into = *pkt
+		return nil
+	case <-t.closed:
+		return io.EOF
+	}
+}
+
+func (t *pipeTunnel) Send(pkt *Packet) error {
+	cp := *pkt
+	select {
+	case t.out <- &cp:
+		return nil
+	case <-t.closed:
+		return io.EOF
+	}
+}
+
+// Close 关闭两端
+func (t *pipeTunnel) Close() error {
+	t.once.Do(func() { close(t.closed) })
+	return nil
+}
+
+// waitFor 轮询直到条件满足，超时返回 false
+func waitFor(cond func() bool) bool {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(10 * time.Second)
+	for !cond() {
+		select {
+		case <-ticker.C:
+		case <-timeout:
+			return false
+		}
+	}
+	return true
+}
+
+// recordTunnel 记录发送的数据包
+type recordTunnel struct {
+	sent chan *Packet
+}
+
+func (t *recordTunnel) Recv(*Packet) error { return io.EOF }
+
+func (t *recordTunnel) Send(pkt *Packet) error {
+	t.sent <- pkt
+	return nil
+}
+
+func (t *recordTunnel) Close() error { return nil }
+
+func Test_sendScheduler(t *testing.T) {
+	rec := &recordTunnel{sent: make(chan *Packet, 16)}
+	s := newSendScheduler(rec)
+	defer s.close(nil)
+
+	data := func(src string, cid int64, content string) *Packet {
+		return &Packet{Kind: PacketKindData, Src: src, SrcCID: cid, Data: []byte(content)}
+	}
+	for _, pkt := range []*Packet{
+		data("a", 1, "a1"), data("a", 1, "a2"), data("a", 1, "a3"),
+		data("b", 1, "b1"),
+		{Kind: PacketKindClose, Src: "b", SrcCID: 1, Data: []byte("b-close")},
+		{Kind: PacketKindWindowUpdate, Src: "a", SrcCID: 1, Data: []byte("window")},
+		{Kind: PacketKindRoute, Src: "a", Data: []byte("route")},
+	} {
+		if err := s.Send(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	go s.run()
+
+	got := []string{}
+	for i := 0; i < 7; i++ {
+		got = append(got, string((<-rec.sent).Data))
+	}
+	// 控制包优先，连接之间轮询，关闭包与数据保持顺序
+	want := []string{"window", "route", "a1", "b1", "a2", "b-close", "a3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("send order = %v, want %v", got, want)
+	}
+}
+
+func Test_sendScheduler_backpressure(t *testing.T) {
+	s := newSendScheduler(&recordTunnel{sent: make(chan *Packet, 16)})
+
+	if err := s.Send(&Packet{Kind: PacketKindData, Src: "a", SrcCID: 1, Data: make([]byte, DefaultSendQueueSize)}); err != nil {
+		t.Fatal(err)
+	}
+	sent := make(chan error)
+	go func() {
+		sent <- s.Send(&Packet{Kind: PacketKindData, Src: "a", SrcCID: 1, Data: []byte("blocked")})
+	}()
+	select {
+	case <-sent:
+		t.Fatal("send should block when queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// 其他连接不受影响
+	if err := s.Send(&Packet{Kind: PacketKindData, Src: "b", SrcCID: 1, Data: []byte("b")}); err != nil {
+		t.Fatal(err)
+	}
+	go s.run()
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+	s.close(nil)
+	if err := s.Send(&Packet{Kind: PacketKindRoute}); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("send after close = %v, want %v", err, net.ErrClosed)
+	}
+}
+
+func Test_sendWindow(t *testing.T) {
+	done := make(chan struct{})
+	w := newSendWindow()
+	// 未启用流控时不限制
+	if err := w.acquire(DefaultWindowSize*2, done, nil); err != nil {
+		t.Fatal(err)
+	}
+	w.init(1024)
+	if err := w.acquire(1024, done, nil); err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan error)
+	go func() { acquired <- w.acquire(512, done, nil) }()
+	select {
+	case <-acquired:
+		t.Fatal("acquire should block when window exhausted")
+	case <-time.After(50 * time.Millisecond):
+	}
+	w.release(512)
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+	go func() { acquired <- w.acquire(512, done, nil) }()
+	close(done)
+	if err := <-acquired; !errors.Is(err, net.ErrClosed) {
+		t.Errorf("acquire after close = %v, want %v", err, net.ErrClosed)
+	}
+}
+
+func TestTunnelConn_flowControl(t *testing.T) {
+	pair := newTunnelPair(t)
+	conn, peer := pair.dial(t)
+	defer conn.Close()
+	go func() {
+		defer peer.Close()
+		_, _ = io.Copy(peer, peer)
+	}()
+
+	tunconn := conn.(*TunnelConn)
+	if !tunconn.window.enabled || tunconn.recvWindow != DefaultWindowSize {
+		t.Fatalf("flow control not negotiated")
+	}
+	// 写入超过窗口大小的数据，读取端消费后窗口更新
+	content := make([]byte, 4*DefaultWindowSize+123)
+	_, _ = rand.Read(content)
+	go func() {
+		if _, err := conn.Write(content); err != nil {
+			t.Error(err)
+		}
+	}()
+	got := make([]byte, len(content))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("echoed content mismatch")
+	}
+}
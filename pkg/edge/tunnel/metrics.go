@@ -0,0 +1,78 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TunnelCollector 采集隧道拓扑指标，每次采集时从路由表读取
+type TunnelCollector struct {
+	server      *TunnelServer
+	peers       *prometheus.Desc
+	peer        *prometheus.Desc
+	connections *prometheus.Desc
+}
+
+func NewTunnelCollector(server *TunnelServer) *TunnelCollector {
+	return &TunnelCollector{
+		server: server,
+		peers: prometheus.NewDesc(
+			prometheus.BuildFQName("kubegems", "edge_tunnel", "connected_peers"),
+			"Number of peers reachable through each direct connected tunnel",
+			[]string{"next_hop"},
+			nil,
+		),
+		peer: prometheus.NewDesc(
+			prometheus.BuildFQName("kubegems", "edge_tunnel", "peer_last_keepalive_seconds"),
+			"Unix time of the last keepalive received from the peer",
+			[]string{"peer", "next_hop", "hops"},
+			nil,
+		),
+		connections: prometheus.NewDesc(
+			prometheus.BuildFQName("kubegems", "edge_tunnel", "open_connections"),
+			"Number of open tunnel connections to the peer",
+			[]string{"peer"},
+			nil,
+		),
+	}
+}
+
+func (c *TunnelCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.peers
+	ch <- c.peer
+	ch <- c.connections
+}
+
+func (c *TunnelCollector) Collect(ch chan<- prometheus.Metric) {
+	topology := c.server.Topology()
+	peers := map[string]int{}
+	for _, route := range topology.Routes {
+		peers[route.NextHop]++
+		keepalive := float64(0)
+		if !route.LastKeepAlive.IsZero() {
+			keepalive = float64(route.LastKeepAlive.Unix())
+		}
+		ch <- prometheus.MustNewConstMetric(c.peer, prometheus.GaugeValue, keepalive,
+			route.Peer, route.NextHop, strconv.Itoa(route.Hops))
+		ch <- prometheus.MustNewConstMetric(c.connections, prometheus.GaugeValue, float64(route.Connections),
+			route.Peer)
+	}
+	for nexthop, count := range peers {
+		ch <- prometheus.MustNewConstMetric(c.peers, prometheus.GaugeValue, float64(count), nexthop)
+	}
+}
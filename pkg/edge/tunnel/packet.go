@@ -20,11 +20,13 @@ import (
 )
 
 const (
-	PacketKindData    PacketKind = iota // data or as a ack
-	PacketKindConnect                   // handshake and auth
-	PacketKindOpen                      // open connection
-	PacketKindClose                     // close connect/stream
-	PacketKindRoute                     // route update
+	PacketKindData         PacketKind = iota // data or as a ack
+	PacketKindConnect                        // handshake and auth
+	PacketKindOpen                           // open connection
+	PacketKindClose                          // close connect/stream
+	PacketKindRoute                          // route update
+	PacketKindWindowUpdate                   // flow control window update
+	PacketKindTrace                          // trace route request or reply
 )
 
 type PacketKind int
@@ -55,16 +57,38 @@ type PacketDataRoute struct {
 	Kind        RouteUpdateKind        `json:"kind,omitempty"`
 	Annotations Annotations            `json:"annotations,omitempty"`
 	Peers       map[string]Annotations `json:"peers,omitempty"`
+	Hops        map[string]int         `json:"hops,omitempty"` // hops from sender to peers, empty if not supported
 }
 
 type PacketDataConnect struct {
-	Token string `json:"token,omitempty"`
+	Token        string   `json:"token,omitempty"`
+	Compressions []string `json:"compressions,omitempty"` // supported compressions, empty if compression not supported
+}
+
+// PacketDataConnectAck 认证成功后的回复，Credential 为对端后续连接使用的凭据
+type PacketDataConnectAck struct {
+	Credential string `json:"credential,omitempty"`
 }
 
 type PacketDataOpen struct {
 	Network string        `json:"network,omitempty"`
 	Address string        `json:"address,omitempty"`
 	Timeout time.Duration `json:"timeout,omitempty"`
+	Window  int64         `json:"window,omitempty"` // receive window of opener, zero if flow control not supported
+}
+
+// PacketDataOpenAck the data of ack to open,empty if flow control not supported
+type PacketDataOpenAck struct {
+	Window int64 `json:"window,omitempty"` // receive window of acceptor
+}
+
+type PacketDataWindowUpdate struct {
+	Increment int64 `json:"increment,omitempty"`
+}
+
+type PacketDataTrace struct {
+	Reply bool     `json:"reply,omitempty"`
+	Path  []string `json:"path,omitempty"` // peers the trace request passed through in order
 }
 
 func PacketEncode(data any) []byte {
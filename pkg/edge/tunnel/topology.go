@@ -0,0 +1,208 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"kubegems.io/kubegems/pkg/log"
+)
+
+// DefaultTraceRouteTimeout 等待 trace route 回复的默认超时时间
+const DefaultTraceRouteTimeout = 10 * time.Second
+
+// Route 路由表中到某个节点的路由
+type Route struct {
+	Peer          string      `json:"peer"`
+	NextHop       string      `json:"nextHop"` // direct connected tunnel to the peer
+	Hops          int         `json:"hops"`
+	LastKeepAlive time.Time   `json:"lastKeepAlive,omitempty"`
+	Connections   int         `json:"connections"` // open connections to the peer
+	Annotations   Annotations `json:"annotations,omitempty"`
+}
+
+// Topology 节点所见的隧道拓扑
+type Topology struct {
+	ID         string  `json:"id"`
+	DefaultOut string  `json:"defaultOut,omitempty"` // tunnel used when no route to the destination
+	Routes     []Route `json:"routes"`
+}
+
+// TraceResult trace route 的结果
+type TraceResult struct {
+	Dest    string        `json:"dest"`
+	Path    []string      `json:"path"` // peers the packet passed through in order, include the source
+	Reached bool          `json:"reached"`
+	RTT     time.Duration `json:"rtt"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// routes 返回路由表中的所有路由，按照跳数以及节点排序
+func (t *RouteTable) routes() []Route {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	routes := map[string]Route{}
+	set := func(route Route) {
+		if exists, ok := routes[route.Peer]; !ok || route.Hops < exists.Hops {
+			routes[route.Peer] = route
+		}
+	}
+	for id, val := range t.records {
+		for child, annotations := range val.Children {
+			set(Route{
+				Peer:          child,
+				NextHop:       id,
+				Hops:          hopsOf(val.Hops, child) + 1,
+				LastKeepAlive: val.KeepAlive[child],
+				Annotations:   annotations,
+			})
+		}
+		set(Route{
+			Peer:          id,
+			NextHop:       id,
+			Hops:          1,
+			LastKeepAlive: val.KeepAlive[id],
+			Annotations:   val.Annotations,
+		})
+	}
+	ret := make([]Route, 0, len(routes))
+	for _, route := range routes {
+		ret = append(ret, route)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Hops != ret[j].Hops {
+			return ret[i].Hops < ret[j].Hops
+		}
+		return ret[i].Peer < ret[j].Peer
+	})
+	return ret
+}
+
+func (t *RouteTable) defaultOut() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.defaultout == nil {
+		return ""
+	}
+	return t.defaultout.ID
+}
+
+// Topology 返回当前的隧道拓扑以及到每个节点打开的连接数
+func (s *TunnelServer) Topology() Topology {
+	routes := s.routeTable.routes()
+	counts := s.connections.countByPeer()
+	for i := range routes {
+		routes[i].Connections = counts[routes[i].Peer]
+	}
+	return Topology{
+		ID:         s.id,
+		DefaultOut: s.routeTable.defaultOut(),
+		Routes:     routes,
+	}
+}
+
+// TraceRoute 向 dest 发送 trace 请求，返回数据包经过的节点
+// 请求经过的每个节点将自身加入路径，目的节点将完整路径回复给发送方；转发失败时由失败的节点回复。
+func (s *TunnelServer) TraceRoute(ctx context.Context, dest string) (*TraceResult, error) {
+	result := &TraceResult{Dest: dest, Path: []string{s.id}}
+	if dest == s.id {
+		result.Reached = true
+		return result, nil
+	}
+	next, err := s.routeTable.Select(dest)
+	if err != nil {
+		return nil, err
+	}
+	id := atomic.AddInt64(&s.traceid, 1)
+	reply := make(chan *Packet, 1)
+	s.traces.Store(id, reply)
+	defer s.traces.Delete(id)
+
+	start := time.Now()
+	if err := next.Send(&Packet{
+		Kind:   PacketKindTrace,
+		Src:    s.id,
+		SrcCID: id,
+		Dest:   dest,
+		Data:   PacketEncode(PacketDataTrace{Path: result.Path}),
+	}); err != nil {
+		return nil, err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTraceRouteTimeout)
+		defer cancel()
+	}
+	select {
+	case pkt := <-reply:
+		data := PacketDecode[PacketDataTrace](pkt.Data)
+		result.RTT = time.Since(start)
+		result.Path = data.Path
+		result.Error = pkt.Error
+		result.Reached = pkt.Error == "" && len(data.Path) > 0 && data.Path[len(data.Path)-1] == dest
+		return result, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("trace route to %s: no reply from peers", dest)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// traceHop 将本节点加入 trace 请求的路径
+func (s *TunnelServer) traceHop(pkt *Packet) {
+	data := PacketDecode[PacketDataTrace](pkt.Data)
+	if data.Reply {
+		return
+	}
+	data.Path = append(data.Path, s.id)
+	pkt.Data = PacketEncode(data)
+}
+
+// traceIn 处理发往本节点的 trace 请求或者回复
+func (s *TunnelServer) traceIn(channel *ConnectedTunnel, pkt *Packet) {
+	data := PacketDecode[PacketDataTrace](pkt.Data)
+	if data.Reply {
+		if val, ok := s.traces.Load(pkt.DestCID); ok {
+			select {
+			case val.(chan *Packet) <- pkt:
+			default:
+			}
+		}
+		return
+	}
+	s.traceReply(channel, pkt, "")
+}
+
+// traceReply 将 trace 请求已经经过的路径回复给发送方
+func (s *TunnelServer) traceReply(channel *ConnectedTunnel, pkt *Packet, errmsg string) {
+	data := PacketDecode[PacketDataTrace](pkt.Data)
+	if err := channel.Send(&Packet{
+		Kind:    PacketKindTrace,
+		Src:     s.id,
+		Dest:    pkt.Src,
+		DestCID: pkt.SrcCID,
+		Data:    PacketEncode(PacketDataTrace{Reply: true, Path: data.Path}),
+		Error:   errmsg,
+	}); err != nil {
+		log.Error(err, "trace reply", "dest", pkt.Src)
+	}
+}
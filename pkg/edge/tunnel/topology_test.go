@@ -0,0 +1,138 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newTunnelChain 创建 edge -> hub -> server 的三级隧道
+func newTunnelChain(t *testing.T) (server, hub, edge *TunnelServer) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	server, hub, edge = NewTunnelServer("server", nil), NewTunnelServer("hub", nil), NewTunnelServer("edge", nil)
+	connect := func(downstream, upstream *TunnelServer) {
+		down, up := newPipeTunnel()
+		go downstream.Connect(ctx, down, "", nil, TunnelOptions{SendRouteChange: true, IsDefaultOut: true})
+		go upstream.Connect(ctx, up, "", nil, TunnelOptions{})
+	}
+	// 等待路由传播到 server
+	waitRoutes := func(n int) {
+		if !waitFor(func() bool { return len(server.Topology().Routes) == n }) {
+			t.Fatalf("routes not propagated: %+v", server.Topology())
+		}
+	}
+	// hub 连接 server 完成前 edge 的上线通知不会转发给 server，依次连接
+	connect(hub, server)
+	waitRoutes(1)
+	connect(edge, hub)
+	waitRoutes(2)
+	return
+}
+
+func TestTunnelServer_Topology(t *testing.T) {
+	server, _, edge := newTunnelChain(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	conn, err := server.DialerOn("edge").DialTimeout("tcp", listener.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	topology := server.Topology()
+	got := []Route{}
+	for _, route := range topology.Routes {
+		if route.LastKeepAlive.IsZero() {
+			t.Errorf("missing last keepalive of %s", route.Peer)
+		}
+		route.LastKeepAlive = time.Time{}
+		got = append(got, route)
+	}
+	want := []Route{
+		{Peer: "hub", NextHop: "hub", Hops: 1},
+		{Peer: "edge", NextHop: "hub", Hops: 2, Connections: 1},
+	}
+	if topology.ID != "server" || topology.DefaultOut != "" || !reflect.DeepEqual(got, want) {
+		t.Errorf("Topology() = %+v, want routes %+v", topology, want)
+	}
+	if edge.Topology().DefaultOut != "hub" {
+		t.Errorf("edge default out = %s, want hub", edge.Topology().DefaultOut)
+	}
+
+	expected := `
+# HELP kubegems_edge_tunnel_open_connections Number of open tunnel connections to the peer
+# TYPE kubegems_edge_tunnel_open_connections gauge
+kubegems_edge_tunnel_open_connections{peer="edge"} 1
+kubegems_edge_tunnel_open_connections{peer="hub"} 0
+# HELP kubegems_edge_tunnel_connected_peers Number of peers reachable through each direct connected tunnel
+# TYPE kubegems_edge_tunnel_connected_peers gauge
+kubegems_edge_tunnel_connected_peers{next_hop="hub"} 2
+`
+	if err := testutil.CollectAndCompare(NewTunnelCollector(server), strings.NewReader(expected),
+		"kubegems_edge_tunnel_open_connections", "kubegems_edge_tunnel_connected_peers"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTunnelServer_TraceRoute(t *testing.T) {
+	server, hub, edge := newTunnelChain(t)
+
+	tests := []struct {
+		name        string
+		from        *TunnelServer
+		dest        string
+		wantPath    []string
+		wantReached bool
+		wantErr     bool
+	}{
+		{name: "self", from: hub, dest: "hub", wantPath: []string{"hub"}, wantReached: true},
+		{name: "downstream", from: server, dest: "edge", wantPath: []string{"server", "hub", "edge"}, wantReached: true},
+		{name: "upstream via default out", from: edge, dest: "server", wantPath: []string{"edge", "hub", "server"}, wantReached: true},
+		{name: "unreachable", from: edge, dest: "unknown", wantPath: []string{"edge", "hub", "server"}},
+		{name: "no route", from: server, dest: "unknown", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			result, err := tt.from.TraceRoute(ctx, tt.dest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TraceRoute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(result.Path, tt.wantPath) || result.Reached != tt.wantReached {
+				t.Errorf("TraceRoute() = %+v, want path %v reached %v", result, tt.wantPath, tt.wantReached)
+			}
+			if !tt.wantReached && result.Error == "" {
+				t.Errorf("missing error of unreachable trace")
+			}
+		})
+	}
+}
@@ -23,6 +23,7 @@ type Tunnel interface {
 type TunnelOptions struct {
 	SendRouteChange bool
 	IsDefaultOut    bool // send to this channel if no route
+	IsUpstream      bool // remote is upstream, authenticated by UpstreamAuth instead of the auth of server
 }
 
 type ConnectedTunnel struct {
@@ -30,4 +31,25 @@ type ConnectedTunnel struct {
 	ID              string
 	AnnotationsSent Annotations
 	Options         TunnelOptions
+
+	scheduler *sendScheduler
+}
+
+// Send 通过发送调度发送数据包，隧道连接建立之前直接发送
+func (t *ConnectedTunnel) Send(pkt *Packet) error {
+	if t.scheduler == nil {
+		return t.Tunnel.Send(pkt)
+	}
+	return t.scheduler.Send(pkt)
+}
+
+func (t *ConnectedTunnel) startScheduler() {
+	t.scheduler = newSendScheduler(t.Tunnel)
+	go t.scheduler.run()
+}
+
+func (t *ConnectedTunnel) stopScheduler() {
+	if t.scheduler != nil {
+		t.scheduler.close(nil)
+	}
 }
@@ -18,6 +18,10 @@ import (
 	"errors"
 	"io"
 	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/sync/errgroup"
@@ -37,12 +41,33 @@ type TunnelConn struct {
 	remote             string
 	remoteConnectionID int64
 
-	rdata  []byte
-	closed bool
-	ack    chan *connectData
+	mu       sync.Mutex // protect ack,closed and rawConn
+	closed   bool
+	closeErr error // returned by Read after closed
+	ack      chan *connectData
+	done     chan struct{}
+
+	rmu     sync.Mutex // serialize Read
+	rdata   []byte
+	rcost   int64 // window cost of the packet reading
+	unacked int64 // consumed but not acked to remote
+
+	wmu        sync.Mutex  // serialize Write
+	window     *sendWindow // send window,granted by remote
+	recvWindow int64       // receive window advertised to remote,zero if remote not support flow control
+
+	readDeadline  *connDeadline
+	writeDeadline *connDeadline
+	lastActive    atomic.Int64 // unix nano of last read or write
 }
 
 func (c *TunnelConn) recv(remotecid int64, data []byte, err string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	c.active()
 	select {
 	case c.ack <- &connectData{remoteID: remotecid, err: err, data: data}:
 		return nil
@@ -61,19 +86,63 @@ func (c *TunnelConn) opened(remotecid int64) {
 }
 
 func (c *TunnelConn) accepted(conn net.Conn) {
+	c.mu.Lock()
 	c.rawConn = conn
+	c.mu.Unlock()
 	eg := errgroup.Group{}
 	eg.Go(func() error {
-		_, err := io.Copy(c.rawConn, c)
+		_, err := io.Copy(conn, c)
+		// 对端关闭时已接收的数据均已写入
+		conn.Close()
 		return err
 	})
 	eg.Go(func() error {
-		_, err := io.Copy(c, c.rawConn)
+		_, err := io.Copy(c, conn)
+		// 隧道连接不支持半关闭，读取结束后关闭连接
+		c.Close()
 		return err
 	})
 	eg.Wait()
 }
 
+// shutdown 关闭连接，之后的 Read 在读取完已接收的数据后返回 err
+// 对端正常关闭(err 为 io.EOF)时不关闭原始连接，由 accepted 在写入剩余数据后关闭
+func (c *TunnelConn) shutdown(err error) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed, c.closeErr = true, err
+	close(c.ack)
+	close(c.done)
+	rawConn := c.rawConn
+	c.mu.Unlock()
+	if rawConn != nil && err != io.EOF {
+		// https://man7.org/linux/man-pages/man2/close.2.html
+		// close() will fail when a routine on block write()
+		return rawConn.Close()
+	}
+	return nil
+}
+
+func (c *TunnelConn) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *TunnelConn) active() {
+	c.lastActive.Store(time.Now().UnixNano())
+}
+
+func (c *TunnelConn) idle() time.Duration {
+	return time.Since(time.Unix(0, c.lastActive.Load()))
+}
+
 type connectData struct {
 	remoteID int64
 	err      string
@@ -81,13 +150,23 @@ type connectData struct {
 }
 
 func (c *TunnelConn) Read(b []byte) (n int, err error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	if c.readDeadline.expired() {
+		return 0, os.ErrDeadlineExceeded
+	}
 	var data []byte
 	if c.rdata != nil {
 		data = c.rdata
 	} else {
-		ack := <-c.ack
+		var ack *connectData
+		select {
+		case ack = <-c.ack:
+		case <-c.readDeadline.wait():
+			return 0, os.ErrDeadlineExceeded
+		}
 		if ack == nil /*closed*/ {
-			return 0, net.ErrClosed
+			return 0, c.closeErr
 		}
 		if ack.err == "EOF" {
 			return 0, io.EOF
@@ -96,10 +175,12 @@ func (c *TunnelConn) Read(b []byte) (n int, err error) {
 			return 0, errors.New(ack.err)
 		}
 		data = ack.data
+		c.rcost = packetCost(len(data))
 	}
 	if data == nil {
 		return 0, io.EOF
 	}
+	c.active()
 	if len(data) > len(b) {
 		copy(b, data[:len(b)])
 		c.rdata = data[len(b):]
@@ -107,48 +188,169 @@ func (c *TunnelConn) Read(b []byte) (n int, err error) {
 	}
 	c.rdata = nil
 	copy(b, data)
+	c.consumed(c.rcost)
 	return len(data), nil
 }
 
-func (c *TunnelConn) Write(b []byte) (n int, err error) {
-	if c.closed {
-		return 0, net.ErrClosed
+// consumed 数据包被读取后归还窗口，累计超过窗口的一半时通知对端
+func (c *TunnelConn) consumed(cost int64) {
+	if c.recvWindow <= 0 {
+		return
+	}
+	c.unacked += cost
+	if c.unacked < c.recvWindow/2 {
+		return
 	}
-	if err = c.sendData(b); err != nil {
-		return 0, err
+	if err := c.sendWindowUpdate(c.unacked); err != nil {
+		log.Error(err, "send window update", "cid", c.localConnectionID, "remote", c.remote)
+		return
+	}
+	c.unacked = 0
+}
+
+// Write 将数据拆分为不超过 MaxPacketDataSize 的数据包，窗口不足时阻塞直到超时
+func (c *TunnelConn) Write(b []byte) (n int, err error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	for len(b) > 0 {
+		if c.isClosed() {
+			return n, net.ErrClosed
+		}
+		if c.writeDeadline.expired() {
+			return n, os.ErrDeadlineExceeded
+		}
+		size := len(b)
+		if size > MaxPacketDataSize {
+			size = MaxPacketDataSize
+		}
+		if err := c.window.acquire(packetCost(size), c.done, c.writeDeadline.wait()); err != nil {
+			return n, err
+		}
+		// 数据包异步发送，不能引用调用方的 buffer
+		if err := c.sendData(append([]byte(nil), b[:size]...)); err != nil {
+			return n, err
+		}
+		c.active()
+		n, b = n+size, b[size:]
 	}
-	return len(b), err
+	return n, nil
 }
 
 // Close tunnel connection and close raw connection,remove self from connection manager
 func (c *TunnelConn) Close() error {
-	return c.sendClose(c.close())
+	if c.isClosed() {
+		return nil
+	}
+	closeErr := c.close()
+	if err := c.sendClose(nil); err != nil {
+		return err
+	}
+	return closeErr
 }
 
 func (c *TunnelConn) close() error {
-	return c.c.close(c.remoteConnectionID)
+	return c.c.close(c.localConnectionID, net.ErrClosed)
 }
 
 func (c *TunnelConn) LocalAddr() net.Addr {
-	return nil
+	return TunnelAddr{Peer: c.local, ConnectionID: c.localConnectionID}
 }
 
 func (c *TunnelConn) RemoteAddr() net.Addr {
-	return nil
+	return TunnelAddr{Peer: c.remote, ConnectionID: c.remoteConnectionID}
 }
 
 func (c *TunnelConn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
 	return nil
 }
 
 func (c *TunnelConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
 	return nil
 }
 
 func (c *TunnelConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
 	return nil
 }
 
+// TunnelAddr 隧道连接的地址，由对端 id 以及连接 id 组成
+type TunnelAddr struct {
+	Peer         string
+	ConnectionID int64
+}
+
+func (a TunnelAddr) Network() string {
+	return "tunnel"
+}
+
+func (a TunnelAddr) String() string {
+	return a.Peer + "/" + strconv.FormatInt(a.ConnectionID, 10)
+}
+
+// connDeadline 与 net.Pipe 的实现相同，超时后 wait 返回的 channel 被关闭
+type connDeadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{}
+}
+
+func newConnDeadline() *connDeadline {
+	return &connDeadline{cancel: make(chan struct{})}
+}
+
+// set 设置超时时间，零值表示不超时
+func (d *connDeadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// timer 已经触发时等待 cancel 被关闭
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel
+	}
+	d.timer = nil
+
+	closed := isClosedChan(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() { close(cancel) })
+		return
+	}
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+func (d *connDeadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+func (d *connDeadline) expired() bool {
+	return isClosedChan(d.wait())
+}
+
+func isClosedChan(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
 func (c *TunnelConn) sendData(data []byte) error {
 	return c.sendPkt(func(pkt *Packet) {
 		pkt.Kind = PacketKindData
@@ -172,6 +374,13 @@ func (c *TunnelConn) sendOpen(data PacketDataOpen) error {
 	})
 }
 
+func (c *TunnelConn) sendWindowUpdate(increment int64) error {
+	return c.sendPkt(func(pkt *Packet) {
+		pkt.Kind = PacketKindWindowUpdate
+		pkt.Data = PacketEncode(PacketDataWindowUpdate{Increment: increment})
+	})
+}
+
 func (c *TunnelConn) sendPkt(fun func(pkt *Packet)) error {
 	pkt := &Packet{
 		Kind:    PacketKindData,
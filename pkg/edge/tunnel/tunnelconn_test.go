@@ -0,0 +1,224 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/net/nettest"
+)
+
+// tunnelPair 通过内存隧道连接的两个 TunnelServer，a 通过隧道连接 b 后方的 listener
+type tunnelPair struct {
+	a, b     *TunnelServer
+	listener net.Listener
+	accepted chan net.Conn
+}
+
+func newTunnelPair(t *testing.T) *tunnelPair {
+	return newTunnelPairWith(t, func(ctx context.Context, a, b *TunnelServer) {
+		ta, tb := newPipeTunnel()
+		go a.Connect(ctx, ta, "", nil, TunnelOptions{SendRouteChange: true, IsDefaultOut: true})
+		go b.Connect(ctx, tb, "", nil, TunnelOptions{})
+	})
+}
+
+// newTunnelPairWith 使用 connect 将 a 作为下游连接到 b
+func newTunnelPairWith(t *testing.T, connect func(ctx context.Context, a, b *TunnelServer)) *tunnelPair {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	pair := &tunnelPair{
+		a:        NewTunnelServer("a", nil),
+		b:        NewTunnelServer("b", nil),
+		listener: listener,
+		accepted: make(chan net.Conn),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			pair.accepted <- conn
+		}
+	}()
+	connect(ctx, pair.a, pair.b)
+	return pair
+}
+
+// dial 返回 a 上的隧道连接以及 listener 接收到的连接
+func (p *tunnelPair) dial(t *testing.T) (net.Conn, net.Conn) {
+	var (
+		conn net.Conn
+		err  error
+	)
+	// 等待路由交换完成
+	waitFor(func() bool {
+		conn, err = p.a.DialerOn("b").DialTimeout("tcp", p.listener.Addr().String(), time.Second)
+		return err == nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case peer := <-p.accepted:
+		return conn, peer
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not accepted")
+		return nil, nil
+	}
+}
+
+func TestTunnelConn_nettest(t *testing.T) {
+	pair := newTunnelPair(t)
+	nettest.TestConn(t, func() (c1, c2 net.Conn, stop func(), err error) {
+		c1, c2 = pair.dial(t)
+		stop = func() {
+			c1.Close()
+			c2.Close()
+		}
+		return c1, c2, stop, nil
+	})
+}
+
+func TestTunnelConn_deadline(t *testing.T) {
+	pair := newTunnelPair(t)
+	conn, peer := pair.dial(t)
+	defer conn.Close()
+	defer peer.Close()
+
+	tests := []struct {
+		name string
+		set  func(time.Time) error
+		do   func() error
+	}{
+		{
+			name: "read",
+			set:  conn.SetReadDeadline,
+			do: func() error {
+				_, err := conn.Read(make([]byte, 8))
+				return err
+			},
+		},
+		{
+			name: "write",
+			set:  conn.SetWriteDeadline,
+			do: func() error {
+				// 对端不读取，窗口耗尽后写入阻塞
+				for {
+					if _, err := conn.Write(make([]byte, MaxPacketDataSize)); err != nil {
+						return err
+					}
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.set(time.Now().Add(50 * time.Millisecond))
+			start := time.Now()
+			err := tt.do()
+			if !errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Fatalf("err = %v, want %v", err, os.ErrDeadlineExceeded)
+			}
+			if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+				t.Errorf("err should be a timeout net.Error")
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("deadline exceeded after %s", elapsed)
+			}
+			tt.set(time.Time{})
+		})
+	}
+}
+
+func TestConnections_reapIdle(t *testing.T) {
+	pair := newTunnelPair(t)
+	idleconn, idlepeer := pair.dial(t)
+	defer idlepeer.Close()
+	activeconn, activepeer := pair.dial(t)
+	defer activeconn.Close()
+	defer activepeer.Close()
+
+	tunconn := idleconn.(*TunnelConn)
+	tunconn.lastActive.Store(time.Now().Add(-time.Hour).UnixNano())
+	if n := pair.a.connections.tunnel(tunconn.channel).reapIdle(time.Minute); n != 1 {
+		t.Fatalf("reaped %d connections, want 1", n)
+	}
+	if _, err := idleconn.Read(make([]byte, 8)); !errors.Is(err, ErrIdleTimeout) {
+		t.Errorf("read on reaped connection = %v, want %v", err, ErrIdleTimeout)
+	}
+	// 对端收到关闭后关闭了 listener 接收的连接
+	idlepeer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := idlepeer.Read(make([]byte, 8)); err != io.EOF {
+		t.Errorf("read on peer = %v, want %v", err, io.EOF)
+	}
+	// 活跃的连接不受影响
+	if _, err := activeconn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(activepeer, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("active connection broken: %v", err)
+	}
+}
+
+func TestTunnelServer_OriginOf(t *testing.T) {
+	pair := newTunnelPair(t)
+	conn, peer := pair.dial(t)
+	defer peer.Close()
+
+	want := Origin{Peer: "a", Tunnel: "a"}
+	if got, ok := pair.b.OriginOf(peer.RemoteAddr().String()); !ok || got != want {
+		t.Errorf("OriginOf() = %v, %v, want %v", got, ok, want)
+	}
+	if _, ok := pair.b.OriginOf(pair.listener.Addr().String()); ok {
+		t.Error("OriginOf() found origin of a connection not opened through the tunnel")
+	}
+	conn.Close()
+	if !waitFor(func() bool { _, ok := pair.b.OriginOf(peer.RemoteAddr().String()); return !ok }) {
+		t.Error("origin not removed after connection closed")
+	}
+}
+
+func TestTunnelServer_DialFilter(t *testing.T) {
+	pair := newTunnelPair(t)
+	pair.b.DialFilter = DenyDownstreamLocalDial
+
+	if !waitFor(func() bool { return pair.a.routeTable.Exists("b") }) {
+		t.Fatal("b not connected")
+	}
+	if _, err := pair.a.DialerOn("b").DialTimeout("tcp", pair.listener.Addr().String(), time.Second); err == nil {
+		t.Error("dial local address from downstream succeeded")
+	}
+	select {
+	case conn := <-pair.accepted:
+		conn.Close()
+		t.Error("local listener accepted connection from downstream")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
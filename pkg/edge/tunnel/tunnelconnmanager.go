@@ -18,9 +18,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"kubegems.io/kubegems/pkg/log"
@@ -29,6 +31,13 @@ import (
 const (
 	DefaultDataChannelSize = 512
 	MaxOpenConnectTimeout  = 30 * time.Second
+	// DefaultIdleTimeout 连接超过该时间没有读写时被关闭
+	DefaultIdleTimeout = 30 * time.Minute
+)
+
+var (
+	ErrIdleTimeout = errors.New("connection idle timeout")
+	ErrTunnelLost  = errors.New("tunnel lost")
 )
 
 type Connections struct {
@@ -47,8 +56,12 @@ func (c *Connections) pending(tun *ConnectedTunnel, remote string, remotecid int
 		local:              c.local,
 		localConnectionID:  atomic.AddInt64(&c.autoinc, 1),
 		ack:                make(chan *connectData, DefaultDataChannelSize),
-		closed:             false,
+		done:               make(chan struct{}),
+		window:             newSendWindow(),
+		readDeadline:       newConnDeadline(),
+		writeDeadline:      newConnDeadline(),
 	}
+	tunconn.active()
 	c.mu.Lock()
 	c.connections[tunconn.localConnectionID] = tunconn
 	c.mu.Unlock()
@@ -69,26 +82,22 @@ func (c *Connections) get(localcid int64) *TunnelConn {
 	return val
 }
 
-func (c *Connections) close(localcid int64) (err error) {
+// close 关闭连接，reason 为连接之后 Read 返回的错误
+func (c *Connections) close(localcid int64, reason error) (err error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	return c.closeWihoutLock(localcid)
+	return c.closeWihoutLock(localcid, reason)
 }
 
-func (c *Connections) closeWihoutLock(localcid int64) (err error) {
+func (c *Connections) closeWihoutLock(localcid int64, reason error) (err error) {
 	if conn, ok := c.connections[localcid]; ok {
 		log.Info("connection closed",
 			"cid", conn.localConnectionID,
 			"remote", conn.remote,
 			"remote cid", conn.remoteConnectionID,
+			"reason", reason,
 		)
-		close(conn.ack)
-		conn.closed = true
-		if conn.rawConn != nil {
-			// https://man7.org/linux/man-pages/man2/close.2.html
-			// close() will fail when a routine on block write()
-			err = conn.rawConn.Close()
-		}
+		err = conn.shutdown(reason)
 		delete(c.connections, localcid)
 	}
 	return
@@ -98,13 +107,39 @@ func (c *Connections) flush() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	for cid, conn := range c.connections {
-		_ = conn.c.closeWihoutLock(cid)
+		_ = conn.c.closeWihoutLock(cid, ErrTunnelLost)
+	}
+}
+
+// reapIdle 关闭超过 idle 时间没有读写的连接，并通知对端关闭
+func (c *Connections) reapIdle(idle time.Duration) int {
+	c.mu.RLock()
+	idles := []*TunnelConn{}
+	for _, conn := range c.connections {
+		if conn.idle() > idle {
+			idles = append(idles, conn)
+		}
 	}
+	c.mu.RUnlock()
+	for _, conn := range idles {
+		_ = c.close(conn.localConnectionID, ErrIdleTimeout)
+		_ = conn.sendClose(ErrIdleTimeout)
+	}
+	return len(idles)
+}
+
+// Origin 对端通过隧道打开的连接的发起方
+type Origin struct {
+	Peer     string // 发起连接的节点
+	Tunnel   string // 连接经由的直连隧道
+	Upstream bool   // 经由的隧道是否为上游
 }
 
 type ConnectionManager struct {
 	s       *TunnelServer
+	mu      sync.Mutex
 	tunnels map[string]*Connections
+	origins sync.Map // local address of accepted connection -> Origin
 }
 
 func NewConectionManager(s *TunnelServer) *ConnectionManager {
@@ -114,7 +149,29 @@ func NewConectionManager(s *TunnelServer) *ConnectionManager {
 	}
 }
 
+// countByPeer 返回到每个节点打开的连接数
+func (cm *ConnectionManager) countByPeer() map[string]int {
+	cm.mu.Lock()
+	tunnels := make([]*Connections, 0, len(cm.tunnels))
+	for _, connections := range cm.tunnels {
+		tunnels = append(tunnels, connections)
+	}
+	cm.mu.Unlock()
+
+	counts := map[string]int{}
+	for _, connections := range tunnels {
+		connections.mu.RLock()
+		for _, conn := range connections.connections {
+			counts[conn.remote]++
+		}
+		connections.mu.RUnlock()
+	}
+	return counts
+}
+
 func (cm *ConnectionManager) tunnel(tun *ConnectedTunnel) *Connections {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
 	val, ok := cm.tunnels[tun.ID]
 	if !ok {
 		val = &Connections{
@@ -142,7 +199,8 @@ func (cm *ConnectionManager) Open(network, address string, timeout time.Duration
 		"peer", dest, "cid", tunconn.localConnectionID,
 		"network", network, "address", address,
 	)
-	if err := tunconn.sendOpen(PacketDataOpen{Network: network, Address: address, Timeout: timeout}); err != nil {
+	tunconn.recvWindow = DefaultWindowSize
+	if err := tunconn.sendOpen(PacketDataOpen{Network: network, Address: address, Timeout: timeout, Window: tunconn.recvWindow}); err != nil {
 		return nil, err
 	}
 	// wait open ack
@@ -162,6 +220,15 @@ func (cm *ConnectionManager) Open(network, address string, timeout time.Duration
 		}
 		// established
 		tunconn.opened(ack.remoteID)
+		// remote not support flow control if no window in ack
+		ackdata := PacketDataOpenAck{}
+		if len(ack.data) > 0 {
+			ackdata = PacketDecode[PacketDataOpenAck](ack.data)
+		}
+		tunconn.window.init(ackdata.Window)
+		if ackdata.Window == 0 {
+			tunconn.recvWindow = 0
+		}
 		log.Info("connection opend",
 			"network", network, "address", address,
 			"cid", tunconn.localConnectionID,
@@ -188,15 +255,33 @@ func (cm *ConnectionManager) accept(fromtunnel *ConnectedTunnel, remote string,
 		"remote cid", tunConn.remoteConnectionID)
 
 	log.Info("dial options", "opts", dialOptions)
-	conn, err := net.DialTimeout(dialOptions.Network, dialOptions.Address, dialOptions.Timeout)
+	origin := Origin{Peer: remote, Tunnel: fromtunnel.ID, Upstream: fromtunnel.Options.IsUpstream}
+	dialer := &net.Dialer{Timeout: dialOptions.Timeout}
+	if filter := cm.s.DialFilter; filter != nil {
+		// check the resolved address right before connecting
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			return filter(origin, network, address)
+		}
+	}
+	conn, err := dialer.Dial(dialOptions.Network, dialOptions.Address)
 	if err != nil {
 		log.Error(err, "dial timeout", "options", dialOptions)
 		_ = tunConn.sendClose(err)
 		return
 	}
 	defer conn.Close()
+	local := conn.LocalAddr().String()
+	cm.origins.Store(local, origin)
+	defer cm.origins.Delete(local)
 
-	if err := tunConn.sendData([]byte{}); err != nil {
+	// enable flow control if remote supports
+	ackdata := []byte{}
+	if dialOptions.Window > 0 {
+		tunConn.window.init(dialOptions.Window)
+		tunConn.recvWindow = DefaultWindowSize
+		ackdata = PacketEncode(PacketDataOpenAck{Window: tunConn.recvWindow})
+	}
+	if err := tunConn.sendData(ackdata); err != nil {
 		log.Error(err, "connection send ack")
 		return
 	}
@@ -207,17 +292,61 @@ func (cm *ConnectionManager) accept(fromtunnel *ConnectedTunnel, remote string,
 	log.Info("connection exit")
 }
 
+// origin 返回本机地址为 local 的连接的发起方
+func (cm *ConnectionManager) origin(local string) (Origin, bool) {
+	val, ok := cm.origins.Load(local)
+	if !ok {
+		return Origin{}, false
+	}
+	return val.(Origin), true
+}
+
 func (cm *ConnectionManager) recv(fromtunnel *ConnectedTunnel, from string, fromCID int64, localcid int64, data []byte, err string) error {
 	log.Info("packet recv", "cid", localcid, "remote", from, "remote cid", fromCID)
 	conn := cm.tunnel(fromtunnel).get(localcid)
-	if conn == nil || conn.closed {
+	if conn == nil {
 		return net.ErrClosed
 	}
 	return conn.recv(fromCID, data, err)
 }
 
-func (cm *ConnectionManager) close(fromtunnel *ConnectedTunnel, remote string, remotecid int64, localcid int64) (err error) {
-	return cm.tunnel(fromtunnel).close(localcid)
+func (cm *ConnectionManager) windowUpdate(fromtunnel *ConnectedTunnel, localcid int64, data PacketDataWindowUpdate) {
+	if conn := cm.tunnel(fromtunnel).get(localcid); conn != nil {
+		conn.active()
+		conn.window.release(data.Increment)
+	}
+}
+
+// close 对端关闭连接，之后的 Read 返回 io.EOF 或者对端的错误
+func (cm *ConnectionManager) close(fromtunnel *ConnectedTunnel, remote string, remotecid int64, localcid int64, reason string) (err error) {
+	var readerr error = io.EOF
+	if reason != "" {
+		readerr = errors.New(reason)
+	}
+	return cm.tunnel(fromtunnel).close(localcid, readerr)
+}
+
+// reapIdle 定期关闭隧道上空闲的连接，直到 ctx 结束
+func (cm *ConnectionManager) reapIdle(ctx context.Context, tunnel *ConnectedTunnel, idle time.Duration) {
+	if idle <= 0 {
+		return
+	}
+	interval := idle / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n := cm.tunnel(tunnel).reapIdle(idle); n > 0 {
+				log.Info("idle connections reaped", "tunnel", tunnel.ID, "count", n)
+			}
+		}
+	}
 }
 
 // remoteLost close all connections on remote
@@ -15,10 +15,30 @@
 package tunnel
 
 import (
+	"net"
 	"net/http"
 	"time"
 )
 
+// LocalAPIAddress 返回对端通过隧道访问本机监听在 listen 上的 api 的地址，未指定监听 ip 时使用 127.0.0.1
+func LocalAPIAddress(listen string, tls bool) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		host, port = listen, ""
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	scheme := "http"
+	if tls {
+		scheme = "https"
+	}
+	if port == "" {
+		return scheme + "://" + host
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
+
 // nolint: gomnd
 // same with http.DefaultTransport
 // use http2 rr to reuse http(tcp) connection
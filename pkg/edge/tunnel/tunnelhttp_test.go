@@ -0,0 +1,38 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import "testing"
+
+func TestLocalAPIAddress(t *testing.T) {
+	tests := []struct {
+		listen string
+		tls    bool
+		want   string
+	}{
+		{listen: ":8080", want: "http://127.0.0.1:8080"},
+		{listen: "0.0.0.0:8080", want: "http://127.0.0.1:8080"},
+		{listen: "[::]:8080", tls: true, want: "https://127.0.0.1:8080"},
+		{listen: "10.0.0.1:8080", want: "http://10.0.0.1:8080"},
+		{listen: "[fd00::1]:8080", want: "http://[fd00::1]:8080"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.listen, func(t *testing.T) {
+			if got := LocalAPIAddress(tt.listen, tt.tls); got != tt.want {
+				t.Errorf("LocalAPIAddress() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -17,6 +17,7 @@ package tunnel
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"golang.org/x/exp/maps"
 	"kubegems.io/kubegems/pkg/log"
@@ -40,6 +41,8 @@ type ChannelWithChildren struct {
 	Channel     *ConnectedTunnel // channel is the direct connected channel
 	Annotations map[string]string
 	Children    map[string]Annotations // children are channels connected to the direct channel
+	Hops        map[string]int         // hops from the direct channel to children, 1 if unknown
+	KeepAlive   map[string]time.Time   // last keepalive of the direct channel and children
 }
 
 func (t *RouteTable) Select(dest string) (*ConnectedTunnel, error) {
@@ -65,7 +68,9 @@ func (t *RouteTable) Connect(tun *ConnectedTunnel, data PacketDataRoute) {
 	log.Info("tunnel connected", "tunnel", tun.ID)
 	// default out tunnel
 	if tun.Options.IsDefaultOut {
+		t.mu.Lock()
 		t.defaultout = tun
+		t.mu.Unlock()
 	}
 	t.OnChange(tun, data)
 }
@@ -94,6 +99,7 @@ func (t *RouteTable) Disconnect(stream *ConnectedTunnel) {
 	t.mu.Lock()
 	val, ok := t.records[stream.ID]
 	if !ok {
+		t.mu.Unlock()
 		return
 	}
 	removedPeers := maps.Clone(val.Children)
@@ -120,32 +126,51 @@ func (t *RouteTable) OnChange(from *ConnectedTunnel, data PacketDataRoute) {
 		Kind:        data.Kind,
 		Annotations: data.Annotations,
 		Peers:       map[string]Annotations{},
+		Hops:        map[string]int{},
 	}
+	now := time.Now()
 
 	switch data.Kind {
 	case RouteUpdateKindReferesh:
 		if data.Peers == nil {
 			data.Peers = map[string]Annotations{}
 		}
+		keepalive := map[string]time.Time{id: now}
+		for peer := range data.Peers {
+			keepalive[peer] = now
+		}
 		if val, ok := t.records[id]; !ok {
-			t.records[id] = &ChannelWithChildren{Channel: from, Annotations: data.Annotations, Children: data.Peers}
+			t.records[id] = &ChannelWithChildren{
+				Channel:     from,
+				Annotations: data.Annotations,
+				Children:    data.Peers,
+				Hops:        childHops(data),
+				KeepAlive:   keepalive,
+			}
 		} else {
 			// may not happen
 			val.Annotations = data.Annotations
 			val.Children = data.Peers
+			val.Hops = childHops(data)
+			val.KeepAlive = keepalive
 			// refresh tunnel annotations
 			val.Annotations = data.Annotations
 		}
 		changeddata.Kind = RouteUpdateKindOnline
 		maps.Copy(changeddata.Peers, data.Peers)
+		relayHops(changeddata.Hops, data)
 		// advertise all peers and tun self are online
 		changeddata.Peers[id] = data.Annotations
+		changeddata.Hops[id] = 1
 	case RouteUpdateKindKeepAlive:
 		val, ok := t.records[id]
 		if !ok {
+			t.mu.Unlock()
 			return
 		}
 		for alive, anno := range data.Peers {
+			val.KeepAlive[alive] = now
+			val.Hops[alive] = hopsOf(data.Hops, alive)
 			if _, ok := val.Children[alive]; ok {
 				continue
 			}
@@ -153,13 +178,17 @@ func (t *RouteTable) OnChange(from *ConnectedTunnel, data PacketDataRoute) {
 		}
 		// refresh tunnel annotations
 		val.Annotations = data.Annotations
+		val.KeepAlive[id] = now
 		changeddata.Kind = RouteUpdateKindKeepAlive
 		maps.Copy(changeddata.Peers, data.Peers)
+		relayHops(changeddata.Hops, data)
 		// advertise all peers and tun self are keep alived
 		changeddata.Peers[id] = data.Annotations
+		changeddata.Hops[id] = 1
 	case RouteUpdateKindOnline:
 		val, ok := t.records[id]
 		if !ok {
+			t.mu.Unlock()
 			return
 		}
 		for add, anno := range data.Peers {
@@ -167,12 +196,16 @@ func (t *RouteTable) OnChange(from *ConnectedTunnel, data PacketDataRoute) {
 				continue
 			}
 			val.Children[add] = anno
+			val.Hops[add] = hopsOf(data.Hops, add)
+			val.KeepAlive[add] = now
 		}
 		changeddata.Kind = RouteUpdateKindOnline
 		maps.Copy(changeddata.Peers, data.Peers)
+		relayHops(changeddata.Hops, data)
 	case RouteUpdateKindOffline:
 		val, ok := t.records[id]
 		if !ok {
+			t.mu.Unlock()
 			return
 		}
 		for remove := range data.Peers {
@@ -180,6 +213,8 @@ func (t *RouteTable) OnChange(from *ConnectedTunnel, data PacketDataRoute) {
 				continue
 			}
 			delete(val.Children, remove)
+			delete(val.Hops, remove)
+			delete(val.KeepAlive, remove)
 		}
 		changeddata.Annotations = val.Annotations
 		changeddata.Kind = RouteUpdateKindOffline
@@ -191,6 +226,53 @@ func (t *RouteTable) OnChange(from *ConnectedTunnel, data PacketDataRoute) {
 	t.onchange(id, changeddata)
 }
 
+// hopsOf 返回 hops 中到 peer 的跳数，不支持跳数的对端返回 1
+func hopsOf(hops map[string]int, peer string) int {
+	if n, ok := hops[peer]; ok && n > 0 {
+		return n
+	}
+	return 1
+}
+
+// childHops 返回路由更新中从发送方到各个节点的跳数
+func childHops(data PacketDataRoute) map[string]int {
+	hops := make(map[string]int, len(data.Peers))
+	for peer := range data.Peers {
+		hops[peer] = hopsOf(data.Hops, peer)
+	}
+	return hops
+}
+
+// relayHops 将路由更新中的跳数转换为从本节点出发的跳数
+func relayHops(into map[string]int, data PacketDataRoute) {
+	for peer := range data.Peers {
+		into[peer] = hopsOf(data.Hops, peer) + 1
+	}
+}
+
+// allRechableHops 返回从本节点到所有可达节点的跳数
+func (t *RouteTable) allRechableHops(exclude string) map[string]int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	ret := map[string]int{}
+	set := func(peer string, hops int) {
+		if exists, ok := ret[peer]; !ok || hops < exists {
+			ret[peer] = hops
+		}
+	}
+	for k, val := range t.records {
+		if k == exclude {
+			continue
+		}
+		for child := range val.Children {
+			set(child, hopsOf(val.Hops, child)+1)
+		}
+		set(k, 1)
+	}
+	return ret
+}
+
 func (t *RouteTable) allRechablePeers(exclude string) map[string]Annotations {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
@@ -256,11 +338,23 @@ func (t *RouteTable) advertise(changesFrom string, changes PacketDataRoute) {
 				Kind:        changes.Kind,
 				Annotations: peer.Channel.AnnotationsSent,
 				Peers:       changes.Peers,
+				Hops:        changes.Hops,
 			}),
 		})
 	}
 }
 
+// Direct 返回与 id 直接连接的隧道
+func (t *RouteTable) Direct(id string) (*ConnectedTunnel, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	val, ok := t.records[id]
+	if !ok {
+		return nil, false
+	}
+	return val.Channel, true
+}
+
 func (t *RouteTable) Exists(id string) bool {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
@@ -289,6 +383,7 @@ func (t *RouteTable) advertiseKeepalive(idchannel *ConnectedTunnel, annotationsT
 		Kind:        RouteUpdateKindKeepAlive,
 		Annotations: annotationsToSend,
 		Peers:       t.allRechablePeers(idchannel.ID),
+		Hops:        t.allRechableHops(idchannel.ID),
 	}
 	log.Info("route keepalive", "dest", idchannel.ID, "data", data)
 	// advetise self peers
@@ -308,6 +403,7 @@ func (t *RouteTable) advertiseInit(idchannel *ConnectedTunnel, annotationsToSend
 	}
 	if idchannel.Options.SendRouteChange {
 		data.Peers = t.allRechablePeers(idchannel.ID)
+		data.Hops = t.allRechableHops(idchannel.ID)
 	}
 	log.Info("route init", "dest", idchannel.ID, "data", data)
 	// advetise self peers
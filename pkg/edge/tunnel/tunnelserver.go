@@ -21,6 +21,7 @@ import (
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -30,12 +31,26 @@ import (
 var DefaultDialTimeout = 30 * time.Second
 
 type TunnelServer struct {
+	// IdleTimeout 连接超过该时间没有读写时被关闭，为 0 时不关闭
+	IdleTimeout time.Duration
+	// Compressions 启用的数据包压缩算法，与对端协商后使用，为空时不压缩
+	Compressions []string
+	// OnCredential 上游签发凭据后调用，用于持久化凭据
+	OnCredential func(credential string)
+	// UpstreamAuth 校验连接的上游，为空时不校验；NewTunnelServer 指定的认证仅用于下游的连接
+	UpstreamAuth AuthenticationManager
+	// DialFilter 在接受对端打开的连接时校验解析后的地址，返回错误时拒绝连接，为空时不限制
+	DialFilter func(origin Origin, network, address string) error
+
+	credential         atomic.Value // string, credential issued by upstream
 	auth               AuthenticationManager
 	id                 string
 	connections        *ConnectionManager
 	routeTable         *RouteTable
 	eventer            *TunnelEventer
 	statefultransports sync.Map
+	traceid            int64
+	traces             sync.Map // trace id -> chan *Packet
 }
 
 func NewTunnelServer(id string, auth AuthenticationManager) *TunnelServer {
@@ -43,8 +58,9 @@ func NewTunnelServer(id string, auth AuthenticationManager) *TunnelServer {
 		auth = &NonAuthManager{}
 	}
 	s := &TunnelServer{
-		id:   id,
-		auth: auth,
+		IdleTimeout: DefaultIdleTimeout,
+		id:          id,
+		auth:        auth,
 	}
 	s.routeTable = NewEmptyRouteTable(s)
 	s.connections = NewConectionManager(s)
@@ -53,11 +69,13 @@ func NewTunnelServer(id string, auth AuthenticationManager) *TunnelServer {
 }
 
 func (s *TunnelServer) Connect(ctx context.Context, channel Tunnel, token string, annotations Annotations, options TunnelOptions) error {
-	connectedChannel, err := s.authStage(ctx, channel, token)
+	connectedChannel, err := s.authStage(ctx, channel, token, options.IsUpstream)
 	if err != nil {
 		return err
 	}
 	connectedChannel.Options = options
+	connectedChannel.startScheduler()
+	defer connectedChannel.stopScheduler()
 	// check exists tunnel
 	if err := s.existsCheckStage(ctx, connectedChannel); err != nil {
 		return err
@@ -70,6 +88,10 @@ func (s *TunnelServer) Connect(ctx context.Context, channel Tunnel, token string
 	s.routeTable.Connect(connectedChannel, *routedata)
 	defer s.routeTable.Disconnect(connectedChannel)
 
+	reapctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.connections.reapIdle(reapctx, connectedChannel, s.IdleTimeout)
+
 	for {
 		pkt := new(Packet)
 		if err := connectedChannel.Recv(pkt); err != nil {
@@ -79,10 +101,54 @@ func (s *TunnelServer) Connect(ctx context.Context, channel Tunnel, token string
 	}
 }
 
-func (s *TunnelServer) authStage(ctx context.Context, channel Tunnel, token string) (*ConnectedTunnel, error) {
+// OriginOf 返回通过隧道打开并在本机连接到 remoteAddr 的连接的发起方，用于本机服务识别经由隧道的请求
+func (s *TunnelServer) OriginOf(remoteAddr string) (Origin, bool) {
+	return s.connections.origin(remoteAddr)
+}
+
+// Disconnect 关闭与 peer 直接连接的隧道，peer 未直接连接时返回 false
+func (s *TunnelServer) Disconnect(peer string) bool {
+	channel, ok := s.routeTable.Direct(peer)
+	if !ok {
+		return false
+	}
+	log.Info("disconnect tunnel", "tunnel", peer)
+	_ = channel.Close()
+	return true
+}
+
+// SetCredential 设置连接时使用的凭据，设置后替代连接时指定的 token
+func (s *TunnelServer) SetCredential(credential string) {
+	s.credential.Store(credential)
+}
+
+func (s *TunnelServer) Credential() string {
+	credential, _ := s.credential.Load().(string)
+	return credential
+}
+
+// authenticate 校验对端，认证管理器支持签发凭据时返回签发给对端的凭据
+func (s *TunnelServer) authenticate(ctx context.Context, name string, token string, upstream bool) (string, error) {
+	auth := s.auth
+	if upstream {
+		if s.UpstreamAuth == nil {
+			return "", nil
+		}
+		auth = s.UpstreamAuth
+	}
+	if exchanger, ok := auth.(CredentialExchanger); ok {
+		return exchanger.Exchange(ctx, name, token)
+	}
+	return "", auth.Authentication(ctx, name, token)
+}
+
+func (s *TunnelServer) authStage(ctx context.Context, channel Tunnel, token string, upstream bool) (*ConnectedTunnel, error) {
+	if credential := s.Credential(); credential != "" {
+		token = credential
+	}
 	// send meta and auth
-	connectData := PacketDataConnect{Token: token}
-	log.Info("connect send", "data", connectData)
+	connectData := PacketDataConnect{Token: token, Compressions: s.Compressions}
+	log.Info("connect send", "compressions", connectData.Compressions)
 	if err := channel.Send(&Packet{
 		Kind: PacketKindConnect,
 		Src:  s.id,
@@ -101,7 +167,8 @@ func (s *TunnelServer) authStage(ctx context.Context, channel Tunnel, token stri
 
 	remoteid := connectpkt.Src
 	connectData = PacketDecode[PacketDataConnect](connectpkt.Data)
-	log.Info("connect recv", "remote", remoteid, "data", connectData)
+	compression := negotiateCompression(s.Compressions, connectData.Compressions)
+	log.Info("connect recv", "remote", remoteid, "compressions", connectData.Compressions)
 	// check not empty remote id
 	if remoteid == "" {
 		err := errors.New("empty tunnel id")
@@ -109,13 +176,18 @@ func (s *TunnelServer) authStage(ctx context.Context, channel Tunnel, token stri
 		return nil, err
 	}
 	// check remote auth
-	if err := s.auth.Authentication(ctx, remoteid, connectData.Token); err != nil {
+	credential, err := s.authenticate(ctx, remoteid, connectData.Token, upstream)
+	if err != nil {
 		_ = channel.Send(&Packet{Kind: PacketKindClose, Error: err.Error()})
-		log.Error(err, "auth faild", "remote", remoteid, "token", connectData.Token)
+		log.Error(err, "auth faild", "remote", remoteid)
 		return nil, err
 	}
 	// send ack
-	if err := channel.Send(&Packet{Kind: PacketKindData, Src: s.id, Dest: remoteid}); err != nil {
+	ack := &Packet{Kind: PacketKindData, Src: s.id, Dest: remoteid}
+	if credential != "" {
+		ack.Data = PacketEncode(PacketDataConnectAck{Credential: credential})
+	}
+	if err := channel.Send(ack); err != nil {
 		return nil, err
 	}
 	// wait ack
@@ -126,7 +198,22 @@ func (s *TunnelServer) authStage(ctx context.Context, channel Tunnel, token stri
 	if ackpkt.Kind == PacketKindClose || ackpkt.Error != "" {
 		return nil, fmt.Errorf("remote channel closed: %s", ackpkt.Error)
 	}
-	log.Info("auth success", "remote", remoteid)
+	if ackdata := PacketDecode[PacketDataConnectAck](ackpkt.Data); ackdata.Credential != "" {
+		log.Info("credential issued", "remote", remoteid)
+		s.SetCredential(ackdata.Credential)
+		if s.OnCredential != nil {
+			s.OnCredential(ackdata.Credential)
+		}
+	}
+	log.Info("auth success", "remote", remoteid, "compression", compression)
+	// packets after ack are compressed
+	if compression != "" {
+		compressed, err := NewCompressedTunnel(channel, compression)
+		if err != nil {
+			return nil, err
+		}
+		channel = compressed
+	}
 	// connected
 	return &ConnectedTunnel{Tunnel: channel, ID: remoteid}, nil
 }
@@ -148,6 +235,9 @@ func (s *TunnelServer) preRouting(income *ConnectedTunnel, pkt *Packet) {
 		pkt.Dest = s.id
 	}
 	if pkt.Dest != s.id {
+		if pkt.Kind == PacketKindTrace {
+			s.traceHop(pkt)
+		}
 		s.forward(income, pkt)
 	} else {
 		s.localIn(income, pkt)
@@ -159,30 +249,35 @@ func (s *TunnelServer) forward(income *ConnectedTunnel, pkt *Packet) error {
 	targetPeer, err := s.routeTable.Select(pkt.Dest)
 	if err != nil {
 		log.Error(err, "close forward", "src", pkt.Src, "dest", pkt.Dest)
-		_ = income.Send(&Packet{
-			Kind:    PacketKindClose,
-			Src:     s.id,
-			Dest:    pkt.Src,
-			DestCID: pkt.SrcCID,
-			Error:   err.Error(),
-		})
+		s.forwardFailed(income, pkt, err)
 		log.Error(err, "choose")
 		return err
 	}
 	if err := targetPeer.Send(pkt); err != nil {
-		_ = income.Send(&Packet{
-			Kind:    PacketKindClose,
-			Src:     s.id,
-			Dest:    pkt.Src,
-			DestCID: pkt.SrcCID,
-			Error:   err.Error(),
-		})
+		s.forwardFailed(income, pkt, err)
 		log.Error(err, "forward")
 		return err
 	}
 	return nil
 }
 
+// forwardFailed 通知发送方转发失败，trace 请求回复已经经过的路径
+func (s *TunnelServer) forwardFailed(income *ConnectedTunnel, pkt *Packet, err error) {
+	if pkt.Kind == PacketKindTrace {
+		if !PacketDecode[PacketDataTrace](pkt.Data).Reply {
+			s.traceReply(income, pkt, err.Error())
+		}
+		return
+	}
+	_ = income.Send(&Packet{
+		Kind:    PacketKindClose,
+		Src:     s.id,
+		Dest:    pkt.Src,
+		DestCID: pkt.SrcCID,
+		Error:   err.Error(),
+	})
+}
+
 func (s *TunnelServer) localIn(channel *ConnectedTunnel, pkt *Packet) {
 	log.Info("packet in", "src", pkt.Src, "dest", pkt.Dest)
 	switch pkt.Kind {
@@ -201,9 +296,14 @@ func (s *TunnelServer) localIn(channel *ConnectedTunnel, pkt *Packet) {
 			})
 		}
 	case PacketKindClose:
-		go s.connections.close(channel, pkt.Src, pkt.SrcCID, pkt.DestCID)
+		go s.connections.close(channel, pkt.Src, pkt.SrcCID, pkt.DestCID, pkt.Error)
+	case PacketKindWindowUpdate:
+		s.connections.windowUpdate(channel, pkt.DestCID, PacketDecode[PacketDataWindowUpdate](pkt.Data))
 	case PacketKindRoute:
 		go s.routeTable.OnChange(channel, PacketDecode[PacketDataRoute](pkt.Data))
+	case PacketKindTrace:
+		s.traceHop(pkt)
+		s.traceIn(channel, pkt)
 	}
 }
 
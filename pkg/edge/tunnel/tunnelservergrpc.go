@@ -17,6 +17,8 @@ package tunnel
 import (
 	"context"
 	"crypto/tls"
+	"errors"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -25,6 +27,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/peer"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"kubegems.io/kubegems/pkg/edge/tunnel/proto"
 	"kubegems.io/kubegems/pkg/log"
@@ -58,7 +61,14 @@ type grpcstream interface {
 }
 
 type GRPCTunnel[T grpcstream] struct {
-	inner T
+	inner  T
+	cancel context.CancelFunc // cancels the client stream
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newGRPCTunnel[T grpcstream](inner T, cancel context.CancelFunc) *GRPCTunnel[T] {
+	return &GRPCTunnel[T]{inner: inner, cancel: cancel, closed: make(chan struct{})}
 }
 
 func (t *GRPCTunnel[T]) Recv(into *Packet) error {
@@ -66,6 +76,15 @@ func (t *GRPCTunnel[T]) Recv(into *Packet) error {
 	if err != nil {
 		return err
 	}
+	fromProtoPacket(pkt, into)
+	return nil
+}
+
+func (t *GRPCTunnel[T]) Send(from *Packet) error {
+	return t.inner.Send(toProtoPacket(from))
+}
+
+func fromProtoPacket(pkt *proto.Packet, into *Packet) {
 	into.Kind = PacketKind(pkt.Kind)
 	into.Data = pkt.Data
 	into.Error = pkt.Error
@@ -73,11 +92,10 @@ func (t *GRPCTunnel[T]) Recv(into *Packet) error {
 	into.DestCID = pkt.DestID
 	into.Src = pkt.Src
 	into.SrcCID = pkt.SrcID
-	return nil
 }
 
-func (t *GRPCTunnel[T]) Send(from *Packet) error {
-	return t.inner.Send(&proto.Packet{
+func toProtoPacket(from *Packet) *proto.Packet {
+	return &proto.Packet{
 		Src:    from.Src,
 		SrcID:  from.SrcCID,
 		Dest:   from.Dest,
@@ -85,10 +103,17 @@ func (t *GRPCTunnel[T]) Send(from *Packet) error {
 		Kind:   int64(from.Kind),
 		Data:   from.Data,
 		Error:  from.Error,
-	})
+	}
 }
 
+// Close 客户端取消 stream；服务端的 stream 在 Connect 返回后结束
 func (t *GRPCTunnel[T]) Close() error {
+	t.once.Do(func() {
+		close(t.closed)
+		if t.cancel != nil {
+			t.cancel()
+		}
+	})
 	return nil
 }
 
@@ -124,12 +149,29 @@ type GrpcTunnelServer struct {
 }
 
 func (s GrpcTunnelServer) Connect(connectServer proto.PeerService_ConnectServer) error {
-	return s.TunnelServer.Connect(
-		connectServer.Context(), // context
-		&GRPCTunnel[proto.PeerService_ConnectServer]{inner: connectServer}, // grpc based tunnel
-		"",                                    // server do't provide a token to client, required no auth for client.
-		s.ClientAnnotations,                   // annotations send to downstream clients
-		TunnelOptions{SendRouteChange: false}) // we don't send route update to downstream channels.
+	ctx := connectServer.Context()
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			ctx = WithPeerCertificates(ctx, info.State.PeerCertificates)
+		}
+	}
+	tun := newGRPCTunnel[proto.PeerService_ConnectServer](connectServer, nil) // grpc based tunnel
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.TunnelServer.Connect(
+			ctx, // context
+			tun,
+			"",                                    // server do't provide a token to client, required no auth for client.
+			s.ClientAnnotations,                   // annotations send to downstream clients
+			TunnelOptions{SendRouteChange: false}) // we don't send route update to downstream channels.
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-tun.closed:
+		// the stream ends once returned, then the pending Recv fails
+		return errors.New("tunnel closed")
+	}
 }
 
 func (s GrpcTunnelServer) GrpcServer(tlsConfig *tls.Config) *grpc.Server {
@@ -178,13 +220,16 @@ func (s GrpcTunnelServer) ConnectUpstream(ctx context.Context, addr string, tlsC
 		c.Close()
 	}()
 
-	stream, err := proto.NewPeerServiceClient(c).Connect(ctx)
+	streamctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := proto.NewPeerServiceClient(c).Connect(streamctx)
 	if err != nil {
 		return err
 	}
-	peer := &GRPCTunnel[proto.PeerService_ConnectClient]{inner: stream}
+	peer := newGRPCTunnel[proto.PeerService_ConnectClient](stream, cancel)
 	return s.TunnelServer.Connect(ctx, peer, token, annotations, TunnelOptions{
 		SendRouteChange: true,
 		IsDefaultOut:    true, // as default out if no route info
+		IsUpstream:      true,
 	})
 }
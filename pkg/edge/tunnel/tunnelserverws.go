@@ -0,0 +1,246 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	protobuf "google.golang.org/protobuf/proto"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"kubegems.io/kubegems/pkg/edge/tunnel/proto"
+	"kubegems.io/kubegems/pkg/log"
+)
+
+const (
+	TransportGRPC      = "grpc"
+	TransportWebSocket = "websocket"
+
+	// DefaultWebSocketPath 服务端接收 WebSocket 隧道的路径
+	DefaultWebSocketPath = "/v1/tunnel"
+	// DefaultWebSocketPingInterval 发送 ping 的间隔，超过三个间隔没有收到消息时认为隧道断开
+	DefaultWebSocketPingInterval = 30 * time.Second
+)
+
+// UpstreamConnector 通过某种传输方式连接上游
+type UpstreamConnector interface {
+	ConnectUpstreamWithRetry(ctx context.Context, addr string, tlsConfig *tls.Config, token string, annotations Annotations) error
+}
+
+// NewUpstreamConnector 返回指定传输方式的 UpstreamConnector，transport 为空时使用 grpc
+func NewUpstreamConnector(transport string, server *TunnelServer) (UpstreamConnector, error) {
+	switch transport {
+	case "", TransportGRPC:
+		return GrpcTunnelServer{TunnelServer: server}, nil
+	case TransportWebSocket:
+		return WebSocketTunnelServer{TunnelServer: server}, nil
+	default:
+		return nil, fmt.Errorf("unsupported tunnel transport %s", transport)
+	}
+}
+
+// WebSocketTunnel 基于 WebSocket 的隧道，每个数据包使用与 grpc 相同的 protobuf 编码作为一个二进制消息发送
+type WebSocketTunnel struct {
+	conn *websocket.Conn
+	wmu  sync.Mutex
+	done chan struct{}
+	once sync.Once
+}
+
+func NewWebSocketTunnel(conn *websocket.Conn, pingInterval time.Duration) *WebSocketTunnel {
+	t := &WebSocketTunnel{conn: conn, done: make(chan struct{})}
+	if pingInterval > 0 {
+		t.extendReadDeadline(pingInterval)
+		conn.SetPongHandler(func(string) error {
+			t.extendReadDeadline(pingInterval)
+			return nil
+		})
+		go t.keepalive(pingInterval)
+	}
+	return t
+}
+
+func (t *WebSocketTunnel) extendReadDeadline(pingInterval time.Duration) {
+	_ = t.conn.SetReadDeadline(time.Now().Add(3 * pingInterval))
+}
+
+func (t *WebSocketTunnel) keepalive(pingInterval time.Duration) {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			// WriteControl 可以与其他写入并发调用
+			if err := t.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(pingInterval)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (t *WebSocketTunnel) Recv(into *Packet) error {
+	for {
+		kind, data, err := t.conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if kind != websocket.BinaryMessage {
+			continue
+		}
+		pkt := &proto.Packet{}
+		if err := protobuf.Unmarshal(data, pkt); err != nil {
+			return err
+		}
+		fromProtoPacket(pkt, into)
+		return nil
+	}
+}
+
+func (t *WebSocketTunnel) Send(from *Packet) error {
+	data, err := protobuf.Marshal(toProtoPacket(from))
+	if err != nil {
+		return err
+	}
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+	return t.conn.WriteMessage(websocket.BinaryMessage, data)
+}
+
+func (t *WebSocketTunnel) Close() error {
+	t.once.Do(func() { close(t.done) })
+	return t.conn.Close()
+}
+
+// WebSocketTunnelServer 通过 WebSocket 接收下游连接以及连接上游，用于仅允许 HTTP 的网络环境
+type WebSocketTunnelServer struct {
+	TunnelServer      *TunnelServer
+	ClientAnnotations Annotations // annotations send to downstream clients
+	PingInterval      time.Duration
+}
+
+func (s WebSocketTunnelServer) pingInterval() time.Duration {
+	if s.PingInterval == 0 {
+		return DefaultWebSocketPingInterval
+	}
+	return s.PingInterval
+}
+
+func (s WebSocketTunnelServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// upgrader has replied the error
+		log.Error(err, "upgrade websocket tunnel")
+		return
+	}
+	tun := NewWebSocketTunnel(conn, s.pingInterval())
+	defer tun.Close()
+
+	ctx := r.Context()
+	if r.TLS != nil {
+		ctx = WithPeerCertificates(ctx, r.TLS.PeerCertificates)
+	}
+	if err := s.TunnelServer.Connect(
+		ctx,
+		tun,
+		"",                                    // server do't provide a token to client, required no auth for client.
+		s.ClientAnnotations,                   // annotations send to downstream clients
+		TunnelOptions{SendRouteChange: false}, // we don't send route update to downstream channels.
+	); err != nil {
+		log.Error(err, "websocket tunnel disconnected", "remote", r.RemoteAddr)
+	}
+}
+
+func (s WebSocketTunnelServer) ConnectUpstreamWithRetry(ctx context.Context, addr string, tlsConfig *tls.Config, token string, annotations Annotations) error {
+	return wait.PollImmediateInfiniteWithContext(ctx, DefaultRetryInterval, func(ctx context.Context) (done bool, err error) {
+		if err := s.ConnectUpstream(ctx, addr, tlsConfig, token, annotations); err != nil {
+			log.Error(err, "on connect upstream")
+		}
+		return false, nil
+	})
+}
+
+func (s WebSocketTunnelServer) ConnectUpstream(ctx context.Context, addr string, tlsConfig *tls.Config, token string, annotations Annotations) error {
+	wsurl, err := WebSocketURL(addr)
+	if err != nil {
+		return err
+	}
+	log.FromContextOrDiscard(ctx).Info("connecting upstream", "addr", wsurl)
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		TLSClientConfig:  tlsConfig,
+		HandshakeTimeout: DefaultDialTimeout,
+	}
+	conn, resp, err := dialer.DialContext(ctx, wsurl, nil)
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("dial %s: %w: %s", wsurl, err, resp.Status)
+		}
+		return fmt.Errorf("dial %s: %w", wsurl, err)
+	}
+	tun := NewWebSocketTunnel(conn, s.pingInterval())
+	defer tun.Close()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			tun.Close()
+		case <-tun.done:
+		}
+	}()
+	return s.TunnelServer.Connect(ctx, tun, token, annotations, TunnelOptions{
+		SendRouteChange: true,
+		IsDefaultOut:    true, // as default out if no route info
+		IsUpstream:      true,
+	})
+}
+
+// WebSocketURL 将上游地址转换为 WebSocket 地址，未指定协议时使用 wss，未指定路径时使用 DefaultWebSocketPath
+func WebSocketURL(addr string) (string, error) {
+	if !strings.Contains(addr, "://") {
+		addr = "wss://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "ws", "wss":
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("unsupported websocket scheme %s", u.Scheme)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = DefaultWebSocketPath
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebSocketURL(t *testing.T) {
+	tests := []struct {
+		addr    string
+		want    string
+		wantErr bool
+	}{
+		{addr: "hub.example.com:8080", want: "wss://hub.example.com:8080/v1/tunnel"},
+		{addr: "http://hub.example.com", want: "ws://hub.example.com/v1/tunnel"},
+		{addr: "https://hub.example.com/", want: "wss://hub.example.com/v1/tunnel"},
+		{addr: "ws://hub.example.com/edge/tunnel", want: "ws://hub.example.com/edge/tunnel"},
+		{addr: "tcp://hub.example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			got, err := WebSocketURL(tt.addr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WebSocketURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("WebSocketURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebSocketTunnelServer(t *testing.T) {
+	pair := newTunnelPairWith(t, func(ctx context.Context, a, b *TunnelServer) {
+		a.Compressions, b.Compressions = SupportedCompressions, SupportedCompressions
+		server := httptest.NewServer(WebSocketTunnelServer{TunnelServer: b})
+		t.Cleanup(server.Close)
+		go WebSocketTunnelServer{TunnelServer: a}.ConnectUpstream(ctx, server.URL, nil, "", nil)
+	})
+	conn, peer := pair.dial(t)
+	defer conn.Close()
+	go func() {
+		defer peer.Close()
+		_, _ = io.Copy(peer, peer)
+	}()
+
+	content := bytes.Repeat([]byte("kubegems edge tunnel over websocket "), 4*MinCompressSize)
+	go func() {
+		if _, err := conn.Write(content); err != nil {
+			t.Error(err)
+		}
+	}()
+	got := make([]byte, len(content))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("echoed content mismatch")
+	}
+}
@@ -14,6 +14,433 @@
 
 package gitserver
 
-import "net/http"
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
-func (s *Server) ListFiles(w http.ResponseWriter, r *http.Request) {}
+	"kubegems.io/kubegems/pkg/log"
+)
+
+const (
+	RefTypeBranch = "branch"
+	RefTypeTag    = "tag"
+
+	lfsPointerPrefix  = "version https://git-lfs.github.com/spec/v1"
+	lfsPointerMaxSize = 1024 // lfs pointer 文件不会超过 1024 字节
+
+	defaultCommitsLimit = 20
+	maxCommitsLimit     = 100
+)
+
+var errInvalidRef = errors.New("invalid ref")
+
+type Ref struct {
+	Name     string `json:"name"`
+	FullName string `json:"fullName"`
+	Type     string `json:"type"`
+	Hash     string `json:"hash"` // 指向的 commit，附注标签为解引用后的 commit
+}
+
+type RefList struct {
+	Head string `json:"head"` // 默认分支
+	Refs []Ref  `json:"refs"`
+}
+
+type TreeEntry struct {
+	Name string      `json:"name"`
+	Path string      `json:"path"`
+	Type string      `json:"type"` // blob, tree, commit(submodule)
+	Mode string      `json:"mode"`
+	Hash string      `json:"hash"`
+	Size int64       `json:"size"`          // blob 的大小，LFS 文件为实际文件的大小
+	LFS  *LFSPointer `json:"lfs,omitempty"` // 不为空时表示该文件存储在 LFS 中
+}
+
+type Tree struct {
+	Ref     string      `json:"ref"`
+	Commit  string      `json:"commit"`
+	Path    string      `json:"path"`
+	Entries []TreeEntry `json:"entries"`
+}
+
+// LFSPointer git lfs 的指针文件
+// https://github.com/git-lfs/git-lfs/blob/main/docs/spec.md
+type LFSPointer struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+type Signature struct {
+	Name  string    `json:"name"`
+	Email string    `json:"email"`
+	When  time.Time `json:"when"`
+}
+
+type Commit struct {
+	Hash      string    `json:"hash"`
+	Parents   []string  `json:"parents"`
+	Author    Signature `json:"author"`
+	Committer Signature `json:"committer"`
+	Message   string    `json:"message"`
+}
+
+// ListRefs 列出仓库的分支以及标签
+func (s *Server) ListRefs(w http.ResponseWriter, r *http.Request) {
+	s.listRefs(w, r, "refs/heads", "refs/tags")
+}
+
+func (s *Server) ListBranches(w http.ResponseWriter, r *http.Request) {
+	s.listRefs(w, r, "refs/heads")
+}
+
+func (s *Server) ListTags(w http.ResponseWriter, r *http.Request) {
+	s.listRefs(w, r, "refs/tags")
+}
+
+func (s *Server) listRefs(w http.ResponseWriter, r *http.Request, patterns ...string) {
+	repodir := filepath.Join(s.GitBase, s.RepositoryPath(r))
+	args := append([]string{"for-each-ref", "--format=%(refname)%00%(objectname)%00%(*objectname)"}, patterns...)
+	out, err := gitOutput(r.Context(), repodir, args...)
+	if err != nil {
+		gitError(w, err)
+		return
+	}
+	list := RefList{Refs: []Ref{}}
+	if head, err := gitOutput(r.Context(), repodir, "symbolic-ref", "--short", "HEAD"); err == nil {
+		list.Head = strings.TrimSpace(string(head))
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 3 {
+			continue
+		}
+		ref := Ref{FullName: fields[0], Hash: fields[1]}
+		if fields[2] != "" {
+			ref.Hash = fields[2]
+		}
+		switch {
+		case strings.HasPrefix(ref.FullName, "refs/heads/"):
+			ref.Name, ref.Type = strings.TrimPrefix(ref.FullName, "refs/heads/"), RefTypeBranch
+		case strings.HasPrefix(ref.FullName, "refs/tags/"):
+			ref.Name, ref.Type = strings.TrimPrefix(ref.FullName, "refs/tags/"), RefTypeTag
+		}
+		list.Refs = append(list.Refs, ref)
+	}
+	OK(w, list)
+}
+
+// ListFiles 列出 ref 下 path 目录中的文件，?ref=main&path=dir
+func (s *Server) ListFiles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	repodir := filepath.Join(s.GitBase, s.RepositoryPath(r))
+	ref, dir := refOf(r), cleanPath(r.URL.Query().Get("path"))
+
+	commit, err := resolveCommit(ctx, repodir, ref)
+	if err != nil {
+		gitError(w, err)
+		return
+	}
+	args := []string{"ls-tree", "-l", "-z", commit}
+	if dir != "" {
+		args = append(args, "--", dir+"/")
+	}
+	out, err := gitOutput(ctx, repodir, args...)
+	if err != nil {
+		gitError(w, err)
+		return
+	}
+	tree := Tree{Ref: ref, Commit: commit, Path: dir, Entries: parseTreeEntries(out)}
+	if dir != "" && len(tree.Entries) == 0 {
+		NotFound(w)
+		return
+	}
+	if err := detectLFSPointers(ctx, repodir, tree.Entries); err != nil {
+		InternalServerError(w, err.Error())
+		return
+	}
+	OK(w, tree)
+}
+
+// GetBlob 读取 ref 下 path 文件的内容，?ref=main&path=file
+// 存储在 LFS 中的文件重定向到 LFS 对象的下载地址
+func (s *Server) GetBlob(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	repopath := s.RepositoryPath(r)
+	repodir := filepath.Join(s.GitBase, repopath)
+	file := cleanPath(r.URL.Query().Get("path"))
+	if file == "" {
+		BadRequest(w, "path is required")
+		return
+	}
+	commit, err := resolveCommit(ctx, repodir, refOf(r))
+	if err != nil {
+		gitError(w, err)
+		return
+	}
+	object := commit + ":" + file
+	sizeout, err := gitOutput(ctx, repodir, "cat-file", "-s", object)
+	if err != nil {
+		NotFound(w)
+		return
+	}
+	size, _ := strconv.ParseInt(strings.TrimSpace(string(sizeout)), 10, 64)
+
+	contenttype := "application/octet-stream"
+	if mimetype := mime.TypeByExtension(path.Ext(file)); mimetype != "" {
+		contenttype = mimetype
+	}
+	if size <= lfsPointerMaxSize {
+		content, err := gitOutput(ctx, repodir, "cat-file", "blob", object)
+		if err != nil {
+			gitError(w, err)
+			return
+		}
+		if pointer, ok := ParseLFSPointer(content); ok && s.LFS != nil {
+			link, err := s.LFS.Download(ctx, repopath, pointer.OID)
+			if err != nil {
+				InternalServerError(w, err.Error())
+				return
+			}
+			http.Redirect(w, r, link.Href, http.StatusFound)
+			return
+		}
+		RawResponse(w, http.StatusOK, map[string]string{
+			"Content-Type":   contenttype,
+			"Content-Length": strconv.Itoa(len(content)),
+		}, nil)
+		_, _ = w.Write(content)
+		return
+	}
+	w.Header().Set("Content-Type", contenttype)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	// 输出内容前出错时返回错误，输出过程中出错时客户端可以通过 Content-Length 发现内容不完整
+	out := &countWriter{w: w}
+	if err := gitStream(ctx, repodir, out, "cat-file", "blob", object); err != nil {
+		log.Error(err, "read blob", "repository", repopath, "path", file)
+		if out.n == 0 {
+			w.Header().Del("Content-Length")
+			gitError(w, err)
+		}
+	}
+}
+
+// ListCommits 列出 ref 下的提交记录，可以指定 path 仅列出修改该路径的提交，?ref=main&path=file&limit=20&skip=0
+func (s *Server) ListCommits(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	repodir := filepath.Join(s.GitBase, s.RepositoryPath(r))
+	query := r.URL.Query()
+
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 {
+		limit = defaultCommitsLimit
+	}
+	if limit > maxCommitsLimit {
+		limit = maxCommitsLimit
+	}
+	skip, _ := strconv.Atoi(query.Get("skip"))
+	if skip < 0 {
+		skip = 0
+	}
+	commit, err := resolveCommit(ctx, repodir, refOf(r))
+	if err != nil {
+		gitError(w, err)
+		return
+	}
+	const format = "--format=%H%x00%P%x00%an%x00%ae%x00%aI%x00%cn%x00%ce%x00%cI%x00%B%x1e"
+	args := []string{"log", format, "-n", strconv.Itoa(limit), "--skip", strconv.Itoa(skip), commit}
+	if p := cleanPath(query.Get("path")); p != "" {
+		args = append(args, "--", p)
+	}
+	out, err := gitOutput(ctx, repodir, args...)
+	if err != nil {
+		gitError(w, err)
+		return
+	}
+	commits := []Commit{}
+	for _, record := range strings.Split(string(out), "\x1e") {
+		fields := strings.Split(strings.TrimPrefix(record, "\n"), "\x00")
+		if len(fields) != 9 {
+			continue
+		}
+		authorwhen, _ := time.Parse(time.RFC3339, fields[4])
+		committerwhen, _ := time.Parse(time.RFC3339, fields[7])
+		commits = append(commits, Commit{
+			Hash:      fields[0],
+			Parents:   strings.Fields(fields[1]),
+			Author:    Signature{Name: fields[2], Email: fields[3], When: authorwhen},
+			Committer: Signature{Name: fields[5], Email: fields[6], When: committerwhen},
+			Message:   strings.TrimSpace(fields[8]),
+		})
+	}
+	OK(w, commits)
+}
+
+// parseTreeEntries 解析 git ls-tree -l -z 的输出
+func parseTreeEntries(out []byte) []TreeEntry {
+	entries := []TreeEntry{}
+	for _, record := range strings.Split(string(out), "\x00") {
+		// <mode> SP <type> SP <object> SP+ <size> TAB <file>
+		meta, name, ok := strings.Cut(record, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 4 {
+			continue
+		}
+		size, _ := strconv.ParseInt(fields[3], 10, 64)
+		entries = append(entries, TreeEntry{
+			Name: path.Base(name),
+			Path: name,
+			Mode: fields[0],
+			Type: fields[1],
+			Hash: fields[2],
+			Size: size,
+		})
+	}
+	return entries
+}
+
+// ParseLFSPointer 解析 LFS 指针文件，非指针文件时返回 false
+func ParseLFSPointer(content []byte) (*LFSPointer, bool) {
+	if len(content) > lfsPointerMaxSize || !bytes.HasPrefix(content, []byte(lfsPointerPrefix)) {
+		return nil, false
+	}
+	pointer := &LFSPointer{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		key, val, _ := strings.Cut(scanner.Text(), " ")
+		switch key {
+		case "oid":
+			pointer.OID = strings.TrimPrefix(val, "sha256:")
+		case "size":
+			pointer.Size, _ = strconv.ParseInt(val, 10, 64)
+		}
+	}
+	if pointer.OID == "" {
+		return nil, false
+	}
+	return pointer, true
+}
+
+// detectLFSPointers 读取可能为 LFS 指针的文件，设置文件的 LFS 信息以及实际的大小
+func detectLFSPointers(ctx context.Context, repodir string, entries []TreeEntry) error {
+	candidates := []int{}
+	input := &bytes.Buffer{}
+	for i, entry := range entries {
+		if entry.Type == "blob" && entry.Size <= lfsPointerMaxSize {
+			candidates = append(candidates, i)
+			input.WriteString(entry.Hash + "\n")
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	cmd := exec.CommandContext(ctx, "git", "cat-file", "--batch")
+	cmd.Dir = repodir
+	cmd.Stdin = input
+	out, err := cmd.Output()
+	if err != nil {
+		return err
+	}
+	// <oid> SP <type> SP <size> LF <contents> LF
+	reader := bufio.NewReader(bytes.NewReader(out))
+	for _, i := range candidates {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			return fmt.Errorf("unexpected cat-file output: %s", header)
+		}
+		size, _ := strconv.ParseInt(fields[2], 10, 64)
+		content := make([]byte, size+1)
+		if _, err := io.ReadFull(reader, content); err != nil {
+			return err
+		}
+		if pointer, ok := ParseLFSPointer(content[:size]); ok {
+			entries[i].LFS, entries[i].Size = pointer, pointer.Size
+		}
+	}
+	return nil
+}
+
+func refOf(r *http.Request) string {
+	if ref := r.URL.Query().Get("ref"); ref != "" {
+		return ref
+	}
+	return "HEAD"
+}
+
+// resolveCommit 解析 ref 为 commit，避免 ref 被作为 git 的参数
+func resolveCommit(ctx context.Context, repodir, ref string) (string, error) {
+	if strings.HasPrefix(ref, "-") || strings.ContainsAny(ref, ": \x00") {
+		return "", errInvalidRef
+	}
+	out, err := gitOutput(ctx, repodir, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("%w: %s not found", errInvalidRef, ref)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// cleanPath 返回仓库中的相对路径，不允许访问仓库之外的路径
+func cleanPath(p string) string {
+	return strings.Trim(path.Clean("/"+p), "/")
+}
+
+func gitOutput(ctx context.Context, wd string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = wd
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// gitStream 与 gitOutput 相同，但是将输出直接写入 w
+func gitStream(ctx context.Context, wd string, w io.Writer, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = wd
+	stderr := &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = w, stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func gitError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInvalidRef) {
+		RawResponse(w, http.StatusNotFound, nil, err.Error())
+		return
+	}
+	InternalServerError(w, err.Error())
+}
@@ -0,0 +1,173 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testLFSPointer = `version https://git-lfs.github.com/spec/v1
+oid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393
+size 12345
+`
+
+type fakeLFS struct{}
+
+func (fakeLFS) Upload(ctx context.Context, path string, oid string) (*Link, error) {
+	return &Link{Href: "http://s3.example.com/" + path + "/" + oid}, nil
+}
+
+func (fakeLFS) Download(ctx context.Context, path string, oid string) (*Link, error) {
+	return &Link{Href: "http://s3.example.com/" + path + "/" + oid}, nil
+}
+
+func (fakeLFS) Verify(ctx context.Context, path string, oid string) (*BatchObject, error) {
+	return &BatchObject{OID: oid}, nil
+}
+
+func setupTestRepository(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	base, work := t.TempDir(), t.TempDir()
+	git := func(dir string, args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=tester", "GIT_AUTHOR_EMAIL=tester@kubegems.io",
+			"GIT_COMMITTER_NAME=tester", "GIT_COMMITTER_EMAIL=tester@kubegems.io",
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	write := func(name, content string) {
+		_ = os.MkdirAll(filepath.Dir(filepath.Join(work, name)), 0o755)
+		if err := os.WriteFile(filepath.Join(work, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bare := filepath.Join(base, "user", "model.git")
+	_ = os.MkdirAll(bare, 0o755)
+	git(bare, "init", "--initial-branch=main", "--bare", ".")
+	git(work, "init", "--initial-branch=main", ".")
+	write("README.md", "# model\n")
+	git(work, "add", ".")
+	git(work, "commit", "-m", "init")
+	write("models/config.json", `{"layers": 2}`)
+	write("models/model.bin", testLFSPointer)
+	write("large.txt", strings.Repeat("x", 2*lfsPointerMaxSize))
+	git(work, "add", ".")
+	git(work, "commit", "-m", "add model")
+	git(work, "tag", "-a", "v1", "-m", "v1")
+	git(work, "push", bare, "main", "v1")
+	return base
+}
+
+func TestServer_browse(t *testing.T) {
+	s := &Server{GitBase: setupTestRepository(t), LFS: fakeLFS{}}
+	server := httptest.NewServer(s.routes(true, false))
+	defer server.Close()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	get := func(path string, into interface{}) *http.Response {
+		resp, err := client.Get(server.URL + "/user/model" + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if into != nil {
+			if err := json.NewDecoder(resp.Body).Decode(into); err != nil {
+				t.Fatalf("decode %s: %v", path, err)
+			}
+		}
+		return resp
+	}
+
+	refs := RefList{}
+	get("/refs", &refs)
+	if refs.Head != "main" || len(refs.Refs) != 2 {
+		t.Fatalf("unexpected refs %+v", refs)
+	}
+	tags := RefList{}
+	get("/tags", &tags)
+	if len(tags.Refs) != 1 || tags.Refs[0].Type != RefTypeTag || tags.Refs[0].Hash != refs.Refs[0].Hash {
+		t.Errorf("annotated tag should resolve to commit, got %+v, branches %+v", tags, refs)
+	}
+
+	tree := Tree{}
+	get("/files?ref=v1&path=models", &tree)
+	if len(tree.Entries) != 2 {
+		t.Fatalf("unexpected tree %+v", tree)
+	}
+	for _, entry := range tree.Entries {
+		switch entry.Name {
+		case "model.bin":
+			if entry.LFS == nil || entry.Size != 12345 {
+				t.Errorf("lfs pointer not detected %+v", entry)
+			}
+		case "config.json":
+			if entry.LFS != nil || entry.Size != 13 {
+				t.Errorf("unexpected entry %+v", entry)
+			}
+		}
+	}
+	if resp := get("/files?ref=--output=/tmp/x", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("invalid ref status = %d", resp.StatusCode)
+	}
+
+	resp, _ := client.Get(server.URL + "/user/model/blob?path=models/config.json")
+	content, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(content) != `{"layers": 2}` || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected blob %s %s", content, resp.Header.Get("Content-Type"))
+	}
+	resp, _ = client.Get(server.URL + "/user/model/blob?path=large.txt")
+	content, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if len(content) != 2*lfsPointerMaxSize || resp.ContentLength != 2*lfsPointerMaxSize {
+		t.Errorf("unexpected large blob size %d, content length %d", len(content), resp.ContentLength)
+	}
+	if err := gitStream(context.Background(), filepath.Join(s.GitBase, "user", "model.git"), io.Discard, "cat-file", "blob", "main:notexists"); err == nil || !strings.Contains(err.Error(), "notexists") {
+		t.Errorf("gitStream() should return git stderr, got %v", err)
+	}
+	resp = get("/blob?path=models/model.bin", nil)
+	if loc := resp.Header.Get("Location"); resp.StatusCode != http.StatusFound || loc != "http://s3.example.com/user/model.git/4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393" {
+		t.Errorf("lfs blob should redirect to object, got %d %s", resp.StatusCode, loc)
+	}
+	if resp := get("/blob?path=../../etc/passwd", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("path outside repository status = %d", resp.StatusCode)
+	}
+
+	commits := []Commit{}
+	get("/commits", &commits)
+	if len(commits) != 2 || commits[0].Message != "add model" || len(commits[0].Parents) != 1 || commits[0].Author.Email != "tester@kubegems.io" {
+		t.Fatalf("unexpected commits %+v", commits)
+	}
+	commits = []Commit{}
+	get("/commits?path=README.md", &commits)
+	if len(commits) != 1 || commits[0].Message != "init" {
+		t.Errorf("unexpected path commits %+v", commits)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitserver
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"kubegems.io/kubegems/pkg/model/store/auth"
+)
+
+const (
+	ActionRead  = "read"
+	ActionWrite = "write"
+
+	// permission = repository:<action>:<username>/<repository>
+	PermissionResourceRepository = "repository"
+
+	authRealm = "kubegems model registry"
+)
+
+type usernameContextKey struct{}
+
+// UsernameFromContext 返回认证通过的用户名，未启用认证时返回空
+func UsernameFromContext(ctx context.Context) string {
+	username, _ := ctx.Value(usernameContextKey{}).(string)
+	return username
+}
+
+// RepositoryPermission 返回仓库的权限，action 为 * 时表示所有权限
+func RepositoryPermission(action, username, repository string) string {
+	return auth.Permission(PermissionResourceRepository, action, username+"/"+repository)
+}
+
+// AuthMiddleware 使用 token 认证用户，并根据请求检查用户对仓库的读写权限
+// token 可以通过 Authorization: Bearer <token> 或者 basic auth 的密码传递，git 客户端仅支持后者
+func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.Authc == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		token := tokenOf(r)
+		if token == "" {
+			unauthorized(w, "authentication required")
+			return
+		}
+		info, err := s.Authc.UserInfo(ctx, token)
+		if err != nil {
+			unauthorized(w, err.Error())
+			return
+		}
+		vars := mux.Vars(r)
+		if !s.HasPermission(ctx, info.Username, vars["username"], vars["repository"], RequiredAction(r)) {
+			RawResponse(w, http.StatusForbidden, nil, "permission denied")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, usernameContextKey{}, info.Username)))
+	})
+}
+
+// HasPermission 检查用户对仓库的权限，仓库所在命名空间的用户拥有所有权限，写权限包含读权限
+func (s *Server) HasPermission(ctx context.Context, username, owner, repository, action string) bool {
+	if username == owner {
+		return true
+	}
+	if s.Authz == nil {
+		return false
+	}
+	permissions := []string{
+		auth.PermissionAdmin,
+		RepositoryPermission("*", owner, repository),
+		RepositoryPermission(action, owner, repository),
+	}
+	if action == ActionRead {
+		permissions = append(permissions, RepositoryPermission(ActionWrite, owner, repository))
+	}
+	for _, permission := range permissions {
+		if s.Authz.HasPermission(ctx, username, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiredAction 返回请求需要的仓库权限
+// LFS batch 接口在此处按读处理，上传对象时在 LFSBatch 中再次检查写权限
+func RequiredAction(r *http.Request) string {
+	if r.URL.Query().Get("service") == "git-receive-pack" {
+		return ActionWrite
+	}
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/git-receive-pack"):
+		return ActionWrite
+	case strings.HasSuffix(r.URL.Path, "/git-upload-pack"),
+		strings.HasSuffix(r.URL.Path, "/info/lfs/objects/batch"):
+		return ActionRead
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return ActionRead
+	default:
+		return ActionWrite
+	}
+}
+
+func tokenOf(r *http.Request) string {
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); token != r.Header.Get("Authorization") {
+		return token
+	}
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	return ""
+}
+
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="`+authRealm+`"`)
+	RawResponse(w, http.StatusUnauthorized, nil, message)
+}
@@ -0,0 +1,147 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"kubegems.io/kubegems/pkg/model/store/auth"
+)
+
+// fakeAuthc 使用 token 作为用户名
+type fakeAuthc struct{}
+
+func (fakeAuthc) UserInfo(ctx context.Context, token string) (auth.UserInfo, error) {
+	if token == "invalid" {
+		return auth.UserInfo{}, errors.New("invalid token")
+	}
+	return auth.UserInfo{Username: token}, nil
+}
+
+type fakeAuthz map[string][]string
+
+func (a fakeAuthz) AddPermission(ctx context.Context, username string, permission string) error {
+	return nil
+}
+
+func (a fakeAuthz) ListPermissions(ctx context.Context, username string) ([]string, error) {
+	return a[username], nil
+}
+
+func (a fakeAuthz) ListUsersHasPermission(ctx context.Context, permission string) ([]string, error) {
+	return nil, nil
+}
+
+func (a fakeAuthz) RemovePermission(ctx context.Context, username string, permission string) error {
+	return nil
+}
+
+func (a fakeAuthz) HasPermission(ctx context.Context, username string, permission string) bool {
+	for _, p := range a[username] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func TestServer_AuthMiddleware(t *testing.T) {
+	s := &Server{
+		GitBase: setupTestRepository(t),
+		LFS:     fakeLFS{},
+		Authc:   fakeAuthc{},
+		Authz: fakeAuthz{
+			"reader": {RepositoryPermission(ActionRead, "user", "model")},
+			"writer": {RepositoryPermission(ActionWrite, "user", "model")},
+			"admin":  {auth.PermissionAdmin},
+		},
+	}
+	server := httptest.NewServer(s.routes(true, false))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		basic    bool
+		token    string
+		wantCode int
+	}{
+		{name: "no token", method: "GET", path: "/user/model/refs", wantCode: http.StatusUnauthorized},
+		{name: "invalid token", method: "GET", path: "/user/model/refs", token: "invalid", wantCode: http.StatusUnauthorized},
+		{name: "owner", method: "GET", path: "/user/model/refs", token: "user", wantCode: http.StatusOK},
+		{name: "no permission", method: "GET", path: "/user/model/refs", token: "other", wantCode: http.StatusForbidden},
+		{name: "reader read", method: "GET", path: "/user/model/refs", token: "reader", wantCode: http.StatusOK},
+		{name: "reader with basic auth", method: "GET", path: "/user/model/refs", token: "reader", basic: true, wantCode: http.StatusOK},
+		{name: "writer read", method: "GET", path: "/user/model/refs", token: "writer", wantCode: http.StatusOK},
+		{name: "admin read", method: "GET", path: "/user/model/refs", token: "admin", wantCode: http.StatusOK},
+		{
+			name: "reader upload-pack advertisement", method: "GET", path: "/user/model.git/info/refs?service=git-upload-pack",
+			token: "reader", basic: true, wantCode: http.StatusOK,
+		},
+		{
+			name: "reader receive-pack advertisement", method: "GET", path: "/user/model.git/info/refs?service=git-receive-pack",
+			token: "reader", basic: true, wantCode: http.StatusForbidden,
+		},
+		{
+			name: "writer receive-pack advertisement", method: "GET", path: "/user/model.git/info/refs?service=git-receive-pack",
+			token: "writer", basic: true, wantCode: http.StatusOK,
+		},
+		{name: "reader remove repository", method: "DELETE", path: "/user/model", token: "reader", wantCode: http.StatusForbidden},
+		{
+			name: "reader lfs download", method: "POST", path: "/user/model.git/info/lfs/objects/batch", token: "reader",
+			body: `{"operation":"download","objects":[{"oid":"abc","size":1}]}`, wantCode: http.StatusOK,
+		},
+		{
+			name: "reader lfs upload", method: "POST", path: "/user/model.git/info/lfs/objects/batch", token: "reader",
+			body: `{"operation":"upload","objects":[{"oid":"abc","size":1}]}`, wantCode: http.StatusForbidden,
+		},
+		{
+			name: "writer lfs upload", method: "POST", path: "/user/model.git/info/lfs/objects/batch", token: "writer",
+			body: `{"operation":"upload","objects":[{"oid":"abc","size":1}]}`, wantCode: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, server.URL+tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Accept", mimeGitLFSJSON)
+			req.Header.Set("Content-Type", mimeGitLFSJSON)
+			switch {
+			case tt.token == "":
+			case tt.basic:
+				req.SetBasicAuth("git", tt.token)
+			default:
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantCode)
+			}
+			if resp.StatusCode == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+				t.Errorf("missing WWW-Authenticate header")
+			}
+		})
+	}
+}
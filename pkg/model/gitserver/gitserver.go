@@ -17,6 +17,8 @@ package gitserver
 import (
 	"context"
 	"net/http"
+
+	"kubegems.io/kubegems/pkg/model/store/auth"
 )
 
 type Options struct {
@@ -34,6 +36,11 @@ func NewDefaultOptions() *Options {
 type Server struct {
 	GitBase string
 	LFS     LFSMetaManager
+	Locks   LFSLockManager // optional, enable git lfs file locking api
+
+	Authc auth.AuthenticationManager // optional, enable token authentication
+	Authz auth.AuthorizationManager  // optional, used to check permissions of users other than repository owner
+	Hooks []PostReceiveHook          // optional, called after refs updated by push
 }
 
 func (s *Server) Run(ctx context.Context, opts *Options) error {
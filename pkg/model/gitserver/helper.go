@@ -62,6 +62,7 @@ func RawResponse(w http.ResponseWriter, code int, header map[string]string, body
 		w.WriteHeader(code)
 	default:
 		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(code)
 		json.NewEncoder(w).Encode(body)
 	}
 }
@@ -0,0 +1,252 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"kubegems.io/kubegems/pkg/log"
+	"kubegems.io/kubegems/pkg/model/store/repository"
+)
+
+const defaultHookTimeout = 30 * time.Second
+
+type RefUpdate struct {
+	Ref string `json:"ref"` // refs/heads/main
+	Old string `json:"old"` // 为空时表示新建
+	New string `json:"new"` // 为空时表示删除
+}
+
+type PushEvent struct {
+	Username   string      `json:"username"`
+	Repository string      `json:"repository"`
+	Pusher     string      `json:"pusher"` // 未启用认证时为空
+	Updates    []RefUpdate `json:"updates"`
+}
+
+// PostReceiveHook 在 push 完成后调用，repodir 为仓库在服务器上的路径
+type PostReceiveHook interface {
+	PostReceive(ctx context.Context, repodir string, event PushEvent) error
+}
+
+type PostReceiveHookFunc func(ctx context.Context, repodir string, event PushEvent) error
+
+func (f PostReceiveHookFunc) PostReceive(ctx context.Context, repodir string, event PushEvent) error {
+	return f(ctx, repodir, event)
+}
+
+// withPostReceive 对比 receive-pack 前后仓库的 refs，存在更新时异步执行 hooks
+func (s *Server) withPostReceive(r *http.Request, receive func()) {
+	if len(s.Hooks) == 0 {
+		receive()
+		return
+	}
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	repodir := filepath.Join(s.GitBase, s.RepositoryPath(r))
+	before, err := listRefHashes(ctx, repodir)
+	if err != nil {
+		log.Error(err, "list refs before receive-pack", "repository", repodir)
+	}
+	receive()
+	after, err := listRefHashes(ctx, repodir)
+	if err != nil {
+		log.Error(err, "list refs after receive-pack", "repository", repodir)
+		return
+	}
+	updates := diffRefs(before, after)
+	if len(updates) == 0 {
+		return
+	}
+	event := PushEvent{
+		Username:   vars["username"],
+		Repository: vars["repository"],
+		Pusher:     UsernameFromContext(ctx),
+		Updates:    updates,
+	}
+	// 请求结束后 ctx 会被取消，hooks 不应影响 push 的结果
+	go s.runHooks(context.WithoutCancel(ctx), repodir, event)
+}
+
+func (s *Server) runHooks(ctx context.Context, repodir string, event PushEvent) {
+	for _, hook := range s.Hooks {
+		if err := hook.PostReceive(ctx, repodir, event); err != nil {
+			log.Error(err, "post-receive hook", "username", event.Username, "repository", event.Repository)
+		}
+	}
+}
+
+// listRefHashes 返回仓库中所有的 ref 以及其指向的对象
+func listRefHashes(ctx context.Context, repodir string) (map[string]string, error) {
+	out, err := gitOutput(ctx, repodir, "for-each-ref", "--format=%(refname)%00%(objectname)")
+	if err != nil {
+		return nil, err
+	}
+	refs := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if name, hash, ok := strings.Cut(line, "\x00"); ok {
+			refs[name] = hash
+		}
+	}
+	return refs, nil
+}
+
+func diffRefs(before, after map[string]string) []RefUpdate {
+	updates := []RefUpdate{}
+	for ref, hash := range after {
+		if old := before[ref]; old != hash {
+			updates = append(updates, RefUpdate{Ref: ref, Old: old, New: hash})
+		}
+	}
+	for ref, hash := range before {
+		if _, ok := after[ref]; !ok {
+			updates = append(updates, RefUpdate{Ref: ref, Old: hash})
+		}
+	}
+	sort.Slice(updates, func(i, j int) bool { return updates[i].Ref < updates[j].Ref })
+	return updates
+}
+
+type ModelStoreHookOptions struct {
+	Addr    string        `json:"addr,omitempty" description:"model store address, eg. http://kubegems-models-store"`
+	Token   string        `json:"token,omitempty" description:"token used to access model store api"`
+	Source  string        `json:"source,omitempty" description:"model source of the pushed models"`
+	Timeout time.Duration `json:"timeout,omitempty" description:"timeout of the model store api request"`
+}
+
+// ModelStoreHook 在 push 后为模型创建版本，分支以及标签名作为版本名称，模型名称为 <username>/<repository>
+type ModelStoreHook struct {
+	options *ModelStoreHookOptions
+	client  *http.Client
+}
+
+var _ PostReceiveHook = &ModelStoreHook{}
+
+func NewModelStoreHook(opts *ModelStoreHookOptions) *ModelStoreHook {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	return &ModelStoreHook{options: opts, client: &http.Client{Timeout: timeout}}
+}
+
+func (h *ModelStoreHook) PostReceive(ctx context.Context, repodir string, event PushEvent) error {
+	model := event.Username + "/" + event.Repository
+	for _, update := range event.Updates {
+		name, ok := versionName(update.Ref)
+		if !ok || update.New == "" {
+			continue
+		}
+		version, err := ModelVersionOf(ctx, repodir, name, update.New)
+		if err != nil {
+			return err
+		}
+		if err := h.upsertVersion(ctx, model, version); err != nil {
+			return fmt.Errorf("upsert version %s of %s: %w", name, model, err)
+		}
+	}
+	return nil
+}
+
+func (h *ModelStoreHook) upsertVersion(ctx context.Context, model string, version *repository.ModelVersion) error {
+	body, err := json.Marshal(version)
+	if err != nil {
+		return err
+	}
+	// 模型名称中包含 '/'，使用 url safe 的 base64 编码
+	url := fmt.Sprintf("%s/v1/sources/%s/models/%s/versions",
+		strings.TrimRight(h.options.Addr, "/"), h.options.Source, base64.URLEncoding.EncodeToString([]byte(model)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.options.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.options.Token)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// versionName 返回 ref 对应的版本名称，仅分支以及标签会创建版本
+func versionName(ref string) (string, bool) {
+	if name := strings.TrimPrefix(ref, "refs/tags/"); name != ref {
+		return name, true
+	}
+	if name := strings.TrimPrefix(ref, "refs/heads/"); name != ref {
+		return name, true
+	}
+	return "", false
+}
+
+// ModelVersionOf 使用 commit 中的文件以及提交信息生成模型版本，LFS 文件使用实际的大小
+func ModelVersionOf(ctx context.Context, repodir, name, commit string) (*repository.ModelVersion, error) {
+	out, err := gitOutput(ctx, repodir, "log", "-1", "--format=%aI%x00%cI%x00%B", commit)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.SplitN(string(out), "\x00", 3)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("unexpected git log output: %q", out)
+	}
+	authorwhen, _ := time.Parse(time.RFC3339, fields[0])
+	committerwhen, _ := time.Parse(time.RFC3339, fields[1])
+
+	out, err = gitOutput(ctx, repodir, "ls-tree", "-r", "-l", "-z", commit)
+	if err != nil {
+		return nil, err
+	}
+	entries := parseTreeEntries(out)
+	if err := detectLFSPointers(ctx, repodir, entries); err != nil {
+		return nil, err
+	}
+	version := &repository.ModelVersion{
+		Name:         name,
+		Files:        make([]repository.ModelFile, 0, len(entries)),
+		Intro:        strings.TrimSpace(fields[2]),
+		CreationTime: authorwhen,
+		UpdationTime: committerwhen,
+	}
+	for _, entry := range entries {
+		if entry.Type != "blob" {
+			continue
+		}
+		version.Files = append(version.Files, repository.ModelFile{
+			Filename: entry.Path,
+			Size:     entry.Size,
+			ModTime:  committerwhen,
+		})
+	}
+	return version, nil
+}
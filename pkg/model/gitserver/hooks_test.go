@@ -0,0 +1,151 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"kubegems.io/kubegems/pkg/model/store/repository"
+)
+
+func Test_diffRefs(t *testing.T) {
+	tests := []struct {
+		name   string
+		before map[string]string
+		after  map[string]string
+		want   []RefUpdate
+	}{
+		{
+			name:   "no change",
+			before: map[string]string{"refs/heads/main": "a"},
+			after:  map[string]string{"refs/heads/main": "a"},
+			want:   []RefUpdate{},
+		},
+		{
+			name:   "create update and delete",
+			before: map[string]string{"refs/heads/main": "a", "refs/heads/dev": "b"},
+			after:  map[string]string{"refs/heads/main": "c", "refs/tags/v1": "d"},
+			want: []RefUpdate{
+				{Ref: "refs/heads/dev", Old: "b"},
+				{Ref: "refs/heads/main", Old: "a", New: "c"},
+				{Ref: "refs/tags/v1", New: "d"},
+			},
+		},
+		{
+			name:  "empty repository",
+			after: map[string]string{"refs/heads/main": "a"},
+			want:  []RefUpdate{{Ref: "refs/heads/main", New: "a"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffRefs(tt.before, tt.after); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffRefs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_postReceive(t *testing.T) {
+	base := setupTestRepository(t)
+
+	// model store 收到的版本
+	versions := make(chan repository.ModelVersion, 2)
+	store := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// base64url("user/model")
+		if r.URL.Path != "/v1/sources/kubegems/models/dXNlci9tb2RlbA==/versions" || r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unexpected request "+r.URL.Path, http.StatusBadRequest)
+			return
+		}
+		version := repository.ModelVersion{}
+		_ = json.NewDecoder(r.Body).Decode(&version)
+		versions <- version
+	}))
+	defer store.Close()
+
+	events := make(chan PushEvent, 1)
+	s := &Server{
+		GitBase: base,
+		Hooks: []PostReceiveHook{
+			NewModelStoreHook(&ModelStoreHookOptions{Addr: store.URL, Token: "token", Source: "kubegems"}),
+			PostReceiveHookFunc(func(ctx context.Context, repodir string, event PushEvent) error {
+				events <- event
+				return nil
+			}),
+		},
+	}
+	server := httptest.NewServer(s.routes(false, false))
+	defer server.Close()
+
+	work := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = work
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=tester", "GIT_AUTHOR_EMAIL=tester@kubegems.io",
+			"GIT_COMMITTER_NAME=tester", "GIT_COMMITTER_EMAIL=tester@kubegems.io",
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	git("clone", filepath.Join(base, "user", "model.git"), ".")
+	if err := os.WriteFile(filepath.Join(work, "weights.bin"), []byte("weights"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", ".")
+	git("commit", "-m", "add weights")
+	git("tag", "v2")
+	git("push", server.URL+"/user/model.git", "main", "v2")
+
+	select {
+	case event := <-events:
+		if event.Username != "user" || event.Repository != "model" || len(event.Updates) != 2 {
+			t.Fatalf("unexpected event %+v", event)
+		}
+		if event.Updates[0].Ref != "refs/heads/main" || event.Updates[0].Old == "" || event.Updates[1].Ref != "refs/tags/v2" {
+			t.Errorf("unexpected updates %+v", event.Updates)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("post-receive hook not called")
+	}
+
+	got := map[string]repository.ModelVersion{}
+	for i := 0; i < 2; i++ {
+		version := <-versions
+		got[version.Name] = version
+	}
+	v2, ok := got["v2"]
+	if !ok || got["main"].Name != "main" {
+		t.Fatalf("unexpected versions %+v", got)
+	}
+	if v2.Intro != "add weights" || len(v2.Files) != 5 {
+		t.Errorf("unexpected version %+v", v2)
+	}
+	for _, file := range v2.Files {
+		if file.Filename == "models/model.bin" && file.Size != 12345 {
+			t.Errorf("lfs file size = %d, want 12345", file.Size)
+		}
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"net/http"
 	"net/http/cgi"
 	"os/exec"
+	"strings"
 )
 
 func (s *Server) GitHTTPBackend(w http.ResponseWriter, r *http.Request) {
@@ -37,5 +38,9 @@ func (s *Server) GitHTTPBackend(w http.ResponseWriter, r *http.Request) {
 		},
 		Logger: log.Default(),
 	}
+	if strings.HasSuffix(r.URL.Path, "/git-receive-pack") {
+		s.withPostReceive(r, func() { h.ServeHTTP(w, r) })
+		return
+	}
 	h.ServeHTTP(w, r)
 }
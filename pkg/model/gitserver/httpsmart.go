@@ -77,7 +77,9 @@ func (s *Server) UploadPack(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) ReceivePack(w http.ResponseWriter, r *http.Request) {
 	wd := filepath.Join(s.GitBase, s.RepositoryPath(r))
-	GitServiceCall(w, r, wd, "receive-pack", "--stateless-rpc", ".")
+	s.withPostReceive(r, func() {
+		GitServiceCall(w, r, wd, "receive-pack", "--stateless-rpc", ".")
+	})
 }
 
 func GitServiceCall(w http.ResponseWriter, r *http.Request, repopath, servicename string, args ...string) {
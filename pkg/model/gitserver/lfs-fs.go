@@ -0,0 +1,187 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidOID     = errors.New("invalid oid")
+	ErrObjectNotFound = errors.New("object not found")
+	ErrOIDMismatch    = errors.New("content does not match oid")
+)
+
+var oidRegexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// LFSContentStore 由 gitserver 自身存储 LFS 对象内容时需要实现的接口
+// 实现该接口的 LFSMetaManager 返回的链接指向 gitserver 的 /info/lfs/objects/{oid}
+type LFSContentStore interface {
+	// Put 存储对象，内容的 sha256 与 oid 不一致时返回 ErrOIDMismatch
+	Put(ctx context.Context, path string, oid string, content io.Reader) error
+	// Get 读取对象，不存在时返回 ErrObjectNotFound
+	Get(ctx context.Context, path string, oid string) (io.ReadCloser, int64, error)
+	Delete(ctx context.Context, path string, oid string) error
+}
+
+type FSContentManagerOptions struct {
+	Dir          string // the dir lfs objects will be stored in
+	URL          string // the external url of gitserver,used to generate upload/download links
+	LinkExpireIn time.Duration
+}
+
+// FSContentManager 将 LFS 对象存储在本地磁盘中，存储结构与 git lfs 本地存储相同
+// <dir>/<repository>/<oid[0:2]>/<oid[2:4]>/<oid>
+type FSContentManager struct {
+	options *FSContentManagerOptions
+}
+
+var (
+	_ LFSMetaManager  = &FSContentManager{}
+	_ LFSContentStore = &FSContentManager{}
+)
+
+func NewFSContentManager(opts *FSContentManagerOptions) (*FSContentManager, error) {
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FSContentManager{options: opts}, nil
+}
+
+func (m *FSContentManager) Upload(ctx context.Context, path string, oid string) (*Link, error) {
+	return m.link(path, oid)
+}
+
+func (m *FSContentManager) Download(ctx context.Context, path string, oid string) (*Link, error) {
+	if _, err := m.stat(path, oid); err != nil {
+		return nil, err
+	}
+	return m.link(path, oid)
+}
+
+func (m *FSContentManager) Verify(ctx context.Context, path string, oid string) (*BatchObject, error) {
+	fi, err := m.stat(path, oid)
+	if err != nil {
+		return nil, err
+	}
+	return &BatchObject{OID: oid, Size: fi.Size()}, nil
+}
+
+func (m *FSContentManager) Put(ctx context.Context, path string, oid string, content io.Reader) error {
+	filename, err := m.filename(path, oid)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+	// 先写入临时文件，校验通过后再移动，避免读取到不完整的对象
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+oid+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != oid {
+		return ErrOIDMismatch
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+func (m *FSContentManager) Get(ctx context.Context, path string, oid string) (io.ReadCloser, int64, error) {
+	filename, err := m.filename(path, oid)
+	if err != nil {
+		return nil, 0, err
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, ErrObjectNotFound
+		}
+		return nil, 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, fi.Size(), nil
+}
+
+func (m *FSContentManager) Delete(ctx context.Context, path string, oid string) error {
+	filename, err := m.filename(path, oid)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (m *FSContentManager) stat(path, oid string) (os.FileInfo, error) {
+	filename, err := m.filename(path, oid)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return fi, nil
+}
+
+func (m *FSContentManager) filename(path, oid string) (string, error) {
+	if !oidRegexp.MatchString(oid) {
+		return "", ErrInvalidOID
+	}
+	// path 由路由中的 username/repository 组成，不允许跳出存储目录
+	cleaned := filepath.Clean(string(filepath.Separator) + path)
+	return filepath.Join(m.options.Dir, cleaned, oid[0:2], oid[2:4], oid), nil
+}
+
+func (m *FSContentManager) link(path, oid string) (*Link, error) {
+	if !oidRegexp.MatchString(oid) {
+		return nil, ErrInvalidOID
+	}
+	link := &Link{
+		Href: fmt.Sprintf("%s/%s/info/lfs/objects/%s", strings.TrimRight(m.options.URL, "/"), strings.Trim(path, "/"), oid),
+	}
+	if expirein := m.options.LinkExpireIn; expirein > 0 {
+		link.ExpireIn, link.ExpiresAt = int(expirein.Seconds()), time.Now().Add(expirein)
+	}
+	return link, nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func lfsRequest(t *testing.T, method, url, user string, body interface{}) *http.Response {
+	content, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, url, bytes.NewReader(content))
+	req.Header.Set("Accept", mimeGitLFSJSON)
+	req.Header.Set("Content-Type", mimeGitLFSJSON)
+	if user != "" {
+		req.SetBasicAuth(user, "")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func decodeBody(t *testing.T, resp *http.Response, into interface{}) {
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(into); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFSContentManager_transfer(t *testing.T) {
+	s := &Server{GitBase: t.TempDir()}
+	server := httptest.NewServer(s.routes(true, false))
+	defer server.Close()
+	lfs, err := NewFSContentManager(&FSContentManagerOptions{Dir: t.TempDir(), URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.LFS = lfs
+
+	content := []byte("model weights")
+	hash := sha256.Sum256(content)
+	oid := hex.EncodeToString(hash[:])
+	lfsurl := server.URL + "/user/model.git/info/lfs"
+
+	batch := &Batch{}
+	decodeBody(t, lfsRequest(t, http.MethodPost, lfsurl+"/objects/batch", "", Batch{
+		Operation: OperationUpload,
+		Objects:   []BatchObject{{OID: oid, Size: int64(len(content))}},
+	}), batch)
+	upload := batch.Objects[0].Actions["upload"]
+	if upload.Href != lfsurl+"/objects/"+oid {
+		t.Fatalf("unexpected upload link %v", batch.Objects[0])
+	}
+
+	// 内容与 oid 不一致
+	req, _ := http.NewRequest(http.MethodPut, upload.Href, strings.NewReader("other"))
+	if resp, _ := http.DefaultClient.Do(req); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("mismatched content status = %d", resp.StatusCode)
+	}
+	req, _ = http.NewRequest(http.MethodPut, upload.Href, bytes.NewReader(content))
+	if resp, _ := http.DefaultClient.Do(req); resp.StatusCode != http.StatusOK {
+		t.Fatalf("upload status = %d", resp.StatusCode)
+	}
+
+	if resp := lfsRequest(t, http.MethodPost, lfsurl+"/verify", "", BatchObject{OID: oid, Size: int64(len(content))}); resp.StatusCode != http.StatusOK {
+		t.Errorf("verify status = %d", resp.StatusCode)
+	}
+	if resp := lfsRequest(t, http.MethodPost, lfsurl+"/verify", "", BatchObject{OID: oid, Size: 1}); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("verify mismatched size status = %d", resp.StatusCode)
+	}
+
+	resp, err := http.Get(lfsurl + "/objects/" + oid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloaded, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Equal(downloaded, content) {
+		t.Errorf("downloaded %s, want %s", downloaded, content)
+	}
+	if resp, _ := http.Get(lfsurl + "/objects/" + strings.Repeat("0", 64)); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing object status = %d", resp.StatusCode)
+	}
+	if resp, _ := http.Get(lfsurl + "/objects/..%2F..%2Fetc"); resp.StatusCode == http.StatusOK {
+		t.Errorf("invalid oid should not be served")
+	}
+}
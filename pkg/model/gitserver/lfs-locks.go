@@ -0,0 +1,355 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"kubegems.io/kubegems/pkg/model/store/auth"
+)
+
+// https://github.com/git-lfs/git-lfs/blob/main/docs/api/locking.md
+
+const (
+	defaultLocksLimit = 100
+	anonymousOwner    = "anonymous"
+)
+
+var (
+	ErrLockExists   = errors.New("lock already exists")
+	ErrLockNotFound = errors.New("lock not found")
+)
+
+type Lock struct {
+	ID       string    `json:"id"`
+	Path     string    `json:"path"`
+	LockedAt time.Time `json:"locked_at"`
+	Owner    LockOwner `json:"owner"`
+}
+
+type LockOwner struct {
+	Name string `json:"name"`
+}
+
+type LockCreateRequest struct {
+	Path string   `json:"path"`
+	Ref  BatchRef `json:"ref,omitempty"`
+}
+
+type LockResponse struct {
+	Lock    *Lock  `json:"lock,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type LockList struct {
+	Locks      []Lock `json:"locks"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type LockVerifyRequest struct {
+	Cursor string   `json:"cursor,omitempty"`
+	Limit  int      `json:"limit,omitempty"`
+	Ref    BatchRef `json:"ref,omitempty"`
+}
+
+type LockVerifyList struct {
+	Ours       []Lock `json:"ours"`
+	Theirs     []Lock `json:"theirs"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type UnlockRequest struct {
+	Force bool     `json:"force,omitempty"`
+	Ref   BatchRef `json:"ref,omitempty"`
+}
+
+type LockListOptions struct {
+	ID     string
+	Path   string
+	Cursor string // 从该 id 的锁开始返回
+	Limit  int
+}
+
+type LFSLockManager interface {
+	// Create 锁定文件，文件已被锁定时返回已存在的锁以及 ErrLockExists
+	Create(ctx context.Context, repository string, path string, owner string) (*Lock, error)
+	// List 按照锁定时间排序列出锁，返回下一页的 cursor
+	List(ctx context.Context, repository string, opts LockListOptions) ([]Lock, string, error)
+	// Delete 删除锁，不存在时返回 ErrLockNotFound
+	Delete(ctx context.Context, repository string, id string) (*Lock, error)
+}
+
+func (s *Server) LFSCreateLock(w http.ResponseWriter, r *http.Request) {
+	req := &LockCreateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil || req.Path == "" {
+		lfsLockResponse(w, http.StatusBadRequest, LockResponse{Message: "invalid lock request"})
+		return
+	}
+	defer r.Body.Close()
+	lock, err := s.Locks.Create(r.Context(), s.RepositoryPath(r), req.Path, lockOwner(r))
+	switch {
+	case errors.Is(err, ErrLockExists):
+		lfsLockResponse(w, http.StatusConflict, LockResponse{Lock: lock, Message: err.Error()})
+	case err != nil:
+		lfsLockResponse(w, http.StatusInternalServerError, LockResponse{Message: err.Error()})
+	default:
+		lfsLockResponse(w, http.StatusCreated, LockResponse{Lock: lock})
+	}
+}
+
+func (s *Server) LFSListLocks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	locks, next, err := s.Locks.List(r.Context(), s.RepositoryPath(r), LockListOptions{
+		ID:     query.Get("id"),
+		Path:   query.Get("path"),
+		Cursor: query.Get("cursor"),
+		Limit:  limit,
+	})
+	if err != nil {
+		lfsLockResponse(w, http.StatusInternalServerError, LockResponse{Message: err.Error()})
+		return
+	}
+	lfsLockResponse(w, http.StatusOK, LockList{Locks: locks, NextCursor: next})
+}
+
+// LFSVerifyLocks 列出锁并按照是否为当前用户所有分组，客户端在 push 前调用
+func (s *Server) LFSVerifyLocks(w http.ResponseWriter, r *http.Request) {
+	req := &LockVerifyRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		lfsLockResponse(w, http.StatusBadRequest, LockResponse{Message: err.Error()})
+		return
+	}
+	defer r.Body.Close()
+	locks, next, err := s.Locks.List(r.Context(), s.RepositoryPath(r), LockListOptions{Cursor: req.Cursor, Limit: req.Limit})
+	if err != nil {
+		lfsLockResponse(w, http.StatusInternalServerError, LockResponse{Message: err.Error()})
+		return
+	}
+	owner := lockOwner(r)
+	list := LockVerifyList{Ours: []Lock{}, Theirs: []Lock{}, NextCursor: next}
+	for _, lock := range locks {
+		if lock.Owner.Name == owner {
+			list.Ours = append(list.Ours, lock)
+		} else {
+			list.Theirs = append(list.Theirs, lock)
+		}
+	}
+	lfsLockResponse(w, http.StatusOK, list)
+}
+
+// LFSUnlock 解除锁定，非锁的所有者需要指定 force，并且需要是仓库的管理员
+func (s *Server) LFSUnlock(w http.ResponseWriter, r *http.Request) {
+	req := &UnlockRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		lfsLockResponse(w, http.StatusBadRequest, LockResponse{Message: err.Error()})
+		return
+	}
+	defer r.Body.Close()
+	ctx, repository, id := r.Context(), s.RepositoryPath(r), mux.Vars(r)["id"]
+
+	locks, _, err := s.Locks.List(ctx, repository, LockListOptions{ID: id})
+	if err != nil {
+		lfsLockResponse(w, http.StatusInternalServerError, LockResponse{Message: err.Error()})
+		return
+	}
+	if len(locks) == 0 {
+		lfsLockResponse(w, http.StatusNotFound, LockResponse{Message: ErrLockNotFound.Error()})
+		return
+	}
+	if locks[0].Owner.Name != lockOwner(r) {
+		if !req.Force {
+			lfsLockResponse(w, http.StatusForbidden, LockResponse{Lock: &locks[0], Message: "lock is owned by " + locks[0].Owner.Name})
+			return
+		}
+		if !s.canForceUnlock(r) {
+			lfsLockResponse(w, http.StatusForbidden, LockResponse{Lock: &locks[0], Message: "force unlock requires admin permission"})
+			return
+		}
+	}
+	lock, err := s.Locks.Delete(ctx, repository, id)
+	switch {
+	case errors.Is(err, ErrLockNotFound):
+		lfsLockResponse(w, http.StatusNotFound, LockResponse{Message: err.Error()})
+	case err != nil:
+		lfsLockResponse(w, http.StatusInternalServerError, LockResponse{Message: err.Error()})
+	default:
+		lfsLockResponse(w, http.StatusOK, LockResponse{Lock: lock})
+	}
+}
+
+// canForceUnlock 检查用户是否可以强制解除其他用户的锁，仅仓库所在命名空间的用户、拥有仓库所有权限或者管理员权限的用户可以。
+// 未启用认证时无法区分用户，锁的所有者也仅来自 basic auth 中的用户名，不做限制
+func (s *Server) canForceUnlock(r *http.Request) bool {
+	if s.Authc == nil {
+		return true
+	}
+	ctx, vars := r.Context(), mux.Vars(r)
+	username, owner, repository := UsernameFromContext(ctx), vars["username"], vars["repository"]
+	if username == owner {
+		return true
+	}
+	if s.Authz == nil {
+		return false
+	}
+	return s.Authz.HasPermission(ctx, username, auth.PermissionAdmin) ||
+		s.Authz.HasPermission(ctx, username, RepositoryPermission("*", owner, repository))
+}
+
+// lockOwner 使用认证的用户名作为锁的所有者，未启用认证时使用 basic auth 中的用户名
+func lockOwner(r *http.Request) string {
+	if username := UsernameFromContext(r.Context()); username != "" {
+		return username
+	}
+	if username, _, ok := r.BasicAuth(); ok && username != "" {
+		return username
+	}
+	return anonymousOwner
+}
+
+func lfsLockResponse(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", mimeGitLFSJSON)
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// FSLockManager 将锁存储在本地磁盘中，每个仓库一个 json 文件
+// <dir>/<repository>/locks.json
+type FSLockManager struct {
+	dir string
+	mu  sync.Mutex
+}
+
+var _ LFSLockManager = &FSLockManager{}
+
+func NewFSLockManager(dir string) *FSLockManager {
+	return &FSLockManager{dir: dir}
+}
+
+func (m *FSLockManager) Create(ctx context.Context, repository string, path string, owner string) (*Lock, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	locks, err := m.load(repository)
+	if err != nil {
+		return nil, err
+	}
+	for _, lock := range locks {
+		if lock.Path == path {
+			return &lock, ErrLockExists
+		}
+	}
+	lock := Lock{
+		ID:       uuid.NewString(),
+		Path:     path,
+		LockedAt: time.Now().UTC().Truncate(time.Second),
+		Owner:    LockOwner{Name: owner},
+	}
+	if err := m.save(repository, append(locks, lock)); err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+func (m *FSLockManager) List(ctx context.Context, repository string, opts LockListOptions) ([]Lock, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	locks, err := m.load(repository)
+	if err != nil {
+		return nil, "", err
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = defaultLocksLimit
+	}
+	started := opts.Cursor == ""
+	matched := []Lock{}
+	for _, lock := range locks {
+		if !started && lock.ID == opts.Cursor {
+			started = true
+		}
+		if !started || (opts.ID != "" && lock.ID != opts.ID) || (opts.Path != "" && lock.Path != opts.Path) {
+			continue
+		}
+		if len(matched) == opts.Limit {
+			return matched, lock.ID, nil
+		}
+		matched = append(matched, lock)
+	}
+	return matched, "", nil
+}
+
+func (m *FSLockManager) Delete(ctx context.Context, repository string, id string) (*Lock, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	locks, err := m.load(repository)
+	if err != nil {
+		return nil, err
+	}
+	for i, lock := range locks {
+		if lock.ID == id {
+			if err := m.save(repository, append(locks[:i:i], locks[i+1:]...)); err != nil {
+				return nil, err
+			}
+			return &lock, nil
+		}
+	}
+	return nil, ErrLockNotFound
+}
+
+func (m *FSLockManager) filename(repository string) string {
+	return filepath.Join(m.dir, filepath.Clean(string(filepath.Separator)+repository), "locks.json")
+}
+
+func (m *FSLockManager) load(repository string) ([]Lock, error) {
+	content, err := os.ReadFile(m.filename(repository))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	locks := []Lock{}
+	if err := json.Unmarshal(content, &locks); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(locks, func(i, j int) bool { return locks[i].LockedAt.Before(locks[j].LockedAt) })
+	return locks, nil
+}
+
+func (m *FSLockManager) save(repository string, locks []Lock) error {
+	filename := m.filename(repository)
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+	content, err := json.Marshal(locks)
+	if err != nil {
+		return err
+	}
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
@@ -0,0 +1,130 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kubegems.io/kubegems/pkg/model/store/auth"
+)
+
+func TestServer_locks(t *testing.T) {
+	s := &Server{GitBase: t.TempDir(), LFS: fakeLFS{}, Locks: NewFSLockManager(t.TempDir())}
+	server := httptest.NewServer(s.routes(true, false))
+	defer server.Close()
+	locksurl := server.URL + "/user/model.git/info/lfs/locks"
+
+	created := LockResponse{}
+	resp := lfsRequest(t, http.MethodPost, locksurl, "alice", LockCreateRequest{Path: "model.bin"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create lock status = %d", resp.StatusCode)
+	}
+	decodeBody(t, resp, &created)
+	if resp := lfsRequest(t, http.MethodPost, locksurl, "bob", LockCreateRequest{Path: "model.bin"}); resp.StatusCode != http.StatusConflict {
+		t.Errorf("lock on locked path status = %d", resp.StatusCode)
+	}
+	_ = lfsRequest(t, http.MethodPost, locksurl, "bob", LockCreateRequest{Path: "config.json"})
+
+	list := LockList{}
+	decodeBody(t, lfsRequest(t, http.MethodGet, locksurl+"?limit=1", "", nil), &list)
+	if len(list.Locks) != 1 || list.Locks[0].ID != created.Lock.ID || list.NextCursor == "" {
+		t.Errorf("unexpected first page %+v", list)
+	}
+	next := LockList{}
+	decodeBody(t, lfsRequest(t, http.MethodGet, locksurl+"?cursor="+list.NextCursor, "", nil), &next)
+	if len(next.Locks) != 1 || next.Locks[0].Path != "config.json" || next.NextCursor != "" {
+		t.Errorf("unexpected second page %+v", next)
+	}
+
+	verify := LockVerifyList{}
+	decodeBody(t, lfsRequest(t, http.MethodPost, locksurl+"/verify", "alice", LockVerifyRequest{}), &verify)
+	if len(verify.Ours) != 1 || len(verify.Theirs) != 1 || verify.Ours[0].Path != "model.bin" {
+		t.Errorf("unexpected verify result %+v", verify)
+	}
+
+	unlockurl := locksurl + "/" + created.Lock.ID + "/unlock"
+	if resp := lfsRequest(t, http.MethodPost, unlockurl, "bob", UnlockRequest{}); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("unlock others lock status = %d", resp.StatusCode)
+	}
+	if resp := lfsRequest(t, http.MethodPost, unlockurl, "bob", UnlockRequest{Force: true}); resp.StatusCode != http.StatusOK {
+		t.Errorf("force unlock status = %d", resp.StatusCode)
+	}
+	if resp := lfsRequest(t, http.MethodPost, unlockurl, "alice", UnlockRequest{}); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unlock removed lock status = %d", resp.StatusCode)
+	}
+}
+
+// lockRequest 使用 basic auth 的密码传递 token，fakeAuthc 使用 token 作为用户名
+func lockRequest(t *testing.T, url, user string, body interface{}) *http.Response {
+	content, _ := json.Marshal(body)
+	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(content))
+	req.Header.Set("Content-Type", mimeGitLFSJSON)
+	req.SetBasicAuth(user, user)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestServer_LFSUnlock_force(t *testing.T) {
+	s := &Server{
+		GitBase: t.TempDir(),
+		LFS:     fakeLFS{},
+		Locks:   NewFSLockManager(t.TempDir()),
+		Authc:   fakeAuthc{},
+		Authz: fakeAuthz{
+			"alice": {RepositoryPermission(ActionWrite, "user", "model")},
+			"bob":   {RepositoryPermission(ActionWrite, "user", "model")},
+			"maint": {RepositoryPermission("*", "user", "model")},
+			"admin": {auth.PermissionAdmin},
+		},
+	}
+	server := httptest.NewServer(s.routes(true, false))
+	defer server.Close()
+	locksurl := server.URL + "/user/model.git/info/lfs/locks"
+
+	tests := []struct {
+		user     string
+		wantCode int
+	}{
+		{user: "bob", wantCode: http.StatusForbidden},
+		{user: "maint", wantCode: http.StatusOK},
+		{user: "admin", wantCode: http.StatusOK},
+		{user: "user", wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.user, func(t *testing.T) {
+			created := LockResponse{}
+			decodeBody(t, lockRequest(t, locksurl, "alice", LockCreateRequest{Path: "model.bin"}), &created)
+			if created.Lock == nil {
+				t.Fatal("lock not created")
+			}
+			unlockurl := locksurl + "/" + created.Lock.ID + "/unlock"
+			resp := lockRequest(t, unlockurl, tt.user, UnlockRequest{Force: true})
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("force unlock by %s status = %d, want %d", tt.user, resp.StatusCode, tt.wantCode)
+			}
+			if resp.StatusCode != http.StatusOK {
+				lockRequest(t, unlockurl, "alice", UnlockRequest{}).Body.Close()
+			}
+		})
+	}
+}
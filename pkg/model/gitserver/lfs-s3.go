@@ -16,6 +16,7 @@ package gitserver
 
 import (
 	"context"
+	"errors"
 	"path"
 	"time"
 
@@ -23,6 +24,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 type S3ContentManager struct {
@@ -106,9 +108,16 @@ func (m *S3ContentManager) Download(ctx context.Context, dir string, oid string)
 	}, nil
 }
 
-func (m *S3ContentManager) Verify(ctx context.Context, path string, oid string) (*BatchObject, error) {
-	headresult, err := m.s3cli.HeadObject(ctx, &s3.HeadObjectInput{})
+func (m *S3ContentManager) Verify(ctx context.Context, dir string, oid string) (*BatchObject, error) {
+	headresult, err := m.s3cli.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(m.options.Bucket),
+		Key:    aws.String(path.Join(dir, oid)),
+	})
 	if err != nil {
+		var notfound *types.NotFound
+		if errors.As(err, &notfound) {
+			return nil, ErrObjectNotFound
+		}
 		return nil, err
 	}
 	return &BatchObject{
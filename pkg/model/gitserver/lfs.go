@@ -17,9 +17,14 @@ package gitserver
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
+
+	"github.com/gorilla/mux"
 )
 
 const (
@@ -147,6 +152,13 @@ func (s *Server) LFSBatch(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	switch batch.Operation {
 	case OperationUpload:
+		if s.Authc != nil {
+			vars := mux.Vars(r)
+			if !s.HasPermission(ctx, UsernameFromContext(ctx), vars["username"], vars["repository"], ActionWrite) {
+				RawResponse(w, http.StatusForbidden, nil, BatchError{Message: "write permission required"})
+				return
+			}
+		}
 		for _, obj := range batch.Objects {
 			if link, err := s.LFS.Upload(ctx, repopath, obj.OID); err != nil {
 				obj.Error = &ObjectError{Code: http.StatusInternalServerError, Message: err.Error()}
@@ -184,19 +196,83 @@ func (s *Server) LFSUpload(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) LFSDownload(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("ok"))
+	store, ok := s.LFS.(LFSContentStore)
+	if !ok {
+		NotFound(w)
+		return
+	}
+	content, size, err := store.Get(r.Context(), s.RepositoryPath(r), mux.Vars(r)["oid"])
+	if err != nil {
+		lfsObjectError(w, err)
+		return
+	}
+	defer content.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.Copy(w, content)
 }
 
 func (s *Server) LFSUpdate(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("ok"))
+	store, ok := s.LFS.(LFSContentStore)
+	if !ok {
+		NotFound(w)
+		return
+	}
+	defer r.Body.Close()
+	if err := store.Put(r.Context(), s.RepositoryPath(r), mux.Vars(r)["oid"], r.Body); err != nil {
+		lfsObjectError(w, err)
+		return
+	}
+	OK(w, "")
 }
 
 func (s *Server) LFSDelete(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("ok"))
+	store, ok := s.LFS.(LFSContentStore)
+	if !ok {
+		NotFound(w)
+		return
+	}
+	if err := store.Delete(r.Context(), s.RepositoryPath(r), mux.Vars(r)["oid"]); err != nil {
+		lfsObjectError(w, err)
+		return
+	}
+	OK(w, "")
 }
 
+// LFSVerify 校验上传的对象是否存在且大小一致
+// https://github.com/git-lfs/git-lfs/blob/main/docs/api/basic-transfers.md#verification
 func (s *Server) LFSVerify(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("ok"))
+	obj := &BatchObject{}
+	if err := json.NewDecoder(r.Body).Decode(obj); err != nil {
+		BadRequest(w, ObjectError{Code: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+	defer r.Body.Close()
+	exist, err := s.LFS.Verify(r.Context(), s.RepositoryPath(r), obj.OID)
+	if err != nil {
+		lfsObjectError(w, err)
+		return
+	}
+	if exist.Size != obj.Size {
+		RawResponse(w, http.StatusUnprocessableEntity, nil, ObjectError{
+			Code:    http.StatusUnprocessableEntity,
+			Message: fmt.Sprintf("object size mismatch: expect %d, got %d", obj.Size, exist.Size),
+		})
+		return
+	}
+	OK(w, exist)
+}
+
+func lfsObjectError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrObjectNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, ErrInvalidOID), errors.Is(err, ErrOIDMismatch):
+		code = http.StatusUnprocessableEntity
+	}
+	RawResponse(w, code, nil, ObjectError{Code: code, Message: err.Error()})
 }
 
 type LFSMetaManager interface {
@@ -37,7 +37,13 @@ func (s *Server) routes(lfsenabled bool, githttpbackendenabled bool) http.Handle
 	// admin
 	repoapi.HandleFunc("", s.CreateRepository).Methods("POST")
 	repoapi.HandleFunc("", s.RemoveRepository).Methods("DELETE")
+	// browse
+	repoapi.HandleFunc("/refs", s.ListRefs).Methods("GET")
+	repoapi.HandleFunc("/branches", s.ListBranches).Methods("GET")
+	repoapi.HandleFunc("/tags", s.ListTags).Methods("GET")
 	repoapi.HandleFunc("/files", s.ListFiles).Methods("GET")
+	repoapi.HandleFunc("/blob", s.GetBlob).Methods("GET")
+	repoapi.HandleFunc("/commits", s.ListCommits).Methods("GET")
 
 	// .git
 	gitrepor := r.PathPrefix("/{username}/{repository}.git").Subrouter()
@@ -54,6 +60,13 @@ func (s *Server) routes(lfsenabled bool, githttpbackendenabled bool) http.Handle
 		gitlfsr.HandleFunc("/objects/{oid}", s.LFSDelete).Methods("DELETE")
 		// https://github.com/git-lfs/git-lfs/blob/main/docs/api/basic-transfers.md#verification
 		gitlfsr.HandleFunc("/verify", s.LFSVerify).Methods("POST").MatcherFunc(LFSBatchMatcher)
+		// https://github.com/git-lfs/git-lfs/blob/main/docs/api/locking.md
+		if s.Locks != nil {
+			gitlfsr.HandleFunc("/locks", s.LFSCreateLock).Methods("POST")
+			gitlfsr.HandleFunc("/locks", s.LFSListLocks).Methods("GET")
+			gitlfsr.HandleFunc("/locks/verify", s.LFSVerifyLocks).Methods("POST")
+			gitlfsr.HandleFunc("/locks/{id}/unlock", s.LFSUnlock).Methods("POST")
+		}
 	}
 
 	// git http
@@ -96,6 +109,7 @@ func (s *Server) routes(lfsenabled bool, githttpbackendenabled bool) http.Handle
 	}
 	r.Use(mux.CORSMethodMiddleware(r))
 	r.Use(LoggingMiddleware)
+	r.Use(s.AuthMiddleware)
 	return r
 }
 
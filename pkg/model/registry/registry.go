@@ -16,24 +16,49 @@ package registry
 
 import (
 	"context"
+	"fmt"
+	"os"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/go-logr/logr"
 	"kubegems.io/kubegems/pkg/log"
 	"kubegems.io/kubegems/pkg/model/gitserver"
+	"kubegems.io/kubegems/pkg/model/store/auth"
+	"kubegems.io/kubegems/pkg/utils/mongo"
 )
 
 type Options struct {
-	Listen string       `json:"listen,omitempty" description:"http server listen address"`
-	S3     LFSS3Options `json:"s3,omitempty" description:"s3 options"`
-	Git    GitOptions   `json:"git,omitempty" description:"git options"`
+	Listen string                          `json:"listen,omitempty" description:"http server listen address"`
+	LFS    LFSOptions                      `json:"lfs,omitempty" description:"git lfs options"`
+	S3     LFSS3Options                    `json:"s3,omitempty" description:"s3 options"`
+	Git    GitOptions                      `json:"git,omitempty" description:"git options"`
+	Auth   AuthOptions                     `json:"auth,omitempty" description:"authentication and authorization options"`
+	Store  gitserver.ModelStoreHookOptions `json:"store,omitempty" description:"model store notified after push,disabled if addr is empty"`
+}
+
+type AuthOptions struct {
+	Enabled bool           `json:"enabled,omitempty" description:"enable token authentication and per repository authorization"`
+	JWTCert string         `json:"jwtcert,omitempty" description:"public key or certificate file used to verify token signatures, required if auth enabled"`
+	Mongo   *mongo.Options `json:"mongo,omitempty" description:"mongodb the permissions stored in"`
 }
 
 type GitOptions struct {
 	Dir string `json:"dir,omitempty"` // base git directory
 }
 
+const (
+	LFSStorageS3 = "s3"
+	LFSStorageFS = "fs"
+)
+
+type LFSOptions struct {
+	Storage  string `json:"storage,omitempty" description:"lfs objects storage, one of s3, fs"`
+	Dir      string `json:"dir,omitempty" description:"directory the lfs objects stored in when storage is fs"`
+	URL      string `json:"url,omitempty" description:"external url of the git server, used to generate lfs object links when storage is fs"`
+	LocksDir string `json:"locksdir,omitempty" description:"directory the lfs file locks stored in, lfs file locking api disabled if empty"`
+}
+
 type LFSS3Options struct {
 	Addr         string        `json:"addr,omitempty" description:"s3 url"`
 	Bucket       string        `json:"bucket,omitempty" description:"s3 bucket name the lfs objects are stored in"`
@@ -45,6 +70,10 @@ type LFSS3Options struct {
 func DefaultOptions() *Options {
 	return &Options{
 		Listen: ":8080",
+		LFS: LFSOptions{
+			Storage: LFSStorageS3,
+			Dir:     "lfs",
+		},
 		S3: LFSS3Options{
 			Addr:         "http://s3.example.com",
 			Bucket:       "git-lfs",
@@ -53,25 +82,44 @@ func DefaultOptions() *Options {
 		Git: GitOptions{
 			Dir: "repositories",
 		},
+		Auth: AuthOptions{
+			Enabled: false,
+			Mongo:   mongo.DefaultOptions(),
+		},
+		Store: gitserver.ModelStoreHookOptions{
+			Source:  "kubegems",
+			Timeout: 30 * time.Second,
+		},
 	}
 }
 
 func Run(ctx context.Context, opts *Options) error {
 	ctx = log.NewContext(ctx, log.LogrLogger)
 
-	s3lfsman, err := gitserver.NewS3ContentManager(ctx, &gitserver.S3ContentManagerOptions{
-		URL:    opts.S3.Addr,
-		Bucket: opts.S3.Bucket,
-		Credential: aws.Credentials{
-			AccessKeyID:     opts.S3.AccessKey,
-			SecretAccessKey: opts.S3.SecretKey,
-		},
-		LinkExpireIn: opts.S3.LinkExpireIn,
-	})
+	lfsman, err := newLFSMetaManager(ctx, opts)
 	if err != nil {
 		return err
 	}
-	s := gitserver.Server{GitBase: opts.Git.Dir, LFS: s3lfsman}
+	s := gitserver.Server{GitBase: opts.Git.Dir, LFS: lfsman}
+	if opts.LFS.LocksDir != "" {
+		s.Locks = gitserver.NewFSLockManager(opts.LFS.LocksDir)
+	}
+	if opts.Auth.Enabled {
+		authc, err := newJWTAuthenticationManager(opts.Auth.JWTCert)
+		if err != nil {
+			return err
+		}
+		mongocli, mongodb, err := mongo.New(ctx, opts.Auth.Mongo)
+		if err != nil {
+			return fmt.Errorf("setup mongo: %v", err)
+		}
+		defer mongocli.Disconnect(ctx)
+		s.Authc = authc
+		s.Authz = auth.NewLocalAuthorization(ctx, mongodb)
+	}
+	if opts.Store.Addr != "" {
+		s.Hooks = append(s.Hooks, gitserver.NewModelStoreHook(&opts.Store))
+	}
 	log := logr.FromContextOrDiscard(ctx)
 	log.Info("starting git http server", "listen", opts.Listen)
 	if err := s.Run(ctx, &gitserver.Options{Listen: opts.Listen, UseGitHTTPBackend: true}); err != nil {
@@ -79,3 +127,39 @@ func Run(ctx context.Context, opts *Options) error {
 	}
 	return nil
 }
+
+func newLFSMetaManager(ctx context.Context, opts *Options) (gitserver.LFSMetaManager, error) {
+	switch opts.LFS.Storage {
+	case LFSStorageS3, "":
+		return gitserver.NewS3ContentManager(ctx, &gitserver.S3ContentManagerOptions{
+			URL:    opts.S3.Addr,
+			Bucket: opts.S3.Bucket,
+			Credential: aws.Credentials{
+				AccessKeyID:     opts.S3.AccessKey,
+				SecretAccessKey: opts.S3.SecretKey,
+			},
+			LinkExpireIn: opts.S3.LinkExpireIn,
+		})
+	case LFSStorageFS:
+		if opts.LFS.URL == "" {
+			return nil, fmt.Errorf("lfs url is required when lfs storage is %s", LFSStorageFS)
+		}
+		return gitserver.NewFSContentManager(&gitserver.FSContentManagerOptions{
+			Dir: opts.LFS.Dir,
+			URL: opts.LFS.URL,
+		})
+	default:
+		return nil, fmt.Errorf("unknown lfs storage %s", opts.LFS.Storage)
+	}
+}
+
+func newJWTAuthenticationManager(certfile string) (*auth.JWTAuthenticationManager, error) {
+	if certfile == "" {
+		return nil, fmt.Errorf("auth enabled but no jwt cert configured")
+	}
+	content, err := os.ReadFile(certfile)
+	if err != nil {
+		return nil, fmt.Errorf("read jwt cert: %v", err)
+	}
+	return auth.NewJWTAuthenticationManager(content)
+}
@@ -137,6 +137,9 @@ func (m *ModelsAPI) RegisterRoute(rg *route.Group) {
 							// model versions
 							route.GET("/versions").To(m.ListVersions).Doc("list versions").Response([]repository.ModelVersion{}),
 							route.GET("/versions/{version}").To(m.GetVersion).Doc("get version").Response(repository.ModelVersion{}),
+							route.POST("/versions").To(m.UpsertVersion).Doc("create or replace version").
+								Parameters(route.BodyParameter("body", repository.ModelVersion{})).
+								Response(repository.ModelVersion{}),
 						).
 						// models comments
 						AddSubGroup(m.registerCommentsRoute()),
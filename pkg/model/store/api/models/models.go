@@ -29,8 +29,11 @@ func DecodeSourceModelName(req *restful.Request) (string, string) {
 	name := req.PathParameter("model")
 
 	// model name may contains '/' so we b64encode model name at frontend
+	// url safe encoding is also accepted, the encoded name will not contain '/'
 	if decoded, err := base64.StdEncoding.DecodeString(name); err == nil {
 		name = string(decoded)
+	} else if decoded, err := base64.URLEncoding.DecodeString(name); err == nil {
+		name = string(decoded)
 	}
 
 	if decodedname, _ := url.PathUnescape(name); decodedname != "" {
@@ -112,6 +115,25 @@ func (m *ModelsAPI) GetVersion(req *restful.Request, resp *restful.Response) {
 	response.OK(resp, model)
 }
 
+// UpsertVersion 添加或者替换模型版本，模型仓库在推送后通过该接口创建版本
+func (m *ModelsAPI) UpsertVersion(req *restful.Request, resp *restful.Response) {
+	source, name := DecodeSourceModelName(req)
+	var version repository.ModelVersion
+	if err := req.ReadEntity(&version); err != nil {
+		response.BadRequest(resp, err.Error())
+		return
+	}
+	if version.Name == "" {
+		response.BadRequest(resp, "version name is required")
+		return
+	}
+	if err := m.ModelRepository.UpsertVersion(req.Request.Context(), source, name, version); err != nil {
+		response.BadRequest(resp, err.Error())
+		return
+	}
+	response.OK(resp, version)
+}
+
 func (m *ModelsAPI) UpsertModel(req *restful.Request, resp *restful.Response) {
 	var model repository.Model
 	if err := req.ReadEntity(&model); err != nil {
@@ -16,6 +16,7 @@ package auth
 
 import (
 	"context"
+	"crypto/rsa"
 	"fmt"
 
 	"github.com/golang-jwt/jwt"
@@ -48,3 +49,34 @@ func (a *UnVerifyJWTAuthenticationManager) UserInfo(ctx context.Context, token s
 	}
 	return UserInfo{Username: username}, nil
 }
+
+// NewJWTAuthenticationManager 使用签发 token 的公钥(或证书)校验 token 的签名
+func NewJWTAuthenticationManager(publicKeyPEM []byte) (*JWTAuthenticationManager, error) {
+	publicKey, err := jwt.ParseRSAPublicKeyFromPEM(publicKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("parse public key: %v", err)
+	}
+	return &JWTAuthenticationManager{publicKey: publicKey}, nil
+}
+
+type JWTAuthenticationManager struct {
+	publicKey *rsa.PublicKey
+}
+
+func (a *JWTAuthenticationManager) UserInfo(ctx context.Context, token string) (UserInfo, error) {
+	claims := &jwt.StandardClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		return a.publicKey, nil
+	})
+	if err != nil {
+		return UserInfo{}, fmt.Errorf("parse token: %v", err)
+	}
+	username := claims.Subject
+	if username == "" {
+		return UserInfo{}, fmt.Errorf("sub not found in token")
+	}
+	return UserInfo{Username: username}, nil
+}
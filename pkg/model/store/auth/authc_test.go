@@ -0,0 +1,88 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func TestJWTAuthenticationManager_UserInfo(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	public, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	authc, err := NewJWTAuthenticationManager(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(method jwt.SigningMethod, key interface{}, claims jwt.StandardClaims) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	expires := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		name    string
+		token   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "signed",
+			token: sign(jwt.SigningMethodRS256, key, jwt.StandardClaims{Subject: "alice", ExpiresAt: expires}),
+			want:  "alice",
+		},
+		{
+			name:    "signed by other key",
+			token:   sign(jwt.SigningMethodRS256, other, jwt.StandardClaims{Subject: "alice", ExpiresAt: expires}),
+			wantErr: true,
+		},
+		{
+			name:    "hmac with public key",
+			token:   sign(jwt.SigningMethodHS256, public, jwt.StandardClaims{Subject: "alice", ExpiresAt: expires}),
+			wantErr: true,
+		},
+		{
+			name:    "expired",
+			token:   sign(jwt.SigningMethodRS256, key, jwt.StandardClaims{Subject: "alice", ExpiresAt: time.Now().Add(-time.Hour).Unix()}),
+			wantErr: true,
+		},
+		{
+			name:    "no subject",
+			token:   sign(jwt.SigningMethodRS256, key, jwt.StandardClaims{ExpiresAt: expires}),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := authc.UserInfo(context.Background(), tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UserInfo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.Username != tt.want {
+				t.Errorf("UserInfo() = %v, want %v", got.Username, tt.want)
+			}
+		})
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/goharbor/harbor/src/lib/errors"
 	"go.mongodb.org/mongo-driver/bson"
@@ -345,6 +346,31 @@ func (r *ModelsRepository) GetVersion(ctx context.Context, source, model, versio
 	return ModelVersion{}, fmt.Errorf("version %s not found", version)
 }
 
+// UpsertVersion 添加模型版本，同名版本存在时替换该版本，模型不存在时创建模型
+func (r *ModelsRepository) UpsertVersion(ctx context.Context, source, model string, version ModelVersion) error {
+	now := time.Now()
+	result, err := r.Collection.UpdateOne(ctx,
+		bson.M{"source": source, "name": model, "versions.name": version.Name},
+		bson.M{"$set": bson.M{"versions.$": version, "lastModified": now}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+	_, err = r.Collection.UpdateOne(ctx,
+		bson.M{"source": source, "name": model},
+		bson.M{
+			"$push":        bson.M{"versions": version},
+			"$set":         bson.M{"lastModified": now},
+			"$setOnInsert": bson.M{"create_at": now, "enabled": true},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
 func (r *ModelsRepository) Upsert(ctx context.Context, model Model) (Model, error) {
 	var (
 		recomment        int
@@ -50,6 +50,7 @@ func (h *ObservabilityHandler) RegistRouter(rg *gin.RouterGroup) {
 	rg.PUT("/observability/tenant/:tenant_id/channels/:channel_id", h.CheckByTenantID, h.UpdateChannel)
 	rg.DELETE("/observability/tenant/:tenant_id/channels/:channel_id", h.CheckByTenantID, h.DeleteChannel)
 	rg.POST("/observability/tenant/:tenant_id/channels/:channel_id/test", h.TestChannel)
+	rg.POST("/observability/tenant/:tenant_id/channels/_/preview", h.CheckByTenantID, h.PreviewChannel)
 
 	rg.GET("/observability/cluster/:cluster/namespaces/:namespace/logging/alerts", h.CheckByClusterNamespace, h.ListLoggingAlertRule)
 	rg.GET("/observability/cluster/:cluster/namespaces/:namespace/logging/alerts/_/status", h.CheckByClusterNamespace, h.ListLoggingAlertRulesStatus)
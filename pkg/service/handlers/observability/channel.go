@@ -24,7 +24,7 @@ import (
 	"gorm.io/gorm"
 	"kubegems.io/kubegems/pkg/service/handlers"
 	"kubegems.io/kubegems/pkg/service/models"
-	"kubegems.io/kubegems/pkg/utils/prometheus"
+	"kubegems.io/kubegems/pkg/utils/prometheus/channels"
 )
 
 func (h *ObservabilityHandler) getChannelReq(c *gin.Context) (*models.AlertChannel, error) {
@@ -268,27 +268,7 @@ func (h *ObservabilityHandler) TestChannel(c *gin.Context) {
 		return
 	}
 
-	now := time.Now()
-	alertObj := prometheus.WebhookAlert{
-		Receiver: ch.ReceiverName(),
-		Status:   "firing",
-		Alerts: []prometheus.Alert{
-			{
-				Status: "firing",
-				Labels: map[string]string{
-					prometheus.AlertNameLabel:      "kubegems-test-alert",
-					prometheus.SeverityLabel:       prometheus.SeverityError,
-					prometheus.AlertClusterKey:     "kubegems",
-					prometheus.AlertNamespaceLabel: "kubegems-test-namespace",
-				},
-				Annotations: map[string]string{
-					prometheus.MessageAnnotationsKey: "kubegems test alert message",
-					prometheus.ValueAnnotationKey:    "0",
-				},
-				StartsAt: &now,
-			},
-		},
-	}
+	alertObj := channels.SampleWebhookAlert(ch.ReceiverName())
 	if err := ch.ChannelConfig.ChannelIf.Test(alertObj); err != nil {
 		handlers.NotOK(c, err)
 		return
@@ -296,3 +276,28 @@ func (h *ObservabilityHandler) TestChannel(c *gin.Context) {
 
 	handlers.OK(c, "ok")
 }
+
+// PreviewChannel 预览告警渠道模板
+//	@Tags			Observability
+//	@Summary		预览告警渠道模板
+//	@Description	使用示例告警渲染告警渠道的通知模板，未配置模板时使用默认模板
+//	@Accept			json
+//	@Produce		json
+//	@Param			tenant_id	path		string												true	"租户id, 所有租户为_all"
+//	@Param			form		body		models.AlertChannel									true	"body"
+//	@Success		200			{object}	handlers.ResponseStruct{Data=channels.Message}	"resp"
+//	@Router			/v1/observability/tenant/{tenant_id}/channels/_/preview [post]
+//	@Security		JWT
+func (h *ObservabilityHandler) PreviewChannel(c *gin.Context) {
+	req, err := h.getChannelReq(c)
+	if err != nil {
+		handlers.NotOK(c, err)
+		return
+	}
+	msg, err := req.ChannelConfig.ChannelIf.Preview(channels.SampleWebhookAlert(req.ReceiverName()))
+	if err != nil {
+		handlers.NotOK(c, err)
+		return
+	}
+	handlers.OK(c, msg)
+}
@@ -250,6 +250,8 @@ func MigrateModels(db *gorm.DB) error {
 		&PromqlTplScope{}, &PromqlTplResource{}, &PromqlTplRule{},
 		// 公告
 		&Announcement{},
+		// 异步任务历史
+		&TaskHistory{},
 	)
 }
 
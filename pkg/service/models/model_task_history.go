@@ -0,0 +1,41 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// TaskHistory 异步任务历史表，worker 定期将任务存储中超过保留时间的任务归档至此
+type TaskHistory struct {
+	ID uint `gorm:"primarykey"`
+	// 任务 uid
+	UID string `gorm:"type:varchar(64);uniqueIndex"`
+	// 任务分组
+	Group string `gorm:"column:task_group;type:varchar(128);index"`
+	// 任务名称
+	Name string `gorm:"type:varchar(512)"`
+	// 任务状态
+	Status string `gorm:"type:varchar(32)"`
+	// 任务创建时间
+	CreationTimestamp time.Time `gorm:"index"`
+	// 任务完成时间
+	FinishTimestamp *time.Time
+	// 完整的任务数据
+	Content   datatypes.JSON
+	CreatedAt time.Time
+}
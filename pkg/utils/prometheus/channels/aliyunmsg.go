@@ -58,6 +58,9 @@ func (m *AliyunMsg) ToReceiver(name string) v1alpha1.Receiver {
 }
 
 func (m *AliyunMsg) Check() error {
+	if m.Template != nil {
+		return fmt.Errorf("aliyun message uses template code, custom template not supported")
+	}
 	return utils.CheckStructFieldsEmpty(m)
 }
 
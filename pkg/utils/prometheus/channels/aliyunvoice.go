@@ -56,6 +56,9 @@ func (v *AliyunVoice) ToReceiver(name string) v1alpha1.Receiver {
 }
 
 func (v *AliyunVoice) Check() error {
+	if v.Template != nil {
+		return fmt.Errorf("aliyun voice uses tts code, custom template not supported")
+	}
 	return utils.CheckStructFieldsEmpty(v)
 }
 
@@ -51,12 +51,26 @@ type ChannelIf interface {
 	ToReceiver(name string) v1alpha1.Receiver
 	Check() error
 	Test(alert prometheus.WebhookAlert) error
+	Preview(alert prometheus.WebhookAlert) (*Message, error)
 	String() string
 }
 
 type BaseChannel struct {
 	ChannelType  ChannelType `json:"channelType"`
 	SendResolved bool        `json:"sendResolved"`
+	Template     *Template   `json:"template,omitempty"` // 自定义通知模板，邮件、飞书、钉钉以及 webhook 渠道支持，为空时使用渠道默认格式
+}
+
+func (b *BaseChannel) template() *Template {
+	return b.Template
+}
+
+// Preview 使用渠道的模板渲染告警，未配置模板时使用 DefaultTemplate
+func (b *BaseChannel) Preview(alert prometheus.WebhookAlert) (*Message, error) {
+	if b.Template == nil {
+		return DefaultTemplate.Render(alert)
+	}
+	return b.Template.Render(alert)
 }
 
 type ChannelConfig struct {
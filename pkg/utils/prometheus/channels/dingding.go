@@ -15,9 +15,12 @@
 package channels
 
 import (
+	"context"
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1alpha1"
 	"kubegems.io/kubegems/pkg/utils"
@@ -41,6 +44,9 @@ func (f *Dingding) formatURL() string {
 }
 
 func (f *Dingding) ToReceiver(name string) v1alpha1.Receiver {
+	if f.Template != nil {
+		return renderReceiver(name, f.renderURL(), f.SendResolved)
+	}
 	u := f.formatURL()
 	return v1alpha1.Receiver{
 		Name: name,
@@ -57,13 +63,82 @@ func (f *Dingding) Check() error {
 	if !strings.Contains(f.URL, "oapi.dingtalk.com") {
 		return fmt.Errorf("Dingding robot url not valid")
 	}
-	return nil
+	return f.Template.Check(TemplateFormatText, TemplateFormatMarkdown)
 }
 
 func (f *Dingding) Test(alert prometheus.WebhookAlert) error {
+	if f.Template != nil {
+		return renderAndSend(context.Background(), f, alert)
+	}
 	return testAlertproxy(f.formatURL(), alert)
 }
 
+// Preview 未配置模板时通知由 alertproxy 格式化，无法预览
+func (f *Dingding) Preview(alert prometheus.WebhookAlert) (*Message, error) {
+	if f.Template == nil {
+		return nil, fmt.Errorf("dingding message is formatted by alertproxy without a template, configure a template to preview")
+	}
+	return f.Template.Render(alert)
+}
+
+// renderURL 配置模板时由 kubegems 渲染后发送
+func (f *Dingding) renderURL() string {
+	ch := *f
+	ch.ChannelType = TypeDingding
+	return renderURL(&ch)
+}
+
 func (f *Dingding) String() string {
+	if f.Template != nil {
+		return f.renderURL()
+	}
 	return f.formatURL()
 }
+
+type dingdingResponse struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+// Send 通过钉钉机器人发送渲染后的通知
+func (f *Dingding) Send(ctx context.Context, msg *Message) error {
+	mobiles := splitList(f.AtMobiles)
+	at := ""
+	for _, mobile := range mobiles {
+		at += " @" + mobile
+	}
+	payload := map[string]any{
+		"at": map[string]any{"atMobiles": mobiles},
+	}
+	if msg.Format == TemplateFormatMarkdown {
+		payload["msgtype"] = "markdown"
+		payload["markdown"] = map[string]any{"title": msg.Title, "text": msg.Body + at}
+	} else {
+		text := msg.Body
+		if msg.Title != "" {
+			text = msg.Title + "\n" + text
+		}
+		payload["msgtype"] = "text"
+		payload["text"] = map[string]any{"content": text + at}
+	}
+	u := f.URL
+	if f.SignSecret != "" {
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		q := url.Values{}
+		q.Set("timestamp", timestamp)
+		q.Set("sign", hmacSign(f.SignSecret, timestamp+"\n"+f.SignSecret))
+		sep := "?"
+		if strings.Contains(u, "?") {
+			sep = "&"
+		}
+		u += sep + q.Encode()
+	}
+	resp := dingdingResponse{}
+	if err := postJSON(ctx, newHTTPClient(false), u, payload, &resp); err != nil {
+		return err
+	}
+	if resp.ErrCode != 0 {
+		return fmt.Errorf("dingding robot: %d %s", resp.ErrCode, resp.ErrMsg)
+	}
+	return nil
+}
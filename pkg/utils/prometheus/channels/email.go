@@ -46,43 +46,70 @@ func EmailSecretKey(receverName, from string) string {
 	return receverName + "-" + strings.ReplaceAll(from, "@", "")
 }
 
+const defaultEmailSubject = `Kubegems alert [{{ .CommonLabels.gems_alertname }}:{{ .Alerts.Firing | len }}] in [cluster:{{ .CommonLabels.cluster }}] [namespace:{{ .CommonLabels.gems_namespace }}]`
+
 func (e *Email) ToReceiver(name string) v1alpha1.Receiver {
-	return v1alpha1.Receiver{
-		Name: name,
-		EmailConfigs: []v1alpha1.EmailConfig{
+	cfg := v1alpha1.EmailConfig{
+		Smarthost:    e.SMTPServer,
+		RequireTLS:   &e.RequireTLS,
+		From:         e.From,
+		AuthUsername: e.From,
+		AuthIdentity: e.From,
+		To:           e.To,
+		AuthPassword: &v1.SecretKeySelector{
+			LocalObjectReference: v1.LocalObjectReference{
+				Name: EmailSecretName,
+			},
+			Key: EmailSecretKey(name, e.From),
+		},
+		HTML: `{{ template "email.common.html" . }}`,
+		Headers: []v1alpha1.KeyValue{
 			{
-				Smarthost:    e.SMTPServer,
-				RequireTLS:   &e.RequireTLS,
-				From:         e.From,
-				AuthUsername: e.From,
-				AuthIdentity: e.From,
-				To:           e.To,
-				AuthPassword: &v1.SecretKeySelector{
-					LocalObjectReference: v1.LocalObjectReference{
-						Name: EmailSecretName,
-					},
-					Key: EmailSecretKey(name, e.From),
-				},
-				HTML: `{{ template "email.common.html" . }}`,
-				Headers: []v1alpha1.KeyValue{
-					{
-						Key:   "subject",
-						Value: `Kubegems alert [{{ .CommonLabels.gems_alertname }}:{{ .Alerts.Firing | len }}] in [cluster:{{ .CommonLabels.cluster }}] [namespace:{{ .CommonLabels.gems_namespace }}]`,
-					},
-				},
-				SendResolved: utils.BoolPointer(e.SendResolved),
+				Key:   "subject",
+				Value: defaultEmailSubject,
 			},
 		},
+		SendResolved: utils.BoolPointer(e.SendResolved),
+	}
+	// 邮件模板由 alertmanager 渲染
+	if e.Template != nil {
+		if e.Template.Title != "" {
+			cfg.Headers[0].Value = e.Template.Title
+		}
+		if e.Template.format() == TemplateFormatHTML {
+			cfg.HTML = e.Template.Body
+		} else {
+			cfg.HTML, cfg.Text = "", e.Template.Body
+		}
+	}
+	return v1alpha1.Receiver{
+		Name:         name,
+		EmailConfigs: []v1alpha1.EmailConfig{cfg},
 	}
 }
 
 func (e *Email) Check() error {
-	return nil
+	return e.Template.Check(TemplateFormatText, TemplateFormatHTML)
 }
 
 func (e *Email) Test(alert prometheus.WebhookAlert) error {
 	auth := sasl.NewPlainClient("", e.From, e.AuthPassword)
 	receivers := strings.Split(e.To, ",")
+	if e.Template != nil {
+		msg, err := e.Template.Render(alert)
+		if err != nil {
+			return err
+		}
+		contentType := "text/plain"
+		if msg.Format == TemplateFormatHTML {
+			contentType = "text/html"
+		}
+		buf := bytes.NewBufferString("To: " + e.To + "\r\n" +
+			"Subject: " + headerValue(msg.Title) + "\r\n" +
+			"Content-Type: " + contentType + "; charset=UTF-8\r\n" +
+			"\r\n" + msg.Body)
+		return smtp.SendMail(e.SMTPServer, auth, e.From, receivers, buf)
+	}
 	buf := bytes.NewBufferString("To: " + e.To + "\r\n" +
 		"Subject: Kubegems test email" + "\r\n" +
 		"\r\n")
@@ -98,3 +125,8 @@ func (e *Email) Test(alert prometheus.WebhookAlert) error {
 func (e *Email) String() string {
 	return e.SMTPServer + e.From + e.To
 }
+
+// headerValue 去除换行，避免模板渲染的内容注入额外的邮件头
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -15,9 +15,12 @@
 package channels
 
 import (
+	"context"
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1alpha1"
 	"kubegems.io/kubegems/pkg/utils"
@@ -41,6 +44,9 @@ func (f *Feishu) formatURL() string {
 }
 
 func (f *Feishu) ToReceiver(name string) v1alpha1.Receiver {
+	if f.Template != nil {
+		return renderReceiver(name, f.renderURL(), f.SendResolved)
+	}
 	u := f.formatURL()
 	return v1alpha1.Receiver{
 		Name: name,
@@ -57,13 +63,82 @@ func (f *Feishu) Check() error {
 	if !strings.Contains(f.URL, "open.feishu.cn") {
 		return fmt.Errorf("feishu robot url not valid")
 	}
-	return nil
+	return f.Template.Check(TemplateFormatText, TemplateFormatMarkdown)
 }
 
 func (f *Feishu) Test(alert prometheus.WebhookAlert) error {
+	if f.Template != nil {
+		return renderAndSend(context.Background(), f, alert)
+	}
 	return testAlertproxy(f.formatURL(), alert)
 }
 
+// Preview 未配置模板时通知由 alertproxy 格式化，无法预览
+func (f *Feishu) Preview(alert prometheus.WebhookAlert) (*Message, error) {
+	if f.Template == nil {
+		return nil, fmt.Errorf("feishu message is formatted by alertproxy without a template, configure a template to preview")
+	}
+	return f.Template.Render(alert)
+}
+
+// renderURL 配置模板时由 kubegems 渲染后发送
+func (f *Feishu) renderURL() string {
+	ch := *f
+	ch.ChannelType = TypeFeishu
+	return renderURL(&ch)
+}
+
 func (f *Feishu) String() string {
+	if f.Template != nil {
+		return f.renderURL()
+	}
 	return f.formatURL()
 }
+
+type feishuResponse struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+// Send 通过飞书机器人发送渲染后的通知，markdown 格式使用消息卡片
+func (f *Feishu) Send(ctx context.Context, msg *Message) error {
+	payload := map[string]any{}
+	if msg.Format == TemplateFormatMarkdown {
+		content := msg.Body
+		for _, id := range splitList(f.At) {
+			content += fmt.Sprintf("<at id=%s></at>", id)
+		}
+		payload["msg_type"] = "interactive"
+		payload["card"] = map[string]any{
+			"header": map[string]any{
+				"title": map[string]any{"tag": "plain_text", "content": msg.Title},
+			},
+			"elements": []any{
+				map[string]any{"tag": "markdown", "content": content},
+			},
+		}
+	} else {
+		text := msg.Body
+		if msg.Title != "" {
+			text = msg.Title + "\n" + text
+		}
+		for _, id := range splitList(f.At) {
+			text += fmt.Sprintf(`<at user_id="%s"></at>`, id)
+		}
+		payload["msg_type"] = "text"
+		payload["content"] = map[string]any{"text": text}
+	}
+	if f.SignSecret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		payload["timestamp"] = timestamp
+		payload["sign"] = hmacSign(timestamp+"\n"+f.SignSecret, "")
+	}
+	resp := feishuResponse{}
+	if err := postJSON(ctx, newHTTPClient(false), f.URL, payload, &resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return fmt.Errorf("feishu robot: %d %s", resp.Code, resp.Msg)
+	}
+	return nil
+}
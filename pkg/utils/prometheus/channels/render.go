@@ -0,0 +1,160 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	monv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1alpha1"
+	"kubegems.io/kubegems/pkg/apis/gems"
+	"kubegems.io/kubegems/pkg/utils"
+	"kubegems.io/kubegems/pkg/utils/prometheus"
+)
+
+// KubegemsRenderURL 配置了模板的渠道由 alertmanager 发送至 kubegems agent，agent 渲染模板后直接发送通知，不经过 alertproxy
+var KubegemsRenderURL = fmt.Sprintf("https://kubegems-local-agent.%s:8041/alert/render", gems.NamespaceLocal)
+
+// TemplateSender 支持自定义模板的渠道，发送渲染后的通知
+type TemplateSender interface {
+	ChannelIf
+	Send(ctx context.Context, msg *Message) error
+}
+
+// renderURL 返回 KubegemsRenderURL，渠道配置通过 channel 参数传递
+func renderURL(ch ChannelIf) string {
+	bts, _ := json.Marshal(ch)
+	return KubegemsRenderURL + "?" + url.Values{"channel": {string(bts)}}.Encode()
+}
+
+// renderReceiver 返回发送到 KubegemsRenderURL 的 receiver
+func renderReceiver(name string, u string, sendResolved bool) v1alpha1.Receiver {
+	return v1alpha1.Receiver{
+		Name: name,
+		WebhookConfigs: []v1alpha1.WebhookConfig{
+			{
+				URL:          &u,
+				SendResolved: utils.BoolPointer(sendResolved),
+				HTTPConfig: &v1alpha1.HTTPConfig{
+					TLSConfig: &monv1.SafeTLSConfig{InsecureSkipVerify: true},
+				},
+			},
+		},
+	}
+}
+
+// SendRendered 使用 channel 参数中渠道的模板渲染告警并发送，由 agent 接收 alertmanager 的告警时调用
+func SendRendered(ctx context.Context, query url.Values, alert prometheus.WebhookAlert) error {
+	cfg := ChannelConfig{}
+	if err := cfg.UnmarshalJSON([]byte(query.Get("channel"))); err != nil {
+		return err
+	}
+	sender, ok := cfg.ChannelIf.(TemplateSender)
+	if !ok || templateOf(sender) == nil {
+		return fmt.Errorf("channel has no template to render")
+	}
+	if err := sender.Check(); err != nil {
+		return err
+	}
+	return renderAndSend(ctx, sender, alert)
+}
+
+func renderAndSend(ctx context.Context, sender TemplateSender, alert prometheus.WebhookAlert) error {
+	msg, err := templateOf(sender).Render(alert)
+	if err != nil {
+		return err
+	}
+	return sender.Send(ctx, msg)
+}
+
+func templateOf(ch ChannelIf) *Template {
+	if b, ok := ch.(interface{ template() *Template }); ok {
+		return b.template()
+	}
+	return nil
+}
+
+// postJSON 发送 JSON 请求，返回非 2xx 状态码时返回错误，into 不为空时解析响应
+func postJSON(ctx context.Context, cli *http.Client, u string, payload, into any) error {
+	bts, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(bts))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("post %s: %s: %s", redactURL(u), resp.Status, body)
+	}
+	if into == nil {
+		return nil
+	}
+	return json.Unmarshal(body, into)
+}
+
+// redactURL 去除 url 中的查询参数，机器人的 access token 以及签名在查询参数中
+func redactURL(u string) string {
+	if i := strings.IndexByte(u, '?'); i >= 0 {
+		return u[:i]
+	}
+	return u
+}
+
+func newHTTPClient(insecureSkipVerify bool) *http.Client {
+	cli := &http.Client{Timeout: 30 * time.Second}
+	if insecureSkipVerify {
+		cli.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+	return cli
+}
+
+// hmacSign 返回 base64 编码的 hmac-sha256 签名
+func hmacSign(key, data string) string {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(data))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func splitList(s string) []string {
+	ret := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,167 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// newRobotServer 记录收到的请求并返回 resp
+func newRobotServer(t *testing.T, resp string) (*httptest.Server, *[]map[string]any, *[]url.Values) {
+	bodies, queries := &[]map[string]any{}, &[]url.Values{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]any{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		*bodies = append(*bodies, body)
+		*queries = append(*queries, r.URL.Query())
+		w.Write([]byte(resp))
+	}))
+	t.Cleanup(server.Close)
+	return server, bodies, queries
+}
+
+func TestFeishu_Send(t *testing.T) {
+	server, bodies, _ := newRobotServer(t, `{"code":0,"msg":"success"}`)
+	feishu := &Feishu{URL: server.URL, At: "all", SignSecret: "secret"}
+
+	if err := feishu.Send(context.Background(), &Message{Title: "title", Body: "**body**", Format: TemplateFormatMarkdown}); err != nil {
+		t.Fatal(err)
+	}
+	if err := feishu.Send(context.Background(), &Message{Title: "title", Body: "body", Format: TemplateFormatText}); err != nil {
+		t.Fatal(err)
+	}
+	card, text := (*bodies)[0], (*bodies)[1]
+	if card["msg_type"] != "interactive" || card["sign"] == "" || card["timestamp"] == "" {
+		t.Errorf("markdown message = %v", card)
+	}
+	elements := card["card"].(map[string]any)["elements"].([]any)
+	if content := elements[0].(map[string]any)["content"]; content != `**body**<at id=all></at>` {
+		t.Errorf("markdown card content = %v", content)
+	}
+	if text["msg_type"] != "text" || text["content"].(map[string]any)["text"] != `title`+"\n"+`body<at user_id="all"></at>` {
+		t.Errorf("text message = %v", text)
+	}
+
+	server, _, _ = newRobotServer(t, `{"code":19021,"msg":"sign match fail"}`)
+	feishu.URL = server.URL
+	if err := feishu.Send(context.Background(), &Message{Body: "body"}); err == nil || !strings.Contains(err.Error(), "sign match fail") {
+		t.Errorf("Send() error = %v", err)
+	}
+}
+
+func TestDingding_Send(t *testing.T) {
+	server, bodies, queries := newRobotServer(t, `{"errcode":0,"errmsg":"ok"}`)
+	dingding := &Dingding{URL: server.URL + "?access_token=token", AtMobiles: "123,456", SignSecret: "secret"}
+
+	if err := dingding.Send(context.Background(), &Message{Title: "title", Body: "body", Format: TemplateFormatMarkdown}); err != nil {
+		t.Fatal(err)
+	}
+	query := (*queries)[0]
+	if query.Get("access_token") != "token" || query.Get("sign") != hmacSign("secret", query.Get("timestamp")+"\nsecret") {
+		t.Errorf("query = %v", query)
+	}
+	body := (*bodies)[0]
+	markdown := body["markdown"].(map[string]any)
+	if body["msgtype"] != "markdown" || markdown["title"] != "title" || markdown["text"] != "body @123 @456" {
+		t.Errorf("markdown message = %v", body)
+	}
+
+	server, _, _ = newRobotServer(t, `{"errcode":310000,"errmsg":"keywords not in content"}`)
+	dingding.URL = server.URL
+	if err := dingding.Send(context.Background(), &Message{Body: "body"}); err == nil || !strings.Contains(err.Error(), "keywords not in content") {
+		t.Errorf("Send() error = %v", err)
+	}
+}
+
+func TestWebhook_template(t *testing.T) {
+	server, bodies, _ := newRobotServer(t, `ok`)
+	tpl := &Template{Title: "{{ .Status }}", Body: "{{ .CommonLabels.gems_alertname }}"}
+	webhook := &Webhook{URL: server.URL, BaseChannel: BaseChannel{Template: tpl}}
+
+	// alertmanager sends to kubegems which renders the template
+	receiver := webhook.ToReceiver("test")
+	u, err := url.Parse(*receiver.WebhookConfigs[0].URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != KubegemsRenderURL {
+		t.Fatalf("receiver url = %s, want %s", got, KubegemsRenderURL)
+	}
+	if webhook.String() != *receiver.WebhookConfigs[0].URL {
+		t.Error("String() differs from the receiver url, channel status would be changed")
+	}
+	if err := SendRendered(context.Background(), u.Query(), SampleWebhookAlert("test")); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"title": "firing", "body": "kubegems-test-alert", "format": "text"}
+	if got := (*bodies)[0]; len(got) != len(want) || got["title"] != want["title"] || got["body"] != want["body"] || got["format"] != want["format"] {
+		t.Errorf("webhook received %v, want %v", got, want)
+	}
+}
+
+func TestChannel_Preview(t *testing.T) {
+	alert := SampleWebhookAlert("test")
+	tests := []struct {
+		name     string
+		channel  ChannelIf
+		wantBody string
+		wantErr  bool
+	}{
+		{name: "feishu template", channel: &Feishu{BaseChannel: BaseChannel{Template: &Template{Body: "{{ .Status }}"}}}, wantBody: "firing"},
+		{name: "feishu formatted by alertproxy", channel: &Feishu{}, wantErr: true},
+		{name: "dingding template", channel: &Dingding{BaseChannel: BaseChannel{Template: &Template{Body: "{{ .Status }}"}}}, wantBody: "firing"},
+		{name: "dingding formatted by alertproxy", channel: &Dingding{}, wantErr: true},
+		{name: "webhook template", channel: &Webhook{BaseChannel: BaseChannel{Template: &Template{Body: "{{ .Status }}"}}}, wantBody: "firing"},
+		{name: "webhook raw alert", channel: &Webhook{}, wantBody: `"receiver": "test"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := tt.channel.Preview(alert)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Preview() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !strings.Contains(msg.Body, tt.wantBody) {
+				t.Errorf("Preview() body = %q, want %q", msg.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestFeishu_ToReceiver(t *testing.T) {
+	feishu := &Feishu{URL: "https://open.feishu.cn/hook", At: "all"}
+	if u := *feishu.ToReceiver("test").WebhookConfigs[0].URL; !strings.HasPrefix(u, "http://"+alertProxyReceiverHost) {
+		t.Errorf("receiver without template = %s, want alertproxy", u)
+	}
+	feishu.Template = &DefaultTemplate
+	u, err := url.Parse(*feishu.ToReceiver("test").WebhookConfigs[0].URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := ChannelConfig{}
+	if err := cfg.UnmarshalJSON([]byte(u.Query().Get("channel"))); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := cfg.ChannelIf.(*Feishu); !ok || got.URL != feishu.URL || got.At != "all" || got.Template == nil || got.Template.Body != DefaultTemplate.Body {
+		t.Errorf("channel in receiver url = %#v", cfg.ChannelIf)
+	}
+}
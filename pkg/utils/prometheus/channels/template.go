@@ -0,0 +1,185 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channels
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"golang.org/x/exp/slices"
+	"kubegems.io/kubegems/pkg/utils/prometheus"
+)
+
+type TemplateFormat string
+
+const (
+	TemplateFormatText     TemplateFormat = "text"
+	TemplateFormatMarkdown TemplateFormat = "markdown"
+	TemplateFormatHTML     TemplateFormat = "html"
+)
+
+// Template 告警通知模板，Title 与 Body 为 go template，模板数据与 alertmanager 的模板数据一致
+type Template struct {
+	Title  string         `json:"title"`
+	Body   string         `json:"body" binding:"required"`
+	Format TemplateFormat `json:"format"` // text, markdown or html, text by default
+}
+
+// Message 模板渲染的通知内容
+type Message struct {
+	Title  string         `json:"title"`
+	Body   string         `json:"body"`
+	Format TemplateFormat `json:"format"`
+}
+
+// DefaultTemplate 渠道未配置模板时预览使用的示例模板
+var DefaultTemplate = Template{
+	Title: `[{{ .Status | toUpper }}] {{ .CommonLabels.gems_alertname }}`,
+	Body: `{{ range .Alerts.Firing -}}
+- **{{ .Labels.gems_alertname }}** [cluster:{{ .Labels.cluster }}] [namespace:{{ .Labels.gems_namespace }}]
+  {{ .Annotations.message }}
+{{ end -}}
+{{ range .Alerts.Resolved -}}
+- **{{ .Labels.gems_alertname }}** resolved
+{{ end -}}`,
+	Format: TemplateFormatMarkdown,
+}
+
+// templateFuncs alertmanager 默认模板函数中的常用部分，以便模板同时用于 alertmanager 渲染的邮件
+var templateFuncs = template.FuncMap{
+	"toUpper":   strings.ToUpper,
+	"toLower":   strings.ToLower,
+	"title":     strings.Title, // nolint: staticcheck
+	"trimSpace": strings.TrimSpace,
+	"join": func(sep string, s []string) string {
+		return strings.Join(s, sep)
+	},
+	"match": regexp.MatchString,
+	"safeHtml": func(text string) string {
+		return text
+	},
+	"reReplaceAll": func(pattern, repl, text string) string {
+		return regexp.MustCompile(pattern).ReplaceAllString(text, repl)
+	},
+	"stringSlice": func(s ...string) []string {
+		return s
+	},
+}
+
+type templateAlerts []prometheus.Alert
+
+func (as templateAlerts) Firing() []prometheus.Alert {
+	return as.withStatus("firing")
+}
+
+func (as templateAlerts) Resolved() []prometheus.Alert {
+	return as.withStatus("resolved")
+}
+
+func (as templateAlerts) withStatus(status string) []prometheus.Alert {
+	ret := []prometheus.Alert{}
+	for _, alert := range as {
+		if alert.Status == status {
+			ret = append(ret, alert)
+		}
+	}
+	return ret
+}
+
+type templateData struct {
+	prometheus.WebhookAlert
+	Alerts templateAlerts
+}
+
+func (t *Template) format() TemplateFormat {
+	if t.Format == "" {
+		return TemplateFormatText
+	}
+	return t.Format
+}
+
+// Render 使用告警渲染模板
+func (t *Template) Render(alert prometheus.WebhookAlert) (*Message, error) {
+	data := templateData{WebhookAlert: alert, Alerts: alert.Alerts}
+	title, err := renderTemplate("title", t.Title, data)
+	if err != nil {
+		return nil, err
+	}
+	body, err := renderTemplate("body", t.Body, data)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Title: title, Body: body, Format: t.format()}, nil
+}
+
+// Check 校验模板格式是否被渠道支持，并使用示例告警渲染模板，未配置模板时不校验
+func (t *Template) Check(formats ...TemplateFormat) error {
+	if t == nil {
+		return nil
+	}
+	if !slices.Contains(formats, t.format()) {
+		return fmt.Errorf("template format %s not supported, supported formats: %v", t.format(), formats)
+	}
+	if strings.TrimSpace(t.Body) == "" {
+		return fmt.Errorf("template body can't be empty")
+	}
+	if _, err := t.Render(SampleWebhookAlert("kubegems-sample-receiver")); err != nil {
+		return err
+	}
+	return nil
+}
+
+func renderTemplate(name, text string, data any) (string, error) {
+	tpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parse %s template: %w", name, err)
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := tpl.Execute(buf, data); err != nil {
+		return "", fmt.Errorf("render %s template: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// SampleWebhookAlert 用于测试渠道以及预览模板的示例告警
+func SampleWebhookAlert(receiver string) prometheus.WebhookAlert {
+	now := time.Now()
+	labels := map[string]string{
+		prometheus.AlertNameLabel:      "kubegems-test-alert",
+		prometheus.SeverityLabel:       prometheus.SeverityError,
+		prometheus.AlertClusterKey:     "kubegems",
+		prometheus.AlertNamespaceLabel: "kubegems-test-namespace",
+	}
+	return prometheus.WebhookAlert{
+		Receiver:     receiver,
+		Status:       "firing",
+		CommonLabels: labels,
+		Alerts: []prometheus.Alert{
+			{
+				Status: "firing",
+				Labels: labels,
+				Annotations: map[string]string{
+					prometheus.MessageAnnotationsKey: "kubegems test alert message",
+					prometheus.ValueAnnotationKey:    "0",
+				},
+				StartsAt: &now,
+			},
+		},
+	}
+}
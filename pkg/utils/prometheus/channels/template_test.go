@@ -0,0 +1,145 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package channels
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTemplate_Render(t *testing.T) {
+	tests := []struct {
+		name      string
+		tpl       Template
+		wantTitle string
+		wantBody  string
+		wantErr   bool
+	}{
+		{
+			name:      "alertmanager data",
+			tpl:       Template{Title: `{{ .Status | toUpper }} {{ .CommonLabels.gems_alertname }}`, Body: `{{ .Alerts.Firing | len }}/{{ .Alerts.Resolved | len }}`},
+			wantTitle: "FIRING kubegems-test-alert",
+			wantBody:  "1/0",
+		},
+		{
+			name:     "alert fields",
+			tpl:      Template{Body: `{{ range .Alerts }}{{ .Labels.cluster }}: {{ .Annotations.message }}{{ end }}`},
+			wantBody: "kubegems: kubegems test alert message",
+		},
+		{
+			name:     "missing label",
+			tpl:      Template{Body: `[{{ .CommonLabels.notexists }}]`},
+			wantBody: "[]",
+		},
+		{
+			name:    "parse error",
+			tpl:     Template{Body: `{{ .Status `},
+			wantErr: true,
+		},
+		{
+			name:    "execute error",
+			tpl:     Template{Body: `{{ .NotExists }}`},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := tt.tpl.Render(SampleWebhookAlert("test"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if msg.Title != tt.wantTitle || msg.Body != tt.wantBody || msg.Format != TemplateFormatText {
+				t.Errorf("Render() = %+v, want title %q body %q", msg, tt.wantTitle, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestChannel_CheckTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel ChannelIf
+		wantErr string
+	}{
+		{
+			name:    "no template",
+			channel: &Feishu{URL: "https://open.feishu.cn/hook"},
+		},
+		{
+			name:    "html email",
+			channel: &Email{BaseChannel: BaseChannel{Template: &Template{Title: "{{ .Status }}", Body: "<b>x</b>", Format: TemplateFormatHTML}}},
+		},
+		{
+			name:    "markdown not supported by email",
+			channel: &Email{BaseChannel: BaseChannel{Template: &DefaultTemplate}},
+			wantErr: "not supported",
+		},
+		{
+			name:    "feishu markdown",
+			channel: &Feishu{URL: "https://open.feishu.cn/hook", BaseChannel: BaseChannel{Template: &DefaultTemplate}},
+		},
+		{
+			name:    "html not supported by feishu",
+			channel: &Feishu{URL: "https://open.feishu.cn/hook", BaseChannel: BaseChannel{Template: &Template{Body: "<b>x</b>", Format: TemplateFormatHTML}}},
+			wantErr: "not supported",
+		},
+		{
+			name:    "dingding markdown",
+			channel: &Dingding{URL: "https://oapi.dingtalk.com/hook", BaseChannel: BaseChannel{Template: &DefaultTemplate}},
+		},
+		{
+			name:    "empty body",
+			channel: &Email{BaseChannel: BaseChannel{Template: &Template{Title: "x"}}},
+			wantErr: "body can't be empty",
+		},
+		{
+			name:    "invalid template",
+			channel: &Email{BaseChannel: BaseChannel{Template: &Template{Body: "{{ .Foo }}"}}},
+			wantErr: "render body template",
+		},
+		{
+			name:    "webhook html",
+			channel: &Webhook{URL: "http://example.com", BaseChannel: BaseChannel{Template: &Template{Body: "<b>x</b>", Format: TemplateFormatHTML}}},
+		},
+		{
+			name:    "aliyun",
+			channel: &AliyunMsg{BaseChannel: BaseChannel{Template: &DefaultTemplate}},
+			wantErr: "not supported",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.channel.Check()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Check() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Check() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_headerValue(t *testing.T) {
+	if got := headerValue("FIRING\r\nBcc: someone@example.com"); got != "FIRING  Bcc: someone@example.com" {
+		t.Errorf("headerValue() = %q", got)
+	}
+}
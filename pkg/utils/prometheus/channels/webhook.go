@@ -16,6 +16,7 @@ package channels
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"io"
@@ -37,6 +38,9 @@ type Webhook struct {
 }
 
 func (w *Webhook) ToReceiver(name string) v1alpha1.Receiver {
+	if w.Template != nil {
+		return renderReceiver(name, w.renderURL(), w.SendResolved)
+	}
 	cfg := v1alpha1.WebhookConfig{
 		URL:          &w.URL,
 		SendResolved: utils.BoolPointer(w.SendResolved),
@@ -58,10 +62,13 @@ func (w *Webhook) Check() error {
 	if _, err := url.ParseRequestURI(w.URL); err != nil {
 		return errors.Wrap(err, "url 不合法")
 	}
-	return nil
+	return w.Template.Check(TemplateFormatText, TemplateFormatMarkdown, TemplateFormatHTML)
 }
 
 func (w *Webhook) Test(alert prometheus.WebhookAlert) error {
+	if w.Template != nil {
+		return renderAndSend(context.Background(), w, alert)
+	}
 	buf := bytes.NewBuffer(nil)
 	if err := json.NewEncoder(buf).Encode(alert); err != nil {
 		return err
@@ -87,6 +94,33 @@ func (w *Webhook) Test(alert prometheus.WebhookAlert) error {
 	return nil
 }
 
+// Preview 未配置模板时 webhook 接收原始的告警
+func (w *Webhook) Preview(alert prometheus.WebhookAlert) (*Message, error) {
+	if w.Template != nil {
+		return w.Template.Render(alert)
+	}
+	bts, err := json.MarshalIndent(alert, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Body: string(bts), Format: TemplateFormatText}, nil
+}
+
+// Send 配置模板时 webhook 接收渲染后的 Message
+func (w *Webhook) Send(ctx context.Context, msg *Message) error {
+	return postJSON(ctx, newHTTPClient(w.InsecureSkipVerify), w.URL, msg, nil)
+}
+
+// renderURL 配置模板时由 kubegems 渲染后发送
+func (w *Webhook) renderURL() string {
+	ch := *w
+	ch.ChannelType = TypeWebhook
+	return renderURL(&ch)
+}
+
 func (w *Webhook) String() string {
+	if w.Template != nil {
+		return w.renderURL()
+	}
 	return w.URL
 }
@@ -0,0 +1,199 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"kubegems.io/kubegems/pkg/log"
+	"kubegems.io/kubegems/pkg/utils/workflow"
+)
+
+// step 执行时间较长，使用秒至十分钟级别的 buckets
+var workflowStepBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120, 300, 600}
+
+type stepStats struct {
+	total        uint64
+	failures     uint64
+	retries      uint64
+	totalSeconds float64
+	countBuckets map[float64]uint64
+}
+
+type taskStatusKey struct {
+	group  string
+	status string
+}
+
+// WorkflowCollector 收集 workflow 的运行指标，实现 workflow.Metrics
+type WorkflowCollector struct {
+	queueDepth   *prometheus.Desc
+	stepsRunning *prometheus.Desc
+	stepsTotal   *prometheus.Desc
+	stepFailures *prometheus.Desc
+	stepRetries  *prometheus.Desc
+	stepDuration *prometheus.Desc
+	tasksTotal   *prometheus.Desc
+
+	running int64
+	steps   map[string]*stepStats
+	tasks   map[taskStatusKey]uint64
+	depths  map[string]workflow.QueueDepth
+
+	mutex sync.Mutex
+}
+
+var _ workflow.Metrics = &WorkflowCollector{}
+
+func GetWorkflowCollector() *WorkflowCollector {
+	tmp := GetInitiatedCollectors()
+	return tmp["workflow"].(*WorkflowCollector)
+}
+
+func NewWorkflowCollector() Collectorfunc {
+	return func(_ *log.Logger) (Collector, error) {
+		return &WorkflowCollector{
+			queueDepth: prometheus.NewDesc(
+				prometheus.BuildFQName(getNamespace(), "workflow", "queue_depth"),
+				"Gems workflow queue depth",
+				[]string{"queue", "state"},
+				nil,
+			),
+			stepsRunning: prometheus.NewDesc(
+				prometheus.BuildFQName(getNamespace(), "workflow", "steps_in_flight"),
+				"Gems workflow steps executing",
+				nil,
+				nil,
+			),
+			stepsTotal: prometheus.NewDesc(
+				prometheus.BuildFQName(getNamespace(), "workflow", "step_executions_total"),
+				"Gems workflow step executions total",
+				[]string{"function"},
+				nil,
+			),
+			stepFailures: prometheus.NewDesc(
+				prometheus.BuildFQName(getNamespace(), "workflow", "step_failures_total"),
+				"Gems workflow step failed executions total",
+				[]string{"function"},
+				nil,
+			),
+			stepRetries: prometheus.NewDesc(
+				prometheus.BuildFQName(getNamespace(), "workflow", "step_retries_total"),
+				"Gems workflow step retries total",
+				[]string{"function"},
+				nil,
+			),
+			stepDuration: prometheus.NewDesc(
+				prometheus.BuildFQName(getNamespace(), "workflow", "step_duration_seconds"),
+				"Gems workflow step execution duration seconds",
+				[]string{"function"},
+				nil,
+			),
+			tasksTotal: prometheus.NewDesc(
+				prometheus.BuildFQName(getNamespace(), "workflow", "tasks_finished_total"),
+				"Gems workflow finished tasks total",
+				[]string{"group", "status"},
+				nil,
+			),
+			steps:  map[string]*stepStats{},
+			tasks:  map[taskStatusKey]uint64{},
+			depths: map[string]workflow.QueueDepth{},
+		}, nil
+	}
+}
+
+func (c *WorkflowCollector) stepStatsOf(function string) *stepStats {
+	stats, ok := c.steps[function]
+	if !ok {
+		stats = &stepStats{countBuckets: map[float64]uint64{}}
+		for _, bucket := range workflowStepBuckets {
+			stats.countBuckets[bucket] = 0
+		}
+		c.steps[function] = stats
+	}
+	return stats
+}
+
+// StepStarted implements workflow.Metrics
+func (c *WorkflowCollector) StepStarted(_ string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.running++
+}
+
+// StepFinished implements workflow.Metrics
+func (c *WorkflowCollector) StepFinished(function string, duration time.Duration, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.running--
+
+	stats := c.stepStatsOf(function)
+	dur := duration.Seconds()
+	for k := range stats.countBuckets {
+		if dur < k {
+			stats.countBuckets[k]++
+		}
+	}
+	stats.total++
+	stats.totalSeconds += dur
+	if err != nil {
+		stats.failures++
+	}
+}
+
+// StepRetried implements workflow.Metrics
+func (c *WorkflowCollector) StepRetried(function string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.stepStatsOf(function).retries++
+}
+
+// TaskFinished implements workflow.Metrics
+func (c *WorkflowCollector) TaskFinished(group string, status workflow.TaskStatusCode) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.tasks[taskStatusKey{group: group, status: string(status)}]++
+}
+
+// QueueDepth implements workflow.Metrics
+func (c *WorkflowCollector) QueueDepth(queue string, depth workflow.QueueDepth) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.depths[queue] = depth
+}
+
+// Update implements Collector
+func (c *WorkflowCollector) Update(ch chan<- prometheus.Metric) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for queue, depth := range c.depths {
+		ch <- prometheus.MustNewConstMetric(c.queueDepth, prometheus.GaugeValue, float64(depth.Waiting), queue, "waiting")
+		ch <- prometheus.MustNewConstMetric(c.queueDepth, prometheus.GaugeValue, float64(depth.Pending), queue, "pending")
+	}
+	ch <- prometheus.MustNewConstMetric(c.stepsRunning, prometheus.GaugeValue, float64(c.running))
+	for function, stats := range c.steps {
+		ch <- prometheus.MustNewConstMetric(c.stepsTotal, prometheus.CounterValue, float64(stats.total), function)
+		ch <- prometheus.MustNewConstMetric(c.stepFailures, prometheus.CounterValue, float64(stats.failures), function)
+		ch <- prometheus.MustNewConstMetric(c.stepRetries, prometheus.CounterValue, float64(stats.retries), function)
+		ch <- prometheus.MustNewConstHistogram(c.stepDuration, stats.total, stats.totalSeconds, copyBuckets(stats.countBuckets), function)
+	}
+	for key, count := range c.tasks {
+		ch <- prometheus.MustNewConstMetric(c.tasksTotal, prometheus.CounterValue, float64(count), key.group, key.status)
+	}
+	return nil
+}
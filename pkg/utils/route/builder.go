@@ -25,11 +25,18 @@ import (
 
 var DefaultBuilder = NewBuilder(InterfaceBuildOptionOverride)
 
-const DefinitionsRoot = "#/definitions/"
+const (
+	DefinitionsRoot = "#/definitions/"
+	ComponentsRoot  = "#/components/schemas/" // openapi v3
+)
 
 type Builder struct {
 	InterfaceBuildOption InterfaceBuildOption
 	Definitions          map[string]spec.Schema
+	// RefPrefix 引用 Definitions 的前缀，默认为 DefinitionsRoot
+	RefPrefix string
+	// Nullable 指针类型的字段允许为 null，仅用于 openapi v3
+	Nullable bool
 }
 
 type InterfaceBuildOption string
@@ -39,6 +46,7 @@ const (
 	InterfaceBuildOptionOverride InterfaceBuildOption = "override" // override using interface's value if exist
 	InterfaceBuildOptionIgnore   InterfaceBuildOption = "ignore"   // ignore interface field
 	InterfaceBuildOptionMerge    InterfaceBuildOption = "merge"    // anyOf 'object{}' type and interface's value type
+	InterfaceBuildOptionOneOf    InterfaceBuildOption = "oneof"    // oneOf interface's value types, used in openapi v3
 )
 
 type SchemaBuildFunc func(v reflect.Value) *spec.Schema
@@ -149,7 +157,11 @@ func (b *Builder) buildSlice(v reflect.Value) *spec.Schema {
 	case 1:
 		schema.Items = &spec.SchemaOrArray{Schema: &items[0]}
 	default:
-		schema.Items = &spec.SchemaOrArray{Schemas: items}
+		if b.InterfaceBuildOption == InterfaceBuildOptionOneOf {
+			schema.Items = &spec.SchemaOrArray{Schema: &spec.Schema{SchemaProps: spec.SchemaProps{OneOf: uniqueSchemas(items)}}}
+		} else {
+			schema.Items = &spec.SchemaOrArray{Schemas: items}
+		}
 	}
 	return &schema
 }
@@ -172,12 +184,55 @@ func (b *Builder) buildInterface(v reflect.Value) *spec.Schema {
 			return ObjectProperty()
 		}
 		return b.BuildSchema(v.Elem())
+	case InterfaceBuildOptionOneOf:
+		if v.IsNil() {
+			return ObjectProperty()
+		}
+		if innerSchema := b.BuildSchema(v.Elem()); innerSchema != nil {
+			return &spec.Schema{SchemaProps: spec.SchemaProps{OneOf: []spec.Schema{*innerSchema}}}
+		}
 	case InterfaceBuildOptionIgnore:
 		return nil
 	}
 	return ObjectProperty()
 }
 
+// uniqueSchemas 去除重复的 schema，例如 []interface{} 中相同类型的元素
+func uniqueSchemas(schemas []spec.Schema) []spec.Schema {
+	unique := make([]spec.Schema, 0, len(schemas))
+	for _, schema := range schemas {
+		found := false
+		for _, exist := range unique {
+			if reflect.DeepEqual(exist, schema) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unique = append(unique, schema)
+		}
+	}
+	return unique
+}
+
+func (b *Builder) refSchema(name string) *spec.Schema {
+	if b.RefPrefix == "" {
+		return spec.RefSchema(DefinitionsRoot + name)
+	}
+	return spec.RefSchema(b.RefPrefix + name)
+}
+
+// nullable 允许 schema 为 null，引用类型的 schema 无法直接修改 type，使用 oneOf
+func nullable(schema *spec.Schema) *spec.Schema {
+	if len(schema.Type) == 0 {
+		return &spec.Schema{SchemaProps: spec.SchemaProps{OneOf: []spec.Schema{*schema, *(&spec.Schema{}).Typed("null", "")}}}
+	}
+	if !schema.Type.Contains("null") {
+		schema.Type = append(append(spec.StringOrArray{}, schema.Type...), "null")
+	}
+	return schema
+}
+
 func (b *Builder) buildMap(v reflect.Value) *spec.Schema {
 	itemSchema := b.BuildSchema(reflect.New(v.Type().Elem()))
 	schema := &spec.Schema{
@@ -252,18 +307,21 @@ func (b *Builder) buildStruct(v reflect.Value) *spec.Schema {
 			continue
 		}
 		if fieldSchema := b.BuildSchema(fieldv); fieldSchema != nil {
+			if b.Nullable && structField.Type.Kind() == reflect.Ptr {
+				fieldSchema = nullable(fieldSchema)
+			}
 			schema.Properties[fieldName] = *fieldSchema
 		}
 	}
 	if len(overrideProperties) > 0 || len(overrideEmbeddedProperties) > 0 {
-		allof := []spec.Schema{*spec.RefSchema(DefinitionsRoot + structTypeName)}
+		allof := []spec.Schema{*b.refSchema(structTypeName)}
 		allof = append(allof, overrideEmbeddedProperties...)
 		if len(overrideProperties) > 0 {
 			allof = append(allof, *ObjectPropertyProperties(overrideProperties))
 		}
 		return &spec.Schema{SchemaProps: spec.SchemaProps{AllOf: allof}}
 	} else {
-		return spec.RefSchema(DefinitionsRoot + structTypeName)
+		return b.refSchema(structTypeName)
 	}
 }
 
@@ -46,7 +46,12 @@ func isSamePattern(a, b []Element) bool {
 			case ElementKindConst:
 				str += e.param
 			case ElementKindVariable:
-				str += "{}"
+				// 约束不同的变量作为不同的路由
+				if e.constraint != "" {
+					str += "{:" + e.constraint + "}"
+				} else {
+					str += "{}"
+				}
 			case ElementKindStar:
 				str += "*"
 			case ElementKindSplit:
@@ -58,8 +63,10 @@ func isSamePattern(a, b []Element) bool {
 	return tostr(a) == tostr(b)
 }
 
+// sortSectionMatches 按照匹配的优先级排序，常量多的优先，有约束的变量优先于无约束的变量
+// 优先级相同时按照注册的顺序
 func sortSectionMatches(sections []*node) {
-	sort.Slice(sections, func(i, j int) bool {
+	sort.SliceStable(sections, func(i, j int) bool {
 		secsi, secsj := sections[i].key, sections[j].key
 
 		switch lasti, lastj := (secsi)[len(secsi)-1].kind, (secsj)[len(secsj)-1].kind; {
@@ -70,19 +77,19 @@ func sortSectionMatches(sections []*node) {
 		}
 		cnti, cntj := 0, 0
 		for _, v := range secsi {
-			switch v.kind {
-			case ElementKindConst:
+			switch {
+			case v.kind == ElementKindConst:
 				cnti += 99
-			case ElementKindVariable:
+			case v.kind == ElementKindVariable && v.regexp == nil:
 				cnti -= 1
 			}
 		}
 
 		for _, v := range secsj {
-			switch v.kind {
-			case ElementKindConst:
+			switch {
+			case v.kind == ElementKindConst:
 				cntj += 99
-			case ElementKindVariable:
+			case v.kind == ElementKindVariable && v.regexp == nil:
 				cntj -= 1
 			}
 		}
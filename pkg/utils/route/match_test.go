@@ -50,6 +50,18 @@ func Test_matcher_Register(t *testing.T) {
 			args:    args{pattern: "/api/{name/{path}", val: "-"},
 			wantErr: true,
 		},
+		{
+			args:    args{pattern: "/api/{name:int}/{path}", val: "-"},
+			wantErr: false,
+		},
+		{
+			args:    args{pattern: "/api/{id:[0-9}", val: "-"},
+			wantErr: true,
+		},
+		{
+			args:    args{pattern: "/api/{rest:path}/{name}", val: "-"},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.args.pattern, func(t *testing.T) {
@@ -133,6 +145,70 @@ func Test_matcher_Match(t *testing.T) {
 			matched: false,
 			vars:    map[string]string{},
 		},
+		{
+			registered: []string{
+				"/namespaces/{name}",
+				"/namespaces/{id:int}",
+			},
+			req:       "/namespaces/123",
+			matched:   true,
+			wantMatch: "/namespaces/{id:int}",
+			vars:      map[string]string{"id": "123"},
+		},
+		{
+			registered: []string{
+				"/namespaces/{name}",
+				"/namespaces/{id:int}",
+			},
+			req:       "/namespaces/default",
+			matched:   true,
+			wantMatch: "/namespaces/{name}",
+			vars:      map[string]string{"name": "default"},
+		},
+		{
+			registered: []string{
+				"/namespaces/{name:[a-z0-9-]+}",
+			},
+			req:     "/namespaces/Default",
+			matched: false,
+			vars:    map[string]string{},
+		},
+		{
+			registered: []string{
+				"/files/{name:[a-z]{2,3}}.{ext}",
+			},
+			req:       "/files/abc.tar.gz",
+			matched:   true,
+			wantMatch: "/files/{name:[a-z]{2,3}}.{ext}",
+			vars:      map[string]string{"name": "abc", "ext": "tar.gz"},
+		},
+		{
+			registered: []string{
+				"/files/{name:[a-z.]+}-{version:int}",
+			},
+			req:     "/files/a-b.c-12",
+			matched: false,
+			vars:    map[string]string{},
+		},
+		{
+			registered: []string{
+				"/files/{name:[a-z.-]+}-{version:int}",
+			},
+			req:       "/files/a-b.c-12",
+			matched:   true,
+			wantMatch: "/files/{name:[a-z.-]+}-{version:int}",
+			vars:      map[string]string{"name": "a-b.c", "version": "12"},
+		},
+		{
+			registered: []string{
+				"/proxy/{rest:path}",
+				"/proxy/{name}",
+			},
+			req:       "/proxy/api/v1/pods",
+			matched:   true,
+			wantMatch: "/proxy/{rest:path}",
+			vars:      map[string]string{"rest": "api/v1/pods"},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.req, func(t *testing.T) {
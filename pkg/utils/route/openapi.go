@@ -22,6 +22,7 @@ import (
 	"github.com/go-openapi/spec"
 )
 
+// BuildOpenAPIWebService 在 path 提供 swagger 2.0 文档，在 path/v3 提供 openapi 3.1 文档
 func BuildOpenAPIWebService(wss []*restful.WebService, path string, postfun func(swagger *spec.Swagger)) *restful.WebService {
 	ws := new(restful.WebService).
 		Path(path).
@@ -34,10 +35,15 @@ func BuildOpenAPIWebService(wss []*restful.WebService, path string, postfun func
 		InterfaceBuildOption: InterfaceBuildOptionOverride,
 	}
 	swagger := builder.buildOpenAPI(wss, postfun)
+	// openapi v3 使用单独的 builder，与 v2 的 definitions 引用路径不同
+	openapiv3 := NewBuilderV3().buildOpenAPIV3(wss, swagger)
 
 	ws.Route(ws.GET("/").To(func(r *restful.Request, w *restful.Response) {
 		w.WriteAsJson(swagger)
 	}))
+	ws.Route(ws.GET("/v3").To(func(r *restful.Request, w *restful.Response) {
+		w.WriteAsJson(openapiv3)
+	}))
 	return ws
 }
 
@@ -64,7 +70,7 @@ func (b *Builder) buildOpenAPI(wss []*restful.WebService, afterFunc func(swagger
 
 		for _, route := range ws.Routes() {
 			pathItem := spec.PathItem{}
-			routePath, patterns := sanitizePath(route.Path)
+			routePath, constraints := sanitizePath(route.Path)
 
 			if exist, ok := paths[routePath]; ok {
 				pathItem = exist
@@ -72,7 +78,7 @@ func (b *Builder) buildOpenAPI(wss []*restful.WebService, afterFunc func(swagger
 			// common parameters
 			pathItem.Parameters = commonPathParameters
 			// fill pattern
-			operation := b.buildOperation(route, patterns)
+			operation := b.buildOperation(route, constraints)
 
 			switch route.Method {
 			case http.MethodGet, "":
@@ -104,7 +110,7 @@ func (b *Builder) buildOpenAPI(wss []*restful.WebService, afterFunc func(swagger
 	return swagger
 }
 
-func (b *Builder) buildOperation(route restful.Route, pathPatterns map[string]string) *spec.Operation {
+func (b *Builder) buildOperation(route restful.Route, pathConstraints map[string]string) *spec.Operation {
 	op := &spec.Operation{
 		OperationProps: spec.OperationProps{
 			Summary:     route.Doc,
@@ -122,8 +128,8 @@ func (b *Builder) buildOperation(route restful.Route, pathPatterns map[string]st
 	for _, param := range route.ParameterDocs {
 		param := convertParameter(param.Data())
 		if param.In == "path" {
-			if pattern, ok := pathPatterns[param.Name]; ok {
-				param.Pattern = pattern
+			if constraint, ok := pathConstraints[param.Name]; ok {
+				applyPathConstraint(&param, constraint)
 			}
 		}
 		params = append(params, param)
@@ -274,24 +280,34 @@ func convertParameter(param restful.ParameterData) spec.Parameter {
 // since openapi only supports setting the pattern as a property named "pattern".
 // Expressions like "/api/v1/{name:[a-z]}/" are converted to "/api/v1/{name}/".
 // The second return value is a map which contains the mapping from the path parameter
-// name to the extracted pattern
+// name to the extracted constraint
 func sanitizePath(restfulPath string) (string, map[string]string) {
 	openapiPath := ""
-	patterns := map[string]string{}
-	for _, fragment := range strings.Split(restfulPath, "/") {
-		if fragment == "" {
+	constraints := map[string]string{}
+	for _, fragment := range parsePatternTokens(restfulPath) {
+		if fragment == "/" {
 			continue
 		}
-		if strings.HasPrefix(fragment, "{") && strings.Contains(fragment, ":") {
-			split := strings.Split(fragment, ":")
-			fragment = split[0][1:]
-			pattern := split[1][:len(split[1])-1]
-			patterns[fragment] = pattern
-			fragment = "{" + fragment + "}"
+		if strings.HasPrefix(fragment, "{") && strings.HasSuffix(fragment, "}") && strings.Contains(fragment, ":") {
+			name, constraint := parseVariable(fragment[1 : len(fragment)-1])
+			constraints[name] = constraint
+			fragment = "{" + name + "}"
 		}
 		openapiPath += "/" + fragment
 	}
-	return openapiPath, patterns
+	return openapiPath, constraints
+}
+
+// applyPathConstraint 根据路径变量的约束设置参数的类型或者 pattern
+func applyPathConstraint(param *spec.Parameter, constraint string) {
+	switch constraint {
+	case ConstraintInt:
+		param.Type, param.Format = "integer", "int64"
+	case ConstraintPath, "*":
+		// 向后匹配的路径无法使用 pattern 描述
+	default:
+		param.Pattern = constraint
+	}
 }
 
 // buildHeader builds a specification header structure from restful.Header
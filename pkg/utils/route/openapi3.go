@@ -0,0 +1,340 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/emicklei/go-restful/v3"
+	"github.com/go-openapi/spec"
+)
+
+const OpenAPIV3Version = "3.1.0"
+
+// OpenAPIV3 openapi 3.1 文档，schema 兼容 JSON Schema 2020-12，复用 spec.Schema
+// https://spec.openapis.org/oas/v3.1.0
+type OpenAPIV3 struct {
+	OpenAPI    string                 `json:"openapi"`
+	Info       *spec.Info             `json:"info,omitempty"`
+	Servers    []ServerV3             `json:"servers,omitempty"`
+	Paths      map[string]*PathItemV3 `json:"paths"`
+	Components *ComponentsV3          `json:"components,omitempty"`
+	Security   []map[string][]string  `json:"security,omitempty"`
+	Tags       []spec.Tag             `json:"tags,omitempty"`
+}
+
+type ServerV3 struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+type ComponentsV3 struct {
+	Schemas         map[string]spec.Schema      `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecuritySchemeV3 `json:"securitySchemes,omitempty"`
+}
+
+type SecuritySchemeV3 struct {
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	Name        string `json:"name,omitempty"`   // apiKey
+	In          string `json:"in,omitempty"`     // apiKey
+	Scheme      string `json:"scheme,omitempty"` // http
+}
+
+type PathItemV3 struct {
+	Get        *OperationV3  `json:"get,omitempty"`
+	Put        *OperationV3  `json:"put,omitempty"`
+	Post       *OperationV3  `json:"post,omitempty"`
+	Delete     *OperationV3  `json:"delete,omitempty"`
+	Options    *OperationV3  `json:"options,omitempty"`
+	Head       *OperationV3  `json:"head,omitempty"`
+	Patch      *OperationV3  `json:"patch,omitempty"`
+	Parameters []ParameterV3 `json:"parameters,omitempty"`
+}
+
+type OperationV3 struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId,omitempty"`
+	Parameters  []ParameterV3         `json:"parameters,omitempty"`
+	RequestBody *RequestBodyV3        `json:"requestBody,omitempty"`
+	Responses   map[string]ResponseV3 `json:"responses"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+}
+
+type ParameterV3 struct {
+	Name            string       `json:"name"`
+	In              string       `json:"in"`
+	Description     string       `json:"description,omitempty"`
+	Required        bool         `json:"required,omitempty"`
+	AllowEmptyValue bool         `json:"allowEmptyValue,omitempty"`
+	Style           string       `json:"style,omitempty"`
+	Explode         *bool        `json:"explode,omitempty"`
+	Schema          *spec.Schema `json:"schema,omitempty"`
+}
+
+type RequestBodyV3 struct {
+	Description string                 `json:"description,omitempty"`
+	Content     map[string]MediaTypeV3 `json:"content"`
+	Required    bool                   `json:"required,omitempty"`
+}
+
+type MediaTypeV3 struct {
+	Schema *spec.Schema `json:"schema,omitempty"`
+}
+
+type ResponseV3 struct {
+	Description string                 `json:"description"`
+	Headers     map[string]HeaderV3    `json:"headers,omitempty"`
+	Content     map[string]MediaTypeV3 `json:"content,omitempty"`
+}
+
+type HeaderV3 struct {
+	Description string       `json:"description,omitempty"`
+	Schema      *spec.Schema `json:"schema,omitempty"`
+}
+
+// NewBuilderV3 返回用于生成 openapi v3 的 Builder，interface 字段使用 oneOf，指针字段允许为 null
+func NewBuilderV3() *Builder {
+	return &Builder{
+		Definitions:          make(map[string]spec.Schema),
+		InterfaceBuildOption: InterfaceBuildOptionOneOf,
+		RefPrefix:            ComponentsRoot,
+		Nullable:             true,
+	}
+}
+
+// buildOpenAPIV3 生成 openapi v3 文档，info、tags 以及认证信息从 v2 文档中转换
+func (b *Builder) buildOpenAPIV3(wss []*restful.WebService, swagger *spec.Swagger) *OpenAPIV3 {
+	doc := &OpenAPIV3{
+		OpenAPI: OpenAPIV3Version,
+		Paths:   map[string]*PathItemV3{},
+	}
+	for _, ws := range wss {
+		var commonPathParameters []ParameterV3
+		for _, pathparam := range ws.PathParameters() {
+			commonPathParameters = append(commonPathParameters, convertParameterV3(convertParameter(pathparam.Data()), ""))
+		}
+
+		for _, route := range ws.Routes() {
+			routePath, constraints := sanitizePath(route.Path)
+			pathItem, ok := doc.Paths[routePath]
+			if !ok {
+				pathItem = &PathItemV3{}
+				doc.Paths[routePath] = pathItem
+			}
+			pathItem.Parameters = commonPathParameters
+
+			operation := b.buildOperationV3(route, constraints)
+			switch route.Method {
+			case http.MethodGet, "":
+				pathItem.Get = operation
+			case http.MethodPost:
+				pathItem.Post = operation
+			case http.MethodPut:
+				pathItem.Put = operation
+			case http.MethodDelete:
+				pathItem.Delete = operation
+			case http.MethodPatch:
+				pathItem.Patch = operation
+			case http.MethodHead:
+				pathItem.Head = operation
+			case http.MethodOptions:
+				pathItem.Options = operation
+			}
+		}
+	}
+	doc.Components = &ComponentsV3{Schemas: b.Definitions}
+
+	if swagger != nil {
+		doc.Info, doc.Tags, doc.Security = swagger.Info, swagger.Tags, swagger.Security
+		for _, scheme := range swagger.Schemes {
+			if swagger.Host != "" {
+				doc.Servers = append(doc.Servers, ServerV3{URL: scheme + "://" + swagger.Host + swagger.BasePath})
+			}
+		}
+		for name, scheme := range swagger.SecurityDefinitions {
+			if converted, ok := convertSecuritySchemeV3(scheme); ok {
+				if doc.Components.SecuritySchemes == nil {
+					doc.Components.SecuritySchemes = map[string]SecuritySchemeV3{}
+				}
+				doc.Components.SecuritySchemes[name] = converted
+			}
+		}
+	}
+	return doc
+}
+
+func (b *Builder) buildOperationV3(route restful.Route, pathConstraints map[string]string) *OperationV3 {
+	op := &OperationV3{
+		Summary:     route.Doc,
+		Description: route.Doc,
+		Deprecated:  route.Deprecated,
+		Responses:   map[string]ResponseV3{},
+	}
+	if val, ok := route.Metadata["openapi.tags"].([]string); ok {
+		op.Tags = val
+	}
+
+	consumes := route.Consumes
+	if len(consumes) == 0 {
+		consumes = []string{restful.MIME_JSON}
+	}
+	produces := route.Produces
+	if len(produces) == 0 {
+		produces = []string{restful.MIME_JSON}
+	}
+
+	// parameters
+	formProperties := spec.SchemaProperties{}
+	formRequired := []string{}
+	for _, param := range route.ParameterDocs {
+		data := param.Data()
+		switch data.Kind {
+		case restful.BodyParameterKind:
+			if route.ReadSample == nil {
+				continue
+			}
+			op.RequestBody = &RequestBodyV3{
+				Description: data.Description,
+				Content:     mediaTypesV3(consumes, b.Build(route.ReadSample)),
+				Required:    data.Required,
+			}
+		case restful.FormParameterKind:
+			// 表单参数合并为 requestBody 中的一个 object
+			converted := convertParameterV3(convertParameter(data), "")
+			formProperties[data.Name] = *converted.Schema
+			if data.Required {
+				formRequired = append(formRequired, data.Name)
+			}
+		default:
+			op.Parameters = append(op.Parameters, convertParameterV3(convertParameter(data), pathConstraints[data.Name]))
+		}
+	}
+	if len(formProperties) > 0 && op.RequestBody == nil {
+		schema := ObjectPropertyProperties(formProperties)
+		schema.Required = formRequired
+		op.RequestBody = &RequestBodyV3{
+			Content: mediaTypesV3([]string{"application/x-www-form-urlencoded", "multipart/form-data"}, schema),
+		}
+	}
+
+	// responses
+	if route.DefaultResponse != nil {
+		op.Responses["default"] = b.convertResponseV3(*route.DefaultResponse, produces)
+	}
+	for code, resp := range route.ResponseErrors {
+		op.Responses[strconv.Itoa(code)] = b.convertResponseV3(resp, produces)
+	}
+	if len(op.Responses) == 0 {
+		op.Responses["200"] = ResponseV3{Description: "OK"}
+	}
+	return op
+}
+
+func (b *Builder) convertResponseV3(resp restful.ResponseError, produces []string) ResponseV3 {
+	response := ResponseV3{Description: resp.Message}
+	if len(resp.Headers) > 0 {
+		response.Headers = map[string]HeaderV3{}
+		for k, h := range resp.Headers {
+			response.Headers[k] = HeaderV3{
+				Description: h.Description,
+				Schema:      (&spec.Schema{}).Typed(h.Type, h.Format),
+			}
+		}
+	}
+	if schema := b.Build(resp.Model); schema != nil {
+		response.Content = mediaTypesV3(produces, schema)
+	}
+	return response
+}
+
+func mediaTypesV3(mimes []string, schema *spec.Schema) map[string]MediaTypeV3 {
+	content := make(map[string]MediaTypeV3, len(mimes))
+	for _, mime := range mimes {
+		content[mime] = MediaTypeV3{Schema: schema}
+	}
+	return content
+}
+
+// convertParameterV3 将 v2 的参数转换为 v3，v3 中参数的类型以及校验均在 schema 中
+func convertParameterV3(param spec.Parameter, constraint string) ParameterV3 {
+	if constraint != "" {
+		applyPathConstraint(&param, constraint)
+	}
+	schema := &spec.Schema{
+		SchemaProps: spec.SchemaProps{
+			Format:      param.Format,
+			Default:     param.Default,
+			Pattern:     param.Pattern,
+			Enum:        param.Enum,
+			MaxLength:   param.MaxLength,
+			MinLength:   param.MinLength,
+			Maximum:     param.Maximum,
+			Minimum:     param.Minimum,
+			MaxItems:    param.MaxItems,
+			MinItems:    param.MinItems,
+			UniqueItems: param.UniqueItems,
+		},
+	}
+	if param.Type != "" {
+		schema.Type = spec.StringOrArray{param.Type}
+	} else {
+		schema.Type = spec.StringOrArray{"string"}
+	}
+	if param.Items != nil {
+		schema.Items = &spec.SchemaOrArray{Schema: (&spec.Schema{}).Typed(param.Items.Type, param.Items.Format)}
+	}
+	converted := ParameterV3{
+		Name:            param.Name,
+		In:              param.In,
+		Description:     param.Description,
+		Required:        param.Required || param.In == "path",
+		AllowEmptyValue: param.AllowEmptyValue,
+		Schema:          schema,
+	}
+	// 数组参数的序列化方式，v2 中 collectionFormat 为空时即 csv，例如 ?a=1,2
+	// multi 使用重复的参数传递，例如 ?a=1&a=2
+	if param.Type == "array" {
+		explode := param.CollectionFormat == "multi"
+		switch param.CollectionFormat {
+		case "ssv":
+			converted.Style = "spaceDelimited"
+		case "pipes":
+			converted.Style = "pipeDelimited"
+		default:
+			converted.Style = "form"
+		}
+		converted.Explode = &explode
+	}
+	return converted
+}
+
+func convertSecuritySchemeV3(scheme *spec.SecurityScheme) (SecuritySchemeV3, bool) {
+	if scheme == nil {
+		return SecuritySchemeV3{}, false
+	}
+	switch scheme.Type {
+	case "apiKey":
+		return SecuritySchemeV3{Type: "apiKey", Description: scheme.Description, Name: scheme.Name, In: scheme.In}, true
+	case "basic":
+		return SecuritySchemeV3{Type: "http", Description: scheme.Description, Scheme: "basic"}, true
+	default:
+		// oauth2 的 flow 在 v3 中结构不同，暂不转换
+		return SecuritySchemeV3{}, false
+	}
+}
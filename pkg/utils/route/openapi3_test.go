@@ -0,0 +1,126 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emicklei/go-restful/v3"
+	"github.com/go-openapi/spec"
+)
+
+type SampleZoo struct {
+	Name    string        `json:"name"`
+	Keeper  *string       `json:"keeper"`
+	Animal  *SampleAnimal `json:"animal"`
+	Animals []interface{} `json:"animals"`
+}
+
+func TestBuildOpenAPIWebService_v3(t *testing.T) {
+	keeper := "bob"
+	ws := new(restful.WebService)
+	(&Tree{
+		Group: NewGroup("/v1").AddRoutes(
+			POST("/zoos").To(Samplefunc).
+				Parameters(BodyParameter("zoo", SampleZoo{})).
+				Response(SampleZoo{Keeper: &keeper, Animals: []interface{}{SampleAnimal{}, SampleLoginData{}}}),
+			GET("/zoos/{id:[0-9]+}").To(Samplefunc).
+				Parameters(PathParameter("id", "zoo id"), QueryParameter("search", "search").Optional()),
+		),
+	}).AddToWebService(ws)
+
+	container := restful.NewContainer()
+	container.Add(BuildOpenAPIWebService([]*restful.WebService{ws}, "/docs.json", func(swagger *spec.Swagger) {
+		swagger.Info = &spec.Info{InfoProps: spec.InfoProps{Title: "zoo"}}
+		swagger.SecurityDefinitions = map[string]*spec.SecurityScheme{"jwt": spec.APIKeyAuth("Authorization", "header")}
+	}))
+	w := httptest.NewRecorder()
+	container.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs.json/v3", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	doc := &OpenAPIV3{}
+	if err := json.Unmarshal(w.Body.Bytes(), doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.OpenAPI != OpenAPIV3Version || doc.Info == nil || doc.Info.Title != "zoo" {
+		t.Errorf("unexpected version or info: %s %v", doc.OpenAPI, doc.Info)
+	}
+	if scheme := doc.Components.SecuritySchemes["jwt"]; scheme.Type != "apiKey" || scheme.In != "header" {
+		t.Errorf("unexpected security scheme %v", scheme)
+	}
+
+	post := doc.Paths["/v1/zoos"].Post
+	if post == nil || post.RequestBody == nil {
+		t.Fatalf("missing request body")
+	}
+	// 包含 interface 字段的结构体使用 allOf 引用
+	if body := post.RequestBody.Content[restful.MIME_JSON].Schema; len(body.AllOf) == 0 || body.AllOf[0].Ref.String() != ComponentsRoot+"route.SampleZoo" {
+		t.Errorf("unexpected request body schema %v", body)
+	}
+	if _, ok := post.Responses["200"].Content[restful.MIME_JSON]; !ok {
+		t.Errorf("missing response content %v", post.Responses)
+	}
+
+	zoo := doc.Components.Schemas["route.SampleZoo"]
+	if typ := zoo.Properties["keeper"].Type; !typ.Contains("string") || !typ.Contains("null") {
+		t.Errorf("pointer field should be nullable, got %v", typ)
+	}
+	if oneof := zoo.Properties["animal"].OneOf; len(oneof) != 2 || oneof[0].Ref.String() != ComponentsRoot+"route.SampleAnimal" {
+		t.Errorf("pointer struct field should be oneOf ref and null, got %v", oneof)
+	}
+
+	get := doc.Paths["/v1/zoos/{id}"].Get
+	if get == nil || len(get.Parameters) != 2 {
+		t.Fatalf("unexpected get operation %v", get)
+	}
+	if id := get.Parameters[0]; id.In != "path" || !id.Required || id.Schema.Pattern != "[0-9]+" {
+		t.Errorf("unexpected path parameter %+v", id)
+	}
+}
+
+func TestBuilder_v3InterfaceSlice(t *testing.T) {
+	b := NewBuilderV3()
+	schema := b.Build([]interface{}{SampleAnimal{}, SampleLoginData{}, SampleAnimal{}})
+	if schema.Items == nil || schema.Items.Schema == nil || len(schema.Items.Schema.OneOf) != 2 {
+		t.Fatalf("interface slice items should be oneOf, got %v", schema.Items)
+	}
+}
+
+func TestConvertParameterV3_array(t *testing.T) {
+	tests := []struct {
+		collectionFormat string
+		wantStyle        string
+		wantExplode      bool
+	}{
+		{collectionFormat: "", wantStyle: "form", wantExplode: false},
+		{collectionFormat: "csv", wantStyle: "form", wantExplode: false},
+		{collectionFormat: "multi", wantStyle: "form", wantExplode: true},
+		{collectionFormat: "pipes", wantStyle: "pipeDelimited", wantExplode: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.collectionFormat, func(t *testing.T) {
+			param := *spec.QueryParam("ids").CollectionOf(spec.NewItems().Typed("string", ""), tt.collectionFormat)
+			got := convertParameterV3(param, "")
+			if got.Style != tt.wantStyle || got.Explode == nil || *got.Explode != tt.wantExplode {
+				t.Errorf("convertParameterV3() style = %s, explode = %v", got.Style, got.Explode)
+			}
+		})
+	}
+}
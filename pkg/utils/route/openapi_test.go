@@ -0,0 +1,63 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+func Test_sanitizePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		wantPath string
+		want     map[string]spec.Parameter
+	}{
+		{
+			path:     "/namespaces/{id:int}/files/{name:[a-z0-9/]+}",
+			wantPath: "/namespaces/{id}/files/{name}",
+			want: map[string]spec.Parameter{
+				"id":   {SimpleSchema: spec.SimpleSchema{Type: "integer", Format: "int64"}},
+				"name": {CommonValidations: spec.CommonValidations{Pattern: "[a-z0-9/]+"}},
+			},
+		},
+		{
+			path:     "/proxy/{name}/{rest:path}",
+			wantPath: "/proxy/{name}/{rest}",
+			want: map[string]spec.Parameter{
+				"rest": {},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			gotPath, constraints := sanitizePath(tt.path)
+			if gotPath != tt.wantPath {
+				t.Errorf("sanitizePath() path = %v, want %v", gotPath, tt.wantPath)
+			}
+			got := map[string]spec.Parameter{}
+			for name, constraint := range constraints {
+				param := spec.Parameter{}
+				applyPathConstraint(&param, constraint)
+				got[name] = param
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sanitizePath() constraints = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
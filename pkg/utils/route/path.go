@@ -14,6 +14,8 @@
 
 package route
 
+import "fmt"
+
 type PathTokens struct {
 	Tokens []string
 }
@@ -36,10 +38,34 @@ func ParsePathTokens(path string) []string {
 	return tokens
 }
 
+// parsePatternTokens 与 ParsePathTokens 相同，但是不拆分变量定义中的 '/'，例如 {name:[a-z/]+}，以便在编译时报错
+func parsePatternTokens(pattern string) []string {
+	tokens := []string{}
+	pos, depth := 0, 0
+	for i, char := range pattern {
+		switch {
+		case char == '{':
+			depth++
+		case char == '}' && depth > 0:
+			depth--
+		case char == '/' && depth == 0:
+			if pos != i {
+				tokens = append(tokens, pattern[pos:i])
+			}
+			tokens = append(tokens, "/")
+			pos = i + 1
+		}
+	}
+	if pos != len(pattern) {
+		tokens = append(tokens, pattern[pos:])
+	}
+	return tokens
+}
+
 func CompilePathPattern(pattern string) ([][]Element, error) {
 	sections := [][]Element{}
-	pathtokens := ParsePathTokens(pattern)
-	for _, token := range pathtokens {
+	pathtokens := parsePatternTokens(pattern)
+	for i, token := range pathtokens {
 		if token == "/" {
 			sections = append(sections, []Element{{kind: ElementKindSplit}})
 			continue
@@ -48,6 +74,11 @@ func CompilePathPattern(pattern string) ([][]Element, error) {
 		if err != nil {
 			return nil, err
 		}
+		for _, elem := range compiled {
+			if elem.constraint == ConstraintPath && i != len(pathtokens)-1 {
+				return nil, fmt.Errorf("invalid pattern [%s]: path variable {%s:path} must be the last element", pattern, elem.param)
+			}
+		}
 		sections = append(sections, compiled)
 	}
 	return sections, nil
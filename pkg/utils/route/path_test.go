@@ -80,6 +80,10 @@ func TestCompilePathPattern(t *testing.T) {
 				{{kind: ElementKindVariable, param: "name"}, {kind: ElementKindStar}},
 			},
 		},
+		{
+			pattern: "/tree/{dir:[a-z/]+}",
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.pattern, func(t *testing.T) {
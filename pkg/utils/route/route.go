@@ -16,13 +16,35 @@ package route
 
 import (
 	"net/http"
+	"path"
+	"sort"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Middleware 包装路由的处理函数，可以在处理前后执行逻辑，不调用 next 时中断处理
+type Middleware func(next gin.HandlerFunc) gin.HandlerFunc
+
+// WrapGinMiddleware 将 gin 的中间件转换为 Middleware，中间件调用 c.Abort() 时中断处理
+// 由于 Router 作为 gin 的最后一个处理函数执行，中间件中的 c.Next() 不会执行后续的处理
+func WrapGinMiddleware(middleware gin.HandlerFunc) Middleware {
+	return func(next gin.HandlerFunc) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			middleware(c)
+			if !c.IsAborted() {
+				next(c)
+			}
+		}
+	}
+}
+
 type Router struct {
-	methods  map[string]matcher
-	Notfound gin.HandlerFunc
+	methods     map[string]matcher
+	middlewares []Middleware
+	Notfound    gin.HandlerFunc
+	// MethodNotAllowed 路径存在但是方法不匹配时的处理，调用前已经设置 Allow header
+	MethodNotAllowed gin.HandlerFunc
 }
 
 func NewRouter() *Router {
@@ -31,45 +53,57 @@ func NewRouter() *Router {
 
 var DefaultNotFoundHandler = gin.WrapF(http.NotFound)
 
-func (m *Router) GET(path string, handler gin.HandlerFunc) {
-	m.MustRegister(http.MethodGet, path, handler)
+var DefaultMethodNotAllowedHandler = func(c *gin.Context) {
+	c.String(http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
 }
 
-func (m *Router) POST(path string, handler gin.HandlerFunc) {
-	m.MustRegister(http.MethodPost, path, handler)
+// Use 添加中间件，仅对之后注册的路由生效
+func (m *Router) Use(middlewares ...Middleware) {
+	m.middlewares = append(m.middlewares, middlewares...)
 }
 
-func (m *Router) PUT(path string, handler gin.HandlerFunc) {
-	m.MustRegister(http.MethodPut, path, handler)
+// Group 创建拥有共同前缀以及中间件的路由组
+func (m *Router) Group(prefix string, middlewares ...Middleware) *RouterGroup {
+	return m.root().Group(prefix, middlewares...)
 }
 
-func (m *Router) DELETE(path string, handler gin.HandlerFunc) {
-	m.MustRegister(http.MethodDelete, path, handler)
+func (m *Router) root() *RouterGroup {
+	return &RouterGroup{router: m, middlewares: m.middlewares}
 }
 
-func (m *Router) PATCH(path string, handler gin.HandlerFunc) {
-	m.MustRegister(http.MethodPatch, path, handler)
+func (m *Router) GET(path string, handler gin.HandlerFunc, middlewares ...Middleware) {
+	m.root().GET(path, handler, middlewares...)
 }
 
-func (m *Router) ANY(path string, handler gin.HandlerFunc) {
-	_ = m.Register(http.MethodGet, path, handler)
-	_ = m.Register(http.MethodPost, path, handler)
-	_ = m.Register(http.MethodPut, path, handler)
-	_ = m.Register(http.MethodPatch, path, handler)
-	_ = m.Register(http.MethodDelete, path, handler)
-	_ = m.Register(http.MethodHead, path, handler)
-	_ = m.Register(http.MethodOptions, path, handler)
-	_ = m.Register(http.MethodTrace, path, handler)
-	_ = m.Register(http.MethodConnect, path, handler)
+func (m *Router) POST(path string, handler gin.HandlerFunc, middlewares ...Middleware) {
+	m.root().POST(path, handler, middlewares...)
 }
 
-func (m *Router) MustRegister(method, path string, handler gin.HandlerFunc) {
-	if err := m.Register(method, path, handler); err != nil {
-		panic(err)
-	}
+func (m *Router) PUT(path string, handler gin.HandlerFunc, middlewares ...Middleware) {
+	m.root().PUT(path, handler, middlewares...)
+}
+
+func (m *Router) DELETE(path string, handler gin.HandlerFunc, middlewares ...Middleware) {
+	m.root().DELETE(path, handler, middlewares...)
 }
 
-func (m *Router) Register(method, path string, handler gin.HandlerFunc) error {
+func (m *Router) PATCH(path string, handler gin.HandlerFunc, middlewares ...Middleware) {
+	m.root().PATCH(path, handler, middlewares...)
+}
+
+func (m *Router) ANY(path string, handler gin.HandlerFunc, middlewares ...Middleware) {
+	m.root().ANY(path, handler, middlewares...)
+}
+
+func (m *Router) MustRegister(method, path string, handler gin.HandlerFunc, middlewares ...Middleware) {
+	m.root().MustRegister(method, path, handler, middlewares...)
+}
+
+func (m *Router) Register(method, path string, handler gin.HandlerFunc, middlewares ...Middleware) error {
+	return m.root().Register(method, path, handler, middlewares...)
+}
+
+func (m *Router) register(method, path string, handler gin.HandlerFunc) error {
 	if m.methods == nil {
 		m.methods = map[string]matcher{}
 	}
@@ -81,23 +115,41 @@ func (m *Router) Register(method, path string, handler gin.HandlerFunc) error {
 	return methodreg.Register(path, handler)
 }
 
+// Handle 匹配并执行路由，可直接作为 gin 的处理函数
+func (m *Router) Handle(c *gin.Context) {
+	m.Match(c)(c)
+}
+
 func (m *Router) Match(c *gin.Context) gin.HandlerFunc {
 	// always match * method
-	if regs, ok := m.methods["*"]; ok {
-		if matched, val, vars := regs.Match(c.Request.URL.Path); matched {
-			for k, v := range vars {
-				c.Params = append(c.Params, gin.Param{Key: k, Value: v})
-			}
-			return val.(gin.HandlerFunc)
+	if handler := m.match(c, "*"); handler != nil {
+		return handler
+	}
+	if handler := m.match(c, c.Request.Method); handler != nil {
+		return handler
+	}
+	// HEAD 请求未注册时使用 GET 的处理函数，响应内容由 http server 丢弃
+	if c.Request.Method == http.MethodHead {
+		if handler := m.match(c, http.MethodGet); handler != nil {
+			return handler
 		}
 	}
-
-	if regs, ok := m.methods[c.Request.Method]; ok {
-		if matched, val, vars := regs.Match(c.Request.URL.Path); matched {
-			for k, v := range vars {
-				c.Params = append(c.Params, gin.Param{Key: k, Value: v})
+	if allowed := m.allowed(c.Request.URL.Path); len(allowed) > 0 {
+		allow := strings.Join(allowed, ", ")
+		// OPTIONS 请求未注册时返回支持的方法
+		if c.Request.Method == http.MethodOptions {
+			return func(c *gin.Context) {
+				c.Header("Allow", allow)
+				c.Status(http.StatusNoContent)
 			}
-			return val.(gin.HandlerFunc)
+		}
+		return func(c *gin.Context) {
+			c.Header("Allow", allow)
+			if m.MethodNotAllowed == nil {
+				DefaultMethodNotAllowedHandler(c)
+				return
+			}
+			m.MethodNotAllowed(c)
 		}
 	}
 
@@ -108,3 +160,126 @@ func (m *Router) Match(c *gin.Context) gin.HandlerFunc {
 		return m.Notfound
 	}()
 }
+
+func (m *Router) match(c *gin.Context, method string) gin.HandlerFunc {
+	regs, ok := m.methods[method]
+	if !ok {
+		return nil
+	}
+	matched, val, vars := regs.Match(c.Request.URL.Path)
+	if !matched {
+		return nil
+	}
+	for k, v := range vars {
+		c.Params = append(c.Params, gin.Param{Key: k, Value: v})
+	}
+	return val.(gin.HandlerFunc)
+}
+
+// allowed 返回路径上已注册的方法，不包含匹配任意方法的 "*"
+func (m *Router) allowed(path string) []string {
+	allowed := []string{}
+	for method, regs := range m.methods {
+		if method == "*" {
+			continue
+		}
+		if matched, _, _ := regs.Match(path); matched {
+			allowed = append(allowed, method)
+		}
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	has := func(method string) bool {
+		for _, m := range allowed {
+			if m == method {
+				return true
+			}
+		}
+		return false
+	}
+	if has(http.MethodGet) && !has(http.MethodHead) {
+		allowed = append(allowed, http.MethodHead)
+	}
+	if !has(http.MethodOptions) {
+		allowed = append(allowed, http.MethodOptions)
+	}
+	sort.Strings(allowed)
+	return allowed
+}
+
+// RouterGroup 拥有共同前缀以及中间件的一组路由，子路由组继承父路由组的前缀以及中间件
+type RouterGroup struct {
+	router      *Router
+	prefix      string
+	middlewares []Middleware
+}
+
+func (g *RouterGroup) Use(middlewares ...Middleware) *RouterGroup {
+	g.middlewares = append(g.middlewares, middlewares...)
+	return g
+}
+
+func (g *RouterGroup) Group(prefix string, middlewares ...Middleware) *RouterGroup {
+	return &RouterGroup{
+		router:      g.router,
+		prefix:      g.fullpath(prefix),
+		middlewares: append(append([]Middleware{}, g.middlewares...), middlewares...),
+	}
+}
+
+func (g *RouterGroup) fullpath(p string) string {
+	if p == "" {
+		return g.prefix
+	}
+	joined := path.Join(g.prefix, p)
+	// 保留末尾的 '/'，其在匹配时有意义
+	if strings.HasSuffix(p, "/") && !strings.HasSuffix(joined, "/") {
+		joined += "/"
+	}
+	return joined
+}
+
+func (g *RouterGroup) GET(path string, handler gin.HandlerFunc, middlewares ...Middleware) {
+	g.MustRegister(http.MethodGet, path, handler, middlewares...)
+}
+
+func (g *RouterGroup) POST(path string, handler gin.HandlerFunc, middlewares ...Middleware) {
+	g.MustRegister(http.MethodPost, path, handler, middlewares...)
+}
+
+func (g *RouterGroup) PUT(path string, handler gin.HandlerFunc, middlewares ...Middleware) {
+	g.MustRegister(http.MethodPut, path, handler, middlewares...)
+}
+
+func (g *RouterGroup) DELETE(path string, handler gin.HandlerFunc, middlewares ...Middleware) {
+	g.MustRegister(http.MethodDelete, path, handler, middlewares...)
+}
+
+func (g *RouterGroup) PATCH(path string, handler gin.HandlerFunc, middlewares ...Middleware) {
+	g.MustRegister(http.MethodPatch, path, handler, middlewares...)
+}
+
+func (g *RouterGroup) ANY(path string, handler gin.HandlerFunc, middlewares ...Middleware) {
+	for _, method := range []string{
+		http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+		http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodConnect,
+	} {
+		_ = g.Register(method, path, handler, middlewares...)
+	}
+}
+
+func (g *RouterGroup) MustRegister(method, path string, handler gin.HandlerFunc, middlewares ...Middleware) {
+	if err := g.Register(method, path, handler, middlewares...); err != nil {
+		panic(err)
+	}
+}
+
+// Register 注册路由，中间件按照 路由组、路由 的顺序执行
+func (g *RouterGroup) Register(method, path string, handler gin.HandlerFunc, middlewares ...Middleware) error {
+	all := append(append([]Middleware{}, g.middlewares...), middlewares...)
+	for i := len(all) - 1; i >= 0; i-- {
+		handler = all[i](handler)
+	}
+	return g.router.register(method, g.fullpath(path), handler)
+}
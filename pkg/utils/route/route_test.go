@@ -147,3 +147,102 @@ func TestRouter_MustRegister(t *testing.T) {
 		})
 	}
 }
+
+func TestRouter_Group(t *testing.T) {
+	record := func(name string) Middleware {
+		return func(next gin.HandlerFunc) gin.HandlerFunc {
+			return func(c *gin.Context) {
+				c.Writer.Header().Add("X-Middleware", name)
+				next(c)
+			}
+		}
+	}
+	handler := func(c *gin.Context) { c.String(http.StatusOK, c.Param("name")) }
+	deny := WrapGinMiddleware(func(c *gin.Context) { c.AbortWithStatus(http.StatusForbidden) })
+
+	m := NewRouter()
+	m.Use(record("router"))
+	v1 := m.Group("/v1", record("v1"))
+	v1.GET("/clusters/{name}", handler, record("route"))
+	v1.Group("/admin", deny).DELETE("/clusters/{name}", handler)
+	m.POST("/clusters", handler)
+
+	tests := []struct {
+		name            string
+		req             *http.Request
+		wantStatus      int
+		wantBody        string
+		wantAllow       string
+		wantMiddlewares []string
+	}{
+		{
+			name:            "group prefix and middlewares",
+			req:             httptest.NewRequest(http.MethodGet, "/v1/clusters/abc", nil),
+			wantStatus:      http.StatusOK,
+			wantBody:        "abc",
+			wantMiddlewares: []string{"router", "v1", "route"},
+		},
+		{
+			name:            "head fallback to get",
+			req:             httptest.NewRequest(http.MethodHead, "/v1/clusters/abc", nil),
+			wantStatus:      http.StatusOK,
+			wantMiddlewares: []string{"router", "v1", "route"},
+		},
+		{
+			name:       "method not allowed",
+			req:        httptest.NewRequest(http.MethodPut, "/v1/clusters/abc", nil),
+			wantStatus: http.StatusMethodNotAllowed,
+			wantAllow:  "GET, HEAD, OPTIONS",
+		},
+		{
+			name:       "options",
+			req:        httptest.NewRequest(http.MethodOptions, "/clusters", nil),
+			wantStatus: http.StatusNoContent,
+			wantAllow:  "OPTIONS, POST",
+		},
+		{
+			name:            "middleware abort",
+			req:             httptest.NewRequest(http.MethodDelete, "/v1/admin/clusters/abc", nil),
+			wantStatus:      http.StatusForbidden,
+			wantMiddlewares: []string{"router", "v1"},
+		},
+		{
+			name:       "not found",
+			req:        httptest.NewRequest(http.MethodGet, "/v2/clusters/abc", nil),
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = tt.req
+			m.Handle(c)
+			c.Writer.WriteHeaderNow()
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", w.Body.String(), tt.wantBody)
+			}
+			if allow := w.Header().Get("Allow"); allow != tt.wantAllow {
+				t.Errorf("Allow = %s, want %s", allow, tt.wantAllow)
+			}
+			if got := w.Header().Values("X-Middleware"); len(got)+len(tt.wantMiddlewares) > 0 && !reflect.DeepEqual(got, tt.wantMiddlewares) {
+				t.Errorf("middlewares = %v, want %v", got, tt.wantMiddlewares)
+			}
+		})
+	}
+}
+
+func TestRouter_allowed(t *testing.T) {
+	handler := func(c *gin.Context) {}
+	m := NewRouter()
+	m.MustRegister("*", "/clusters", handler)
+	m.GET("/clusters", handler)
+
+	if got := m.allowed("/clusters"); !reflect.DeepEqual(got, []string{"GET", "HEAD", "OPTIONS"}) {
+		t.Errorf("allowed() = %v", got)
+	}
+}
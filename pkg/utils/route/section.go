@@ -16,6 +16,7 @@ package route
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 )
 
@@ -29,9 +30,49 @@ const (
 	ElementKindSplit    ElementKind = "/"
 )
 
+// 路径变量的约束，使用 {name:constraint} 定义，除以下类型外的约束作为正则表达式
+const (
+	ConstraintInt  = "int"  // 整数
+	ConstraintPath = "path" // 向后匹配剩余的路径，等同于 {name}*，只能作为最后一个元素
+)
+
 type Element struct {
-	kind  ElementKind
-	param string
+	kind       ElementKind
+	param      string
+	constraint string
+	regexp     *regexp.Regexp // 变量需要满足的约束，为空时不限制
+}
+
+// accept 判断变量的值是否满足约束
+func (e Element) accept(val string) bool {
+	return e.regexp == nil || e.regexp.MatchString(val)
+}
+
+// parseVariable 解析变量定义 name:constraint
+func parseVariable(def string) (string, string) {
+	name, constraint, _ := strings.Cut(def, ":")
+	return name, constraint
+}
+
+func compileVariable(def string) (Element, error) {
+	name, constraint := parseVariable(def)
+	elem := Element{kind: ElementKindVariable, param: name, constraint: constraint}
+	switch constraint {
+	case "", ConstraintPath:
+	case ConstraintInt:
+		elem.regexp = regexp.MustCompile(`^-?[0-9]+$`)
+	default:
+		// 路径按照 '/' 拆分后逐段匹配，包含 '/' 的正则表达式永远无法匹配
+		if strings.Contains(constraint, "/") {
+			return elem, fmt.Errorf("constraint of {%s} can't contain '/', use {%s:path} instead", name, name)
+		}
+		re, err := regexp.Compile("^(?:" + constraint + ")$")
+		if err != nil {
+			return elem, err
+		}
+		elem.regexp = re
+	}
+	return elem, nil
 }
 
 type CompileError struct {
@@ -64,6 +105,7 @@ func CompileSection(pattern string) ([]Element, error) {
 	}
 
 	pos := 0
+	depth := 0 // 约束的正则表达式中可能存在 '{' '}'
 	currentKind := ElementKindNone
 	for i, rune := range pattern {
 		switch {
@@ -75,10 +117,23 @@ func CompileSection(pattern string) ([]Element, error) {
 			// start a variable defination
 			currentKind = ElementKindVariable
 			pos = i + 1
-
+		case rune == '{' && currentKind == ElementKindVariable:
+			depth++
+		case rune == '}' && currentKind == ElementKindVariable && depth > 0:
+			depth--
 		case rune == '}' && currentKind == ElementKindVariable:
 			// end a variable defination
-			elems = append(elems, Element{kind: ElementKindVariable, param: pattern[pos:i]})
+			elem, err := compileVariable(pattern[pos:i])
+			if err != nil {
+				return nil, CompileError{Position: i, Pattern: pattern, Rune: rune, Message: err.Error()}
+			}
+			elems = append(elems, elem)
+			if elem.constraint == ConstraintPath {
+				if i != len(pattern)-1 {
+					return nil, CompileError{Position: i, Pattern: pattern, Rune: rune, Message: "path variable must be the last element"}
+				}
+				hasStarSuffix = true
+			}
 			currentKind = ElementKindNone
 			pos = i + 1
 		default:
@@ -133,6 +188,9 @@ func MatchSection(compiled []Element, sections []string) (bool, bool, map[string
 		case ElementKindVariable:
 			// no next
 			if i == len(compiled)-1 {
+				if !elem.accept(section[pos:]) {
+					return false, false, nil
+				}
 				vars[elem.param] = section[pos:]
 				return true, false, vars
 			}
@@ -142,6 +200,24 @@ func MatchSection(compiled []Element, sections []string) (bool, bool, map[string
 			switch nextsec.kind {
 			case ElementKindConst:
 				index := strings.Index(section[pos:], nextsec.param)
+				// 有约束时依次尝试每个位置，直到变量以及剩余的部分均匹配
+				if elem.regexp != nil {
+					for index > 0 {
+						if elem.accept(section[pos : pos+index]) {
+							left := append([]string{section[pos+index:]}, sections[1:]...)
+							if matched, matchleft, leftvars := MatchSection(compiled[i+1:], left); matched {
+								vars[elem.param] = section[pos : pos+index]
+								return true, matchleft, mergeMap(leftvars, vars)
+							}
+						}
+						next := strings.Index(section[pos+index+1:], nextsec.param)
+						if next == -1 {
+							break
+						}
+						index += next + 1
+					}
+					return false, false, nil
+				}
 				if index == -1 || index == 0 {
 					// not match next const
 					return false, false, nil
@@ -153,7 +229,11 @@ func MatchSection(compiled []Element, sections []string) (bool, bool, map[string
 				continue
 			case ElementKindStar:
 				// var is bettwen pos to sections end
-				vars[elem.param] = strings.Join(append([]string{section[pos:]}, sections[1:]...), "")
+				val := strings.Join(append([]string{section[pos:]}, sections[1:]...), "")
+				if !elem.accept(val) {
+					return false, false, nil
+				}
+				vars[elem.param] = val
 				return true, true, vars
 			}
 		case ElementKindStar:
@@ -16,6 +16,7 @@ package route
 
 import (
 	"reflect"
+	"regexp"
 	"testing"
 )
 
@@ -56,6 +57,26 @@ func TestCompileSection(t *testing.T) {
 				{kind: ElementKindStar},
 			},
 		},
+		{
+			pattern: "v{id:int}-{rest:path}",
+			want: []Element{
+				{kind: ElementKindConst, param: "v"},
+				{kind: ElementKindVariable, param: "id", constraint: ConstraintInt, regexp: regexp.MustCompile(`^-?[0-9]+$`)},
+				{kind: ElementKindConst, param: "-"},
+				{kind: ElementKindVariable, param: "rest", constraint: ConstraintPath},
+				{kind: ElementKindStar},
+			},
+		},
+		{
+			pattern:    "{rest:path}-a",
+			wantErr:    true,
+			wantErrStr: "invalid char [}] in [{rest:path}-a] at position 10: path variable must be the last element",
+		},
+		{
+			pattern:    "{dir:[a-z/]+}",
+			wantErr:    true,
+			wantErrStr: "invalid char [}] in [{dir:[a-z/]+}] at position 12: constraint of {dir} can't contain '/', use {dir:path} instead",
+		},
 		{
 			pattern:    "{hello",
 			wantErr:    true,
@@ -19,9 +19,11 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"kubegems.io/kubegems/pkg/log"
 )
 
 // Backend 作为后端的数据存储，需要一致性支持
@@ -51,6 +53,7 @@ type Backend interface {
 type RedisBackend struct {
 	kvprefix    string
 	steamprefix string
+	deadprefix  string
 	cli         *redis.Client
 }
 
@@ -58,13 +61,26 @@ func NewRedisBackendFromClient(c *redis.Client) *RedisBackend {
 	return &RedisBackend{
 		kvprefix:    "/workflow-store/",
 		steamprefix: "/workflow-queue/",
+		deadprefix:  "/workflow-dead/",
 		cli:         c,
 	}
 }
 
+const (
+	// listScanCount List 时每次 SCAN 的数量
+	listScanCount = 1000
+
+	DefaultMaxDeliveries = 5
+	// DefaultClaimMinIdle 需要大于任务的默认超时时间，避免正在执行的消息被其他消费者认领
+	DefaultClaimMinIdle = 2 * DefaultTaskTimeout
+)
+
 type SubOptions struct {
-	AutoACK     bool // 自动确认，无论结果是否为 error
-	Concurrency int  // 支持的并发数量
+	AutoACK       bool          // 自动确认，无论结果是否为 error
+	Concurrency   int           // 支持的并发数量
+	MaxDeliveries int64         // 消息的最大投递次数，超过后转移至死信队列，0 为不限制
+	ClaimMinIdle  time.Duration // 未确认的消息超过该时间后可被其他消费者认领
+	Consumer      string        // 消费者名称，默认为 hostname
 }
 
 type SubOption func(o *SubOptions)
@@ -77,13 +93,40 @@ func WithAutoACK(ack bool) SubOption {
 	return func(o *SubOptions) { o.AutoACK = ack }
 }
 
-// 队列
-// nolint: funlen,gocognit
-func (b *RedisBackend) Sub(ctx context.Context, name string, onchange OnChangeFunc, opts ...SubOption) error {
-	options := &SubOptions{Concurrency: 1}
+func WithMaxDeliveries(max int64) SubOption {
+	return func(o *SubOptions) { o.MaxDeliveries = max }
+}
+
+func WithClaimMinIdle(idle time.Duration) SubOption {
+	return func(o *SubOptions) { o.ClaimMinIdle = idle }
+}
+
+func WithConsumer(consumer string) SubOption {
+	return func(o *SubOptions) { o.Consumer = consumer }
+}
+
+func newSubOptions(opts ...SubOption) *SubOptions {
+	options := &SubOptions{
+		Concurrency:   1,
+		MaxDeliveries: DefaultMaxDeliveries,
+		ClaimMinIdle:  DefaultClaimMinIdle,
+	}
 	for _, opt := range opts {
 		opt(options)
 	}
+	if options.Consumer == "" {
+		options.Consumer, _ = os.Hostname()
+	}
+	return options
+}
+
+// 队列
+// 消息在处理失败或者消费者异常退出时保持未确认状态，
+// 超过 ClaimMinIdle 未确认的消息会被存活的消费者通过 XAUTOCLAIM 认领并重新处理，
+// 投递次数超过 MaxDeliveries 的消息被转移至死信队列。
+// nolint: funlen,gocognit
+func (b *RedisBackend) Sub(ctx context.Context, name string, onchange OnChangeFunc, opts ...SubOption) error {
+	options := newSubOptions(opts...)
 
 	keyprefix := b.steamprefix + name
 
@@ -97,13 +140,88 @@ func (b *RedisBackend) Sub(ctx context.Context, name string, onchange OnChangeFu
 		}
 	}
 
+	// 读取以及认领消息使用单独的 context，出错退出时不会取消正在处理的消息
+	loopctx, cancel := context.WithCancel(ctx)
+	wg := &sync.WaitGroup{}
+	defer func() {
+		cancel()
+		// 等待正在处理的消息完成，重新订阅后不会超出并发限制
+		wg.Wait()
+	}()
+
 	// concurrent
 	concurrentchan := make(chan struct{}, options.Concurrency)
 
+	dispatch := func(msg redis.XMessage) bool {
+		if len(msg.Values) == 0 {
+			// 消息已经被删除
+			b.cli.XAck(ctx, keyprefix, consumergroup, msg.ID)
+			return true
+		}
+		for k, v := range msg.Values {
+			val := []byte{}
+			switch data := v.(type) {
+			case string:
+				val = []byte(data)
+			case []byte:
+				val = data
+			}
+
+			select {
+			case <-loopctx.Done():
+				return false
+			case concurrentchan <- struct{}{}:
+				wg.Add(1)
+				go func(msgid string, k string, v []byte) {
+					defer wg.Done()
+					stop := b.keepalive(ctx, keyprefix, consumergroup, msgid, options)
+					err := onchange(ctx, k, v)
+					stop()
+					if err == nil || options.AutoACK {
+						// ack，退出时已经处理完成的消息同样需要确认
+						b.cli.XAck(context.WithoutCancel(ctx), keyprefix, consumergroup, msgid)
+					}
+					// put it back
+					<-concurrentchan
+				}(msg.ID, k, val)
+			}
+		}
+		return true
+	}
+
+	// 定期认领其他消费者超时未确认的消息
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		interval := options.ClaimMinIdle / 2
+		if interval < time.Second {
+			interval = time.Second
+		}
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+		for {
+			select {
+			case <-loopctx.Done():
+				return
+			case <-timer.C:
+				msgs, err := b.claimStale(loopctx, name, consumergroup, options)
+				if err != nil {
+					log.FromContextOrDiscard(ctx).Error(err, "claim stale messages", "stream", keyprefix)
+				}
+				for _, msg := range msgs {
+					if !dispatch(msg) {
+						return
+					}
+				}
+				timer.Reset(interval)
+			}
+		}
+	}()
+
 	shouldconsumeunacked := true
 	for {
 		select {
-		case <-ctx.Done():
+		case <-loopctx.Done():
 			return nil
 		default:
 			// 消费
@@ -118,12 +236,9 @@ func (b *RedisBackend) Sub(ctx context.Context, name string, onchange OnChangeFu
 				ids = "0"
 			}
 			// https://redis.io/commands/XREADGROUP
-			result, err := b.cli.XReadGroup(ctx, &redis.XReadGroupArgs{
-				Group: consumergroup,
-				Consumer: func() string {
-					hostname, _ := os.Hostname()
-					return hostname
-				}(),
+			result, err := b.cli.XReadGroup(loopctx, &redis.XReadGroupArgs{
+				Group:    consumergroup,
+				Consumer: options.Consumer,
 				Streams: []string{
 					keyprefix, ids,
 				},
@@ -134,34 +249,16 @@ func (b *RedisBackend) Sub(ctx context.Context, name string, onchange OnChangeFu
 			}
 
 			for _, stream := range result {
-				for _, msg := range stream.Messages {
-					for k, v := range msg.Values {
-						val := []byte{}
-						switch data := v.(type) {
-						case string:
-							val = []byte(data)
-						case []byte:
-							val = data
-						}
-
-						select {
-						case <-ctx.Done():
-							return nil
-						case concurrentchan <- struct{}{}:
-							go func(stream redis.XStream, msgid string, k string, v []byte) {
-								if err := onchange(ctx, k, v); err != nil {
-									if options.AutoACK {
-										// ack
-										b.cli.XAck(ctx, stream.Stream, consumergroup, msgid)
-									}
-								} else {
-									// ack
-									b.cli.XAck(ctx, stream.Stream, consumergroup, msgid)
-								}
-								// put it back
-								<-concurrentchan
-							}(stream, msg.ID, k, val)
-						}
+				msgs := stream.Messages
+				if ids != ">" {
+					// 上次未确认的消息同样需要检查投递次数
+					if msgs, err = b.filterPoison(loopctx, name, consumergroup, msgs, options); err != nil {
+						return err
+					}
+				}
+				for _, msg := range msgs {
+					if !dispatch(msg) {
+						return nil
 					}
 				}
 			}
@@ -169,6 +266,97 @@ func (b *RedisBackend) Sub(ctx context.Context, name string, onchange OnChangeFu
 	}
 }
 
+// keepalive 对处理时间较长的消息定期重置空闲时间，避免被其他消费者认领
+func (b *RedisBackend) keepalive(ctx context.Context, stream, group, msgid string, options *SubOptions) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	interval := options.ClaimMinIdle / 2
+	if interval <= 0 {
+		return cancel
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// XCLAIM JUSTID 不会增加投递次数
+				b.cli.XClaimJustID(ctx, &redis.XClaimArgs{
+					Stream:   stream,
+					Group:    group,
+					Consumer: options.Consumer,
+					Messages: []string{msgid},
+				})
+			}
+		}
+	}()
+	return cancel
+}
+
+// claimStale 认领超过 ClaimMinIdle 未确认的消息，包括已经不存在的消费者的消息
+// https://redis.io/commands/xautoclaim
+func (b *RedisBackend) claimStale(ctx context.Context, name, group string, options *SubOptions) ([]redis.XMessage, error) {
+	claimed := []redis.XMessage{}
+	start := "0-0"
+	for {
+		msgs, next, err := b.cli.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   b.steamprefix + name,
+			Group:    group,
+			Consumer: options.Consumer,
+			MinIdle:  options.ClaimMinIdle,
+			Start:    start,
+			Count:    100,
+		}).Result()
+		if err != nil {
+			return claimed, err
+		}
+		msgs, err = b.filterPoison(ctx, name, group, msgs, options)
+		if err != nil {
+			return claimed, err
+		}
+		claimed = append(claimed, msgs...)
+		if next == "" || next == "0-0" {
+			return claimed, nil
+		}
+		start = next
+	}
+}
+
+// filterPoison 将投递次数超过 MaxDeliveries 的消息转移至死信队列，返回剩余的消息
+func (b *RedisBackend) filterPoison(ctx context.Context, name, group string, msgs []redis.XMessage, options *SubOptions) ([]redis.XMessage, error) {
+	if options.MaxDeliveries <= 0 {
+		return msgs, nil
+	}
+	stream := b.steamprefix + name
+	remain := make([]redis.XMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		pending, err := b.cli.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: stream,
+			Group:  group,
+			Start:  msg.ID,
+			End:    msg.ID,
+			Count:  1,
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(pending) == 0 {
+			// 已经被确认
+			continue
+		}
+		if pending[0].RetryCount <= options.MaxDeliveries {
+			remain = append(remain, msg)
+			continue
+		}
+		log.FromContextOrDiscard(ctx).Info("move message to dead letter queue", "stream", stream, "id", msg.ID, "deliveries", pending[0].RetryCount)
+		if err := b.deadLetter(ctx, name, group, msg, pending[0]); err != nil {
+			return nil, err
+		}
+	}
+	return remain, nil
+}
+
 func (b *RedisBackend) Pub(ctx context.Context, name string, key string, val []byte) error {
 	keyprefix := b.steamprefix + name
 	return b.cli.XAdd(ctx, &redis.XAddArgs{
@@ -180,7 +368,12 @@ func (b *RedisBackend) Pub(ctx context.Context, name string, key string, val []b
 // kv存储
 func (b *RedisBackend) Put(ctx context.Context, key string, val []byte, ttl ...time.Duration) error {
 	prefixedKey := b.kvprefix + key
-	set := b.cli.Set(ctx, prefixedKey, val, 0)
+	var expiration time.Duration
+	if len(ttl) > 0 {
+		expiration = ttl[0]
+	}
+	// expiration 为 0 时不过期
+	set := b.cli.Set(ctx, prefixedKey, val, expiration)
 	return set.Err()
 }
 
@@ -195,25 +388,41 @@ func (b *RedisBackend) Get(ctx context.Context, key string) ([]byte, error) {
 	return get.Bytes()
 }
 
+// List 使用 SCAN 遍历所有匹配的 key，每一页使用 MGET 批量获取
 func (b *RedisBackend) List(ctx context.Context, keyprefix string) (map[string][]byte, error) {
-	prefixedKey := b.kvprefix + keyprefix
-	iter := b.cli.Scan(ctx, 0, prefixedKey+"*", 0).Iterator()
+	match := escapeGlob(b.kvprefix+keyprefix) + "*"
 
 	list := map[string][]byte{}
-	for iter.Next(ctx) {
-		if err := iter.Err(); err != nil {
-			return nil, err
-		}
-		key := iter.Val()
-		val, err := b.cli.Get(ctx, key).Bytes()
+	var cursor uint64
+	for {
+		keys, next, err := b.cli.Scan(ctx, cursor, match, listScanCount).Result()
 		if err != nil {
 			return nil, err
 		}
-
-		itemkey := strings.TrimPrefix(key, prefixedKey)
-		list[itemkey] = val
+		if len(keys) > 0 {
+			vals, err := b.cli.MGet(ctx, keys...).Result()
+			if err != nil {
+				return nil, err
+			}
+			for i, val := range vals {
+				// key 在 SCAN 之后被删除或者过期
+				str, ok := val.(string)
+				if !ok {
+					continue
+				}
+				list[strings.TrimPrefix(keys[i], b.kvprefix)] = []byte(str)
+			}
+		}
+		if next == 0 {
+			return list, nil
+		}
+		cursor = next
 	}
-	return list, nil
+}
+
+// escapeGlob 转义 key 中的 glob 特殊字符
+func escapeGlob(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`).Replace(s)
 }
 
 func (b *RedisBackend) Watch(ctx context.Context, key string, onchange OnChangeFunc) error {
@@ -0,0 +1,224 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type backendFeatures struct {
+	watch bool // miniredis 不支持 keyspace notifications
+}
+
+// 所有 Backend 实现都需要通过的测试
+func TestBackendConformance(t *testing.T) {
+	backends := map[string]struct {
+		new      func(ctx context.Context, t *testing.T) Backend
+		features backendFeatures
+	}{
+		"inmemory": {
+			new:      func(ctx context.Context, t *testing.T) Backend { return NewInmemoryBackend(ctx) },
+			features: backendFeatures{watch: true},
+		},
+		"redis": {
+			new: func(ctx context.Context, t *testing.T) Backend { return NewRedisBackendFromClient(setupRedis(t)) },
+		},
+		"database": {
+			new:      func(ctx context.Context, t *testing.T) Backend { return setupDatabaseBackend(ctx, t) },
+			features: backendFeatures{watch: true},
+		},
+	}
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			testBackend(ctx, t, backend.new(ctx, t), backend.features)
+		})
+	}
+}
+
+func setupDatabaseBackend(ctx context.Context, t *testing.T) *DatabaseBackend {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "workflow.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sqlite 不支持并发写入
+	sqldb, _ := db.DB()
+	sqldb.SetMaxOpenConns(1)
+	backend, err := NewDatabaseBackend(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.pollInterval = 50 * time.Millisecond
+	return backend
+}
+
+func testBackend(ctx context.Context, t *testing.T, backend Backend, features backendFeatures) {
+	t.Run("kv", func(t *testing.T) {
+		if err := backend.Put(ctx, "kv/a", []byte("1")); err != nil {
+			t.Fatal(err)
+		}
+		if err := backend.Put(ctx, "kv/a", []byte("2"), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if val, err := backend.Get(ctx, "kv/a"); err != nil || string(val) != "2" {
+			t.Fatalf("Get() = %s, %v, want 2", val, err)
+		}
+		if err := backend.Del(ctx, "kv/a"); err != nil {
+			t.Fatal(err)
+		}
+		// 不存在的 key 可以返回空值或者错误
+		if val, _ := backend.Get(ctx, "kv/a"); len(val) != 0 {
+			t.Fatalf("Get() deleted key = %s", val)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		// 超过单次 SCAN 的数量
+		const count = 1200
+		for i := 0; i < count; i++ {
+			if err := backend.Put(ctx, fmt.Sprintf("list/%d", i), []byte("v")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, key := range []string{"listx/1", "_list/1", "a_b/1", "axb/1"} {
+			if err := backend.Put(ctx, key, []byte("v")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		kvs, err := backend.List(ctx, "list/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(kvs) != count {
+			t.Fatalf("List() got %d keys, want %d", len(kvs), count)
+		}
+		if string(kvs["list/7"]) != "v" {
+			t.Errorf("List() should return full keys, got %v", kvs["list/7"])
+		}
+		// 前缀中的特殊字符不能作为通配符
+		if kvs, _ := backend.List(ctx, "a_b/"); len(kvs) != 1 {
+			t.Errorf("List() with wildcard in prefix got %d keys, want 1", len(kvs))
+		}
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		if !features.watch {
+			t.Skip("watch not supported in test environment")
+		}
+		watchctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		changes := make(chan string, 10)
+		go backend.Watch(watchctx, "watch/", func(_ context.Context, key string, val []byte) error {
+			changes <- key + "=" + string(val)
+			return nil
+		})
+		// 重复写入直到 watcher 开始监听
+		if !waitFor(func() bool {
+			_ = backend.Put(ctx, "other/a", []byte("1"))
+			_ = backend.Put(ctx, "watch/a", []byte("1"))
+			select {
+			case change := <-changes:
+				if change != "watch/a=1" {
+					t.Errorf("unexpected change %s", change)
+				}
+				return true
+			default:
+				return false
+			}
+		}) {
+			t.Fatal("change not received")
+		}
+	})
+
+	t.Run("queue", func(t *testing.T) {
+		subctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		const count = 20
+		mu, received, ready := sync.Mutex{}, map[string]int{}, false
+		done := make(chan struct{})
+		onchange := func(_ context.Context, key string, _ []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			// 探测消息用于确认已经开始订阅
+			if key == "probe" {
+				ready = true
+				return nil
+			}
+			received[key]++
+			if len(received) == count {
+				close(done)
+			}
+			return nil
+		}
+		// 两个消费者共享队列中的消息
+		subs := sync.WaitGroup{}
+		for i := 0; i < 2; i++ {
+			subs.Add(1)
+			go func(consumer string) {
+				defer subs.Done()
+				_ = backend.Sub(subctx, "conformance", onchange, WithConcurrency(2), WithConsumer(consumer))
+			}(fmt.Sprintf("consumer-%d", i))
+		}
+		// 其他队列的消息不会被投递
+		go backend.Sub(subctx, "other", func(context.Context, string, []byte) error {
+			t.Error("received message of other queue")
+			return nil
+		})
+		if !waitFor(func() bool {
+			if err := backend.Pub(ctx, "conformance", "probe", []byte("v")); err != nil {
+				t.Fatal(err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			return ready
+		}) {
+			t.Fatal("subscriber not ready")
+		}
+		for i := 0; i < count; i++ {
+			if err := backend.Pub(ctx, "conformance", fmt.Sprintf("msg-%d", i), []byte("v")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			mu.Lock()
+			defer mu.Unlock()
+			t.Fatalf("received %d messages, want %d", len(received), count)
+		}
+		// 取消订阅后不会再收到消息
+		cancel()
+		subs.Wait()
+		mu.Lock()
+		defer mu.Unlock()
+		for key, n := range received {
+			if n != 1 {
+				t.Errorf("message %s delivered %d times", key, n)
+			}
+		}
+	})
+}
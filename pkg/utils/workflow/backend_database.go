@@ -0,0 +1,423 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workflow
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"kubegems.io/kubegems/pkg/log"
+)
+
+// 数据库存储的 Backend，用于没有 redis 的环境。
+// kv 存储于 workflow_kvs 表，每次修改都会记录至 workflow_events 表，Watch 通过轮询 workflow_events 实现。
+// 队列存储于 workflow_messages 表，消费者使用 SELECT ... FOR UPDATE SKIP LOCKED 获取消息并设置锁定时间，
+// 处理成功后删除，处理失败或者消费者异常退出时锁定时间过期后重新投递。
+const (
+	DefaultDatabasePollInterval = time.Second
+	// databaseEventRetention 变更记录的保留时间，Watch 仅需要最近的变更
+	databaseEventRetention = 10 * time.Minute
+	databaseCleanupPeriod  = time.Minute
+)
+
+type workflowKV struct {
+	Key       string     `gorm:"column:kv_key;type:varchar(512);primaryKey"`
+	Value     []byte     `gorm:"type:longblob"`
+	ExpireAt  *time.Time `gorm:"index"`
+	UpdatedAt time.Time
+}
+
+func (workflowKV) TableName() string {
+	return "workflow_kvs"
+}
+
+type workflowEvent struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement"`
+	Key       string    `gorm:"column:kv_key;type:varchar(512)"`
+	CreatedAt time.Time `gorm:"index"`
+}
+
+func (workflowEvent) TableName() string {
+	return "workflow_events"
+}
+
+type workflowMessage struct {
+	ID          uint64     `gorm:"primaryKey;autoIncrement"`
+	Queue       string     `gorm:"type:varchar(128);index:idx_workflow_messages_fetch,priority:1"`
+	Key         string     `gorm:"column:msg_key;type:varchar(512)"`
+	Value       []byte     `gorm:"type:longblob"`
+	Deliveries  int64      // 投递次数
+	Consumer    string     `gorm:"type:varchar(256)"`                            // 最后一次投递的消费者
+	LockedUntil *time.Time `gorm:"index:idx_workflow_messages_fetch,priority:3"` // 锁定期间不会被其他消费者获取
+	DeadAt      *time.Time `gorm:"index:idx_workflow_messages_fetch,priority:2"` // 不为空时为死信
+	CreatedAt   time.Time
+}
+
+func (workflowMessage) TableName() string {
+	return "workflow_messages"
+}
+
+var (
+	_ Backend         = &DatabaseBackend{}
+	_ Locker          = &DatabaseBackend{}
+	_ DeadLetterQueue = &DatabaseBackend{}
+	_ QueueInspector  = &DatabaseBackend{}
+)
+
+type DatabaseBackend struct {
+	db           *gorm.DB
+	pollInterval time.Duration
+}
+
+// NewDatabaseBackend 使用数据库作为 Backend，会自动创建所需的表
+func NewDatabaseBackend(ctx context.Context, db *gorm.DB) (*DatabaseBackend, error) {
+	if err := db.WithContext(ctx).AutoMigrate(&workflowKV{}, &workflowEvent{}, &workflowMessage{}); err != nil {
+		return nil, err
+	}
+	backend := &DatabaseBackend{db: db, pollInterval: DefaultDatabasePollInterval}
+	go backend.run(ctx)
+	return backend, nil
+}
+
+// run 定期清理过期的 key 以及变更记录
+func (b *DatabaseBackend) run(ctx context.Context) {
+	ticker := time.NewTicker(databaseCleanupPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := b.removeExpired(ctx); err != nil {
+				log.FromContextOrDiscard(ctx).Error(err, "remove expired workflow keys")
+			}
+		}
+	}
+}
+
+func (b *DatabaseBackend) removeExpired(ctx context.Context) error {
+	now := time.Now()
+	expired := []string{}
+	if err := b.db.WithContext(ctx).Model(&workflowKV{}).
+		Where("expire_at IS NOT NULL AND expire_at < ?", now).
+		Pluck("kv_key", &expired).Error; err != nil {
+		return err
+	}
+	for _, key := range expired {
+		if err := b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			ret := tx.Where("kv_key = ? AND expire_at < ?", key, now).Delete(&workflowKV{})
+			if ret.Error != nil || ret.RowsAffected == 0 {
+				return ret.Error
+			}
+			return tx.Create(&workflowEvent{Key: key}).Error
+		}); err != nil {
+			return err
+		}
+	}
+	return b.db.WithContext(ctx).Where("created_at < ?", now.Add(-databaseEventRetention)).Delete(&workflowEvent{}).Error
+}
+
+// kv存储
+func (b *DatabaseBackend) Put(ctx context.Context, key string, val []byte, ttl ...time.Duration) error {
+	item := &workflowKV{Key: key, Value: val}
+	// expiration 为 0 时不过期
+	if len(ttl) > 0 && ttl[0] > 0 {
+		expire := time.Now().Add(ttl[0])
+		item.ExpireAt = &expire
+	}
+	return b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(item).Error; err != nil {
+			return err
+		}
+		return tx.Create(&workflowEvent{Key: key}).Error
+	})
+}
+
+func (b *DatabaseBackend) Del(ctx context.Context, key string) error {
+	return b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("kv_key = ?", key).Delete(&workflowKV{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&workflowEvent{Key: key}).Error
+	})
+}
+
+func (b *DatabaseBackend) Get(ctx context.Context, key string) ([]byte, error) {
+	items := []workflowKV{}
+	if err := b.notExpired(b.db.WithContext(ctx)).Where("kv_key = ?", key).Limit(1).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+	return items[0].Value, nil
+}
+
+func (b *DatabaseBackend) List(ctx context.Context, keyprefix string) (map[string][]byte, error) {
+	items := []workflowKV{}
+	if err := b.notExpired(b.db.WithContext(ctx)).
+		Where("kv_key LIKE ? ESCAPE '!'", escapeLike(keyprefix)+"%").
+		Find(&items).Error; err != nil {
+		return nil, err
+	}
+	list := make(map[string][]byte, len(items))
+	for _, item := range items {
+		list[item.Key] = item.Value
+	}
+	return list, nil
+}
+
+func (b *DatabaseBackend) notExpired(tx *gorm.DB) *gorm.DB {
+	return tx.Where("expire_at IS NULL OR expire_at > ?", time.Now())
+}
+
+// Watch 轮询变更记录，key 被删除时 val 为空
+// 并发写入时自增 id 的提交顺序可能与分配顺序不一致，极少数情况下会遗漏变更
+func (b *DatabaseBackend) Watch(ctx context.Context, key string, onchange OnChangeFunc) error {
+	var last uint64
+	if err := b.db.WithContext(ctx).Model(&workflowEvent{}).Select("COALESCE(MAX(id), 0)").Scan(&last).Error; err != nil {
+		return err
+	}
+	ticker := time.NewTicker(b.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			events := []workflowEvent{}
+			if err := b.db.WithContext(ctx).
+				Where("id > ? AND kv_key LIKE ? ESCAPE '!'", last, escapeLike(key)+"%").
+				Order("id").Limit(100).Find(&events).Error; err != nil {
+				return err
+			}
+			for _, event := range events {
+				last = event.ID
+				val, err := b.Get(ctx, event.Key)
+				if err != nil {
+					continue
+				}
+				if err := onchange(ctx, event.Key, val); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// 队列
+func (b *DatabaseBackend) Pub(ctx context.Context, name string, key string, val []byte) error {
+	return b.db.WithContext(ctx).Create(&workflowMessage{Queue: name, Key: key, Value: val}).Error
+}
+
+// 这里的sub要求多个消费者共享同一个topic下的数据，且无重复。
+func (b *DatabaseBackend) Sub(ctx context.Context, name string, onchange OnChangeFunc, opts ...SubOption) error {
+	options := newSubOptions(opts...)
+
+	// 获取消息使用单独的 context，出错退出时不会取消正在处理的消息
+	loopctx, cancel := context.WithCancel(ctx)
+	wg := &sync.WaitGroup{}
+	defer func() {
+		cancel()
+		// 等待正在处理的消息完成，重新订阅后不会超出并发限制
+		wg.Wait()
+	}()
+
+	concurrentchan := make(chan struct{}, options.Concurrency)
+	for {
+		select {
+		case <-loopctx.Done():
+			return nil
+		case concurrentchan <- struct{}{}:
+		}
+		msg, err := b.fetch(loopctx, name, options)
+		if err != nil {
+			<-concurrentchan
+			if loopctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if msg == nil {
+			<-concurrentchan
+			select {
+			case <-loopctx.Done():
+				return nil
+			case <-time.After(b.pollInterval):
+			}
+			continue
+		}
+		wg.Add(1)
+		go func(msg *workflowMessage) {
+			defer wg.Done()
+			defer func() { <-concurrentchan }()
+			stop := b.keepalive(ctx, msg.ID, options)
+			err := onchange(ctx, msg.Key, msg.Value)
+			stop()
+			if err == nil || options.AutoACK {
+				// ack，退出时已经处理完成的消息同样需要确认，否则会被重新投递
+				b.db.WithContext(context.WithoutCancel(ctx)).Delete(&workflowMessage{}, msg.ID)
+			}
+		}(msg)
+	}
+}
+
+// fetch 获取一条未被锁定的消息并锁定，投递次数超过 MaxDeliveries 的消息转为死信
+func (b *DatabaseBackend) fetch(ctx context.Context, name string, options *SubOptions) (*workflowMessage, error) {
+	for {
+		var msg *workflowMessage
+		dead := false
+		err := b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+			msgs := []workflowMessage{}
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("queue = ? AND dead_at IS NULL AND (locked_until IS NULL OR locked_until < ?)", name, now).
+				Order("id").Limit(1).Find(&msgs).Error; err != nil {
+				return err
+			}
+			if len(msgs) == 0 {
+				return nil
+			}
+			msg = &msgs[0]
+			msg.Deliveries++
+			msg.Consumer = options.Consumer
+			updates := map[string]interface{}{"deliveries": msg.Deliveries, "consumer": msg.Consumer}
+			if options.MaxDeliveries > 0 && msg.Deliveries > options.MaxDeliveries {
+				dead = true
+				updates["dead_at"] = now
+			} else {
+				updates["locked_until"] = now.Add(options.ClaimMinIdle)
+			}
+			return tx.Model(msg).Updates(updates).Error
+		})
+		if err != nil || !dead {
+			return msg, err
+		}
+		log.FromContextOrDiscard(ctx).Info("move message to dead letter queue", "queue", name, "id", msg.ID, "deliveries", msg.Deliveries)
+	}
+}
+
+// keepalive 对处理时间较长的消息定期延长锁定时间，避免被其他消费者获取
+func (b *DatabaseBackend) keepalive(ctx context.Context, id uint64, options *SubOptions) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	interval := options.ClaimMinIdle / 2
+	if interval <= 0 {
+		return cancel
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				b.db.WithContext(ctx).Model(&workflowMessage{ID: id}).Update("locked_until", time.Now().Add(options.ClaimMinIdle))
+			}
+		}
+	}()
+	return cancel
+}
+
+func (b *DatabaseBackend) QueueDepth(ctx context.Context, name string) (QueueDepth, error) {
+	now := time.Now()
+	depth := QueueDepth{}
+	queue := b.db.WithContext(ctx).Model(&workflowMessage{}).Where("queue = ? AND dead_at IS NULL", name)
+	if err := queue.Session(&gorm.Session{}).Where("locked_until IS NULL OR locked_until < ?", now).Count(&depth.Waiting).Error; err != nil {
+		return depth, err
+	}
+	if err := queue.Session(&gorm.Session{}).Where("locked_until >= ?", now).Count(&depth.Pending).Error; err != nil {
+		return depth, err
+	}
+	return depth, nil
+}
+
+func (b *DatabaseBackend) ListDeadLetters(ctx context.Context, name string) ([]DeadLetter, error) {
+	msgs := []workflowMessage{}
+	if err := b.deadLetters(ctx, name, nil).Order("id").Find(&msgs).Error; err != nil {
+		return nil, err
+	}
+	list := make([]DeadLetter, 0, len(msgs))
+	for _, msg := range msgs {
+		id := strconv.FormatUint(msg.ID, 10)
+		list = append(list, DeadLetter{
+			ID:         id,
+			Queue:      msg.Queue,
+			MessageID:  id,
+			Key:        msg.Key,
+			Value:      string(msg.Value),
+			Deliveries: msg.Deliveries,
+			Consumer:   msg.Consumer,
+			Timestamp:  *msg.DeadAt,
+		})
+	}
+	return list, nil
+}
+
+func (b *DatabaseBackend) ReplayDeadLetters(ctx context.Context, name string, ids ...string) error {
+	return b.deadLetters(ctx, name, ids).Updates(map[string]interface{}{
+		"dead_at":      nil,
+		"locked_until": nil,
+		"deliveries":   0,
+	}).Error
+}
+
+func (b *DatabaseBackend) PurgeDeadLetters(ctx context.Context, name string, ids ...string) error {
+	return b.deadLetters(ctx, name, ids).Delete(&workflowMessage{}).Error
+}
+
+func (b *DatabaseBackend) deadLetters(ctx context.Context, name string, ids []string) *gorm.DB {
+	tx := b.db.WithContext(ctx).Model(&workflowMessage{}).Where("queue = ? AND dead_at IS NOT NULL", name)
+	if len(ids) > 0 {
+		tx = tx.Where("id IN ?", ids)
+	}
+	return tx
+}
+
+func (b *DatabaseBackend) TryLock(ctx context.Context, key, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	expire := now.Add(ttl)
+	// 续约或者接管已经过期的租约
+	ret := b.db.WithContext(ctx).Model(&workflowKV{}).
+		Where("kv_key = ? AND (value = ? OR (expire_at IS NOT NULL AND expire_at < ?))", key, []byte(holder), now).
+		Updates(map[string]interface{}{"value": []byte(holder), "expire_at": expire})
+	if ret.Error != nil {
+		return false, ret.Error
+	}
+	if ret.RowsAffected > 0 {
+		return true, nil
+	}
+	// 并发创建时仅有一个成功
+	ret = b.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&workflowKV{Key: key, Value: []byte(holder), ExpireAt: &expire})
+	if ret.Error != nil {
+		return false, ret.Error
+	}
+	return ret.RowsAffected > 0, nil
+}
+
+func (b *DatabaseBackend) Unlock(ctx context.Context, key, holder string) error {
+	return b.db.WithContext(ctx).Where("kv_key = ? AND value = ?", key, []byte(holder)).Delete(&workflowKV{}).Error
+}
+
+// escapeLike 转义 LIKE 中的通配符，使用 '!' 作为转义字符以兼容不同的数据库
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
@@ -35,16 +35,32 @@ type kv struct {
 	expireTime time.Time
 }
 
+// expired 未设置过期时间的 key 不会过期，与 redis 行为一致
+func (v kv) expired(now time.Time) bool {
+	return !v.expireTime.IsZero() && v.expireTime.Before(now)
+}
+
 type kvwatcher struct {
 	key string
 	fn  OnChangeFunc
 }
 
+type submsg struct {
+	queue string
+	key   string
+	val   []byte
+}
+
+type subscriber struct {
+	queue string
+	fn    OnChangeFunc
+}
+
 func NewInmemoryBackend(ctx context.Context) *InmemoryBackend {
 	backend := &InmemoryBackend{
 		db:         make(map[string]kv),
-		subeventch: make(chan kv, 64),
-		subs:       make(map[string]OnChangeFunc),
+		subeventch: make(chan submsg, 64),
+		subs:       make(map[string]subscriber),
 		watchch:    make(chan kv, 64),
 		watchers:   make(map[string]kvwatcher),
 	}
@@ -58,8 +74,8 @@ type InmemoryBackend struct {
 	dblock sync.RWMutex
 
 	sublock    sync.RWMutex
-	subs       map[string]OnChangeFunc
-	subeventch chan kv
+	subs       map[string]subscriber
+	subeventch chan submsg
 
 	watchch   chan kv
 	watchlock sync.RWMutex
@@ -79,7 +95,13 @@ func (t *InmemoryBackend) run(ctx context.Context) error {
 				case <-ctx.Done():
 					return
 				case kv := <-t.watchch:
+					t.watchlock.RLock()
+					watchers := make([]kvwatcher, 0, len(t.watchers))
 					for _, watcher := range t.watchers {
+						watchers = append(watchers, watcher)
+					}
+					t.watchlock.RUnlock()
+					for _, watcher := range watchers {
 						if strings.HasPrefix(kv.key, watcher.key) {
 							log.V(5).Info("watcher nofity", "key", kv.key)
 							watcher.fn(ctx, kv.key, kv.val)
@@ -95,10 +117,21 @@ func (t *InmemoryBackend) run(ctx context.Context) error {
 				select {
 				case <-ctx.Done():
 					return
-				case kv := <-t.subeventch:
-					for _, onchange := range t.subs {
-						log.V(5).Info("subscriber nofity", "key", kv.key)
-						onchange(ctx, kv.key, kv.val)
+				case msg := <-t.subeventch:
+					// 每条消息仅投递给队列的一个订阅者
+					// 订阅者在并发已满时会阻塞，不能在持有锁时调用，否则订阅者无法退出
+					var fn OnChangeFunc
+					t.sublock.RLock()
+					for _, sub := range t.subs {
+						if sub.queue == msg.queue {
+							fn = sub.fn
+							break
+						}
+					}
+					t.sublock.RUnlock()
+					if fn != nil {
+						log.V(5).Info("subscriber nofity", "key", msg.key)
+						fn(ctx, msg.key, msg.val)
 					}
 				}
 			}
@@ -129,7 +162,7 @@ func (t *InmemoryBackend) removeExpired(ctx context.Context) {
 
 	now := time.Now()
 	for k, v := range t.db {
-		if v.expireTime.Before(now) {
+		if v.expired(now) {
 			log.Info("remove expire", "key", k)
 			delete(t.db, k)
 			t.event(kv{key: k})
@@ -160,7 +193,10 @@ func (t *InmemoryBackend) Get(ctx context.Context, key string) ([]byte, error) {
 	logr.FromContextOrDiscard(ctx).V(5).Info("get", "key", key)
 	t.dblock.RLock()
 	defer t.dblock.RUnlock()
-	return t.db[key].val, nil
+	if kv, ok := t.db[key]; ok && !kv.expired(time.Now()) {
+		return kv.val, nil
+	}
+	return nil, nil
 }
 
 // List implements Backend.
@@ -170,8 +206,9 @@ func (t *InmemoryBackend) List(ctx context.Context, keyprefix string) (map[strin
 
 	t.dblock.RLock()
 	defer t.dblock.RUnlock()
+	now := time.Now()
 	for k, v := range t.db {
-		if strings.HasPrefix(k, keyprefix) {
+		if strings.HasPrefix(k, keyprefix) && !v.expired(now) {
 			ret[k] = v.val
 		}
 	}
@@ -182,7 +219,7 @@ func (t *InmemoryBackend) List(ctx context.Context, keyprefix string) (map[strin
 func (t *InmemoryBackend) Pub(ctx context.Context, name string, key string, val []byte) error {
 	logr.FromContextOrDiscard(ctx).V(5).Info("pub", "name", name, "key", key, "val", string(val))
 	select {
-	case t.subeventch <- kv{key: key, val: val}:
+	case t.subeventch <- submsg{queue: name, key: key, val: val}:
 	case <-ctx.Done():
 	default:
 		return fmt.Errorf("subevent channel full")
@@ -198,7 +235,7 @@ func (t *InmemoryBackend) Put(ctx context.Context, key string, val []byte, ttl .
 		val:        val,
 		createTime: time.Now(),
 	}
-	if len(ttl) > 0 {
+	if len(ttl) > 0 && ttl[0] > 0 {
 		kv.expireTime = kv.createTime.Add(ttl[0])
 	}
 	t.dblock.Lock()
@@ -211,17 +248,14 @@ func (t *InmemoryBackend) Put(ctx context.Context, key string, val []byte, ttl .
 
 // 这里的sub要求多个消费者共享同一个topic下的数据，且无重复。
 func (t *InmemoryBackend) Sub(ctx context.Context, name string, onchange OnChangeFunc, opts ...SubOption) error {
-	options := &SubOptions{Concurrency: 1}
-	for _, opt := range opts {
-		opt(options)
-	}
+	options := newSubOptions(opts...)
 	uid := uuid.New().String()
 	logr.FromContextOrDiscard(ctx).V(5).Info("sub", "name", name, "uid", uid, "concurrency", options.Concurrency)
 
 	concurrency := make(chan struct{}, options.Concurrency)
 
 	t.sublock.Lock()
-	t.subs[uid] = func(ctx context.Context, key string, val []byte) error {
+	t.subs[uid] = subscriber{queue: name, fn: func(ctx context.Context, key string, val []byte) error {
 		concurrency <- struct{}{}
 		go func() {
 			defer func() {
@@ -230,7 +264,7 @@ func (t *InmemoryBackend) Sub(ctx context.Context, name string, onchange OnChang
 			onchange(ctx, key, val)
 		}()
 		return nil
-	}
+	}}
 	t.sublock.Unlock()
 	defer func() {
 		logr.FromContextOrDiscard(ctx).V(5).Info("unsub", "name", name, "uid", uid)
@@ -18,7 +18,9 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/go-redis/redis/v8"
 )
 
@@ -68,3 +70,91 @@ func TestRedisBackend_Sub(t *testing.T) {
 		})
 	}
 }
+
+func TestRedisBackend_Sub_waitHandlers(t *testing.T) {
+	server := miniredis.RunT(t)
+	b := NewRedisBackendFromClient(redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1}))
+	if err := b.Pub(context.Background(), "test", "key", []byte("val")); err != nil {
+		t.Fatal(err)
+	}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	handlererr := make(chan error, 1)
+	onchange := func(ctx context.Context, _ string, _ []byte) error {
+		close(started)
+		<-release
+		handlererr <- ctx.Err()
+		return nil
+	}
+	suberr := make(chan error, 1)
+	go func() {
+		suberr <- b.Sub(context.Background(), "test", onchange)
+	}()
+	<-started
+
+	// 读取消息出错退出时，需要等待正在处理的消息完成
+	server.Close()
+	select {
+	case err := <-suberr:
+		t.Fatalf("Sub() returned before handler finished: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	close(release)
+	if err := <-handlererr; err != nil {
+		t.Errorf("handler context cancelled: %v", err)
+	}
+	select {
+	case err := <-suberr:
+		if err == nil {
+			t.Errorf("Sub() should return the read error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Sub() not returned")
+	}
+}
+
+func TestInmemoryBackend_Sub_unsubscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := NewInmemoryBackend(ctx)
+
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	defer close(release)
+	subctx, unsub := context.WithCancel(ctx)
+	suberr := make(chan error, 1)
+	go func() {
+		suberr <- b.Sub(subctx, "test", func(context.Context, string, []byte) error {
+			started <- struct{}{}
+			<-release
+			return nil
+		}, WithConcurrency(1))
+	}()
+	if !waitFor(func() bool {
+		b.sublock.RLock()
+		defer b.sublock.RUnlock()
+		return len(b.subs) > 0
+	}) {
+		t.Fatal("subscriber not ready")
+	}
+	// 第二条消息投递时并发已满
+	for _, val := range []string{"a", "b"} {
+		if err := b.Pub(ctx, "test", "key", []byte(val)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler not started")
+	}
+	if !waitFor(func() bool { return len(b.subeventch) == 0 }) {
+		t.Fatal("second message not delivered")
+	}
+
+	unsub()
+	select {
+	case <-suberr:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Sub() blocked while delivering to a busy subscriber")
+	}
+}
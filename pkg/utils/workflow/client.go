@@ -18,7 +18,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"path"
+	"fmt"
 	"sort"
 
 	"github.com/google/uuid"
@@ -30,14 +30,53 @@ type Client interface {
 	ListTasks(ctx context.Context, group, name string) ([]Task, error)
 	RemoveTask(ctx context.Context, group, name string, uid string) error
 	WatchTasks(ctx context.Context, group, name string, onchange func(ctx context.Context, task *Task) error) error
+	// CancelTask 取消任务，正在执行的 step 会被中断
+	CancelTask(ctx context.Context, group, name string, uid string) error
+	// PauseTask 暂停任务，正在执行的 step 执行完成后暂停
+	PauseTask(ctx context.Context, group, name string, uid string) error
+	// ResumeTask 恢复暂停的任务
+	ResumeTask(ctx context.Context, group, name string, uid string) error
+	// ListTaskHistory 查询已经归档的历史任务
+	ListTaskHistory(ctx context.Context, opts HistoryListOptions) (*TaskHistoryList, error)
+	// ListDeadLetters 查询超过最大投递次数的任务消息
+	ListDeadLetters(ctx context.Context) ([]DeadLetter, error)
+	// ReplayDeadLetters 重新投递死信消息，ids 为空时重新投递全部
+	ReplayDeadLetters(ctx context.Context, ids ...string) error
+	// PurgeDeadLetters 删除死信消息，ids 为空时删除全部
+	PurgeDeadLetters(ctx context.Context, ids ...string) error
+	// ListFunctions 查询已注册的函数及其参数描述
+	ListFunctions(ctx context.Context) (*FunctionList, error)
 }
 
 type DefaultClient struct {
-	backend Backend
+	backend   Backend
+	history   TaskHistory
+	registry  *FunctionRegistry
+	retention RetentionPolicy
 }
 
-func NewClientFromBackend(backend Backend) Client {
+type ClientOption func(c *DefaultClient)
+
+// WithTaskHistory 设置历史任务存储
+func WithTaskHistory(history TaskHistory) ClientOption {
+	return func(c *DefaultClient) { c.history = history }
+}
+
+// WithFunctionRegistry 设置已注册的函数，提交任务时校验 step 的函数以及参数
+func WithFunctionRegistry(registry *FunctionRegistry) ClientOption {
+	return func(c *DefaultClient) { c.registry = registry }
+}
+
+// WithTaskRetention 设置任务的保留时间，需要与 server 的 RetentionPolicy 一致
+func WithTaskRetention(policy RetentionPolicy) ClientOption {
+	return func(c *DefaultClient) { c.retention = policy }
+}
+
+func NewClientFromBackend(backend Backend, options ...ClientOption) Client {
 	cli := &DefaultClient{backend: backend}
+	for _, opt := range options {
+		opt(cli)
+	}
 	return cli
 }
 
@@ -45,6 +84,11 @@ func (c *DefaultClient) SubmitTask(ctx context.Context, task Task) error {
 	if task.Name == "" {
 		return errors.New("empty task name")
 	}
+	if c.registry != nil {
+		if err := c.registry.Validate(task); err != nil {
+			return err
+		}
+	}
 	task.CreationTimestamp = metav1.Now()
 	if task.UID == "" {
 		task.UID = uuid.New().String()
@@ -52,16 +96,18 @@ func (c *DefaultClient) SubmitTask(ctx context.Context, task Task) error {
 	if task.Status == nil {
 		task.Status = &TaskStatus{Status: TaskStatusPending}
 	}
+	injectTraceContext(ctx, &task)
 	content, err := json.Marshal(task)
 	if err != nil {
 		return err
 	}
 
-	taskjkey := path.Join(task.Group, task.Name, task.UID)
-	if err := c.backend.Put(ctx, taskjkey, content); err != nil {
+	// 与 server 更新任务时使用相同的 TTL
+	taskjkey := taskKeyOf(task.Group, task.Name, task.UID)
+	if err := c.backend.Put(ctx, taskjkey, content, c.retention.taskTTL(task.Group, task.Status)); err != nil {
 		return err
 	}
-	return c.backend.Pub(ctx, "submit", "", content)
+	return c.backend.Pub(ctx, taskQueue, "", content)
 }
 
 func (c *DefaultClient) ListTasks(ctx context.Context, group, name string) ([]Task, error) {
@@ -76,7 +122,10 @@ func (c *DefaultClient) ListTasks(ctx context.Context, group, name string) ([]Ta
 	}
 
 	list := make([]Task, 0, len(kvs))
-	for _, v := range kvs {
+	for k, v := range kvs {
+		if isInternalKey(k) {
+			continue
+		}
 		task := Task{}
 		_ = json.Unmarshal(v, &task)
 		list = append(list, task)
@@ -90,21 +139,139 @@ func (c *DefaultClient) ListTasks(ctx context.Context, group, name string) ([]Ta
 }
 
 func (c *DefaultClient) RemoveTask(ctx context.Context, group, name string, uid string) error {
-	keyprefix := path.Join(group, name, uid)
+	keyprefix := taskKeyOf(group, name, uid)
 	return c.backend.Del(ctx, keyprefix)
 }
 
+func (c *DefaultClient) ListTaskHistory(ctx context.Context, opts HistoryListOptions) (*TaskHistoryList, error) {
+	if c.history == nil {
+		return nil, ErrTaskHistoryNotConfigured
+	}
+	return c.history.ListTaskHistory(ctx, opts)
+}
+
+func (c *DefaultClient) ListDeadLetters(ctx context.Context) ([]DeadLetter, error) {
+	dlq, ok := c.backend.(DeadLetterQueue)
+	if !ok {
+		return nil, ErrDeadLetterNotSupported
+	}
+	return dlq.ListDeadLetters(ctx, taskQueue)
+}
+
+func (c *DefaultClient) ReplayDeadLetters(ctx context.Context, ids ...string) error {
+	dlq, ok := c.backend.(DeadLetterQueue)
+	if !ok {
+		return ErrDeadLetterNotSupported
+	}
+	return dlq.ReplayDeadLetters(ctx, taskQueue, ids...)
+}
+
+func (c *DefaultClient) PurgeDeadLetters(ctx context.Context, ids ...string) error {
+	dlq, ok := c.backend.(DeadLetterQueue)
+	if !ok {
+		return ErrDeadLetterNotSupported
+	}
+	return dlq.PurgeDeadLetters(ctx, taskQueue, ids...)
+}
+
+func (c *DefaultClient) ListFunctions(ctx context.Context) (*FunctionList, error) {
+	if c.registry == nil {
+		return nil, ErrFunctionRegistryNotConfigured
+	}
+	return c.registry.Functions(), nil
+}
+
+func (c *DefaultClient) CancelTask(ctx context.Context, group, name string, uid string) error {
+	task, err := c.getTask(ctx, group, name, uid)
+	if err != nil {
+		return err
+	}
+	switch {
+	case task.Status.Status.Finished():
+		return fmt.Errorf("task %s already finished", uid)
+	case task.Status.Status == TaskStatusPaused:
+		// 暂停的任务不在队列中，直接标记为取消
+		task.Status.Status = TaskStatusCancelled
+		task.Status.FinishTimestamp = metav1.Now()
+		task.Status.Message = ErrTaskCancelled.Error()
+		return c.putTask(ctx, task)
+	}
+	return putControl(ctx, c.backend, group, name, uid, TaskActionCancel, c.retention.TTLOf(group))
+}
+
+func (c *DefaultClient) PauseTask(ctx context.Context, group, name string, uid string) error {
+	task, err := c.getTask(ctx, group, name, uid)
+	if err != nil {
+		return err
+	}
+	switch {
+	case task.Status.Status.Finished():
+		return fmt.Errorf("task %s already finished", uid)
+	case task.Status.Status == TaskStatusPaused:
+		return nil
+	}
+	return putControl(ctx, c.backend, group, name, uid, TaskActionPause, c.retention.TTLOf(group))
+}
+
+func (c *DefaultClient) ResumeTask(ctx context.Context, group, name string, uid string) error {
+	// 暂停指令还未生效，撤销即可
+	if getControl(ctx, c.backend, group, name, uid) == TaskActionPause {
+		return c.backend.Del(ctx, controlKeyOf(group, name, uid))
+	}
+	task, err := c.getTask(ctx, group, name, uid)
+	if err != nil {
+		return err
+	}
+	if task.Status.Status != TaskStatusPaused {
+		return fmt.Errorf("task %s is not paused", uid)
+	}
+	task.Status.Status = TaskStatusRunning
+	if err := c.putTask(ctx, task); err != nil {
+		return err
+	}
+	content, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	// 重新进入队列，从暂停处继续执行
+	return c.backend.Pub(ctx, taskQueue, "", content)
+}
+
+// 使用 jsonArgsTask 读写，避免丢失仅 server 使用的字段
+func (c *DefaultClient) getTask(ctx context.Context, group, name string, uid string) (*jsonArgsTask, error) {
+	content, err := c.backend.Get(ctx, taskKeyOf(group, name, uid))
+	if err != nil || len(content) == 0 {
+		return nil, fmt.Errorf("task %s not found", uid)
+	}
+	task := &jsonArgsTask{}
+	if err := json.Unmarshal(content, task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+func (c *DefaultClient) putTask(ctx context.Context, task *jsonArgsTask) error {
+	content, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	return c.backend.Put(ctx, taskKeyOf(task.Group, task.Name, task.UID), content, c.retention.taskTTL(task.Group, &task.Status))
+}
+
 func (c *DefaultClient) WatchTasks(ctx context.Context, group, name string, onchange func(ctx context.Context, task *Task) error) error {
 	keyprefix := group + "/" + name
 	if group == "" && name == "" {
 		keyprefix = ""
 	}
 
-	return c.backend.Watch(ctx, keyprefix, func(ctx context.Context, _ string, val []byte) error {
+	return c.backend.Watch(ctx, keyprefix, func(ctx context.Context, key string, val []byte) error {
 		if len(val) == 0 {
 			// is delete
 			return nil
 		}
+		if isInternalKey(key) {
+			return nil
+		}
 		task := &Task{}
 		if err := json.Unmarshal(val, task); err != nil {
 			return err
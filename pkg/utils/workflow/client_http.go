@@ -18,9 +18,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"kubegems.io/kubegems/pkg/log"
 	"kubegems.io/library/rest/request"
@@ -31,7 +34,10 @@ type RemoteClient struct {
 	client  *http.Client
 }
 
-var _ Client = &RemoteClient{}
+var (
+	_ Client      = &RemoteClient{}
+	_ CronManager = &RemoteClient{}
+)
 
 func NewDefaultRemoteClient() *RemoteClient {
 	return NewRemoteClient("http://kubegems-worker.kubegems")
@@ -58,9 +64,98 @@ func (r *RemoteClient) RemoveTask(ctx context.Context, group string, name string
 
 // SubmitTask implements Client.
 func (r *RemoteClient) SubmitTask(ctx context.Context, task Task) error {
+	injectTraceContext(ctx, &task)
 	return r.do(ctx, http.MethodPost, "/tasks", nil, task, nil)
 }
 
+// CancelTask implements Client.
+func (r *RemoteClient) CancelTask(ctx context.Context, group string, name string, uid string) error {
+	return r.do(ctx, http.MethodPost, "/tasks/cancel", nil, Task{Group: group, Name: name, UID: uid}, nil)
+}
+
+// PauseTask implements Client.
+func (r *RemoteClient) PauseTask(ctx context.Context, group string, name string, uid string) error {
+	return r.do(ctx, http.MethodPost, "/tasks/pause", nil, Task{Group: group, Name: name, UID: uid}, nil)
+}
+
+// ResumeTask implements Client.
+func (r *RemoteClient) ResumeTask(ctx context.Context, group string, name string, uid string) error {
+	return r.do(ctx, http.MethodPost, "/tasks/resume", nil, Task{Group: group, Name: name, UID: uid}, nil)
+}
+
+// ListTaskHistory implements Client.
+func (r *RemoteClient) ListTaskHistory(ctx context.Context, opts HistoryListOptions) (*TaskHistoryList, error) {
+	q := map[string]string{
+		"group": opts.Group,
+		"name":  opts.Name,
+		"page":  strconv.Itoa(opts.Page),
+		"size":  strconv.Itoa(opts.Size),
+	}
+	if !opts.Since.IsZero() {
+		q["since"] = opts.Since.Format(time.RFC3339)
+	}
+	if !opts.Until.IsZero() {
+		q["until"] = opts.Until.Format(time.RFC3339)
+	}
+	list := &TaskHistoryList{}
+	if err := r.do(ctx, http.MethodGet, "/tasks/history", q, nil, list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ListDeadLetters implements Client.
+func (r *RemoteClient) ListDeadLetters(ctx context.Context) ([]DeadLetter, error) {
+	var list []DeadLetter
+	if err := r.do(ctx, http.MethodGet, "/deadletters", nil, nil, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ReplayDeadLetters implements Client.
+func (r *RemoteClient) ReplayDeadLetters(ctx context.Context, ids ...string) error {
+	return r.do(ctx, http.MethodPost, "/deadletters/replay", nil, deadLetterIDs{IDs: ids}, nil)
+}
+
+// PurgeDeadLetters implements Client.
+func (r *RemoteClient) PurgeDeadLetters(ctx context.Context, ids ...string) error {
+	return r.do(ctx, http.MethodDelete, "/deadletters", nil, deadLetterIDs{IDs: ids}, nil)
+}
+
+// ListFunctions implements Client.
+func (r *RemoteClient) ListFunctions(ctx context.Context) (*FunctionList, error) {
+	list := &FunctionList{}
+	if err := r.do(ctx, http.MethodGet, "/functions", nil, nil, list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ListCronTasks implements CronManager.
+func (r *RemoteClient) ListCronTasks(ctx context.Context) ([]CronTask, error) {
+	var list []CronTask
+	if err := r.do(ctx, http.MethodGet, "/crontasks", nil, nil, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// PauseCronTask implements CronManager.
+func (r *RemoteClient) PauseCronTask(ctx context.Context, name string) error {
+	return r.do(ctx, http.MethodPost, "/crontasks/pause", nil, CronTask{Name: name}, nil)
+}
+
+// ResumeCronTask implements CronManager.
+func (r *RemoteClient) ResumeCronTask(ctx context.Context, name string) error {
+	return r.do(ctx, http.MethodPost, "/crontasks/resume", nil, CronTask{Name: name}, nil)
+}
+
+// TriggerCronTask implements CronManager.
+func (r *RemoteClient) TriggerCronTask(ctx context.Context, name string) error {
+	return r.do(ctx, http.MethodPost, "/crontasks/trigger", nil, CronTask{Name: name}, nil)
+}
+
 // WatchTasks implements Client.
 func (r *RemoteClient) WatchTasks(ctx context.Context, group string, name string, onchange func(ctx context.Context, task *Task) error) error {
 	q := map[string]string{"group": group, "name": name, "watch": "true"}
@@ -122,6 +217,10 @@ func (r *RemoteClient) do(ctx context.Context, method string, path string, queri
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		// 错误信息由 http.Error 写入 body
+		if msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096)); len(bytes.TrimSpace(msg)) > 0 {
+			return fmt.Errorf("request failed: %s: %s", resp.Status, bytes.TrimSpace(msg))
+		}
 		return fmt.Errorf("request failed: %s", resp.Status)
 	}
 	if into != nil {
@@ -132,6 +231,10 @@ func (r *RemoteClient) do(ctx context.Context, method string, path string, queri
 	return nil
 }
 
+type deadLetterIDs struct {
+	IDs []string `json:"ids,omitempty"`
+}
+
 type RemoteClientServer struct {
 	Client Client
 }
@@ -159,6 +262,51 @@ func (s *RemoteClientServer) Handler() http.Handler {
 			http.NotFound(w, r)
 		}
 	})
+	mux.HandleFunc("/tasks/history", s.history)
+	mux.HandleFunc("/tasks/cancel", s.control(s.Client.CancelTask))
+	mux.HandleFunc("/tasks/pause", s.control(s.Client.PauseTask))
+	mux.HandleFunc("/tasks/resume", s.control(s.Client.ResumeTask))
+	mux.HandleFunc("/deadletters", func(w http.ResponseWriter, r *http.Request) {
+		log.Info("request", "method", r.Method, "url", r.URL.String())
+		switch r.Method {
+		case http.MethodGet:
+			s.listDeadLetters(w, r)
+		case http.MethodDelete:
+			s.deadLetters(s.Client.PurgeDeadLetters)(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	mux.HandleFunc("/deadletters/replay", func(w http.ResponseWriter, r *http.Request) {
+		log.Info("request", "method", r.Method, "url", r.URL.String())
+		if r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		s.deadLetters(s.Client.ReplayDeadLetters)(w, r)
+	})
+	mux.HandleFunc("/functions", func(w http.ResponseWriter, r *http.Request) {
+		log.Info("request", "method", r.Method, "url", r.URL.String())
+		if r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		s.listFunctions(w, r)
+	})
+	// 定时任务管理
+	if cron, ok := s.Client.(CronManager); ok {
+		mux.HandleFunc("/crontasks", func(w http.ResponseWriter, r *http.Request) {
+			log.Info("request", "method", r.Method, "url", r.URL.String())
+			if r.Method != http.MethodGet {
+				http.NotFound(w, r)
+				return
+			}
+			s.listCronTasks(cron)(w, r)
+		})
+		mux.HandleFunc("/crontasks/pause", s.cronControl(cron.PauseCronTask))
+		mux.HandleFunc("/crontasks/resume", s.cronControl(cron.ResumeCronTask))
+		mux.HandleFunc("/crontasks/trigger", s.cronControl(cron.TriggerCronTask))
+	}
 	return mux
 }
 
@@ -169,6 +317,10 @@ func (s *RemoteClientServer) submit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err := s.Client.SubmitTask(r.Context(), task); err != nil {
+		if errors.Is(err, ErrInvalidArgs) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -202,6 +354,125 @@ func (s *RemoteClientServer) remove(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+func (s *RemoteClientServer) history(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts := HistoryListOptions{Group: q.Get("group"), Name: q.Get("name")}
+	opts.Page, _ = strconv.Atoi(q.Get("page"))
+	opts.Size, _ = strconv.Atoi(q.Get("size"))
+	for key, into := range map[string]*time.Time{"since": &opts.Since, "until": &opts.Until} {
+		if val := q.Get(key); val != "" {
+			t, err := time.Parse(time.RFC3339, val)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid %s: %s", key, err.Error()), http.StatusBadRequest)
+				return
+			}
+			*into = t
+		}
+	}
+	list, err := s.Client.ListTaskHistory(r.Context(), opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *RemoteClientServer) control(fn func(ctx context.Context, group, name, uid string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("request", "method", r.Method, "url", r.URL.String())
+		if r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		task := Task{}
+		if err := request.Body(r, &task); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := fn(r.Context(), task.Group, task.Name, task.UID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (s *RemoteClientServer) listDeadLetters(w http.ResponseWriter, r *http.Request) {
+	list, err := s.Client.ListDeadLetters(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *RemoteClientServer) deadLetters(fn func(ctx context.Context, ids ...string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body := deadLetterIDs{}
+		if err := request.Body(r, &body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := fn(r.Context(), body.IDs...); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (s *RemoteClientServer) listFunctions(w http.ResponseWriter, r *http.Request) {
+	list, err := s.Client.ListFunctions(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *RemoteClientServer) listCronTasks(cron CronManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := cron.ListCronTasks(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(list); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (s *RemoteClientServer) cronControl(fn func(ctx context.Context, name string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("request", "method", r.Method, "url", r.URL.String())
+		if r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		crontask := CronTask{}
+		if err := request.Body(r, &crontask); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := fn(r.Context(), crontask.Name); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
 func (s *RemoteClientServer) watch(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
 	group, name := q.Get("group"), q.Get("name")
@@ -0,0 +1,82 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workflow
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// values 返回 task 当前的运行时数据，用于 step 的条件判断以及参数引用
+// 结构为:
+//
+//	{
+//	  "addtionals": {"key": "value"},
+//	  "steps": {
+//	    "<step-name>": {"status": "Success", "message": "", "result": [...]}
+//	  }
+//	}
+//
+// step 名称重复时以先出现的为准
+func (t *jsonArgsTask) values() map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	steps := map[string]interface{}{}
+	var walk func([]*jsonArgsStep)
+	walk = func(list []*jsonArgsStep) {
+		for _, step := range list {
+			if _, ok := steps[step.Name]; !ok && step.Name != "" {
+				steps[step.Name] = map[string]interface{}{
+					"status":  string(step.Status.Status),
+					"message": step.Status.Message,
+					"result":  step.Status.Result,
+				}
+			}
+			walk(step.SubSteps)
+		}
+	}
+	walk(t.Steps)
+
+	addtionals := t.Addtionals
+	if addtionals == nil {
+		addtionals = map[string]string{}
+	}
+	return map[string]interface{}{
+		"addtionals": addtionals,
+		"steps":      steps,
+	}
+}
+
+// evaluateWhen 使用 go template 渲染条件表达式，渲染结果需要为 bool 值
+// 例如: {{ eq .steps.build.status "Success" }} 或 {{ eq (index .addtionals "type") "deploy" }}
+func evaluateWhen(when string, values map[string]interface{}) (bool, error) {
+	tpl, err := template.New("when").Option("missingkey=error").Parse(when)
+	if err != nil {
+		return false, fmt.Errorf("parse when condition: %w", err)
+	}
+	buf := &bytes.Buffer{}
+	if err := tpl.Execute(buf, values); err != nil {
+		return false, fmt.Errorf("evaluate when condition: %w", err)
+	}
+	ok, err := strconv.ParseBool(strings.TrimSpace(buf.String()))
+	if err != nil {
+		return false, fmt.Errorf("when condition result %q is not a bool", buf.String())
+	}
+	return ok, nil
+}
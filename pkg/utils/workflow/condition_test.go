@@ -0,0 +1,175 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEvaluateWhen(t *testing.T) {
+	task := &jsonArgsTask{
+		Addtionals: map[string]string{"type": "deploy"},
+		Steps: []*jsonArgsStep{
+			{Name: "build", Status: TaskStatus{Status: TaskStatusSuccess, Result: []interface{}{"v1.0.0"}}},
+			{Name: "group", SubSteps: []*jsonArgsStep{
+				{Name: "test", Status: TaskStatus{Status: TaskStatusError}},
+			}},
+		},
+	}
+	tests := []struct {
+		name    string
+		when    string
+		want    bool
+		wantErr bool
+	}{
+		{name: "status", when: `{{ eq .steps.build.status "Success" }}`, want: true},
+		{name: "substep status", when: `{{ eq .steps.test.status "Success" }}`, want: false},
+		{name: "result", when: `{{ eq (index .steps.build.result 0) "v1.0.0" }}`, want: true},
+		{name: "addtionals", when: `{{ eq .addtionals.type "deploy" }}`, want: true},
+		{name: "literal", when: `false`, want: false},
+		{name: "missing step", when: `{{ .steps.missing.status }}`, wantErr: true},
+		{name: "not bool", when: `{{ .addtionals.type }}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := evaluateWhen(tt.when, task.values())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("evaluateWhen() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("evaluateWhen() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_processParallel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := NewServerFromBackend(NewInmemoryBackend(ctx))
+	var calls int32
+	_ = s.Register("count", func() string {
+		atomic.AddInt32(&calls, 1)
+		return "ok"
+	})
+
+	content, _ := json.Marshal(Task{
+		Name: "parallel",
+		Steps: []Step{
+			{Name: "build", Function: "count"},
+			{
+				Name: "sync",
+				Mode: StepModeParallel,
+				SubSteps: []Step{
+					{Name: "sync-dev", Function: "count", SubSteps: []Step{{Name: "check-dev", Function: "count"}}},
+					{Name: "sync-test", Function: "count"},
+					{Name: "sync-prod", Function: "count", When: `{{ eq .addtionals.prod "true" }}`},
+				},
+			},
+			{Name: "notify", Function: "count", When: `{{ eq .steps.sync.status "Success" }}`},
+		},
+		Addtionals: map[string]string{"prod": "false"},
+	})
+	task := &jsonArgsTask{}
+	if err := json.Unmarshal(content, task); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; !s.process(ctx, task); i++ {
+		if i > 10 {
+			t.Fatal("task not finished")
+		}
+	}
+	if task.Status.Status != TaskStatusSuccess {
+		t.Errorf("task status = %v, want %v: %s", task.Status.Status, TaskStatusSuccess, task.Status.Message)
+	}
+	if got := atomic.LoadInt32(&calls); got != 5 {
+		t.Errorf("function calls = %v, want %v", got, 5)
+	}
+	if got := task.Steps[1].SubSteps[2].Status.Status; got != TaskStatusSkipped {
+		t.Errorf("skipped branch status = %v, want %v", got, TaskStatusSkipped)
+	}
+}
+
+func TestServer_processParallel_cancelOnFailure(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s := NewServerFromBackend(NewInmemoryBackend(ctx), WithParallelism(2))
+	var running, maxrunning int32
+	waiting := make(chan struct{}, 4)
+	_ = s.Register("wait", func(ctx context.Context) error {
+		waiting <- struct{}{}
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxrunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxrunning, max, n) {
+				break
+			}
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	// 与其他分支同时执行时失败
+	_ = s.Register("fail", func(ctx context.Context) error {
+		select {
+		case <-waiting:
+		case <-ctx.Done():
+		}
+		return errors.New("failed")
+	})
+
+	content, _ := json.Marshal(Task{
+		Name: "parallel",
+		Steps: []Step{
+			{
+				Name: "sync",
+				Mode: StepModeParallel,
+				SubSteps: []Step{
+					{Name: "wait-1", Function: "wait"},
+					{Name: "fail", Function: "fail"},
+					{Name: "wait-2", Function: "wait"},
+					{Name: "wait-3", Function: "wait"},
+				},
+			},
+		},
+	})
+	task := &jsonArgsTask{}
+	if err := json.Unmarshal(content, task); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; !s.process(ctx, task); i++ {
+		if i > 10 {
+			t.Fatal("task not finished")
+		}
+	}
+	if ctx.Err() != nil {
+		t.Fatal("branches not cancelled after failure")
+	}
+	if task.Status.Status != TaskStatusError {
+		t.Errorf("task status = %v, want %v", task.Status.Status, TaskStatusError)
+	}
+	if got := atomic.LoadInt32(&maxrunning); got > 2 {
+		t.Errorf("max running branches = %v, want <= 2", got)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kubegems.io/kubegems/pkg/log"
+)
+
+// 任务控制指令存储在 /{controlKeyPrefix}/{group}/{name}/{uid}
+// client 写入指令，server 通过 watch 接收指令并作用于正在运行的任务，
+// 对于队列中的任务，server 在每次消费任务时检查是否存在指令。
+// 指令的 TTL 与任务记录一致，任务结束时删除指令，避免排队时间较长的任务丢失指令。
+const controlKeyPrefix = "_control/"
+
+type TaskAction string
+
+const (
+	// TaskActionCancel 取消任务，正在执行的 step 会收到 context 取消
+	TaskActionCancel TaskAction = "Cancel"
+	// TaskActionPause 暂停任务，在当前 step 执行完成后暂停
+	TaskActionPause TaskAction = "Pause"
+	// TaskActionResume 恢复暂停的任务
+	TaskActionResume TaskAction = "Resume"
+)
+
+var ErrTaskCancelled = errors.New("task cancelled")
+
+type taskControl struct {
+	Action            TaskAction  `json:"action,omitempty"`
+	CreationTimestamp metav1.Time `json:"creationTimestamp,omitempty"`
+}
+
+func taskKeyOf(group, name, uid string) string {
+	return path.Join(group, name, uid)
+}
+
+func controlKeyOf(group, name, uid string) string {
+	return controlKeyPrefix + taskKeyOf(group, name, uid)
+}
+
+// isInternalKey 以 _ 开头的 key 用于存储控制指令、定时任务等内部数据，不是任务
+func isInternalKey(key string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(key, "/"), "_")
+}
+
+func putControl(ctx context.Context, backend Backend, group, name, uid string, action TaskAction, ttl time.Duration) error {
+	content, err := json.Marshal(taskControl{Action: action, CreationTimestamp: metav1.Now()})
+	if err != nil {
+		return err
+	}
+	return backend.Put(ctx, controlKeyOf(group, name, uid), content, ttl)
+}
+
+func getControl(ctx context.Context, backend Backend, group, name, uid string) TaskAction {
+	content, err := backend.Get(ctx, controlKeyOf(group, name, uid))
+	if err != nil || len(content) == 0 {
+		return ""
+	}
+	control := taskControl{}
+	if err := json.Unmarshal(content, &control); err != nil {
+		return ""
+	}
+	return control.Action
+}
+
+// watchControl 监听控制指令，取消在本实例上正在运行的任务
+func (s *Server) watchControl(ctx context.Context) error {
+	return s.backend.Watch(ctx, controlKeyPrefix, func(ctx context.Context, key string, val []byte) error {
+		if len(val) == 0 {
+			return nil
+		}
+		control := taskControl{}
+		if err := json.Unmarshal(val, &control); err != nil {
+			return nil
+		}
+		if control.Action != TaskActionCancel {
+			// 暂停在 step 之间进行，无需中断正在运行的 step
+			return nil
+		}
+		taskkey := strings.TrimPrefix(strings.TrimPrefix(key, "/"), controlKeyPrefix)
+		s.runninglock.Lock()
+		cancel, ok := s.running[taskkey]
+		s.runninglock.Unlock()
+		if ok {
+			log.FromContextOrDiscard(ctx).Info("cancel running task", "key", taskkey)
+			cancel(ErrTaskCancelled)
+		}
+		return nil
+	})
+}
+
+// withRunning 注册正在运行的任务，返回的 context 会在收到取消指令时被取消
+func (s *Server) withRunning(ctx context.Context, task *jsonArgsTask) (context.Context, func()) {
+	key := taskKeyOf(task.Group, task.Name, task.UID)
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	s.runninglock.Lock()
+	if s.running == nil {
+		s.running = map[string]context.CancelCauseFunc{}
+	}
+	s.running[key] = cancel
+	s.runninglock.Unlock()
+
+	return ctx, func() {
+		s.runninglock.Lock()
+		delete(s.running, key)
+		s.runninglock.Unlock()
+		cancel(nil)
+	}
+}
+
+// applyControl 在任务开始处理前检查控制指令，返回 true 表示任务已经被取消或者暂停，无需继续处理
+func (s *Server) applyControl(ctx context.Context, task *jsonArgsTask) bool {
+	var status TaskStatusCode
+	switch getControl(ctx, s.backend, task.Group, task.Name, task.UID) {
+	case TaskActionCancel:
+		status = TaskStatusCancelled
+	case TaskActionPause:
+		status = TaskStatusPaused
+	default:
+		return false
+	}
+	log.FromContextOrDiscard(ctx).Info("apply task control", "status", status)
+	task.Status.Status = status
+	if status == TaskStatusCancelled {
+		task.Status.FinishTimestamp = metav1.Now()
+		task.Status.Message = ErrTaskCancelled.Error()
+	}
+	_ = s.updateTask(ctx, task)
+	_ = s.backend.Del(ctx, controlKeyOf(task.Group, task.Name, task.UID))
+	if status == TaskStatusCancelled {
+		s.taskFinished(ctx, task)
+	}
+	return true
+}
+
+func isCancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrTaskCancelled)
+}
@@ -0,0 +1,157 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workflow
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// waitFor 轮询直到条件满足，超时返回 false
+func waitFor(cond func() bool) bool {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(10 * time.Second)
+	for !cond() {
+		select {
+		case <-ticker.C:
+		case <-timeout:
+			return false
+		}
+	}
+	return true
+}
+
+func waitTaskStatus(t *testing.T, cli Client, task Task, status TaskStatusCode) *Task {
+	t.Helper()
+	var found *Task
+	if !waitFor(func() bool {
+		tasks, err := cli.ListTasks(context.Background(), task.Group, task.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range tasks {
+			if tasks[i].UID == task.UID && tasks[i].Status != nil && tasks[i].Status.Status == status {
+				found = &tasks[i]
+				return true
+			}
+		}
+		return false
+	}) {
+		t.Fatalf("task %s not in status %s", task.UID, status)
+	}
+	return found
+}
+
+func setupControlServer(t *testing.T, funcs map[string]interface{}) Client {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	backend := NewInmemoryBackend(ctx)
+	s := NewServerFromBackend(backend)
+	for name, fun := range funcs {
+		if err := s.Register(name, fun); err != nil {
+			t.Fatal(err)
+		}
+	}
+	go s.Run(ctx)
+	// wait subscriber and control watcher ready
+	if !waitFor(func() bool {
+		backend.sublock.RLock()
+		defer backend.sublock.RUnlock()
+		backend.watchlock.RLock()
+		defer backend.watchlock.RUnlock()
+		return len(backend.subs) > 0 && len(backend.watchers) > 0
+	}) {
+		t.Fatal("server not ready")
+	}
+	return s.NewClient(ctx)
+}
+
+func TestClient_CancelTask(t *testing.T) {
+	started := make(chan struct{})
+	cli := setupControlServer(t, map[string]interface{}{
+		"block": func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+
+	task := Task{Group: "test", Name: "cancel", UID: "cancel-uid", Steps: []Step{{Name: "block", Function: "block"}}}
+	if err := cli.SubmitTask(context.Background(), task); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("step not started")
+	}
+	if err := cli.CancelTask(context.Background(), task.Group, task.Name, task.UID); err != nil {
+		t.Fatal(err)
+	}
+	cancelled := waitTaskStatus(t, cli, task, TaskStatusCancelled)
+	if got := cancelled.Steps[0].Status.Status; got != TaskStatusCancelled {
+		t.Errorf("step status = %v, want %v", got, TaskStatusCancelled)
+	}
+	// 任务结束后删除控制指令
+	backend := cli.(*DefaultClient).backend
+	if !waitFor(func() bool { return getControl(context.Background(), backend, task.Group, task.Name, task.UID) == "" }) {
+		t.Fatal("control should be removed after task finished")
+	}
+	if err := cli.CancelTask(context.Background(), task.Group, task.Name, task.UID); err == nil {
+		t.Errorf("cancel a finished task should return error")
+	}
+}
+
+func TestClient_PauseResumeTask(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	cli := setupControlServer(t, map[string]interface{}{
+		"wait": func() {
+			close(started)
+			<-release
+		},
+		"now": func() string {
+			return time.Now().String()
+		},
+	})
+
+	task := Task{
+		Group: "test", Name: "pause", UID: "pause-uid",
+		Steps: []Step{{Name: "wait", Function: "wait"}, {Name: "now", Function: "now"}},
+	}
+	if err := cli.SubmitTask(context.Background(), task); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := cli.PauseTask(context.Background(), task.Group, task.Name, task.UID); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+
+	paused := waitTaskStatus(t, cli, task, TaskStatusPaused)
+	if got := paused.Steps[0].Status.Status; got != TaskStatusSuccess {
+		t.Errorf("first step status = %v, want %v", got, TaskStatusSuccess)
+	}
+	if paused.Steps[1].Status != nil && paused.Steps[1].Status.Status != "" {
+		t.Errorf("second step should not run while paused, got %v", paused.Steps[1].Status.Status)
+	}
+
+	if err := cli.ResumeTask(context.Background(), task.Group, task.Name, task.UID); err != nil {
+		t.Fatal(err)
+	}
+	waitTaskStatus(t, cli, task, TaskStatusSuccess)
+}
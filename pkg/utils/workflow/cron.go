@@ -16,34 +16,343 @@ package workflow
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/robfig/cron/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"kubegems.io/kubegems/pkg/log"
 )
 
+// 定时任务存储在 Backend 中，所有实例都可以注册定时任务，
+// 通过租约选出一个实例作为 leader 负责触发，leader 退出后由其他实例接替。
+// leader 开始调度时删除未在本实例注册的定时任务。
+const (
+	cronKeyPrefix   = "_cron/tasks/"
+	cronLeaderKey   = "_cron/leader"
+	cronLeaseTTL    = 15 * time.Second
+	cronCheckPeriod = 5 * time.Second
+	// CronStartingDeadline 超过该时间仍未触发的执行视为错过
+	CronStartingDeadline = time.Minute
+	// maxCronCatchUpRuns 补偿执行时最多执行的次数
+	maxCronCatchUpRuns = 10
+)
+
+// MissedRunPolicy 定时任务错过执行时间(例如所有实例都不可用)后的处理策略
+type MissedRunPolicy string
+
+const (
+	// MissedRunSkip 跳过错过的执行，等待下一次执行时间
+	MissedRunSkip MissedRunPolicy = "Skip"
+	// MissedRunOnce 错过的执行合并为一次立即执行
+	MissedRunOnce MissedRunPolicy = "RunOnce"
+	// MissedRunCatchUp 每次错过的执行都补偿执行，最多 maxCronCatchUpRuns 次
+	MissedRunCatchUp MissedRunPolicy = "CatchUp"
+)
+
+type CronTask struct {
+	Name             string          `json:"name"` // {group}/{name}
+	Schedule         string          `json:"schedule"`
+	MissedRunPolicy  MissedRunPolicy `json:"missedRunPolicy,omitempty"`
+	Suspend          bool            `json:"suspend,omitempty"`
+	Task             Task            `json:"task"`
+	LastScheduleTime metav1.Time     `json:"lastScheduleTime,omitempty"`
+	NextScheduleTime metav1.Time     `json:"nextScheduleTime,omitempty"`
+}
+
+// CronManager 定时任务的管理接口
+type CronManager interface {
+	ListCronTasks(ctx context.Context) ([]CronTask, error)
+	// PauseCronTask 暂停定时任务，暂停期间的执行在恢复后不会补偿
+	PauseCronTask(ctx context.Context, name string) error
+	ResumeCronTask(ctx context.Context, name string) error
+	// TriggerCronTask 立即执行一次定时任务，不影响定时执行
+	TriggerCronTask(ctx context.Context, name string) error
+}
+
+type CronOption func(c *CronTask)
+
+func WithMissedRunPolicy(policy MissedRunPolicy) CronOption {
+	return func(c *CronTask) { c.MissedRunPolicy = policy }
+}
+
+var _ CronManager = &CronClient{}
+
 type CronClient struct {
 	Client
-	crontab *cron.Cron
+	backend Backend
+	holder  string
+
+	lock       sync.Mutex
+	registered map[string]struct{} // 本实例注册的定时任务
 }
 
-func NewCronSubmiter(client Client) *CronClient {
-	c := &CronClient{
-		Client:  client,
-		crontab: cron.New(),
+func NewCronSubmiter(client Client, backend Backend) *CronClient {
+	hostname, _ := os.Hostname()
+	return &CronClient{
+		Client:     client,
+		backend:    backend,
+		holder:     hostname + "-" + uuid.NewString(),
+		registered: map[string]struct{}{},
 	}
-	go c.crontab.Run()
-	return c
 }
 
-func (s *CronClient) SubmitCronTask(ctx context.Context, task Task, crontabexp string) error {
-	log := log.FromContextOrDiscard(ctx).WithValues("task", task, "cron", crontabexp)
+func cronKeyOf(name string) string {
+	return cronKeyPrefix + name
+}
+
+// SubmitCronTask 注册定时任务，已经存在的定时任务保留其暂停状态以及上次执行时间
+func (s *CronClient) SubmitCronTask(ctx context.Context, task Task, crontabexp string, options ...CronOption) error {
+	log := log.FromContextOrDiscard(ctx).WithValues("task", task.Name, "cron", crontabexp)
+	if _, err := cron.ParseStandard(crontabexp); err != nil {
+		return fmt.Errorf("invalid cron expression %q: %w", crontabexp, err)
+	}
+	crontask := &CronTask{
+		Name:            path.Join(task.Group, task.Name),
+		Schedule:        crontabexp,
+		MissedRunPolicy: MissedRunSkip,
+		Task:            task,
+	}
+	for _, opt := range options {
+		opt(crontask)
+	}
+	if exist, err := s.getCronTask(ctx, crontask.Name); err == nil {
+		crontask.Suspend = exist.Suspend
+		crontask.LastScheduleTime = exist.LastScheduleTime
+		if exist.Schedule == crontask.Schedule {
+			crontask.NextScheduleTime = exist.NextScheduleTime
+		}
+	}
 	log.Info("register cron task")
-	_, err := s.crontab.AddFunc(crontabexp, func() {
-		log.Info("trigger a cron task run", "now", time.Now())
-		if err := s.Client.SubmitTask(ctx, task); err != nil {
-			log.Error(err, "run crontab task failed")
+	if err := s.putCronTask(ctx, crontask); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.registered[crontask.Name] = struct{}{}
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *CronClient) ListCronTasks(ctx context.Context) ([]CronTask, error) {
+	kvs, err := s.backend.List(ctx, cronKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]CronTask, 0, len(kvs))
+	for _, v := range kvs {
+		crontask := CronTask{}
+		if err := json.Unmarshal(v, &crontask); err != nil {
+			continue
+		}
+		list = append(list, crontask)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (s *CronClient) PauseCronTask(ctx context.Context, name string) error {
+	crontask, err := s.getCronTask(ctx, name)
+	if err != nil {
+		return err
+	}
+	crontask.Suspend = true
+	return s.putCronTask(ctx, crontask)
+}
+
+func (s *CronClient) ResumeCronTask(ctx context.Context, name string) error {
+	crontask, err := s.getCronTask(ctx, name)
+	if err != nil {
+		return err
+	}
+	crontask.Suspend = false
+	// 从当前时间开始重新计算，暂停期间的执行不做补偿
+	crontask.NextScheduleTime = metav1.Time{}
+	return s.putCronTask(ctx, crontask)
+}
+
+func (s *CronClient) TriggerCronTask(ctx context.Context, name string) error {
+	crontask, err := s.getCronTask(ctx, name)
+	if err != nil {
+		return err
+	}
+	return s.Client.SubmitTask(ctx, crontask.Task)
+}
+
+func (s *CronClient) getCronTask(ctx context.Context, name string) (*CronTask, error) {
+	content, err := s.backend.Get(ctx, cronKeyOf(name))
+	if err != nil || len(content) == 0 {
+		return nil, fmt.Errorf("cron task %s not found", name)
+	}
+	crontask := &CronTask{}
+	if err := json.Unmarshal(content, crontask); err != nil {
+		return nil, err
+	}
+	return crontask, nil
+}
+
+func (s *CronClient) putCronTask(ctx context.Context, crontask *CronTask) error {
+	content, err := json.Marshal(crontask)
+	if err != nil {
+		return err
+	}
+	return s.backend.Put(ctx, cronKeyOf(crontask.Name), content)
+}
+
+// Run 参与 leader 选举，成为 leader 后负责触发定时任务
+func (s *CronClient) Run(ctx context.Context) error {
+	log := log.FromContextOrDiscard(ctx).WithValues("holder", s.holder)
+	locker, ok := s.backend.(Locker)
+	if !ok {
+		log.Info("backend not support lease, run cron scheduler without leader election")
+		return s.schedule(ctx)
+	}
+	defer locker.Unlock(context.WithoutCancel(ctx), cronLeaderKey, s.holder)
+
+	var stop context.CancelFunc
+	ticker := time.NewTicker(cronLeaseTTL / 3)
+	defer ticker.Stop()
+	for {
+		leading, err := locker.TryLock(ctx, cronLeaderKey, s.holder, cronLeaseTTL)
+		if err != nil {
+			log.Error(err, "renew cron leader lease")
+		}
+		switch {
+		case leading && stop == nil:
+			log.Info("became cron leader")
+			var leaderctx context.Context
+			leaderctx, stop = context.WithCancel(ctx)
+			go s.schedule(leaderctx)
+		case !leading && stop != nil:
+			log.Info("lost cron leader")
+			stop()
+			stop = nil
+		}
+		select {
+		case <-ctx.Done():
+			if stop != nil {
+				stop()
+			}
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *CronClient) schedule(ctx context.Context) error {
+	s.pruneCronTasks(ctx)
+	ticker := time.NewTicker(cronCheckPeriod)
+	defer ticker.Stop()
+	for {
+		s.scheduleOnce(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// pruneCronTasks 删除未在本实例注册的定时任务，即新版本中已经移除的定时任务
+func (s *CronClient) pruneCronTasks(ctx context.Context) {
+	log := log.FromContextOrDiscard(ctx)
+	crontasks, err := s.ListCronTasks(ctx)
+	if err != nil {
+		log.Error(err, "list cron tasks")
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, crontask := range crontasks {
+		if _, ok := s.registered[crontask.Name]; ok {
+			continue
+		}
+		log.Info("remove unregistered cron task", "name", crontask.Name)
+		if err := s.backend.Del(ctx, cronKeyOf(crontask.Name)); err != nil {
+			log.Error(err, "remove cron task", "name", crontask.Name)
+		}
+	}
+}
+
+// scheduleOnce 触发所有到期的定时任务
+func (s *CronClient) scheduleOnce(ctx context.Context, now time.Time) {
+	log := log.FromContextOrDiscard(ctx)
+	crontasks, err := s.ListCronTasks(ctx)
+	if err != nil {
+		log.Error(err, "list cron tasks")
+		return
+	}
+	for i := range crontasks {
+		crontask := &crontasks[i]
+		if crontask.Suspend {
+			continue
+		}
+		sched, err := cron.ParseStandard(crontask.Schedule)
+		if err != nil {
+			log.Error(err, "parse cron schedule", "name", crontask.Name)
+			continue
+		}
+		if crontask.NextScheduleTime.IsZero() {
+			crontask.NextScheduleTime = metav1.NewTime(sched.Next(now))
+			_ = s.putCronTask(ctx, crontask)
+			continue
+		}
+		if crontask.NextScheduleTime.After(now) {
+			continue
+		}
+		due := dueTimes(sched, crontask.NextScheduleTime.Time, now)
+		runs := crontask.MissedRunPolicy.runs(due, now)
+		if skipped := len(due) - len(runs); skipped > 0 {
+			log.Info("skip missed cron runs", "name", crontask.Name, "count", skipped, "policy", crontask.MissedRunPolicy)
+		}
+		crontask.LastScheduleTime = metav1.NewTime(now)
+		crontask.NextScheduleTime = metav1.NewTime(sched.Next(now))
+		// 先更新下次执行时间再提交，避免 leader 切换时重复提交
+		if err := s.putCronTask(ctx, crontask); err != nil {
+			log.Error(err, "update cron task", "name", crontask.Name)
+			continue
+		}
+		for _, scheduled := range runs {
+			log.Info("trigger a cron task run", "name", crontask.Name, "scheduled", scheduled)
+			if err := s.Client.SubmitTask(ctx, crontask.Task); err != nil {
+				log.Error(err, "run crontab task failed", "name", crontask.Name)
+			}
 		}
-	})
-	return err
+	}
+}
+
+// dueTimes 返回 [next, now] 之间所有应该执行的时间，最多返回 maxCronCatchUpRuns 个最近的时间
+func dueTimes(sched cron.Schedule, next, now time.Time) []time.Time {
+	times := []time.Time{}
+	for t := next; !t.IsZero() && !t.After(now); t = sched.Next(t) {
+		times = append(times, t)
+		if len(times) > maxCronCatchUpRuns {
+			times = times[1:]
+		}
+	}
+	return times
+}
+
+// runs 根据策略返回需要执行的时间
+func (p MissedRunPolicy) runs(due []time.Time, now time.Time) []time.Time {
+	if len(due) == 0 {
+		return nil
+	}
+	latest := due[len(due)-1]
+	switch p {
+	case MissedRunCatchUp:
+		return due
+	case MissedRunOnce:
+		return []time.Time{latest}
+	default:
+		if now.Sub(latest) <= CronStartingDeadline {
+			return []time.Time{latest}
+		}
+		return nil
+	}
 }
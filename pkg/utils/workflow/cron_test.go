@@ -0,0 +1,169 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workflow
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMissedRunPolicy_runs(t *testing.T) {
+	now := time.Now()
+	due := []time.Time{now.Add(-3 * time.Hour), now.Add(-2 * time.Hour), now.Add(-10 * time.Second)}
+	tests := []struct {
+		name   string
+		policy MissedRunPolicy
+		due    []time.Time
+		want   int
+	}{
+		{name: "skip on time", policy: MissedRunSkip, due: due, want: 1},
+		{name: "skip missed", policy: MissedRunSkip, due: due[:2], want: 0},
+		{name: "default is skip", policy: "", due: due[:2], want: 0},
+		{name: "run once", policy: MissedRunOnce, due: due[:2], want: 1},
+		{name: "catch up", policy: MissedRunCatchUp, due: due, want: 3},
+		{name: "nothing due", policy: MissedRunCatchUp, due: nil, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.runs(tt.due, now); len(got) != tt.want {
+				t.Errorf("MissedRunPolicy.runs() = %v, want %d runs", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronClient_scheduleOnce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backend := NewInmemoryBackend(ctx)
+	cli := NewCronSubmiter(NewClientFromBackend(backend), backend)
+	task := Task{Group: "test", Name: "cron", Steps: []Step{{Function: "now"}}}
+	if err := cli.SubmitCronTask(ctx, task, "@every 1m", WithMissedRunPolicy(MissedRunCatchUp)); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.SubmitCronTask(ctx, task, "invalid"); err == nil {
+		t.Error("expect error on invalid cron expression")
+	}
+	countTasks := func() int {
+		tasks, err := cli.ListTasks(ctx, task.Group, task.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(tasks)
+	}
+
+	now := time.Now()
+	cli.scheduleOnce(ctx, now)
+	if n := countTasks(); n != 0 {
+		t.Fatalf("submitted %d tasks before schedule time", n)
+	}
+	// 错过了三次执行
+	cli.scheduleOnce(ctx, now.Add(3*time.Minute+30*time.Second))
+	if n := countTasks(); n != 3 {
+		t.Fatalf("submitted %d tasks, want 3", n)
+	}
+
+	if err := cli.PauseCronTask(ctx, "test/cron"); err != nil {
+		t.Fatal(err)
+	}
+	cli.scheduleOnce(ctx, now.Add(10*time.Minute))
+	if n := countTasks(); n != 3 {
+		t.Fatalf("paused cron task submitted, got %d tasks", n)
+	}
+	if err := cli.TriggerCronTask(ctx, "test/cron"); err != nil {
+		t.Fatal(err)
+	}
+	if n := countTasks(); n != 4 {
+		t.Fatalf("triggered cron task not submitted, got %d tasks", n)
+	}
+
+	list, err := cli.ListCronTasks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || !list[0].Suspend || list[0].MissedRunPolicy != MissedRunCatchUp {
+		t.Errorf("unexpected cron tasks %+v", list)
+	}
+	// 重新注册时保留暂停状态
+	if err := cli.SubmitCronTask(ctx, task, "@every 1m"); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := cli.ListCronTasks(ctx); !list[0].Suspend {
+		t.Error("suspend lost after register again")
+	}
+}
+
+func TestCronClient_pruneCronTasks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backend := NewInmemoryBackend(ctx)
+	// 旧版本注册的定时任务
+	old := NewCronSubmiter(NewClientFromBackend(backend), backend)
+	for _, name := range []string{"kept", "removed"} {
+		if err := old.SubmitCronTask(ctx, Task{Group: "test", Name: name}, "@every 1m"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cli := NewCronSubmiter(NewClientFromBackend(backend), backend)
+	if err := cli.SubmitCronTask(ctx, Task{Group: "test", Name: "kept"}, "@every 1m"); err != nil {
+		t.Fatal(err)
+	}
+	cli.pruneCronTasks(ctx)
+
+	list, err := cli.ListCronTasks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Name != "test/kept" {
+		t.Errorf("unexpected cron tasks after prune %+v", list)
+	}
+}
+
+func TestBackend_TryLock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backends := map[string]Locker{
+		"inmemory": NewInmemoryBackend(ctx),
+		"redis":    NewRedisBackendFromClient(setupRedis(t)),
+		"database": setupDatabaseBackend(ctx, t),
+	}
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			if ok, err := backend.TryLock(ctx, "leader", "a", time.Minute); !ok {
+				t.Fatalf("a should acquire lease: %v", err)
+			}
+			if ok, _ := backend.TryLock(ctx, "leader", "b", time.Minute); ok {
+				t.Fatal("b should not acquire lease held by a")
+			}
+			if ok, _ := backend.TryLock(ctx, "leader", "a", time.Minute); !ok {
+				t.Fatal("a should renew lease")
+			}
+			if err := backend.Unlock(ctx, "leader", "b"); err != nil {
+				t.Fatal(err)
+			}
+			if ok, _ := backend.TryLock(ctx, "leader", "b", time.Minute); ok {
+				t.Fatal("lease released by other holder")
+			}
+			_ = backend.Unlock(ctx, "leader", "a")
+			if ok, _ := backend.TryLock(ctx, "leader", "b", time.Minute); !ok {
+				t.Fatal("b should acquire released lease")
+			}
+		})
+	}
+}
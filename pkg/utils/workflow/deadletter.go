@@ -0,0 +1,146 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workflow
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var ErrDeadLetterNotSupported = errors.New("dead letter queue not supported by backend")
+
+// DeadLetter 超过最大投递次数仍未被成功处理的消息
+type DeadLetter struct {
+	ID         string    `json:"id"`        // 死信队列中的 id
+	Queue      string    `json:"queue"`     // 原队列
+	MessageID  string    `json:"messageID"` // 原队列中的 id
+	Key        string    `json:"key,omitempty"`
+	Value      string    `json:"value,omitempty"`
+	Deliveries int64     `json:"deliveries"`
+	Consumer   string    `json:"consumer,omitempty"` // 最后一次投递的消费者
+	Timestamp  time.Time `json:"timestamp"`          // 进入死信队列的时间
+}
+
+// DeadLetterQueue 由支持死信队列的 Backend 实现
+// ids 为空时作用于队列中的全部消息
+type DeadLetterQueue interface {
+	ListDeadLetters(ctx context.Context, name string) ([]DeadLetter, error)
+	// ReplayDeadLetters 将消息重新投递至原队列并从死信队列中移除
+	ReplayDeadLetters(ctx context.Context, name string, ids ...string) error
+	PurgeDeadLetters(ctx context.Context, name string, ids ...string) error
+}
+
+var _ DeadLetterQueue = &RedisBackend{}
+
+// deadLetter 将消息转移至死信队列，并从原队列中确认和删除
+func (b *RedisBackend) deadLetter(ctx context.Context, name, group string, msg redis.XMessage, pending redis.XPendingExt) error {
+	values := map[string]interface{}{
+		"queue":      name,
+		"id":         msg.ID,
+		"deliveries": pending.RetryCount,
+		"consumer":   pending.Consumer,
+		"timestamp":  time.Now().Format(time.RFC3339),
+	}
+	for k, v := range msg.Values {
+		values["key"], values["value"] = k, v
+	}
+	stream := b.steamprefix + name
+	_, err := b.cli.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{Stream: b.deadprefix + name, Values: values})
+		pipe.XAck(ctx, stream, group, msg.ID)
+		pipe.XDel(ctx, stream, msg.ID)
+		return nil
+	})
+	return err
+}
+
+func (b *RedisBackend) ListDeadLetters(ctx context.Context, name string) ([]DeadLetter, error) {
+	msgs, err := b.cli.XRange(ctx, b.deadprefix+name, "-", "+").Result()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]DeadLetter, 0, len(msgs))
+	for _, msg := range msgs {
+		list = append(list, deadLetterOf(msg))
+	}
+	return list, nil
+}
+
+func (b *RedisBackend) ReplayDeadLetters(ctx context.Context, name string, ids ...string) error {
+	list, err := b.selectDeadLetters(ctx, name, ids)
+	if err != nil {
+		return err
+	}
+	for _, item := range list {
+		if _, err := b.cli.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: b.steamprefix + name,
+				Values: map[string]interface{}{item.Key: item.Value},
+			})
+			pipe.XDel(ctx, b.deadprefix+name, item.ID)
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *RedisBackend) PurgeDeadLetters(ctx context.Context, name string, ids ...string) error {
+	if len(ids) == 0 {
+		return b.cli.Del(ctx, b.deadprefix+name).Err()
+	}
+	return b.cli.XDel(ctx, b.deadprefix+name, ids...).Err()
+}
+
+func (b *RedisBackend) selectDeadLetters(ctx context.Context, name string, ids []string) ([]DeadLetter, error) {
+	if len(ids) == 0 {
+		return b.ListDeadLetters(ctx, name)
+	}
+	list := make([]DeadLetter, 0, len(ids))
+	for _, id := range ids {
+		msgs, err := b.cli.XRange(ctx, b.deadprefix+name, id, id).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgs {
+			list = append(list, deadLetterOf(msg))
+		}
+	}
+	return list, nil
+}
+
+func deadLetterOf(msg redis.XMessage) DeadLetter {
+	str := func(key string) string {
+		val, _ := msg.Values[key].(string)
+		return val
+	}
+	deliveries, _ := strconv.ParseInt(str("deliveries"), 10, 64)
+	timestamp, _ := time.Parse(time.RFC3339, str("timestamp"))
+	return DeadLetter{
+		ID:         msg.ID,
+		Queue:      str("queue"),
+		MessageID:  str("id"),
+		Key:        str("key"),
+		Value:      str("value"),
+		Deliveries: deliveries,
+		Consumer:   str("consumer"),
+		Timestamp:  timestamp,
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workflow
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestRedisBackend_DeadLetter(t *testing.T) {
+	ctx := context.Background()
+	b := NewRedisBackendFromClient(setupRedis(t))
+	stream := b.steamprefix + "test"
+	if err := b.cli.XGroupCreateMkStream(ctx, stream, DefaultGroup, "0").Err(); err != nil {
+		t.Fatal(err)
+	}
+	for _, val := range []string{"a", "b"} {
+		if err := b.Pub(ctx, "test", "key", []byte(val)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 由已经不存在的消费者读取但未确认
+	if err := b.cli.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group: DefaultGroup, Consumer: "dead-pod", Streams: []string{stream, ">"},
+	}).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	options := newSubOptions(WithConsumer("alive-pod"), WithClaimMinIdle(0), WithMaxDeliveries(2))
+	claimed, err := b.claimStale(ctx, "test", DefaultGroup, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 2 {
+		t.Fatalf("claimed %d messages, want 2", len(claimed))
+	}
+	// 第三次投递超过最大投递次数
+	claimed, err = b.claimStale(ctx, "test", DefaultGroup, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 0 {
+		t.Fatalf("claimed %d poison messages, want 0", len(claimed))
+	}
+	if n := b.cli.XLen(ctx, stream).Val(); n != 0 {
+		t.Errorf("poison messages left in queue: %d", n)
+	}
+
+	list, err := b.ListDeadLetters(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("dead letters = %d, want 2", len(list))
+	}
+	if got := list[0]; got.Value != "a" || got.Key != "key" || got.Deliveries != 3 || got.Consumer != "alive-pod" {
+		t.Errorf("unexpected dead letter %+v", got)
+	}
+
+	if err := b.ReplayDeadLetters(ctx, "test", list[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	msgs := b.cli.XRange(ctx, stream, "-", "+").Val()
+	if len(msgs) != 1 || msgs[0].Values["key"] != "a" {
+		t.Errorf("replayed messages = %v", msgs)
+	}
+
+	if err := b.PurgeDeadLetters(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := b.ListDeadLetters(ctx, "test"); len(list) != 0 {
+		t.Errorf("dead letters not purged: %v", list)
+	}
+}
+
+func TestDatabaseBackend_DeadLetter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := setupDatabaseBackend(ctx, t)
+	for _, val := range []string{"a", "b"} {
+		if err := b.Pub(ctx, "test", "key", []byte(val)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 锁定时间为 0，处理失败的消息立即重新投递
+	options := newSubOptions(WithConsumer("alive-pod"), WithClaimMinIdle(0), WithMaxDeliveries(2))
+	deliveries := 0
+	for {
+		msg, err := b.fetch(ctx, "test", options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg == nil {
+			break
+		}
+		deliveries++
+	}
+	if deliveries != 4 {
+		t.Fatalf("delivered %d times, want 4", deliveries)
+	}
+
+	list, err := b.ListDeadLetters(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("dead letters = %d, want 2", len(list))
+	}
+	if got := list[0]; got.Value != "a" || got.Key != "key" || got.Deliveries != 3 || got.Consumer != "alive-pod" {
+		t.Errorf("unexpected dead letter %+v", got)
+	}
+
+	if err := b.ReplayDeadLetters(ctx, "test", list[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if msg, _ := b.fetch(ctx, "test", options); msg == nil || string(msg.Value) != "a" {
+		t.Errorf("replayed message = %v", msg)
+	}
+
+	if err := b.PurgeDeadLetters(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := b.ListDeadLetters(ctx, "test"); len(list) != 0 {
+		t.Errorf("dead letters not purged: %v", list)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTaskRetention = 5 * 24 * time.Hour
+	// TaskArchiveGrace 已完成任务的 TTL 在保留时间之上额外增加的时间，保证任务过期前能够被归档
+	TaskArchiveGrace = 2 * time.Hour
+)
+
+var ErrTaskHistoryNotConfigured = errors.New("task history not configured")
+
+// RetentionPolicy 任务在任务存储(Backend)中的保留时间，可以按照任务分组单独配置
+// 任务完成后由 archiver 保存至历史存储，超过保留时间后从任务存储中删除；
+// 未完成的任务不过期，已完成任务的记录在 保留时间+TaskArchiveGrace 后过期，仅用于兜底清理
+type RetentionPolicy struct {
+	Default time.Duration            `json:"default,omitempty"`
+	Groups  map[string]time.Duration `json:"groups,omitempty"`
+}
+
+func (p RetentionPolicy) RetentionOf(group string) time.Duration {
+	if retention, ok := p.Groups[group]; ok && retention > 0 {
+		return retention
+	}
+	if p.Default > 0 {
+		return p.Default
+	}
+	return DefaultTaskRetention
+}
+
+// TTLOf 返回任务存储中已完成任务记录的 TTL
+func (p RetentionPolicy) TTLOf(group string) time.Duration {
+	return p.RetentionOf(group) + TaskArchiveGrace
+}
+
+// taskTTL 返回任务记录的 TTL，未完成的任务返回 0 即不过期，避免暂停或长时间运行的任务在归档前过期
+func (p RetentionPolicy) taskTTL(group string, status *TaskStatus) time.Duration {
+	if status == nil || !status.Status.Finished() {
+		return 0
+	}
+	return p.TTLOf(group)
+}
+
+// ParseGroupRetentions 解析 group=duration 格式的配置，例如 application=720h
+func ParseGroupRetentions(kvs []string) (map[string]time.Duration, error) {
+	groups := map[string]time.Duration{}
+	for _, kv := range kvs {
+		group, val, ok := strings.Cut(kv, "=")
+		if !ok || group == "" {
+			return nil, fmt.Errorf("invalid group retention %q, must be group=duration", kv)
+		}
+		retention, err := time.ParseDuration(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid group retention %q: %w", kv, err)
+		}
+		groups[group] = retention
+	}
+	return groups, nil
+}
+
+type HistoryListOptions struct {
+	Group string    `json:"group,omitempty"`
+	Name  string    `json:"name,omitempty"` // 按照名称前缀匹配
+	Since time.Time `json:"since,omitempty"`
+	Until time.Time `json:"until,omitempty"`
+	Page  int       `json:"page,omitempty"`
+	Size  int       `json:"size,omitempty"`
+}
+
+type TaskHistoryList struct {
+	Total int64  `json:"total"`
+	Page  int    `json:"page"`
+	Size  int    `json:"size"`
+	Items []Task `json:"items"`
+}
+
+// TaskHistory 存储已经从任务存储中归档的任务，用于审计查询
+type TaskHistory interface {
+	SaveTaskHistory(ctx context.Context, tasks ...Task) error
+	ListTaskHistory(ctx context.Context, opts HistoryListOptions) (*TaskHistoryList, error)
+}
@@ -0,0 +1,85 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workflow
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Locker 由支持租约的 Backend 实现，用于多个实例间的选主
+type Locker interface {
+	// TryLock 尝试获取 key 的租约，已经持有时续约
+	TryLock(ctx context.Context, key, holder string, ttl time.Duration) (bool, error)
+	// Unlock 释放持有的租约
+	Unlock(ctx context.Context, key, holder string) error
+}
+
+var (
+	_ Locker = &RedisBackend{}
+	_ Locker = &InmemoryBackend{}
+)
+
+var trylockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func (b *RedisBackend) TryLock(ctx context.Context, key, holder string, ttl time.Duration) (bool, error) {
+	ret, err := trylockScript.Run(ctx, b.cli, []string{b.kvprefix + key}, holder, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return ret == 1, nil
+}
+
+func (b *RedisBackend) Unlock(ctx context.Context, key, holder string) error {
+	return unlockScript.Run(ctx, b.cli, []string{b.kvprefix + key}, holder).Err()
+}
+
+func (t *InmemoryBackend) TryLock(ctx context.Context, key, holder string, ttl time.Duration) (bool, error) {
+	t.dblock.Lock()
+	defer t.dblock.Unlock()
+	now := time.Now()
+	if exist, ok := t.db[key]; ok && !exist.expired(now) && string(exist.val) != holder {
+		return false, nil
+	}
+	t.db[key] = kv{key: key, val: []byte(holder), createTime: now, expireTime: now.Add(ttl)}
+	return true, nil
+}
+
+func (t *InmemoryBackend) Unlock(ctx context.Context, key, holder string) error {
+	t.dblock.Lock()
+	defer t.dblock.Unlock()
+	if exist, ok := t.db[key]; ok && string(exist.val) == holder {
+		delete(t.db, key)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workflow
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"kubegems.io/kubegems/pkg/log"
+)
+
+// QueueDepthSampleInterval 队列深度的采样间隔
+const QueueDepthSampleInterval = 15 * time.Second
+
+// maxQueueDepthScan 统计等待中消息时最多扫描的消息数量
+const maxQueueDepthScan = 10000
+
+// Metrics 接收 workflow 运行时的指标，由 exporter 实现并导出
+type Metrics interface {
+	StepStarted(function string)
+	StepFinished(function string, duration time.Duration, err error)
+	StepRetried(function string)
+	TaskFinished(group string, status TaskStatusCode)
+	QueueDepth(queue string, depth QueueDepth)
+}
+
+type QueueDepth struct {
+	Waiting int64 `json:"waiting"` // 等待消费的消息
+	Pending int64 `json:"pending"` // 已经投递但未确认的消息
+}
+
+// QueueInspector 由支持查询队列深度的 Backend 实现
+type QueueInspector interface {
+	QueueDepth(ctx context.Context, name string) (QueueDepth, error)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) StepStarted(string)                        {}
+func (noopMetrics) StepFinished(string, time.Duration, error) {}
+func (noopMetrics) StepRetried(string)                        {}
+func (noopMetrics) TaskFinished(string, TaskStatusCode)       {}
+func (noopMetrics) QueueDepth(string, QueueDepth)             {}
+
+// WithMetrics 设置指标收集
+func WithMetrics(metrics Metrics) ServerOption {
+	return func(s *Server) {
+		if metrics != nil {
+			s.metrics = metrics
+		}
+	}
+}
+
+// sampleQueueDepth 定期采样任务队列深度
+func (s *Server) sampleQueueDepth(ctx context.Context) error {
+	inspector, ok := s.backend.(QueueInspector)
+	if !ok {
+		return nil
+	}
+	ticker := time.NewTicker(QueueDepthSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			depth, err := inspector.QueueDepth(ctx, taskQueue)
+			if err != nil {
+				log.FromContextOrDiscard(ctx).Error(err, "sample queue depth")
+				continue
+			}
+			s.metrics.QueueDepth(taskQueue, depth)
+		}
+	}
+}
+
+var (
+	_ QueueInspector = &RedisBackend{}
+	_ QueueInspector = &InmemoryBackend{}
+)
+
+// QueueDepth 使用 XINFO GROUPS 获取未确认的消息数量，等待中的消息为最后投递的消息之后的消息
+func (b *RedisBackend) QueueDepth(ctx context.Context, name string) (QueueDepth, error) {
+	stream := b.steamprefix + name
+	groups, err := b.cli.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		return QueueDepth{}, err
+	}
+	depth := QueueDepth{}
+	lastDelivered := "0"
+	for _, group := range groups {
+		if group.Name == DefaultGroup {
+			depth.Pending = group.Pending
+			lastDelivered = group.LastDeliveredID
+		}
+	}
+	msgs, err := b.cli.XRangeN(ctx, stream, lastDelivered, "+", maxQueueDepthScan).Result()
+	if err != nil && err != redis.Nil {
+		return QueueDepth{}, err
+	}
+	depth.Waiting = int64(len(msgs))
+	if len(msgs) > 0 && msgs[0].ID == lastDelivered {
+		depth.Waiting--
+	}
+	return depth, nil
+}
+
+func (t *InmemoryBackend) QueueDepth(ctx context.Context, name string) (QueueDepth, error) {
+	return QueueDepth{Waiting: int64(len(t.subeventch))}, nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordMetrics struct {
+	mu       sync.Mutex
+	running  int
+	finished int
+	failures int
+	retries  int
+	tasks    map[TaskStatusCode]int
+}
+
+func (m *recordMetrics) StepStarted(string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.running++
+}
+
+func (m *recordMetrics) StepFinished(_ string, _ time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.running--
+	m.finished++
+	if err != nil {
+		m.failures++
+	}
+}
+
+func (m *recordMetrics) StepRetried(string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retries++
+}
+
+func (m *recordMetrics) TaskFinished(_ string, status TaskStatusCode) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tasks[status]++
+}
+
+func (m *recordMetrics) QueueDepth(string, QueueDepth) {}
+
+func TestServer_metrics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	metrics := &recordMetrics{tasks: map[TaskStatusCode]int{}}
+	s := NewServerFromBackend(NewInmemoryBackend(ctx), WithMetrics(metrics))
+	calls := 0
+	_ = s.Register("flaky", func() error {
+		if calls++; calls < 3 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	content, _ := json.Marshal(Task{
+		Name: "metrics",
+		Steps: []Step{
+			{Name: "flaky", Function: "flaky", Retry: &RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond}},
+		},
+	})
+	task := &jsonArgsTask{}
+	if err := json.Unmarshal(content, task); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; !s.process(ctx, task); i++ {
+		if i > 10 {
+			t.Fatal("task not finished")
+		}
+	}
+	if metrics.running != 0 || metrics.finished != 3 || metrics.failures != 2 || metrics.retries != 2 {
+		t.Errorf("unexpected step metrics %+v", metrics)
+	}
+	if metrics.tasks[TaskStatusSuccess] != 1 {
+		t.Errorf("unexpected task metrics %v", metrics.tasks)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// step 的参数中可以引用之前 step 的结果以及 task 的额外信息，在执行前由 server 替换为实际值
+// 语法为 ${{ <path> }}，例如:
+//
+//	${{ steps.resolve-digest.result[0] }}       // step resolve-digest 的第一个返回值
+//	${{ steps.resolve-digest.result[0].image }} // 返回值中的字段
+//	${{ steps.build.status }}                   // step build 的状态
+//	${{ addtionals.committer }}                 // task 的额外信息
+//
+// 参数为完整的引用时替换为被引用值(保留其类型)，否则作为字符串进行插值。
+// 引用可以出现在参数中的任意层级，例如 []string{"${{ steps.resolve-digest.result[0] }}"}。
+var referenceRegexp = regexp.MustCompile(`\$\{\{\s*([^{}]+?)\s*\}\}`)
+
+// StepResultRef 返回引用 step 第 index 个返回值的表达式
+func StepResultRef(step string, index int) string {
+	return fmt.Sprintf("${{ steps.%s.result[%d] }}", step, index)
+}
+
+// resolveArgs 替换参数中的引用
+func resolveArgs(args []json.RawMessage, values map[string]interface{}) ([]json.RawMessage, error) {
+	if !hasReference(args) {
+		return args, nil
+	}
+	// 统一为 json 格式的数据，返回值可能为未经序列化的结构体
+	normalized := map[string]interface{}{}
+	if err := roundtrip(values, &normalized); err != nil {
+		return nil, err
+	}
+	ret := make([]json.RawMessage, len(args))
+	for i, arg := range args {
+		if !referenceRegexp.Match(arg) {
+			ret[i] = arg
+			continue
+		}
+		var val interface{}
+		dec := json.NewDecoder(bytes.NewReader(arg))
+		dec.UseNumber()
+		if err := dec.Decode(&val); err != nil {
+			return nil, fmt.Errorf("decode args[%d]: %w", i, err)
+		}
+		resolved, err := resolveValue(val, normalized)
+		if err != nil {
+			return nil, fmt.Errorf("resolve args[%d]: %w", i, err)
+		}
+		raw, err := json.Marshal(resolved)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = raw
+	}
+	return ret, nil
+}
+
+func hasReference(args []json.RawMessage) bool {
+	for _, arg := range args {
+		if referenceRegexp.Match(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+func roundtrip(from, into interface{}) error {
+	content, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+	return dec.Decode(into)
+}
+
+func resolveValue(val interface{}, values interface{}) (interface{}, error) {
+	switch v := val.(type) {
+	case string:
+		return resolveString(v, values)
+	case []interface{}:
+		for i, item := range v {
+			resolved, err := resolveValue(item, values)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = resolved
+		}
+		return v, nil
+	case map[string]interface{}:
+		for k, item := range v {
+			resolved, err := resolveValue(item, values)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = resolved
+		}
+		return v, nil
+	default:
+		return val, nil
+	}
+}
+
+func resolveString(str string, values interface{}) (interface{}, error) {
+	matches := referenceRegexp.FindAllStringSubmatchIndex(str, -1)
+	if len(matches) == 0 {
+		return str, nil
+	}
+	// 完整的引用，保留被引用值的类型
+	if len(matches) == 1 && matches[0][0] == 0 && matches[0][1] == len(str) {
+		return lookupPath(values, str[matches[0][2]:matches[0][3]])
+	}
+	buf := strings.Builder{}
+	last := 0
+	for _, match := range matches {
+		buf.WriteString(str[last:match[0]])
+		val, err := lookupPath(values, str[match[2]:match[3]])
+		if err != nil {
+			return nil, err
+		}
+		switch v := val.(type) {
+		case string:
+			buf.WriteString(v)
+		default:
+			content, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(content)
+		}
+		last = match[1]
+	}
+	buf.WriteString(str[last:])
+	return buf.String(), nil
+}
+
+// lookupPath 按照 a.b[0].c 格式的路径取值
+func lookupPath(values interface{}, path string) (interface{}, error) {
+	cur := values
+	for _, part := range strings.Split(path, ".") {
+		key, indexes := part, ""
+		if i := strings.IndexByte(part, '['); i >= 0 {
+			key, indexes = part[:i], part[i:]
+		}
+		if key != "" {
+			m, ok := cur.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("reference %s: %s is not an object", path, key)
+			}
+			if cur, ok = m[key]; !ok {
+				return nil, fmt.Errorf("reference %s: %s not found", path, key)
+			}
+		}
+		for indexes != "" {
+			end := strings.IndexByte(indexes, ']')
+			if indexes[0] != '[' || end < 0 {
+				return nil, fmt.Errorf("reference %s: invalid index %s", path, indexes)
+			}
+			index, err := strconv.Atoi(indexes[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("reference %s: invalid index %s", path, indexes[:end+1])
+			}
+			list, ok := cur.([]interface{})
+			if !ok || index < 0 || index >= len(list) {
+				return nil, fmt.Errorf("reference %s: index %d out of range", path, index)
+			}
+			cur, indexes = list[index], indexes[end+1:]
+		}
+	}
+	return cur, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestResolveArgs(t *testing.T) {
+	task := &jsonArgsTask{
+		Addtionals: map[string]string{"committer": "admin"},
+		Steps: []*jsonArgsStep{
+			{
+				Name: "resolve-digest",
+				Status: TaskStatus{
+					Status: TaskStatusSuccess,
+					Result: []interface{}{DemoArgs{Foo: "nginx@sha256:abc"}, 3, nil},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name    string
+		args    string
+		want    string
+		wantErr bool
+	}{
+		{name: "no reference", args: `["a",{"b":1}]`, want: `["a",{"b":1}]`},
+		{name: "object", args: `["${{ steps.resolve-digest.result[0] }}"]`, want: `[{"foo":"nginx@sha256:abc"}]`},
+		{name: "field", args: `["${{ steps.resolve-digest.result[0].foo }}"]`, want: `["nginx@sha256:abc"]`},
+		{name: "number", args: `["${{steps.resolve-digest.result[1]}}"]`, want: `[3]`},
+		{name: "nested", args: `[["${{ steps.resolve-digest.result[0].foo }}"]]`, want: `[["nginx@sha256:abc"]]`},
+		{name: "interpolate", args: `["${{ addtionals.committer }} updated to ${{ steps.resolve-digest.result[1] }}"]`, want: `["admin updated to 3"]`},
+		{name: "status", args: `["${{ steps.resolve-digest.status }}"]`, want: `["Success"]`},
+		{name: "missing step", args: `["${{ steps.missing.result[0] }}"]`, wantErr: true},
+		{name: "out of range", args: `["${{ steps.resolve-digest.result[5] }}"]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := []json.RawMessage{}
+			if err := json.Unmarshal([]byte(tt.args), &args); err != nil {
+				t.Fatal(err)
+			}
+			got, err := resolveArgs(args, task.values())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("resolveArgs() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			gotcontent, _ := json.Marshal(got)
+			if string(gotcontent) != tt.want {
+				t.Errorf("resolveArgs() = %s, want %s", gotcontent, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_processWithReference(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := NewServerFromBackend(NewInmemoryBackend(ctx))
+	_ = s.Register("resolve", func() (string, error) {
+		return "nginx@sha256:abc", nil
+	})
+	var updated []string
+	_ = s.Register("update", func(_ context.Context, images []string) error {
+		updated = images
+		return nil
+	})
+
+	content, _ := json.Marshal(Task{
+		Name: "reference",
+		Steps: []Step{
+			{Name: "resolve", Function: "resolve"},
+			{Name: "update", Function: "update", Args: ArgsOf([]string{StepResultRef("resolve", 0)})},
+		},
+	})
+	task := &jsonArgsTask{}
+	if err := json.Unmarshal(content, task); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; !s.process(ctx, task); i++ {
+		if i > 10 {
+			t.Fatal("task not finished")
+		}
+	}
+	if task.Status.Status != TaskStatusSuccess {
+		t.Fatalf("task status = %v: %s", task.Status.Status, task.Status.Message)
+	}
+	if len(updated) != 1 || updated[0] != "nginx@sha256:abc" {
+		t.Errorf("update called with %v", updated)
+	}
+	// 原始参数保持不变
+	if string(task.Steps[1].Args[0]) != `["${{ steps.resolve.result[0] }}"]` {
+		t.Errorf("step args modified: %s", task.Steps[1].Args[0])
+	}
+}
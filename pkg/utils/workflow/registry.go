@@ -0,0 +1,189 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/go-openapi/spec"
+	"kubegems.io/kubegems/pkg/utils/route"
+)
+
+var (
+	// ErrInvalidArgs 提交的任务中 step 的函数或者参数与注册的函数不匹配
+	ErrInvalidArgs = errors.New("invalid step args")
+	// ErrFunctionRegistryNotConfigured 客户端未配置函数注册表
+	ErrFunctionRegistryNotConfigured = errors.New("function registry not configured")
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Function 类型化的函数名称，Args 为函数的参数类型，用于构造参数类型安全的 step
+//
+//	var SyncCluster = workflow.Function[SyncArgs]("sync-cluster")
+//	workflow.RegisterFunc(server, SyncCluster, func(ctx context.Context, args SyncArgs) error {...})
+//	task.Steps = append(task.Steps, SyncCluster.Step("sync", SyncArgs{...}))
+type Function[Args any] string
+
+// Step 使用参数构造调用该函数的 step
+func (f Function[Args]) Step(name string, args Args) Step {
+	return Step{Name: name, Function: string(f), Args: ArgsOf(args)}
+}
+
+// RegisterFunc 注册类型化的函数，提交任务时会校验参数是否为 Args 类型
+func RegisterFunc[Args any](s *Server, f Function[Args], fn func(ctx context.Context, args Args) error) error {
+	return s.Register(string(f), fn)
+}
+
+// RegisterFuncWithResult 注册带有返回值的类型化的函数，返回值可以被后续的 step 引用
+func RegisterFuncWithResult[Args, Result any](s *Server, f Function[Args], fn func(ctx context.Context, args Args) (Result, error)) error {
+	return s.Register(string(f), fn)
+}
+
+// FunctionSchema 注册函数的参数以及返回值描述，不包含 context.Context 参数以及 error 返回值
+type FunctionSchema struct {
+	Name     string         `json:"name"`
+	Args     []*spec.Schema `json:"args,omitempty"`
+	Results  []*spec.Schema `json:"results,omitempty"`
+	Variadic bool           `json:"variadic,omitempty"` // 最后一个参数为可变参数，需要以数组提供
+}
+
+type FunctionList struct {
+	Functions   []FunctionSchema `json:"functions"`
+	Definitions spec.Definitions `json:"definitions,omitempty"`
+}
+
+// FunctionRegistry 保存已注册的函数，server 使用其执行 step，client 使用其校验参数
+type FunctionRegistry struct {
+	mu    sync.RWMutex
+	funcs map[string]interface{}
+}
+
+func NewFunctionRegistry() *FunctionRegistry {
+	return &FunctionRegistry{funcs: map[string]interface{}{}}
+}
+
+func (r *FunctionRegistry) Register(name string, fun interface{}) error {
+	// validate
+	if fun == nil || reflect.TypeOf(fun).Kind() != reflect.Func {
+		return fmt.Errorf("name [%s] fun [%v] not a function", name, fun)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.funcs[name]; ok {
+		return fmt.Errorf("name [%s] fun [%v] already registered", name, fun)
+	}
+	r.funcs[name] = fun
+	return nil
+}
+
+func (r *FunctionRegistry) Lookup(name string) (interface{}, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	fun, ok := r.funcs[name]
+	return fun, ok
+}
+
+// Functions 返回所有已注册函数的描述，按名称排序
+func (r *FunctionRegistry) Functions() *FunctionList {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	builder := route.NewBuilder(route.InterfaceBuildOptionDefault)
+	list := &FunctionList{Functions: make([]FunctionSchema, 0, len(r.funcs))}
+	for name, fun := range r.funcs {
+		funt := reflect.TypeOf(fun)
+		schema := FunctionSchema{Name: name, Variadic: funt.IsVariadic()}
+		for _, argt := range argTypesOf(funt) {
+			schema.Args = append(schema.Args, builder.BuildSchema(reflect.New(argt).Elem()))
+		}
+		for i := 0; i < funt.NumOut(); i++ {
+			if resultt := funt.Out(i); resultt != errorType {
+				schema.Results = append(schema.Results, builder.BuildSchema(reflect.New(resultt).Elem()))
+			}
+		}
+		list.Functions = append(list.Functions, schema)
+	}
+	sort.Slice(list.Functions, func(i, j int) bool { return list.Functions[i].Name < list.Functions[j].Name })
+	if len(builder.Definitions) > 0 {
+		list.Definitions = builder.Definitions
+	}
+	return list
+}
+
+// Validate 校验任务中所有 step 的函数是否已注册以及参数类型是否匹配
+// 包含引用的参数需要在执行时才能确定值，不做校验
+func (r *FunctionRegistry) Validate(task Task) error {
+	return r.validateSteps(task.Steps)
+}
+
+func (r *FunctionRegistry) validateSteps(steps []Step) error {
+	for _, step := range steps {
+		if step.Function != "" {
+			if err := r.validateStep(step); err != nil {
+				return fmt.Errorf("%w: step %s: %s", ErrInvalidArgs, step.Name, err.Error())
+			}
+		}
+		if err := r.validateSteps(step.SubSteps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *FunctionRegistry) validateStep(step Step) error {
+	fun, ok := r.Lookup(step.Function)
+	if !ok {
+		return fmt.Errorf("func %s not registered", step.Function)
+	}
+	argts := argTypesOf(reflect.TypeOf(fun))
+	if len(step.Args) > len(argts) {
+		return fmt.Errorf("func %s accepts %d args, got %d", step.Function, len(argts), len(step.Args))
+	}
+	// 参数未完整提供时，其余的使用空值
+	for i, arg := range step.Args {
+		content, err := json.Marshal(arg)
+		if err != nil {
+			return fmt.Errorf("args[%d]: %w", i, err)
+		}
+		if referenceRegexp.Match(content) {
+			continue
+		}
+		if err := json.Unmarshal(content, reflect.New(argts[i]).Interface()); err != nil {
+			return fmt.Errorf("args[%d]: expect %s: %w", i, argts[i].String(), err)
+		}
+	}
+	return nil
+}
+
+// argTypesOf 返回函数需要由 step 提供的参数类型，第一个参数为 context.Context 时由执行时注入
+func argTypesOf(funt reflect.Type) []reflect.Type {
+	argts := make([]reflect.Type, 0, funt.NumIn())
+	for i := 0; i < funt.NumIn(); i++ {
+		if argt := funt.In(i); !(i == 0 && argt.Implements(contextType)) {
+			argts = append(argts, argt)
+		}
+	}
+	return argts
+}
@@ -0,0 +1,121 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type SyncArgs struct {
+	Cluster string `json:"cluster"`
+	Replica int    `json:"replica"`
+}
+
+var syncFunction = Function[SyncArgs]("sync")
+
+func TestFunctionRegistry_Validate(t *testing.T) {
+	s := NewServerFromBackend(NewInmemoryBackend(context.Background()))
+	if err := RegisterFuncWithResult(s, syncFunction, func(ctx context.Context, args SyncArgs) (string, error) {
+		return args.Cluster, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	_ = s.Register("echo", func(ctx context.Context, msg string) {})
+
+	tests := []struct {
+		name    string
+		steps   []Step
+		wantErr bool
+	}{
+		{
+			name:  "typed step",
+			steps: []Step{syncFunction.Step("sync", SyncArgs{Cluster: "a", Replica: 1})},
+		},
+		{
+			name:  "json args",
+			steps: []Step{{Name: "sync", Function: "sync", Args: ArgsOf(map[string]interface{}{"cluster": "a"})}},
+		},
+		{
+			name:    "mismatched type",
+			steps:   []Step{{Name: "sync", Function: "sync", Args: ArgsOf(map[string]interface{}{"replica": "1"})}},
+			wantErr: true,
+		},
+		{
+			name:    "too many args",
+			steps:   []Step{{Name: "echo", Function: "echo", Args: ArgsOf("a", "b")}},
+			wantErr: true,
+		},
+		{
+			name:    "unregistered in substeps",
+			steps:   []Step{{Name: "root", SubSteps: []Step{{Name: "missing", Function: "missing"}}}},
+			wantErr: true,
+		},
+		{
+			name:  "reference args",
+			steps: []Step{{Name: "echo", Function: "echo", Args: ArgsOf(StepResultRef("sync", 0))}},
+		},
+		{
+			name:  "missing args",
+			steps: []Step{{Name: "echo", Function: "echo"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.NewClient(context.Background()).SubmitTask(context.Background(), Task{Name: "validate", Steps: tt.steps})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SubmitTask() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidArgs) {
+				t.Errorf("SubmitTask() error = %v, want ErrInvalidArgs", err)
+			}
+		})
+	}
+}
+
+func TestRemoteClient_functions(t *testing.T) {
+	ctx := context.Background()
+	s := NewServerFromBackend(NewInmemoryBackend(ctx))
+	_ = RegisterFunc(s, syncFunction, func(ctx context.Context, args SyncArgs) error { return nil })
+
+	httpserver := httptest.NewServer(NewRemoteClientServer(s.NewClient(ctx)).Handler())
+	defer httpserver.Close()
+	cli := NewRemoteClient(httpserver.URL)
+
+	list, err := cli.ListFunctions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Functions) != 1 || len(list.Functions[0].Args) != 1 || len(list.Functions[0].Results) != 0 {
+		t.Fatalf("unexpected functions %+v", list.Functions)
+	}
+	def, ok := list.Definitions["workflow.SyncArgs"]
+	if !ok {
+		t.Fatalf("missing args definition, got %v", list.Definitions)
+	}
+	if content, _ := json.Marshal(def); !strings.Contains(string(content), "replica") {
+		t.Errorf("unexpected args schema %s", content)
+	}
+
+	err = cli.SubmitTask(ctx, Task{Name: "invalid", Steps: []Step{{Name: "sync", Function: "sync", Args: ArgsOf("not an object")}}})
+	if err == nil || !strings.Contains(err.Error(), http.StatusText(http.StatusBadRequest)) || !strings.Contains(err.Error(), "step sync") {
+		t.Errorf("expect bad request with validation message, got %v", err)
+	}
+}
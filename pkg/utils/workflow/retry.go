@@ -0,0 +1,117 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workflow
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	DefaultRetryInitialInterval = 5 * time.Second
+	DefaultRetryMaxInterval     = 2 * time.Minute
+	DefaultRetryMultiplier      = 2.0
+)
+
+// RetryPolicy 定义 step 执行失败后的重试策略
+// 重试间隔为指数退避: initialInterval * multiplier^(n-1)，不超过 maxInterval，并附加 jitter 抖动
+type RetryPolicy struct {
+	MaxAttempts     int           `json:"maxAttempts,omitempty"`     // 最大执行次数，包含首次执行，小于等于1时不重试
+	InitialInterval time.Duration `json:"initialInterval,omitempty"` // 首次重试前的等待时间
+	MaxInterval     time.Duration `json:"maxInterval,omitempty"`     // 重试等待时间上限
+	Multiplier      float64       `json:"multiplier,omitempty"`      // 每次重试等待时间的倍率
+	Jitter          float64       `json:"jitter,omitempty"`          // 抖动系数，实际等待时间在 [d, d*(1+jitter)) 之间
+}
+
+// StepAttempt 记录 step 的一次执行
+type StepAttempt struct {
+	Attempt         int         `json:"attempt,omitempty"`
+	StartTimestamp  metav1.Time `json:"startTimestamp,omitempty"`
+	FinishTimestamp metav1.Time `json:"finishTimestamp,omitempty"`
+	Executer        string      `json:"executer,omitempty"`
+	Message         string      `json:"message,omitempty"`
+}
+
+// Backoff 返回第 attempt 次(从1开始)执行失败后，下一次执行前需要等待的时间
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := wait.Backoff{
+		Duration: p.InitialInterval,
+		Factor:   p.Multiplier,
+		Cap:      p.MaxInterval,
+		Steps:    attempt,
+	}
+	if backoff.Duration <= 0 {
+		backoff.Duration = DefaultRetryInitialInterval
+	}
+	if backoff.Factor < 1 {
+		backoff.Factor = DefaultRetryMultiplier
+	}
+	if backoff.Cap <= 0 {
+		backoff.Cap = DefaultRetryMaxInterval
+	}
+	var duration time.Duration
+	for i := 0; i < attempt; i++ {
+		duration = backoff.Step()
+	}
+	if p.Jitter > 0 {
+		duration = wait.Jitter(duration, p.Jitter)
+	}
+	return duration
+}
+
+// ShouldRetry 判断在第 attempt 次执行返回 err 后是否还需要重试
+func (p *RetryPolicy) ShouldRetry(attempt int, err error) bool {
+	if p == nil || err == nil {
+		return false
+	}
+	return attempt < p.MaxAttempts && IsRetryable(err)
+}
+
+type nonRetryableError struct {
+	err error
+}
+
+func (e *nonRetryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *nonRetryableError) Unwrap() error {
+	return e.err
+}
+
+// NonRetryable 将 err 标记为不可重试的错误，注册的函数可以使用此方法跳过重试直接失败
+func NonRetryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &nonRetryableError{err: err}
+}
+
+// IsRetryable 判断错误是否可以重试
+// 被 NonRetryable 标记的错误，以及 context 被取消导致的错误不进行重试
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	nonretryable := &nonRetryableError{}
+	if errors.As(err, &nonretryable) {
+		return false
+	}
+	return !errors.Is(err, context.Canceled)
+}
@@ -0,0 +1,141 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := &RetryPolicy{
+		InitialInterval: time.Second,
+		MaxInterval:     5 * time.Second,
+		Multiplier:      2,
+	}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: time.Second},
+		{attempt: 2, want: 2 * time.Second},
+		{attempt: 3, want: 4 * time.Second},
+		{attempt: 4, want: 5 * time.Second},
+		{attempt: 10, want: 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("attempt-%d", tt.attempt), func(t *testing.T) {
+			if got := policy.Backoff(tt.attempt); got != tt.want {
+				t.Errorf("RetryPolicy.Backoff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "normal", err: errors.New("connection refused"), want: true},
+		{name: "non retryable", err: NonRetryable(errors.New("invalid args")), want: false},
+		{name: "wrapped non retryable", err: fmt.Errorf("sync: %w", NonRetryable(errors.New("invalid args"))), want: false},
+		{name: "canceled", err: fmt.Errorf("sync: %w", context.Canceled), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_executeWithRetry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	s := NewServerFromBackend(NewInmemoryBackend(ctx))
+	_ = s.Register("flaky", func(_ context.Context, failures int) error {
+		calls++
+		if calls <= failures {
+			return fmt.Errorf("failure %d", calls)
+		}
+		return nil
+	})
+	_ = s.Register("invalid", func() error {
+		calls++
+		return NonRetryable(errors.New("invalid"))
+	})
+
+	tests := []struct {
+		name         string
+		step         *jsonArgsStep
+		wantErr      bool
+		wantAttempts int
+	}{
+		{
+			name:         "no policy",
+			step:         &jsonArgsStep{Function: "flaky", Args: []json.RawMessage{json.RawMessage("1")}},
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+		{
+			name: "succeed after retry",
+			step: &jsonArgsStep{
+				Function: "flaky", Args: []json.RawMessage{json.RawMessage("2")},
+				Retry: &RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond},
+			},
+			wantAttempts: 3,
+		},
+		{
+			name: "exceed max attempts",
+			step: &jsonArgsStep{
+				Function: "flaky", Args: []json.RawMessage{json.RawMessage("5")},
+				Retry: &RetryPolicy{MaxAttempts: 2, InitialInterval: time.Millisecond},
+			},
+			wantErr:      true,
+			wantAttempts: 2,
+		},
+		{
+			name: "non retryable",
+			step: &jsonArgsStep{
+				Function: "invalid",
+				Retry:    &RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond},
+			},
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = 0
+			task := &jsonArgsTask{Name: "test", Steps: []*jsonArgsStep{tt.step}}
+			if err := s.executeWithRetry(ctx, task, tt.step); (err != nil) != tt.wantErr {
+				t.Errorf("Server.executeWithRetry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := len(tt.step.Status.Attempts); got != tt.wantAttempts {
+				t.Errorf("Server.executeWithRetry() attempts = %v, want %v", got, tt.wantAttempts)
+			}
+		})
+	}
+}
@@ -22,10 +22,14 @@ import (
 	"os"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"kubegems.io/kubegems/pkg/log"
 	"kubegems.io/kubegems/pkg/utils/retry"
@@ -33,6 +37,10 @@ import (
 
 const (
 	DefaultTaskTimeout = 5 * time.Minute
+	// DefaultParallelism 并行 step 中同时执行的分支数量
+	DefaultParallelism = 8
+	// taskQueue 任务分发队列
+	taskQueue = "submit"
 )
 
 type Options struct {
@@ -43,34 +51,84 @@ type Options struct {
 
 type Server struct {
 	backend    Backend
-	registered map[string]interface{}
+	registry   *FunctionRegistry
 	executerid string
+
+	retention   RetentionPolicy
+	metrics     Metrics
+	parallelism int
+
+	runninglock sync.Mutex
+	running     map[string]context.CancelCauseFunc // 本实例上正在运行的任务
+}
+
+type ServerOption func(s *Server)
+
+// WithParallelism 设置并行 step 中同时执行的分支数量
+func WithParallelism(n int) ServerOption {
+	return func(s *Server) { s.parallelism = n }
+}
+
+// WithRetentionPolicy 设置任务在任务存储中的保留时间
+func WithRetentionPolicy(policy RetentionPolicy) ServerOption {
+	return func(s *Server) { s.retention = policy }
 }
 
-func NewServerFromBackend(backend Backend) *Server {
+func NewServerFromBackend(backend Backend, options ...ServerOption) *Server {
 	executerid, _ := os.Hostname()
-	return &Server{
-		backend:    backend,
-		registered: map[string]interface{}{},
-		executerid: executerid,
+	s := &Server{
+		backend:     backend,
+		registry:    NewFunctionRegistry(),
+		executerid:  executerid,
+		running:     map[string]context.CancelCauseFunc{},
+		metrics:     noopMetrics{},
+		parallelism: DefaultParallelism,
+	}
+	for _, opt := range options {
+		opt(s)
 	}
+	return s
 }
 
 func (s *Server) NewClient(ctx context.Context) Client {
-	return NewClientFromBackend(s.backend)
+	return NewClientFromBackend(s.backend, WithFunctionRegistry(s.registry), WithTaskRetention(s.retention))
+}
+
+// Registry 返回已注册的函数，可以用于客户端提交任务时校验参数
+func (s *Server) Registry() *FunctionRegistry {
+	return s.registry
 }
 
 func (s *Server) Run(ctx context.Context) error {
 	log := log.FromContextOrDiscard(ctx)
+	eg, ctx := errgroup.WithContext(ctx)
+	// watch task control
+	eg.Go(func() error {
+		return retry.OnError(retry.NotContextCancelError, func() error {
+			log.Info("starting control watcher...")
+			if err := s.watchControl(ctx); err != nil {
+				log.Error(err, "watch control failed, retry...")
+				return err
+			}
+			return nil
+		})
+	})
+	// sample queue depth
+	eg.Go(func() error {
+		return s.sampleQueueDepth(ctx)
+	})
 	// consume submit queue
-	return retry.OnError(retry.NotContextCancelError, func() error {
-		log.Info("starting work consumer...")
-		if err := s.backend.Sub(ctx, "submit", s.consume, WithConcurrency(5), WithAutoACK(true)); err != nil {
-			log.Error(err, "subscripe failed, retry...")
-			return err
-		}
-		return nil
+	eg.Go(func() error {
+		return retry.OnError(retry.NotContextCancelError, func() error {
+			log.Info("starting work consumer...")
+			if err := s.backend.Sub(ctx, taskQueue, s.consume, WithConcurrency(5)); err != nil {
+				log.Error(err, "subscripe failed, retry...")
+				return err
+			}
+			return nil
+		})
 	})
+	return eg.Wait()
 }
 
 func (s *Server) consume(ctx context.Context, _ string, val []byte) error {
@@ -86,7 +144,15 @@ func (s *Server) consume(ctx context.Context, _ string, val []byte) error {
 	log.Info("consume task")
 	ctx = logr.NewContext(ctx, log)
 
-	finished := s.process(ctx, task)
+	// 取消或者暂停的任务不再继续处理
+	if s.applyControl(ctx, task) {
+		log.Info("task controlled", "status", task.Status.Status)
+		return nil
+	}
+
+	runctx, done := s.withRunning(ctx, task)
+	finished := s.process(runctx, task)
+	done()
 	if !finished {
 		// requeue updated task
 		content, err := json.Marshal(task)
@@ -94,7 +160,11 @@ func (s *Server) consume(ctx context.Context, _ string, val []byte) error {
 			return err
 		}
 		log.Info("requeue task")
-		s.backend.Pub(ctx, "submit", "", content)
+		// 重新入队失败时不确认消息，由其他消费者认领后重新处理
+		if err := s.backend.Pub(ctx, taskQueue, "", content); err != nil {
+			log.Error(err, "requeue task")
+			return err
+		}
 		return nil
 	}
 	log.Info("finished task")
@@ -112,13 +182,19 @@ func (s *Server) process(ctx context.Context, task *jsonArgsTask) bool {
 		task.Status.FinishTimestamp = metav1.Now()
 		task.Status.Status = TaskStatusError
 		task.Status.Message = err.Error()
+		if isCancelled(ctx) {
+			task.Status.Status = TaskStatusCancelled
+			task.Status.Message = ErrTaskCancelled.Error()
+		}
 		_ = s.updateTask(ctx, task)
+		s.taskFinished(ctx, task)
 		return true
 	} else if isAllFinished(task.Steps) {
 		// 如果所有子任务都完成则为 finished
 		task.Status.FinishTimestamp = metav1.Now()
 		task.Status.Status = TaskStatusSuccess
 		_ = s.updateTask(ctx, task)
+		s.taskFinished(ctx, task)
 		return true
 	} else {
 		// 否则未完成，进入队列执行下一个任务
@@ -126,8 +202,18 @@ func (s *Server) process(ctx context.Context, task *jsonArgsTask) bool {
 	}
 }
 
+func (s *Server) taskFinished(ctx context.Context, task *jsonArgsTask) {
+	// 任务结束后不再需要控制指令
+	_ = s.backend.Del(context.WithoutCancel(ctx), controlKeyOf(task.Group, task.Name, task.UID))
+	s.metrics.TaskFinished(task.Group, task.Status.Status)
+	traceTask(ctx, task)
+}
+
 func isAllFinished(steps []*jsonArgsStep) bool {
 	for _, step := range steps {
+		if step.Status.Status == TaskStatusSkipped {
+			continue
+		}
 		if step.Status.Status != TaskStatusSuccess {
 			return false
 		}
@@ -144,38 +230,66 @@ func (s *Server) processone(ctx context.Context, task *jsonArgsTask, steps []*js
 
 	for _, step := range steps {
 		switch step.Status.Status {
-		case "", TaskStatusRunning:
+		case TaskStatusSkipped:
+			continue
+		case "", TaskStatusPending, TaskStatusRunning:
+			if step.When != "" {
+				ok, err := evaluateWhen(step.When, task.values())
+				if err != nil {
+					err = fmt.Errorf("step %s: %w", step.Name, err)
+					_ = s.updateStep(ctx, task, step, func(status *TaskStatus) {
+						status.Status = TaskStatusError
+						status.Message = err.Error()
+						status.FinishTimestamp = metav1.Now()
+					})
+					return err
+				}
+				if !ok {
+					// 条件不满足，跳过该 step 及其 substeps
+					_ = s.updateStep(ctx, task, step, func(status *TaskStatus) {
+						status.Status = TaskStatusSkipped
+						status.FinishTimestamp = metav1.Now()
+					})
+					continue
+				}
+			}
 			// save init state
-			step.Status = TaskStatus{
-				Status:         TaskStatusRunning,
-				StartTimestamp: metav1.Now(),
-				Executer:       s.executerid,
+			// 保留已有的执行记录，中断后重新执行时继续累计重试次数
+			_ = s.updateStep(ctx, task, step, func(status *TaskStatus) {
+				*status = TaskStatus{
+					Status:         TaskStatusRunning,
+					StartTimestamp: metav1.Now(),
+					Executer:       s.executerid,
+					Attempts:       status.Attempts,
+				}
+			})
+			if step.Mode == StepModeParallel {
+				// 并行 step 在自身及所有分支执行完成后才完成
+				err := s.executeWithRetry(ctx, task, step)
+				if err == nil {
+					err = s.processParallel(ctx, task, step)
+				}
+				s.finishStep(ctx, task, step, err)
+				return err
 			}
-
-			_ = s.updateTask(ctx, task)
 			if step.Function != "" {
-				if err := s.execute(ctx, step); err != nil {
-					step.Status.Status = TaskStatusError
-					step.Status.Message = err.Error()
-					// 如果出错则终止执行
-					step.Status.FinishTimestamp = metav1.Now()
-					_ = s.updateTask(ctx, task)
-					return err
-				} else {
-					step.Status.Status = TaskStatusSuccess
-					step.Status.FinishTimestamp = metav1.Now()
-					_ = s.updateTask(ctx, task)
-					// 如果step执行成功，则返回 nil 重新入队
-					// 如果不返回nil则只需执行，直到错误或者完成
-					return nil
-				}
+				err := s.executeWithRetry(ctx, task, step)
+				s.finishStep(ctx, task, step, err)
+				// 如果step执行成功，则返回 nil 重新入队
+				// 如果不返回nil则只需执行，直到错误或者完成
+				// 如果出错则终止执行
+				return err
 			} else {
 				// 没有执行任务，可以继续寻找下一个可执行任务
-				step.Status.FinishTimestamp = metav1.Now()
-				step.Status.Status = TaskStatusSuccess
+				_ = s.updateStep(ctx, task, step, func(status *TaskStatus) {
+					status.FinishTimestamp = metav1.Now()
+					status.Status = TaskStatusSuccess
+				})
 			}
 		case TaskStatusError:
 			return errors.New(step.Status.Message) // 因为失败，所以认为已经完成所有阶段
+		case TaskStatusCancelled:
+			return ErrTaskCancelled
 		}
 		// 执行 substeps
 		if err := s.processone(ctx, task, step.SubSteps); err != nil {
@@ -185,27 +299,159 @@ func (s *Server) processone(ctx context.Context, task *jsonArgsTask, steps []*js
 	return nil
 }
 
+// processParallel 并发执行 step 的所有 substeps，每个 substep 作为一个分支
+// 分支内部依然按照顺序执行，所有分支结束后返回，任一分支失败则返回错误
+func (s *Server) processParallel(ctx context.Context, task *jsonArgsTask, step *jsonArgsStep) error {
+	log := log.FromContextOrDiscard(ctx)
+
+	errs := make([]error, len(step.SubSteps))
+	// 任一分支失败时取消其他分支
+	eg, egctx := errgroup.WithContext(ctx)
+	if s.parallelism > 0 {
+		eg.SetLimit(s.parallelism)
+	}
+	for i, branch := range step.SubSteps {
+		i, branch := i, branch
+		eg.Go(func() error {
+			branchsteps := []*jsonArgsStep{branch}
+			for !isAllFinished(branchsteps) {
+				if err := egctx.Err(); err != nil {
+					errs[i] = err
+					return err
+				}
+				if err := s.processone(egctx, task, branchsteps); err != nil {
+					log.Error(err, "branch failed", "step", step.Name, "branch", branch.Name)
+					errs[i] = err
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	_ = eg.Wait()
+
+	failed := []string{}
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", step.SubSteps[i].Name, err.Error()))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("branches failed: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func (s *Server) finishStep(ctx context.Context, task *jsonArgsTask, step *jsonArgsStep, err error) {
+	_ = s.updateStep(ctx, task, step, func(status *TaskStatus) {
+		if err != nil {
+			status.Status = TaskStatusError
+			status.Message = err.Error()
+			if isCancelled(ctx) {
+				status.Status = TaskStatusCancelled
+			}
+		} else {
+			status.Status = TaskStatusSuccess
+		}
+		status.FinishTimestamp = metav1.Now()
+	})
+}
+
+// executeWithRetry 执行 step，失败时根据 step 的重试策略等待后重试
+// 每次执行都会记录至 step.Status.Attempts
+func (s *Server) executeWithRetry(ctx context.Context, task *jsonArgsTask, step *jsonArgsStep) (err error) {
+	if step.Function == "" {
+		return nil
+	}
+	ctx, span := startStepSpan(ctx, task, step)
+	defer func() { endSpan(span, err) }()
+
+	// 在执行前替换参数中对其他 step 结果的引用
+	args, err := resolveArgs(step.Args, task.values())
+	if err != nil {
+		return NonRetryable(fmt.Errorf("step %s: %w", step.Name, err))
+	}
+	log := log.FromContextOrDiscard(ctx)
+	for {
+		attempt := StepAttempt{
+			Attempt:        len(step.Status.Attempts) + 1,
+			StartTimestamp: metav1.Now(),
+			Executer:       s.executerid,
+		}
+		if step.Retry != nil && step.Retry.MaxAttempts > 0 && attempt.Attempt > step.Retry.MaxAttempts {
+			// 已经用完了重试次数，例如在重试过程中 worker 重启
+			return fmt.Errorf("step %s exceeded max attempts %d", step.Name, step.Retry.MaxAttempts)
+		}
+		// 在副本上执行，避免并行分支间同时读写 task
+		run := &jsonArgsStep{
+			Name:     step.Name,
+			Function: step.Function,
+			Args:     args,
+			Timeout:  step.Timeout,
+		}
+		s.metrics.StepStarted(step.Function)
+		err := s.execute(ctx, run)
+		s.metrics.StepFinished(step.Function, time.Since(attempt.StartTimestamp.Time), err)
+		attempt.FinishTimestamp = metav1.Now()
+		if err != nil {
+			attempt.Message = err.Error()
+		}
+		retry := step.Retry.ShouldRetry(attempt.Attempt, err)
+		var backoff time.Duration
+		if retry {
+			backoff = step.Retry.Backoff(attempt.Attempt)
+		}
+		_ = s.updateStep(ctx, task, step, func(status *TaskStatus) {
+			status.Result = run.Status.Result
+			status.Attempts = append(status.Attempts, attempt)
+			if retry {
+				status.Message = fmt.Sprintf("attempt %d failed: %s, retry after %s", attempt.Attempt, err.Error(), backoff)
+			} else {
+				status.Message = ""
+			}
+		})
+		if !retry {
+			return err
+		}
+		log.Info("step failed, retrying", "step", step.Name, "attempt", attempt.Attempt, "backoff", backoff.String(), "err", err.Error())
+		s.metrics.StepRetried(step.Function)
+		span.AddEvent("retry", trace.WithAttributes(
+			attribute.Int("workflow.step.attempt", attempt.Attempt),
+			attribute.String("workflow.step.error", err.Error()),
+		))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// updateStep 修改 step 的状态并保存 task
+// 并行执行时多个分支会同时修改同一个 task，所以状态的修改都需要经过此方法
+func (n *Server) updateStep(ctx context.Context, task *jsonArgsTask, step *jsonArgsStep, fn func(status *TaskStatus)) error {
+	task.mu.Lock()
+	fn(&step.Status)
+	task.mu.Unlock()
+	return n.updateTask(ctx, task)
+}
+
 func (n *Server) updateTask(ctx context.Context, task *jsonArgsTask) error {
+	// 任务被取消时也需要保存状态
+	ctx = context.WithoutCancel(ctx)
+	task.mu.Lock()
 	content, err := json.Marshal(task)
+	ttl := n.retention.taskTTL(task.Group, &task.Status)
+	task.mu.Unlock()
 	if err != nil {
 		return err
 	}
-	taskjkey := strings.Join([]string{task.Group, task.Name, task.UID}, "/")
-	return n.backend.Put(ctx, taskjkey, content, 5*time.Minute)
+	return n.backend.Put(ctx, taskKeyOf(task.Group, task.Name, task.UID), content, ttl)
 }
 
 func (n *Server) Register(name string, fun interface{}) error {
-	// validate
-	t := reflect.ValueOf(fun).Type()
-	if t.Kind() != reflect.Func {
-		return fmt.Errorf("name [%s] fun [%v] not a function", name, fun)
-	}
-	// register
-	if _, ok := n.registered[name]; ok {
-		return fmt.Errorf("name [%s] fun [%v] already registered", name, fun)
-	}
-	n.registered[name] = fun
-	return nil
+	return n.registry.Register(name, fun)
 }
 
 func (n *Server) execute(ctx context.Context, task *jsonArgsStep) (err error) {
@@ -219,9 +465,9 @@ func (n *Server) execute(ctx context.Context, task *jsonArgsStep) (err error) {
 	log.Info("executing", "step", task.Name, "func", task.Function, "args", task.Args)
 
 	name := task.Function
-	fun, ok := n.registered[name]
+	fun, ok := n.registry.Lookup(name)
 	if !ok {
-		return fmt.Errorf("func %s not registered", name)
+		return NonRetryable(fmt.Errorf("func %s not registered", name))
 	}
 
 	defer func() {
@@ -247,7 +493,7 @@ func (n *Server) execute(ctx context.Context, task *jsonArgsStep) (err error) {
 		argt := funt.In(i)
 
 		// 如果第一个参数是 context.Context 则将当前context作为参数
-		if i == 0 && argt.Implements(reflect.TypeOf((*context.Context)(nil)).Elem()) {
+		if i == 0 && argt.Implements(contextType) {
 			argsv = append(argsv, reflect.ValueOf(ctx))
 			continue
 		}
@@ -257,7 +503,7 @@ func (n *Server) execute(ctx context.Context, task *jsonArgsStep) (err error) {
 		// 参数未完整提供时，其余的使用空值
 		if argsi < len(task.Args) {
 			if err := json.Unmarshal(task.Args[argsi], &arg); err != nil {
-				return err
+				return NonRetryable(err)
 			}
 		}
 		// 如果是最一个参数
@@ -278,7 +524,9 @@ func (n *Server) execute(ctx context.Context, task *jsonArgsStep) (err error) {
 		task.Status.Result = append(task.Status.Result, reflect.Indirect(result).Interface())
 	}
 	// 返回的最后一个参数如果是 error 则作为本次error
-	if e, ok := rvs[len(rvs)-1].Interface().(error); ok {
+	if len(rvs) == 0 {
+		log.Info("executed", "step", task.Name, "func", task.Function)
+	} else if e, ok := rvs[len(rvs)-1].Interface().(error); ok {
 		err = e
 		log.Error(err, "executed", "step", task.Name, "func", task.Function)
 	} else {
@@ -117,8 +117,8 @@ func TestServer_Run(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			s := &Server{
-				backend:    tt.fields.backend,
-				registered: tt.fields.registered,
+				backend:  tt.fields.backend,
+				registry: &FunctionRegistry{funcs: tt.fields.registered},
 			}
 
 			if err := NewClientFromBackend(s.backend).SubmitTask(tt.args.ctx, tt.task); err != nil {
@@ -197,8 +197,8 @@ func TestServer_execute(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			n := &Server{
-				backend:    tt.fields.backend,
-				registered: tt.fields.registered,
+				backend:  tt.fields.backend,
+				registry: &FunctionRegistry{funcs: tt.fields.registered},
 			}
 			if err := n.execute(tt.args.ctx, tt.args.task); (err != nil) != tt.wantErr {
 				t.Errorf("Server.execute() error = %v, wantErr %v", err, tt.wantErr)
@@ -206,3 +206,38 @@ func TestServer_execute(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_task_ttl(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backend := NewInmemoryBackend(ctx)
+	retention := RetentionPolicy{Groups: map[string]time.Duration{"short": time.Millisecond}}
+	cli := NewClientFromBackend(backend, WithTaskRetention(retention))
+
+	ttlOf := func(task Task) (time.Duration, bool) {
+		backend.dblock.RLock()
+		defer backend.dblock.RUnlock()
+		kv, ok := backend.db[taskKeyOf(task.Group, task.Name, task.UID)]
+		if !ok || kv.expireTime.IsZero() {
+			return 0, ok
+		}
+		return kv.expireTime.Sub(kv.createTime), ok
+	}
+	for _, group := range []string{"short", "default"} {
+		// 暂停的任务超过保留时间后仍然保留在任务存储中，直到完成后归档
+		task := Task{Group: group, Name: "ttl", UID: "ttl-uid", Steps: []Step{{Name: "now", Function: "now"}}, Status: &TaskStatus{Status: TaskStatusPaused}}
+		if err := cli.SubmitTask(ctx, task); err != nil {
+			t.Fatal(err)
+		}
+		if ttl, ok := ttlOf(task); !ok || ttl != 0 {
+			t.Errorf("group %s unfinished task ttl = %v, exists %v, want no expiration", group, ttl, ok)
+		}
+		if err := cli.CancelTask(ctx, task.Group, task.Name, task.UID); err != nil {
+			t.Fatal(err)
+		}
+		if ttl, _ := ttlOf(task); ttl != retention.TTLOf(group) {
+			t.Errorf("group %s finished task ttl = %v, want %v", group, ttl, retention.TTLOf(group))
+		}
+	}
+}
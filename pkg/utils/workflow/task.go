@@ -16,6 +16,7 @@ package workflow
 
 import (
 	"encoding/json"
+	"sync"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -44,9 +45,21 @@ type Step struct {
 	Function string        `json:"function,omitempty"` // 任务所使用的 函数/组件/插件
 	Args     []interface{} `json:"args,omitempty"`     // 对应的参数
 	SubSteps []Step        `json:"subSteps,omitempty"` // 子任务
+	Mode     StepMode      `json:"mode,omitempty"`     // 子任务执行方式，默认顺序执行
+	When     string        `json:"when,omitempty"`     // 执行条件，为 go template，渲染结果为 true 时才执行
+	Retry    *RetryPolicy  `json:"retry,omitempty"`    // 失败重试策略
 	Status   *TaskStatus   `json:"status,omitempty"`
 }
 
+type StepMode string
+
+const (
+	// StepModeSequential 顺序执行 substeps
+	StepModeSequential StepMode = "Sequential"
+	// StepModeParallel 并行执行 substeps，所有 substeps 完成后该 step 才完成
+	StepModeParallel StepMode = "Parallel"
+)
+
 type jsonArgsTask struct {
 	UID               string            `json:"uid,omitempty"`
 	Name              string            `json:"name,omitempty"`
@@ -55,6 +68,8 @@ type jsonArgsTask struct {
 	CreationTimestamp metav1.Time       `json:"creationTimestamp,omitempty"`
 	Addtionals        map[string]string `json:"addtionals,omitempty"` // 额外信息
 	Status            TaskStatus        `json:"status,omitempty"`
+
+	mu sync.Mutex // 并行执行时保护 steps 状态
 }
 
 type jsonArgsStep struct {
@@ -62,8 +77,11 @@ type jsonArgsStep struct {
 	Function string            `json:"function,omitempty"`
 	Args     []json.RawMessage `json:"args,omitempty"`
 	SubSteps []*jsonArgsStep   `json:"subSteps,omitempty"`
+	Mode     StepMode          `json:"mode,omitempty"`
+	When     string            `json:"when,omitempty"`
 	Status   TaskStatus        `json:"status,omitempty"`
 	Timeout  time.Duration     `json:"timeout,omitempty"` // 任务执行超时
+	Retry    *RetryPolicy      `json:"retry,omitempty"`
 }
 
 func ArgsOf(args ...interface{}) []interface{} {
@@ -77,8 +95,22 @@ const (
 	TaskStatusRunning TaskStatusCode = "Running"
 	TaskStatusSuccess TaskStatusCode = "Success"
 	TaskStatusError   TaskStatusCode = "Error"
+	TaskStatusSkipped TaskStatusCode = "Skipped" // 条件不满足而跳过
+
+	TaskStatusCancelled TaskStatusCode = "Cancelled" // 被取消
+	TaskStatusPaused    TaskStatusCode = "Paused"    // 被暂停，恢复后继续执行
 )
 
+// Finished 任务或者 step 是否已经结束，结束后不会再有状态变化
+func (c TaskStatusCode) Finished() bool {
+	switch c {
+	case TaskStatusSuccess, TaskStatusError, TaskStatusCancelled, TaskStatusSkipped:
+		return true
+	default:
+		return false
+	}
+}
+
 type TaskStatus struct {
 	StartTimestamp  metav1.Time    `json:"startTimestamp,omitempty"`
 	FinishTimestamp metav1.Time    `json:"finishTimestamp,omitempty"`
@@ -86,4 +118,5 @@ type TaskStatus struct {
 	Result          []interface{}  `json:"result,omitempty"`
 	Executer        string         `json:"executer,omitempty"`
 	Message         string         `json:"message,omitempty"`
+	Attempts        []StepAttempt  `json:"attempts,omitempty"` // 执行记录，包含每一次重试
 }
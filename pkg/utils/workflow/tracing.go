@@ -0,0 +1,107 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workflow
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 任务的执行会跨越多次消费以及多个 worker 实例，无法使用一个持续的 span 覆盖整个任务。
+// 提交任务时将提交者的 span context 写入 task.Addtionals，
+// 每个 step 执行时创建一个子 span，任务结束时补充一个从创建时间到结束时间的 task span，
+// 两者的 parent 均为提交者的 span。
+
+func tracer() trace.Tracer {
+	return otel.GetTracerProvider().Tracer("kubegems.io/kubegems")
+}
+
+// injectTraceContext 将当前的 span context 写入 task.Addtionals，已经存在时不覆盖
+func injectTraceContext(ctx context.Context, task *Task) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return
+	}
+	propagator := otel.GetTextMapPropagator()
+	for _, field := range propagator.Fields() {
+		if _, ok := task.Addtionals[field]; ok {
+			return
+		}
+	}
+	if task.Addtionals == nil {
+		task.Addtionals = map[string]string{}
+	}
+	propagator.Inject(ctx, propagation.MapCarrier(task.Addtionals))
+}
+
+func extractTraceContext(ctx context.Context, task *jsonArgsTask) context.Context {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+	if len(task.Addtionals) == 0 {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(task.Addtionals))
+}
+
+func taskAttributes(task *jsonArgsTask) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("workflow.task.group", task.Group),
+		attribute.String("workflow.task.name", task.Name),
+		attribute.String("workflow.task.uid", task.UID),
+	}
+}
+
+func startStepSpan(ctx context.Context, task *jsonArgsTask, step *jsonArgsStep) (context.Context, trace.Span) {
+	attrs := append(taskAttributes(task),
+		attribute.String("workflow.step.name", step.Name),
+		attribute.String("workflow.step.function", step.Function),
+	)
+	return tracer().Start(extractTraceContext(ctx, task), "step "+step.Function,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceTask 在任务结束时记录 task span
+func traceTask(ctx context.Context, task *jsonArgsTask) {
+	start := task.CreationTimestamp.Time
+	if start.IsZero() {
+		start = task.Status.StartTimestamp.Time
+	}
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(append(taskAttributes(task), attribute.String("workflow.task.status", string(task.Status.Status)))...),
+	}
+	if !start.IsZero() {
+		opts = append(opts, trace.WithTimestamp(start))
+	}
+	_, span := tracer().Start(extractTraceContext(ctx, task), "task "+task.Group, opts...)
+	if task.Status.Status != TaskStatusSuccess {
+		span.SetStatus(codes.Error, task.Status.Message)
+	}
+	span.End(trace.WithTimestamp(task.Status.FinishTimestamp.Time))
+}
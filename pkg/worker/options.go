@@ -19,9 +19,11 @@ import (
 	"kubegems.io/kubegems/pkg/utils/database"
 	"kubegems.io/kubegems/pkg/utils/git"
 	"kubegems.io/kubegems/pkg/utils/helm"
+	"kubegems.io/kubegems/pkg/utils/otel"
 	"kubegems.io/kubegems/pkg/utils/prometheus"
 	"kubegems.io/kubegems/pkg/utils/redis"
 	"kubegems.io/kubegems/pkg/worker/dump"
+	"kubegems.io/kubegems/pkg/worker/task"
 )
 
 type Options struct {
@@ -33,7 +35,9 @@ type Options struct {
 	Git      *git.Options                `json:"git,omitempty"`
 	LogLevel string                      `json:"logLevel,omitempty"`
 	Mysql    *database.Options           `json:"mysql,omitempty"`
+	Otel     *otel.Options               `json:"otel,omitempty"`
 	Redis    *redis.Options              `json:"redis,omitempty"`
+	Task     *task.Options               `json:"task,omitempty"`
 }
 
 func DefaultOptions() *Options {
@@ -46,6 +50,8 @@ func DefaultOptions() *Options {
 		Git:      git.NewDefaultOptions(),
 		LogLevel: "debug",
 		Mysql:    database.NewDefaultOptions(),
+		Otel:     otel.NewDefaultOptions(),
 		Redis:    redis.NewDefaultOptions(),
+		Task:     task.NewDefaultOptions(),
 	}
 }
@@ -0,0 +1,47 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package task
+
+import (
+	"time"
+
+	"kubegems.io/kubegems/pkg/utils/workflow"
+)
+
+const (
+	BackendRedis    = "redis"
+	BackendDatabase = "database"
+	BackendMemory   = "memory"
+)
+
+type Options struct {
+	Backend         string        `json:"backend,omitempty" description:"workflow backend, one of redis, database, memory. use redis if configured, otherwise memory"`
+	Retention       time.Duration `json:"retention,omitempty" description:"how long tasks are kept in task store before archived to database"`
+	GroupRetentions []string      `json:"groupRetentions,omitempty" description:"task retention per group, eg. application=720h"`
+}
+
+func NewDefaultOptions() *Options {
+	return &Options{
+		Retention: workflow.DefaultTaskRetention,
+	}
+}
+
+func (o *Options) RetentionPolicy() (workflow.RetentionPolicy, error) {
+	groups, err := workflow.ParseGroupRetentions(o.GroupRetentions)
+	if err != nil {
+		return workflow.RetentionPolicy{}, err
+	}
+	return workflow.RetentionPolicy{Default: o.Retention, Groups: groups}, nil
+}
@@ -19,19 +19,23 @@ import (
 	"time"
 
 	"kubegems.io/kubegems/pkg/log"
-	"kubegems.io/kubegems/pkg/utils/database"
 	"kubegems.io/kubegems/pkg/utils/workflow"
 )
 
-// 用于转移超过时间的任务记录至database
+// 用于转移超过保留时间的任务记录至database
 type TaskArchiverTasker struct {
-	taskcli workflow.Client
+	taskcli   workflow.Client
+	history   workflow.TaskHistory
+	retention workflow.RetentionPolicy
 }
 
-func NewTaskArchiverTasker(databse *database.Database, cli workflow.Client) *TaskArchiverTasker {
-	return &TaskArchiverTasker{taskcli: cli}
+func NewTaskArchiverTasker(history workflow.TaskHistory, cli workflow.Client, retention workflow.RetentionPolicy) *TaskArchiverTasker {
+	return &TaskArchiverTasker{taskcli: cli, history: history, retention: retention}
 }
 
+// ArchiveOutdated 将已完成的任务保存至历史存储，超过保留时间后从任务存储中删除。
+// 任务完成后即归档，任务存储的 TTL 仅用于兜底，worker 停止运行时不会丢失已完成的任务；
+// 未完成的任务在任务存储中不过期，完成后再归档。
 func (t *TaskArchiverTasker) ArchiveOutdated(ctx context.Context) error {
 	// list all tasks
 	tasks, err := t.taskcli.ListTasks(ctx, "", "")
@@ -39,20 +43,36 @@ func (t *TaskArchiverTasker) ArchiveOutdated(ctx context.Context) error {
 		return err
 	}
 	log := log.FromContextOrDiscard(ctx)
+	finished := []workflow.Task{}
 	for _, task := range tasks {
-		needarchive := time.Since(task.CreationTimestamp.Time) > 5*24*time.Hour // 5 days
-		if needarchive {
-			// todo : 存储历史任务
-			log.Info("expired task", "name", task.Name, "creationtimestamp", task.CreationTimestamp)
-			// 删除该记录
-			if err := t.taskcli.RemoveTask(ctx, task.Group, task.Name, task.UID); err != nil {
-				log.Error(err, "remove expired task")
-			}
+		if task.Status != nil && task.Status.Status.Finished() {
+			finished = append(finished, task)
+		}
+	}
+	// 重复归档时忽略
+	if err := t.history.SaveTaskHistory(ctx, finished...); err != nil {
+		return err
+	}
+	for _, task := range finished {
+		if time.Since(lastActiveTime(task)) < t.retention.RetentionOf(task.Group) {
+			continue
+		}
+		log.Info("remove expired task", "group", task.Group, "name", task.Name, "uid", task.UID, "creationtimestamp", task.CreationTimestamp)
+		if err := t.taskcli.RemoveTask(ctx, task.Group, task.Name, task.UID); err != nil {
+			log.Error(err, "remove expired task")
 		}
 	}
 	return nil
 }
 
+// lastActiveTime 任务完成的时间，未记录完成时间时使用创建时间
+func lastActiveTime(task workflow.Task) time.Time {
+	if task.Status != nil && !task.Status.FinishTimestamp.IsZero() {
+		return task.Status.FinishTimestamp.Time
+	}
+	return task.CreationTimestamp.Time
+}
+
 const TaskFunction_ArchiveTasks = "task-archive"
 
 func (t *TaskArchiverTasker) ProvideFuntions() map[string]interface{} {
@@ -0,0 +1,75 @@
+// Copyright 2022 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package task
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slices"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kubegems.io/kubegems/pkg/utils/workflow"
+)
+
+type fakeTaskClient struct {
+	workflow.Client
+	tasks   []workflow.Task
+	removed []string
+}
+
+func (c *fakeTaskClient) ListTasks(ctx context.Context, group, name string) ([]workflow.Task, error) {
+	return c.tasks, nil
+}
+
+func (c *fakeTaskClient) RemoveTask(ctx context.Context, group, name string, uid string) error {
+	c.removed = append(c.removed, uid)
+	return nil
+}
+
+type fakeTaskHistory struct {
+	workflow.TaskHistory
+	saved []string
+}
+
+func (h *fakeTaskHistory) SaveTaskHistory(ctx context.Context, tasks ...workflow.Task) error {
+	for _, task := range tasks {
+		h.saved = append(h.saved, task.UID)
+	}
+	return nil
+}
+
+func TestTaskArchiverTasker_ArchiveOutdated(t *testing.T) {
+	retention := workflow.RetentionPolicy{Default: time.Hour}
+	expired := metav1.NewTime(time.Now().Add(-2 * time.Hour))
+	recent := metav1.NewTime(time.Now().Add(-time.Minute))
+	cli := &fakeTaskClient{tasks: []workflow.Task{
+		{UID: "paused", CreationTimestamp: expired, Status: &workflow.TaskStatus{Status: workflow.TaskStatusPaused}},
+		{UID: "running", CreationTimestamp: expired, Status: &workflow.TaskStatus{Status: workflow.TaskStatusRunning}},
+		{UID: "finished", CreationTimestamp: expired, Status: &workflow.TaskStatus{Status: workflow.TaskStatusSuccess, FinishTimestamp: recent}},
+		{UID: "expired", CreationTimestamp: expired, Status: &workflow.TaskStatus{Status: workflow.TaskStatusError, FinishTimestamp: expired}},
+	}}
+	history := &fakeTaskHistory{}
+	if err := NewTaskArchiverTasker(history, cli, retention).ArchiveOutdated(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// 未完成的任务超过保留时间后既不归档也不删除
+	if want := []string{"finished", "expired"}; !slices.Equal(history.saved, want) {
+		t.Errorf("saved = %v, want %v", history.saved, want)
+	}
+	if want := []string{"expired"}; !slices.Equal(cli.removed, want) {
+		t.Errorf("removed = %v, want %v", cli.removed, want)
+	}
+}
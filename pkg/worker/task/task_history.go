@@ -0,0 +1,113 @@
+// Copyright 2024 The kubegems.io Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package task
+
+import (
+	"context"
+	"encoding/json"
+
+	"gorm.io/gorm/clause"
+	"kubegems.io/kubegems/pkg/service/models"
+	"kubegems.io/kubegems/pkg/utils/database"
+	"kubegems.io/kubegems/pkg/utils/workflow"
+)
+
+var _ workflow.TaskHistory = &DatabaseTaskHistory{}
+
+// DatabaseTaskHistory 使用数据库存储历史任务
+type DatabaseTaskHistory struct {
+	db *database.Database
+}
+
+func NewDatabaseTaskHistory(db *database.Database) *DatabaseTaskHistory {
+	return &DatabaseTaskHistory{db: db}
+}
+
+func (h *DatabaseTaskHistory) SaveTaskHistory(ctx context.Context, tasks ...workflow.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	records := make([]models.TaskHistory, 0, len(tasks))
+	for _, task := range tasks {
+		content, err := json.Marshal(task)
+		if err != nil {
+			return err
+		}
+		record := models.TaskHistory{
+			UID:               task.UID,
+			Group:             task.Group,
+			Name:              task.Name,
+			CreationTimestamp: task.CreationTimestamp.Time,
+			Content:           content,
+		}
+		if task.Status != nil {
+			record.Status = string(task.Status.Status)
+			if !task.Status.FinishTimestamp.IsZero() {
+				finish := task.Status.FinishTimestamp.Time
+				record.FinishTimestamp = &finish
+			}
+		}
+		records = append(records, record)
+	}
+	// 重复归档时忽略
+	return h.db.DB().WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&records, 100).Error
+}
+
+func (h *DatabaseTaskHistory) ListTaskHistory(ctx context.Context, opts workflow.HistoryListOptions) (*workflow.TaskHistoryList, error) {
+	if opts.Page <= 0 {
+		opts.Page = 1
+	}
+	if opts.Size <= 0 {
+		opts.Size = 10
+	}
+	query := h.db.DB().WithContext(ctx).Model(&models.TaskHistory{})
+	if opts.Group != "" {
+		query = query.Where("task_group = ?", opts.Group)
+	}
+	if opts.Name != "" {
+		query = query.Where("name LIKE ?", opts.Name+"%")
+	}
+	if !opts.Since.IsZero() {
+		query = query.Where("creation_timestamp >= ?", opts.Since)
+	}
+	if !opts.Until.IsZero() {
+		query = query.Where("creation_timestamp < ?", opts.Until)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+	records := []models.TaskHistory{}
+	if err := query.Order("creation_timestamp desc").
+		Offset((opts.Page - 1) * opts.Size).
+		Limit(opts.Size).
+		Find(&records).Error; err != nil {
+		return nil, err
+	}
+	list := &workflow.TaskHistoryList{
+		Total: total,
+		Page:  opts.Page,
+		Size:  opts.Size,
+		Items: make([]workflow.Task, 0, len(records)),
+	}
+	for _, record := range records {
+		task := workflow.Task{}
+		if err := json.Unmarshal(record.Content, &task); err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, task)
+	}
+	return list, nil
+}
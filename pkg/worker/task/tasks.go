@@ -16,11 +16,10 @@ package task
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 
 	"github.com/go-logr/logr"
-	"github.com/go-redsync/redsync/v4"
-	"github.com/go-redsync/redsync/v4/redis/goredis/v8"
 	"golang.org/x/sync/errgroup"
 	"kubegems.io/kubegems/pkg/utils/agents"
 	"kubegems.io/kubegems/pkg/utils/argo"
@@ -57,22 +56,24 @@ func Run(ctx context.Context,
 	argocd *argo.Client,
 	helmOptions *helm.Options,
 	agents *agents.ClientSet,
+	options *Options,
+	metrics workflow.Metrics,
 ) error {
-	log := logr.FromContextOrDiscard(ctx).WithName("worker")
-	var backend workflow.Backend
-	var lock DistributedLock
-	if rediscli != nil {
-		log.Info("use redis backend")
-		backend = workflow.NewRedisBackendFromClient(rediscli.Client)
-		lock = NewRedisLock(rediscli)
-	} else {
-		log.Info("use inmemory backend")
-		backend = workflow.NewInmemoryBackend(ctx)
+	backend, err := newBackend(ctx, options.Backend, rediscli, db)
+	if err != nil {
+		return err
 	}
-	workflowcli := workflow.NewClientFromBackend(backend)
+	retention, err := options.RetentionPolicy()
+	if err != nil {
+		return err
+	}
+	history := NewDatabaseTaskHistory(db)
+	server := workflow.NewServerFromBackend(backend, workflow.WithRetentionPolicy(retention), workflow.WithMetrics(metrics))
+	// 提交任务时使用已注册的函数校验参数
+	workflowcli := workflow.NewClientFromBackend(backend, workflow.WithTaskHistory(history), workflow.WithFunctionRegistry(server.Registry()), workflow.WithTaskRetention(retention))
 	p := &ProcessorContext{
-		server:    workflow.NewServerFromBackend(backend),
-		client:    workflow.NewCronSubmiter(workflowcli),
+		server:    server,
+		client:    workflow.NewCronSubmiter(workflowcli, backend),
 		crontasks: []CronTask{},
 	}
 
@@ -83,7 +84,7 @@ func Run(ctx context.Context,
 		// application 应用部署相关
 		MustNewApplicationTasker(db, gitp, argocd, workflowcli, agents),
 		// task-archive 持久化过期任务至database
-		NewTaskArchiverTasker(db, workflowcli),
+		NewTaskArchiverTasker(history, workflowcli, retention),
 		// chart-sync 同步helmchart
 		&HelmSyncTasker{DB: db, ChartRepoUrl: helmOptions.Addr},
 		// cluster
@@ -94,7 +95,33 @@ func Run(ctx context.Context,
 	if err := p.RegisterTasker(taskers...); err != nil {
 		return err
 	}
-	return p.Run(ctx, listen, lock)
+	return p.Run(ctx, listen)
+}
+
+func newBackend(ctx context.Context, kind string, rediscli *redis.Client, db *database.Database) (workflow.Backend, error) {
+	log := logr.FromContextOrDiscard(ctx).WithName("worker")
+	if kind == "" {
+		kind = BackendMemory
+		if rediscli != nil {
+			kind = BackendRedis
+		}
+	}
+	switch kind {
+	case BackendRedis:
+		if rediscli == nil {
+			return nil, fmt.Errorf("redis backend requires redis configured")
+		}
+		log.Info("use redis backend")
+		return workflow.NewRedisBackendFromClient(rediscli.Client), nil
+	case BackendDatabase:
+		log.Info("use database backend")
+		return workflow.NewDatabaseBackend(ctx, db.DB())
+	case BackendMemory:
+		log.Info("use inmemory backend")
+		return workflow.NewInmemoryBackend(ctx), nil
+	default:
+		return nil, fmt.Errorf("unknown workflow backend %s", kind)
+	}
 }
 
 type ProcessorContext struct {
@@ -121,7 +148,7 @@ func (p *ProcessorContext) RegisterTasker(taskers ...Tasker) error {
 	return nil
 }
 
-func (p *ProcessorContext) Run(ctx context.Context, listen string, lock DistributedLock) error {
+func (p *ProcessorContext) Run(ctx context.Context, listen string) error {
 	eg, ctx := errgroup.WithContext(ctx)
 	// 启动 worker 消费
 	eg.Go(func() error {
@@ -129,7 +156,7 @@ func (p *ProcessorContext) Run(ctx context.Context, listen string, lock Distribu
 	})
 	// 启动定时任务
 	eg.Go(func() error {
-		return p.RunCronTasksWithLock(ctx, lock)
+		return p.RunCronTasks(ctx)
 	})
 	// 启动http服务
 	eg.Go(func() error {
@@ -138,50 +165,16 @@ func (p *ProcessorContext) Run(ctx context.Context, listen string, lock Distribu
 	return eg.Wait()
 }
 
-type DistributedLock interface {
-	LockContext(ctx context.Context) error
-	Unlock(ctx context.Context) (bool, error)
-}
-
-type RedisLock struct {
-	mu *redsync.Mutex
-}
-
-func NewRedisLock(rediscli *redis.Client) *RedisLock {
-	rs := redsync.New(goredis.NewPool(rediscli.Client))
-	return &RedisLock{mu: rs.NewMutex("crontask-client-lock")}
-}
-
-func (r *RedisLock) LockContext(ctx context.Context) error {
-	return r.mu.LockContext(ctx)
-}
-
-func (r *RedisLock) Unlock(ctx context.Context) (bool, error) {
-	return r.mu.Unlock()
-}
-
-// 由于worker是多副本的，且crontask 只能在 worker上运行cron。
-// 为了避免多个worker都执行，使用redis 锁选择一个worker来触发这些crontask
-func (p *ProcessorContext) RunCronTasksWithLock(ctx context.Context, lock DistributedLock) error {
+// 由于worker是多副本的，每个worker都会注册定时任务至 backend，
+// 由选举出的 leader 负责触发，避免多个worker重复执行
+func (p *ProcessorContext) RunCronTasks(ctx context.Context) error {
 	log := logr.FromContextOrDiscard(ctx)
-	if lock != nil {
-		log.Info("try to lock crontask")
-		if err := lock.LockContext(ctx); err != nil {
-			return err
-		}
-		defer lock.Unlock(ctx)
-	} else {
-		log.Info("lock not found, skip crontask lock")
-	}
-
 	for _, crontask := range p.crontasks {
 		if err := p.client.SubmitCronTask(ctx, crontask.Task, crontask.CronExp); err != nil {
 			log.Error(err, "submit crontask failed", "exp", crontask.CronExp)
 		}
 	}
-
-	<-ctx.Done()
-	return nil
+	return p.client.Run(ctx)
 }
 
 func (p *ProcessorContext) RunHTTP(ctx context.Context, addr string) error {
@@ -26,6 +26,7 @@ import (
 	"kubegems.io/kubegems/pkg/utils/database"
 	"kubegems.io/kubegems/pkg/utils/git"
 	_ "kubegems.io/kubegems/pkg/utils/kube"
+	"kubegems.io/kubegems/pkg/utils/otel"
 	"kubegems.io/kubegems/pkg/utils/pprof"
 	"kubegems.io/kubegems/pkg/utils/prometheus/exporter"
 	"kubegems.io/kubegems/pkg/utils/redis"
@@ -110,7 +111,13 @@ func Run(ctx context.Context, options *Options) error {
 		}
 	})
 
-	exporterHandler := exporter.NewHandler("gems_worker", map[string]exporter.Collectorfunc{})
+	if err := otel.Init(ctx, options.Otel); err != nil {
+		return err
+	}
+
+	exporterHandler := exporter.NewHandler("gems_worker", map[string]exporter.Collectorfunc{
+		"workflow": exporter.NewWorkflowCollector(),
+	})
 
 	eg, ctx := errgroup.WithContext(ctx)
 	eg.Go(func() error {
@@ -120,7 +127,7 @@ func Run(ctx context.Context, options *Options) error {
 		return exporterHandler.Run(ctx, options.Exporter)
 	})
 	eg.Go(func() error {
-		return task.Run(ctx, options.Listen, deps.Redis, deps.Databse, deps.Git, deps.Argocli, options.AppStore, deps.Agentscli)
+		return task.Run(ctx, options.Listen, deps.Redis, deps.Databse, deps.Git, deps.Argocli, options.AppStore, deps.Agentscli, options.Task, exporter.GetWorkflowCollector())
 	})
 	return eg.Wait()
 }